@@ -0,0 +1,146 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Auth the credentials sent to an endpoint, kept out of its headers.
+type Auth struct {
+	BearerToken     string  `json:"bearerToken,omitempty"`
+	BearerTokenFile string  `json:"bearerTokenFile,omitempty"`
+	Username        string  `json:"username,omitempty"`
+	Password        string  `json:"password,omitempty"`
+	PasswordFile    string  `json:"passwordFile,omitempty"`
+	OAuth2          *OAuth2 `json:"oauth2,omitempty"`
+	HMAC            *HMAC   `json:"hmac,omitempty"`
+	SigV4           *SigV4  `json:"sigv4,omitempty"`
+}
+
+// SigV4 the AWS credentials signing endpoint requests, for endpoints behind API
+// Gateway or Lambda function URLs with IAM authorization. Credentials default to
+// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables, the region to AWS_REGION and the service to execute-api.
+type SigV4 struct {
+	Region          string `json:"region,omitempty"`
+	Service         string `json:"service,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+func (a *Auth) validate() error {
+	if a == nil {
+		return nil
+	}
+	if a.HMAC != nil {
+		if err := a.HMAC.validate(); err != nil {
+			return err
+		}
+	}
+	if a.BearerToken != "" && a.BearerTokenFile != "" {
+		return fmt.Errorf("auth bearerToken and bearerTokenFile are mutually exclusive")
+	}
+	if a.Password != "" && a.PasswordFile != "" {
+		return fmt.Errorf("auth password and passwordFile are mutually exclusive")
+	}
+	basic := a.Username != "" || a.Password != "" || a.PasswordFile != ""
+	if basic && (a.BearerToken != "" || a.BearerTokenFile != "") {
+		return fmt.Errorf("auth bearer token and basic credentials are mutually exclusive")
+	}
+	if basic && a.Username == "" {
+		return fmt.Errorf("auth password requires a username")
+	}
+	credentials := basic || a.BearerToken != "" || a.BearerTokenFile != ""
+	if a.SigV4 != nil && (credentials || a.OAuth2 != nil) {
+		return fmt.Errorf("auth sigv4 excludes the other credentials")
+	}
+	if a.OAuth2 != nil {
+		if credentials {
+			return fmt.Errorf("auth oauth2 excludes the other credentials")
+		}
+		return a.OAuth2.validate()
+	}
+	return nil
+}
+
+// authorize sets the Authorization header of req, then signs it, SigV4 signing
+// every header set before. Credentials have their ${VAR} references expanded,
+// and files are read on every request so that rotated secrets are picked up.
+// OAuth2 tokens are requested with client.
+func (a *Auth) authorize(req *http.Request, client *http.Client, vault *vaultClient) error {
+	if a == nil {
+		return nil
+	}
+	if err := a.setCredentials(req, client, vault); err != nil {
+		return err
+	}
+	now := time.Now()
+	if a.HMAC != nil {
+		if err := a.HMAC.sign(req, now, vault); err != nil {
+			return err
+		}
+	}
+	if s := a.SigV4; s != nil {
+		// the environment is read on every request, picking up renewed
+		// session tokens
+		service := s.Service
+		if service == "" {
+			service = "execute-api"
+		}
+		signer := newSigV4(awsRegion(s.Region), service, expandVars(s.AccessKeyID), expandVars(s.SecretAccessKey), expandVars(s.SessionToken))
+		if signer == nil {
+			return fmt.Errorf("sigv4: no AWS credentials")
+		}
+		return signer.sign(req, now)
+	}
+	return nil
+}
+
+func (a *Auth) setCredentials(req *http.Request, client *http.Client, vault *vaultClient) error {
+	if a.OAuth2 != nil {
+		token, err := a.OAuth2.accessToken(req.Context(), client, vault)
+		if err != nil {
+			return fmt.Errorf("oauth2: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if a.Username != "" {
+		password, err := secretValue(req.Context(), vault, a.Password, a.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("password: %w", err)
+		}
+		req.SetBasicAuth(expandVars(a.Username), password)
+		return nil
+	}
+	token, err := secretValue(req.Context(), vault, a.BearerToken, a.BearerTokenFile)
+	if err != nil {
+		return fmt.Errorf("bearer token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// secretValue returns the content of file, trimmed, when set, the Vault secret
+// of vault:<path>#<field> values, and value with its ${VAR} references
+// expanded otherwise.
+func secretValue(ctx context.Context, vault *vaultClient, value, file string) (string, error) {
+	if file == "" {
+		if isVaultRef(value) {
+			return vault.resolve(ctx, value)
+		}
+		return expandVars(value), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
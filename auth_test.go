@@ -0,0 +1,138 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthBearerToken(t *testing.T) {
+	t.Setenv("CONFIG_TOKEN", "from-env")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		auth     *Auth
+		expected string
+	}{
+		{desc: "no auth", expected: ""},
+		{desc: "literal", auth: &Auth{BearerToken: "secret"}, expected: "Bearer secret"},
+		{desc: "environment variable", auth: &Auth{BearerToken: "${CONFIG_TOKEN}"}, expected: "Bearer from-env"},
+		{desc: "file", auth: &Auth{BearerTokenFile: tokenFile}, expected: "Bearer from-file"},
+		// base64 of user:from-env and admin:from-file
+		{desc: "basic", auth: &Auth{Username: "user", Password: "${CONFIG_TOKEN}"}, expected: "Basic dXNlcjpmcm9tLWVudg=="},
+		{desc: "basic password file", auth: &Auth{Username: "admin", PasswordFile: tokenFile}, expected: "Basic YWRtaW46ZnJvbS1maWxl"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var authorization string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			e := endpoint{url: srv.URL, client: srv.Client(), auth: test.auth, headers: map[string]string{"Authorization": "Bearer header"}}
+			if test.auth == nil {
+				e.headers = nil
+			}
+			if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			if authorization != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, authorization)
+			}
+		})
+	}
+}
+
+func TestAuthTokenFileRotated(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	a := &Auth{BearerTokenFile: tokenFile}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := a.authorize(req, nil, nil); err == nil {
+		t.Error("expected an error for a missing token file")
+	}
+	for _, token := range []string{"first", "second"} {
+		if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.authorize(req, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if actual := req.Header.Get("Authorization"); actual != "Bearer "+token {
+			t.Errorf("expected the %s token, got %q", token, actual)
+		}
+	}
+}
+
+func TestAuthValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		auth    *Auth
+		wantErr bool
+	}{
+		{desc: "bearer token file", auth: &Auth{BearerTokenFile: "/b"}},
+		{desc: "basic", auth: &Auth{Username: "user", PasswordFile: "/p"}},
+		{desc: "bearer token and file", auth: &Auth{BearerToken: "a", BearerTokenFile: "/b"}, wantErr: true},
+		{desc: "password and file", auth: &Auth{Username: "user", Password: "a", PasswordFile: "/p"}, wantErr: true},
+		{desc: "bearer and basic", auth: &Auth{BearerToken: "a", Username: "user"}, wantErr: true},
+		{desc: "password without username", auth: &Auth{Password: "a"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := test.auth.validate()
+			if test.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestAuthSigV4(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	a := &Auth{SigV4: &SigV4{}, HMAC: &HMAC{Secret: "shared"}}
+	req := httptest.NewRequest(http.MethodGet, "https://abc.execute-api.eu-west-1.amazonaws.com/prod/config", nil)
+	if err := a.authorize(req, nil, nil); err == nil {
+		t.Error("expected an error without credentials")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	if err := a.authorize(req, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(authorization, "/eu-west-1/execute-api/aws4_request") {
+		t.Errorf("unexpected authorization %s", authorization)
+	}
+	// headers set before signing are signed
+	if !strings.Contains(authorization, "x-signature;x-signature-timestamp") || req.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("expected the hmac and session token headers to be signed, got %s", authorization)
+	}
+
+	a = &Auth{SigV4: &SigV4{Region: "us-west-2", Service: "lambda", AccessKeyID: "AKID2", SecretAccessKey: "secret"}}
+	if err := a.authorize(req, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if authorization := req.Header.Get("Authorization"); !strings.Contains(authorization, "Credential=AKID2/") || !strings.Contains(authorization, "/us-west-2/lambda/") {
+		t.Errorf("unexpected authorization %s", authorization)
+	}
+	if err := (&Auth{BearerToken: "a", SigV4: &SigV4{}}).validate(); err == nil {
+		t.Error("expected sigv4 and bearer tokens to conflict")
+	}
+}
@@ -0,0 +1,105 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// CircuitBreaker stops polling an endpoint after Failures consecutive failed
+// fetches, probing it again every OpenDuration until it responds.
+type CircuitBreaker struct {
+	Failures     int    `json:"failures,omitempty"`
+	OpenDuration string `json:"openDuration,omitempty"`
+}
+
+// States of a circuit after a failed fetch.
+const (
+	circuitClosed   = "closed"
+	circuitOpened   = "opened"
+	circuitReopened = "reopened"
+)
+
+type circuitBreaker struct {
+	failures int
+	open     time.Duration
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	// the next probe of an open circuit
+	probe time.Time
+}
+
+func newCircuitBreaker(config *CircuitBreaker) (*circuitBreaker, error) {
+	if config == nil {
+		return nil, nil
+	}
+	b := &circuitBreaker{failures: config.Failures, open: time.Minute, circuits: map[string]*circuit{}}
+	if b.failures == 0 {
+		b.failures = 5
+	}
+	if b.failures < 0 {
+		return nil, fmt.Errorf("failures must be greater than 0")
+	}
+	if config.OpenDuration != "" {
+		var err error
+		if b.open, err = time.ParseDuration(config.OpenDuration); err != nil {
+			return nil, fmt.Errorf("openDuration: %w", err)
+		}
+		if b.open <= 0 {
+			return nil, fmt.Errorf("openDuration must be greater than 0")
+		}
+	}
+	return b, nil
+}
+
+// allow reports whether node may be fetched: its circuit is closed or due to
+// be probed.
+func (b *circuitBreaker) allow(node string, now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	c := b.circuits[node]
+	return c == nil || c.failures < b.failures || !now.Before(c.probe)
+}
+
+// success closes the circuit of node, reporting whether it was open.
+func (b *circuitBreaker) success(node string) bool {
+	if b == nil {
+		return false
+	}
+	c := b.circuits[node]
+	delete(b.circuits, node)
+	return c != nil && c.failures >= b.failures
+}
+
+// failure counts a failed fetch of node, returning the state of its circuit.
+func (b *circuitBreaker) failure(node string, now time.Time) string {
+	if b == nil {
+		return circuitClosed
+	}
+	c := b.circuits[node]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[node] = c
+	}
+	c.failures++
+	switch {
+	case c.failures < b.failures:
+		return circuitClosed
+	case c.failures == b.failures:
+		c.probe = now.Add(b.open)
+		return circuitOpened
+	default:
+		c.probe = now.Add(b.open)
+		return circuitReopened
+	}
+}
+
+// forget drops the circuit of a stopped node.
+func (b *circuitBreaker) forget(node string) {
+	if b != nil {
+		delete(b.circuits, node)
+	}
+}
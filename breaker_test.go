@@ -0,0 +1,73 @@
+package multi_http_provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b, err := newCircuitBreaker(&CircuitBreaker{Failures: 2, OpenDuration: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if state := b.failure("node", now); state != circuitClosed || !b.allow("node", now) {
+		t.Errorf("expected the circuit to stay closed after a failure, got %s", state)
+	}
+	if state := b.failure("node", now); state != circuitOpened || b.allow("node", now.Add(30*time.Second)) {
+		t.Errorf("expected the circuit to open, got %s", state)
+	}
+	probe := now.Add(time.Minute)
+	if !b.allow("node", probe) {
+		t.Error("expected a probe once open for the open duration")
+	}
+	if state := b.failure("node", probe); state != circuitReopened || b.allow("node", probe.Add(time.Second)) {
+		t.Errorf("expected the failed probe to reopen the circuit, got %s", state)
+	}
+	if !b.success("node") || !b.allow("node", probe) {
+		t.Error("expected a success to close the open circuit")
+	}
+	if b.success("node") {
+		t.Error("expected the circuit to be closed already")
+	}
+
+	var none *circuitBreaker
+	if !none.allow("node", now) || none.failure("node", now) != circuitClosed || none.success("node") {
+		t.Error("expected no breaker to allow every fetch")
+	}
+	if _, err := newCircuitBreaker(&CircuitBreaker{OpenDuration: "later"}); err == nil {
+		t.Error("expected an invalid duration error")
+	}
+}
+
+func TestProvideCircuitBreaker(t *testing.T) {
+	var down int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&down, 1)
+		// closed connections fail the fetch
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.Close()
+	}))
+	defer failing.Close()
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("stable", "web")))
+	}))
+	defer stable.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "10ms"
+	config.EntryPoints = []string{"web"}
+	config.CircuitBreaker = &CircuitBreaker{Failures: 2, OpenDuration: "1h"}
+	config.Endpoints = map[string]Endpoint{"failing": {Endpoint: failing.URL}, "stable": {Endpoint: stable.URL}}
+	cfgChan := startProviderConfig(t, config)
+
+	receiveConfig(t, cfgChan)
+	// polled for a while, the configuration being unchanged
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&down); n != 2 {
+		t.Errorf("expected the failing endpoint to be fetched twice, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+package multi_http_provider
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic/tls"
+)
+
+// certificateKey identifies a certificate by the serial number of its first
+// PEM block, the certFile being inline content or a file path. Certificates
+// that cannot be read are identified by their certFile.
+func certificateKey(cert *tls.CertAndStores) string {
+	data := []byte(cert.CertFile)
+	if !strings.Contains(cert.CertFile, "-----BEGIN") {
+		content, err := os.ReadFile(cert.CertFile)
+		if err != nil {
+			return "file:" + cert.CertFile
+		}
+		data = content
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "file:" + cert.CertFile
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "file:" + cert.CertFile
+	}
+	return "serial:" + parsed.SerialNumber.Text(16)
+}
+
+// mergeCertificates appends the certificates of src not in dst, by
+// certificateKey, the stores of a certificate shipped by several nodes being
+// combined. The certificates of src are not modified.
+func mergeCertificates(dst, src []*tls.CertAndStores, keys map[string]*tls.CertAndStores) []*tls.CertAndStores {
+	for _, cert := range src {
+		if cert == nil {
+			continue
+		}
+		key := certificateKey(cert)
+		existing, ok := keys[key]
+		if !ok {
+			c := *cert
+			c.Stores = append([]string(nil), cert.Stores...)
+			keys[key] = &c
+			dst = append(dst, &c)
+			continue
+		}
+		for _, store := range cert.Stores {
+			if !containsString(existing.Stores, store) {
+				existing.Stores = append(existing.Stores, store)
+			}
+		}
+	}
+	return dst
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package multi_http_provider
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/tls"
+)
+
+func TestCertificateKey(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), "edge")
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inline := certificateKey(&tls.CertAndStores{Certificate: tls.Certificate{CertFile: string(content)}})
+	if !strings.HasPrefix(inline, "serial:") {
+		t.Fatalf("expected the serial of the inline certificate, got %s", inline)
+	}
+	if key := certificateKey(&tls.CertAndStores{Certificate: tls.Certificate{CertFile: certFile, KeyFile: keyFile}}); key != inline {
+		t.Errorf("expected the certificate file to have the same key, got %s and %s", key, inline)
+	}
+	if key := certificateKey(&tls.CertAndStores{Certificate: tls.Certificate{CertFile: "/missing.crt"}}); key != "file:/missing.crt" {
+		t.Errorf("expected unreadable certificates to be identified by file, got %s", key)
+	}
+}
+
+func TestMergeTLS(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), "edge")
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, otherKey := writeKeyPair(t, t.TempDir(), "other")
+
+	configs := map[string]*dynamic.Configuration{
+		"node1": {TLS: &dynamic.TLSConfiguration{
+			Certificates: []*tls.CertAndStores{{Certificate: tls.Certificate{CertFile: string(content), KeyFile: "key"}, Stores: []string{"default"}}},
+			Options:      map[string]tls.Options{"modern": {MinVersion: "VersionTLS13"}},
+			Stores:       map[string]tls.Store{"default": {DefaultGeneratedCert: &tls.GeneratedCert{Resolver: "le"}}},
+		}},
+		"node2": {TLS: &dynamic.TLSConfiguration{
+			Certificates: []*tls.CertAndStores{
+				{Certificate: tls.Certificate{CertFile: certFile, KeyFile: keyFile}, Stores: []string{"default", "internal"}},
+				{Certificate: tls.Certificate{CertFile: otherCert, KeyFile: otherKey}},
+			},
+			Options: map[string]tls.Options{"modern": {MinVersion: "VersionTLS12"}, "legacy": {MinVersion: "VersionTLS10"}},
+		}},
+	}
+
+	config, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := config.TLS.Certificates
+	if len(certs) != 2 {
+		t.Fatalf("expected the certificates deduplicated by serial, got %d", len(certs))
+	}
+	if !reflect.DeepEqual(certs[0].Stores, []string{"default", "internal"}) {
+		t.Errorf("expected the stores of both nodes, got %v", certs[0].Stores)
+	}
+	if stores := configs["node1"].TLS.Certificates[0].Stores; len(stores) != 1 {
+		t.Errorf("expected the node certificate to be unchanged, got %v", stores)
+	}
+	if config.TLS.Options["modern"].MinVersion != "VersionTLS13" || config.TLS.Options["legacy"].MinVersion != "VersionTLS10" {
+		t.Errorf("unexpected options %v", config.TLS.Options)
+	}
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "tls option modern") {
+		t.Errorf("expected the options conflict, got %v", conflicts)
+	}
+	if _, ok := config.TLS.Stores["default"]; !ok {
+		t.Errorf("expected the default store, got %v", config.TLS.Stores)
+	}
+}
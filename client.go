@@ -0,0 +1,261 @@
+package multi_http_provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientTLS the TLS configuration used when dialing endpoints.
+type ClientTLS struct {
+	CAFiles            []string `json:"caFiles,omitempty"`
+	InsecureSkipVerify bool     `json:"insecureSkipVerify,omitempty"`
+}
+
+// rootCAs builds the root CA pool shared by all endpoints: the system roots
+// extended with the configured CA files.
+func (c *ClientTLS) rootCAs() (*x509.CertPool, error) {
+	if c == nil || len(c.CAFiles) == 0 {
+		return nil, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range c.CAFiles {
+		if err := appendCertFile(pool, file); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+// HTTPClient tunes the connections of the endpoint clients, kept alive and
+// reused across polls. The durations default to those of Go. The
+// ResponseHeaderTimeout only applies to the polled endpoints, the push modes
+// holding their requests open until a configuration changes.
+type HTTPClient struct {
+	MaxIdleConns          int    `json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost   int    `json:"maxIdleConnsPerHost,omitempty"`
+	IdleConnTimeout       string `json:"idleConnTimeout,omitempty"`
+	DialTimeout           string `json:"dialTimeout,omitempty"`
+	KeepAlive             string `json:"keepAlive,omitempty"`
+	TLSHandshakeTimeout   string `json:"tlsHandshakeTimeout,omitempty"`
+	ResponseHeaderTimeout string `json:"responseHeaderTimeout,omitempty"`
+}
+
+// apply configures transport, returning the dialer of its connections.
+func (c *HTTPClient) apply(transport *http.Transport) (*net.Dialer, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c == nil {
+		return dialer, nil
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("maxIdleConns and maxIdleConnsPerHost must not be negative")
+	}
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{name: "idleConnTimeout", value: c.IdleConnTimeout, dst: &transport.IdleConnTimeout},
+		{name: "dialTimeout", value: c.DialTimeout, dst: &dialer.Timeout},
+		{name: "keepAlive", value: c.KeepAlive, dst: &dialer.KeepAlive},
+		{name: "tlsHandshakeTimeout", value: c.TLSHandshakeTimeout, dst: &transport.TLSHandshakeTimeout},
+		{name: "responseHeaderTimeout", value: c.ResponseHeaderTimeout, dst: &transport.ResponseHeaderTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.name, err)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("%s must not be negative", d.name)
+		}
+		*d.dst = v
+	}
+	return dialer, nil
+}
+
+// newClient builds the HTTP client used to poll an endpoint. Without any
+// proxy configured the proxy environment variables are honored.
+func newClient(e Endpoint, defaults *ClientTLS, roots *x509.CertPool, proxy *Proxy, options *HTTPClient) (*http.Client, error) {
+	tlsConfig, err := endpointTLSConfig(e, defaults, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	dialer, err := options.apply(transport)
+	if err != nil {
+		return nil, err
+	}
+	if endpointMode(e) != modePoll {
+		transport.ResponseHeaderTimeout = 0
+	}
+	transport.DialContext = dialer.DialContext
+	if socket := unixSocket(e.Endpoint); socket != "" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		return &http.Client{Transport: transport}, nil
+	}
+	if isGRPCURL(e.Endpoint) {
+		// gRPC requires HTTP/2, negotiated with TLS for grpcs:// endpoints and
+		// spoken directly (h2c) for grpc:// ones.
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if e.Proxy != nil {
+		proxy = e.Proxy
+	}
+	if proxy != nil {
+		transport.Proxy, err = proxy.proxyFunc()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// transportCache shares the transports, and their idle connections, of the
+// clients with the same TLS, proxy and dialing settings.
+type transportCache struct {
+	mu         sync.Mutex
+	transports map[string]http.RoundTripper
+}
+
+// newClient returns a client of the endpoint, sharing the transport of the
+// endpoints built with the same settings.
+func (p *Provider) newClient(e Endpoint, proxy *Proxy) (*http.Client, error) {
+	if e.Proxy != nil {
+		proxy = e.Proxy
+	}
+	settings, err := json.Marshal(struct {
+		ClientCert, ClientKey, CAFile, Socket string
+		GRPC, Poll                            bool
+		Proxy                                 *Proxy
+	}{e.ClientCert, e.ClientKey, e.CAFile, unixSocket(e.Endpoint), isGRPCURL(e.Endpoint), endpointMode(e) == modePoll, proxy})
+	if err != nil {
+		return nil, err
+	}
+	key := string(settings)
+
+	p.transports.mu.Lock()
+	defer p.transports.mu.Unlock()
+	if transport, ok := p.transports.transports[key]; ok {
+		return &http.Client{Transport: transport}, nil
+	}
+	client, err := newClient(e, p.tls, p.roots, proxy, p.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	if p.transports.transports == nil {
+		p.transports.transports = map[string]http.RoundTripper{}
+	}
+	p.transports.transports[key] = client.Transport
+	return client, nil
+}
+
+func endpointTLSConfig(e Endpoint, defaults *ClientTLS, roots *x509.CertPool) (*tls.Config, error) {
+	if (e.ClientCert == "") != (e.ClientKey == "") {
+		return nil, fmt.Errorf("clientCert and clientKey must be set together")
+	}
+
+	config := &tls.Config{RootCAs: roots}
+	if defaults != nil {
+		config.InsecureSkipVerify = defaults.InsecureSkipVerify
+	}
+	if e.ClientCert != "" {
+		cert := &clientCertificate{certFile: e.ClientCert, keyFile: e.ClientKey}
+		if _, err := cert.get(nil); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = cert.get
+	}
+	if e.CAFile != "" {
+		pool := x509.NewCertPool()
+		if err := appendCertFile(pool, e.CAFile); err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func appendCertFile(pool *x509.CertPool, file string) error {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in CA file %s", file)
+	}
+	return nil
+}
+
+// clientCertificate loads the client key pair on handshakes, reloading it when
+// the files change so rotated certificates are used without a restart.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err == nil && c.cert != nil && modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			logger.Warn("Error reloading the client certificate, keeping the previous one", "certFile", c.certFile, "error", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return c.cert, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,312 @@
+package multi_http_provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeKeyPair(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, c *clientCertificate) string {
+	t.Helper()
+
+	cert, err := c.get(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestClientCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "first")
+	c := &clientCertificate{certFile: certFile, keyFile: keyFile}
+
+	if name := commonName(t, c); name != "first" {
+		t.Fatalf("expected certificate first, got %s", name)
+	}
+
+	writeKeyPair(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if name := commonName(t, c); name != "second" {
+		t.Fatalf("expected rotated certificate second, got %s", name)
+	}
+
+	// a broken rotation keeps the previous certificate
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, c); name != "second" {
+		t.Fatalf("expected previous certificate second, got %s", name)
+	}
+}
+
+func TestEndpointTLSConfig(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), "client")
+
+	tests := []struct {
+		desc     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{desc: "no tls settings", endpoint: Endpoint{}},
+		{desc: "client key pair", endpoint: Endpoint{ClientCert: certFile, ClientKey: keyFile}},
+		{desc: "ca file", endpoint: Endpoint{CAFile: certFile}},
+		{desc: "cert without key", endpoint: Endpoint{ClientCert: certFile}, wantErr: true},
+		{desc: "key without cert", endpoint: Endpoint{ClientKey: keyFile}, wantErr: true},
+		{desc: "missing key pair", endpoint: Endpoint{ClientCert: "missing.crt", ClientKey: "missing.key"}, wantErr: true},
+		{desc: "ca file without certificates", endpoint: Endpoint{CAFile: keyFile}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config, err := endpointTLSConfig(test.endpoint, &ClientTLS{InsecureSkipVerify: true}, nil)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !config.InsecureSkipVerify {
+				t.Error("expected insecureSkipVerify to be inherited")
+			}
+			if (config.GetClientCertificate != nil) != (test.endpoint.ClientCert != "") {
+				t.Error("unexpected client certificate callback")
+			}
+			if (config.RootCAs != nil) != (test.endpoint.CAFile != "") {
+				t.Error("unexpected root CAs")
+			}
+		})
+	}
+}
+
+func TestFetchConfigSendsHeaders(t *testing.T) {
+	t.Setenv("CONFIG_TOKEN", "value")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Custom-Header")))
+	}))
+	defer srv.Close()
+
+	p := &Provider{}
+	body, _, err := p.fetchConfig(context.Background(), endpoint{
+		url:     srv.URL,
+		headers: map[string]string{"X-Custom-Header": "${CONFIG_TOKEN}"},
+		client:  srv.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "value" {
+		t.Errorf("expected header value, got %q", body)
+	}
+}
+
+func TestFetchConfigPollTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := &Provider{pollTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client()})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the request to time out, took %s", elapsed)
+	}
+}
+
+func TestFetchConfigEndpointPollTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := &Provider{pollTimeout: time.Hour}
+	start := time.Now()
+	_, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client(), timeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the request to time out, took %s", elapsed)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	options := &HTTPClient{
+		MaxIdleConns:          50,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       "2m",
+		TLSHandshakeTimeout:   "3s",
+		ResponseHeaderTimeout: "5s",
+	}
+	client, err := newClient(Endpoint{Endpoint: "10.0.1.2"}, nil, nil, nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != 2*time.Minute {
+		t.Errorf("unexpected idle connections %d %d %s", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.TLSHandshakeTimeout != 3*time.Second || transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("unexpected timeouts %s %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	for _, options := range []*HTTPClient{{DialTimeout: "soon"}, {KeepAlive: "-1s"}, {MaxIdleConns: -1}} {
+		if _, err := newClient(Endpoint{Endpoint: "10.0.1.2"}, nil, nil, nil, options); err == nil {
+			t.Errorf("expected an error for %+v", options)
+		}
+	}
+}
+
+func TestNewClientReusesConnections(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	var conns int32
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client, err := newClient(Endpoint{Endpoint: srv.URL}, nil, nil, nil, &HTTPClient{DialTimeout: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{}
+	for i := 0; i < 3; i++ {
+		if _, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: client}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected the connection to be reused, got %d connections", n)
+	}
+}
+
+func TestNewClientResponseHeaderTimeout(t *testing.T) {
+	options := &HTTPClient{ResponseHeaderTimeout: "10s"}
+	for endpoint, expected := range map[string]time.Duration{
+		"http://10.0.1.2/config":      10 * time.Second,
+		"ws://10.0.1.2/config":        0,
+		"grpc://10.0.1.2:9000":        0,
+		"consul://10.0.1.2:8500/key":  0,
+		"etcd://10.0.1.2:2379/config": 0,
+	} {
+		client, err := newClient(Endpoint{Endpoint: endpoint}, nil, nil, nil, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := client.Transport.(*http.Transport).ResponseHeaderTimeout; actual != expected {
+			t.Errorf("%s: expected a response header timeout of %s, got %s", endpoint, expected, actual)
+		}
+	}
+	client, err := newClient(Endpoint{Endpoint: "10.0.1.2", Mode: modeLongPoll}, nil, nil, nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := client.Transport.(*http.Transport).ResponseHeaderTimeout; actual != 0 {
+		t.Errorf("expected no response header timeout for long polling, got %s", actual)
+	}
+}
+
+func TestProviderSharesTransports(t *testing.T) {
+	p := &Provider{}
+	first, err := p.newClient(Endpoint{Endpoint: "10.0.1.2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.newClient(Endpoint{Endpoint: "10.0.1.3"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Transport != second.Transport {
+		t.Error("expected the endpoints to share their transport")
+	}
+	proxied, err := p.newClient(Endpoint{Endpoint: "10.0.1.4", Proxy: &Proxy{URL: "http://proxy:3128"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	longPoll, err := p.newClient(Endpoint{Endpoint: "10.0.1.5", Mode: modeLongPoll}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxied.Transport == first.Transport || longPoll.Transport == first.Transport {
+		t.Error("expected the endpoints with other settings to use their own transport")
+	}
+}
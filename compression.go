@@ -0,0 +1,139 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	acceptEncoding = "gzip, zstd"
+	maxDecodedBody = 256 << 20
+)
+
+// readBody reads the body of a response, decompressing it by its
+// Content-Encoding, rejecting bodies larger than limit bytes, before or after
+// decompression. A limit of 0 stands for maxDecodedBody.
+func readBody(resp *http.Response, limit int) ([]byte, error) {
+	limit = bodyLimit(limit)
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return readSized(resp.Body, limit, resp.ContentLength)
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing gzip body: %w", err)
+		}
+		defer reader.Close()
+		body, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing gzip body: %w", err)
+		}
+		if len(body) > limit {
+			return nil, fmt.Errorf("decompressed body exceeds %d bytes", limit)
+		}
+		return body, nil
+	case "zstd":
+		// the compressed body is only needed until it is decompressed
+		buf := bufferPool.Get().(*bytes.Buffer)
+		defer func() {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}()
+		if _, err := buf.ReadFrom(io.LimitReader(resp.Body, int64(limit)+1)); err != nil {
+			return nil, err
+		}
+		if buf.Len() > limit {
+			return nil, fmt.Errorf("response exceeds %d bytes, see maxResponseBytes", limit)
+		}
+		body, err := zstdDecompress(buf.Bytes(), limit)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing zstd body: %w", err)
+		}
+		return body, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %s", encoding)
+	}
+}
+
+// streamBody returns the body of resp decompressed as it is read, nil when
+// its encoding is only decompressed whole by readBody.
+func streamBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing gzip body: %w", err)
+		}
+		return reader, nil
+	default:
+		return nil, nil
+	}
+}
+
+// bodyLimit returns the size limit of the responses, maxDecodedBody for 0.
+func bodyLimit(limit int) int {
+	if limit <= 0 || limit > maxDecodedBody {
+		return maxDecodedBody
+	}
+	return limit
+}
+
+// streamLimiter bounds the bytes read from a stream between two messages, so
+// the messages of a push endpoint are bounded like the polled responses.
+type streamLimiter struct {
+	r     io.Reader
+	limit int
+	n     int
+}
+
+func newStreamLimiter(r io.Reader, limit int) *streamLimiter {
+	return &streamLimiter{r: r, limit: bodyLimit(limit)}
+}
+
+func (l *streamLimiter) Read(p []byte) (int, error) {
+	if l.n > l.limit {
+		return 0, fmt.Errorf("message exceeds %d bytes, see maxResponseBytes", l.limit)
+	}
+	n, err := l.r.Read(p)
+	l.n += n
+	return n, err
+}
+
+// reset starts counting the next message.
+func (l *streamLimiter) reset() {
+	l.n = 0
+}
+
+// bufferPool the buffers of the compressed bodies.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readLimited reads r, failing when it holds more than limit bytes.
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	return readSized(r, limit, -1)
+}
+
+// readSized reads r like readLimited, allocating size bytes at once when
+// known, such as from a Content-Length, rather than growing the body as it
+// is read.
+func readSized(r io.Reader, limit int, size int64) ([]byte, error) {
+	limit = bodyLimit(limit)
+	var buf bytes.Buffer
+	if size > 0 && size <= int64(limit) {
+		// ReadFrom grows buffers with less than MinRead bytes left
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(io.LimitReader(r, int64(limit)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes, see maxResponseBytes", limit)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,315 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressibleConfig() string {
+	var services []string
+	for i := 0; i < 40; i++ {
+		services = append(services, fmt.Sprintf(`"svc-%d":{"loadBalancer":{"servers":[{"url":"http://10.0.%d.1"}]}}`, i, i))
+	}
+	return `{"http":{"routers":{"big":{"entryPoints":["web"],"service":"svc-0"}},"services":{` + strings.Join(services, ",") + `}}}`
+}
+
+// compressibleConfigZstd is compressibleConfig compressed by zstd -19, with
+// Huffman coded literals, FSE coded sequences and a checksum.
+const compressibleConfigZstd = "" +
+	"28b52ffd64b709dd0700420b231970cf0350e538fa802af124dcff311421a54c" +
+	"696a0ca5ff5f08f7de39a58c11c2f79cfb77ef6edf7e4e296384f03de7feddbb" +
+	"9b379f53ca18217ccfb97ff7eeee39a58c11c2f79cfb77ef3e2eb7d07a1828e5" +
+	"c7569cd99a51b6558190072116247af85e6e81624d4cb92a8e65ebc4c0c149bd" +
+	"d8a03c5190131598a5a0ca38c9642b55459633ca1245359c055aa831d02505a9" +
+	"47db01a08324ad061280510408014220a42484ff5fe807810130c140d87064fc" +
+	"76d33824b000266a0807dfdc200e1f1009048d090d187bf7280147e183dfbab5" +
+	"e4b0fdb67db24621e400b4d7ef4dea6fc8d9f344e43e2d98ad014826806b50c9" +
+	"62eaa255030209c2ac"
+
+func zstdFixture(t *testing.T) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(compressibleConfigZstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestZstdDecompress(t *testing.T) {
+	fixture := zstdFixture(t)
+	expected := compressibleConfig()
+
+	tests := []struct {
+		desc     string
+		src      []byte
+		expected string
+		wantErr  bool
+	}{
+		{desc: "compressed", src: fixture, expected: expected},
+		{desc: "concatenated frames", src: append(append([]byte{}, fixture...), fixture...), expected: expected + expected},
+		{
+			desc:     "raw and rle blocks",
+			src:      []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x08, 0x18, 0x00, 0x00, 'a', 'b', 'c', 0x2b, 0x00, 0x00, 'z'},
+			expected: "abczzzzz",
+		},
+		{
+			desc:     "skippable frame",
+			src:      append([]byte{0x50, 0x2a, 0x4d, 0x18, 0x02, 0x00, 0x00, 0x00, 0xff, 0xff}, fixture...),
+			expected: expected,
+		},
+		{desc: "invalid magic", src: []byte{0x1f, 0x8b, 0x08, 0x00}, wantErr: true},
+		{desc: "truncated", src: fixture[:len(fixture)/2], wantErr: true},
+		{desc: "bad checksum", src: append(append([]byte{}, fixture[:len(fixture)-1]...), fixture[len(fixture)-1]^0xff), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			actual, err := zstdDecompress(test.src, maxDecodedBody)
+			if test.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestZstdDecompressLimit(t *testing.T) {
+	if _, err := zstdDecompress(zstdFixture(t), 1024); err == nil {
+		t.Error("expected an error beyond the size limit")
+	}
+}
+
+func TestZstdDecompressCorrupted(t *testing.T) {
+	fixture := zstdFixture(t)
+	for i := 4; i < len(fixture); i++ {
+		corrupted := append([]byte{}, fixture...)
+		corrupted[i] ^= 0x5a
+		// must fail or decode without panicking
+		_, _ = zstdDecompress(corrupted, maxDecodedBody)
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{input: "", expected: 0xef46db3751d8e999},
+		{input: "abc", expected: 0x44bc2cf5ad770999},
+		{input: "Nobody inspects the spammish repetition", expected: 0xfbcea83c8a378bf1},
+	}
+	for _, test := range tests {
+		if actual := xxhash64([]byte(test.input)); actual != test.expected {
+			t.Errorf("%q: expected %#x, got %#x", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestFetchDecompressesResponses(t *testing.T) {
+	expected := compressibleConfig()
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(expected))
+	w.Close()
+
+	bodies := map[string][]byte{
+		"gzip": gzipped.Bytes(),
+		"zstd": zstdFixture(t),
+		"":     []byte(expected),
+	}
+	for encoding, body := range bodies {
+		t.Run("encoding "+encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if accept := r.Header.Get("Accept-Encoding"); accept != "gzip, zstd" {
+					t.Errorf("unexpected Accept-Encoding %q", accept)
+				}
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			p := &Provider{}
+			actual, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != expected {
+				t.Errorf("unexpected body %q", actual)
+			}
+		})
+	}
+}
+
+func TestFetchUnsupportedEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte("compressed"))
+	}))
+	defer srv.Close()
+
+	p := &Provider{}
+	if _, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client()}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFetchMaxResponseBytes(t *testing.T) {
+	config := compressibleConfig()
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(config))
+	w.Close()
+
+	bodies := map[string][]byte{
+		"gzip": gzipped.Bytes(),
+		"":     []byte(config),
+	}
+	for encoding, body := range bodies {
+		t.Run("encoding "+encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			p := &Provider{}
+			e := endpoint{url: srv.URL, client: srv.Client(), maxBytes: len(config) - 1}
+			if _, _, err := p.fetchConfig(context.Background(), e); err == nil || !strings.Contains(err.Error(), "exceeds") {
+				t.Errorf("expected the response to exceed the limit, got %v", err)
+			}
+			e.maxBytes = len(config)
+			if _, _, err := p.fetchConfig(context.Background(), e); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestFetchStreamsJSON(t *testing.T) {
+	config := compressibleConfig()
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(config))
+	w.Close()
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		body     []byte
+		maxBytes int
+		decoded  bool
+		routers  int
+		err      string
+	}{
+		{name: "plain", body: []byte(" \n" + config), decoded: true, routers: 1},
+		{name: "gzip", header: map[string]string{"Content-Encoding": "gzip"}, body: gzipped.Bytes(), decoded: true, routers: 1},
+		{name: "too large", body: []byte(config), maxBytes: len(config) - 1, err: "exceeds"},
+		{name: "too large gzip", header: map[string]string{"Content-Encoding": "gzip"}, body: gzipped.Bytes(), maxBytes: len(config) - 1, err: "exceeds"},
+		{name: "invalid", body: []byte(`{"http":`), err: "unexpected EOF"},
+		{name: "not a configuration", body: []byte(`{"http":[]}`), decoded: true},
+		{name: "trailing data", body: []byte(config + `{}`), decoded: true},
+		{name: "validators", header: map[string]string{"ETag": `"v1"`}, body: []byte(config)},
+		{name: "yaml", header: map[string]string{"Content-Type": "application/yaml"}, body: []byte("http: {}")},
+		{name: "array", body: []byte(`[` + config + `]`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range test.header {
+					w.Header().Set(key, value)
+				}
+				w.Write(test.body)
+			}))
+			defer srv.Close()
+
+			p := &Provider{}
+			r := polled{e: endpoint{url: srv.URL, client: srv.Client(), cache: &responseCache{}, maxBytes: test.maxBytes}}
+			p.fetch(context.Background(), &r, true)
+			if test.err != "" {
+				if r.err == nil || !strings.Contains(r.err.Error(), test.err) {
+					t.Fatalf("expected an error %q, got %v", test.err, r.err)
+				}
+				return
+			}
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if r.decoded != test.decoded {
+				t.Fatalf("expected decoded %t, got %t", test.decoded, r.decoded)
+			}
+			switch {
+			case !test.decoded && len(r.body) == 0:
+				t.Error("expected the body to be read whole")
+			case test.routers == 0 && r.config != nil:
+				t.Errorf("expected no configuration, got %+v", r.config)
+			case test.routers > 0 && (r.config == nil || len(r.config.HTTP.Routers) != test.routers):
+				t.Errorf("unexpected configuration %+v", r.config)
+			}
+		})
+	}
+}
+
+func TestReadSized(t *testing.T) {
+	config := compressibleConfig()
+	body, err := readSized(strings.NewReader(config), 0, int64(len(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != config {
+		t.Errorf("unexpected body %q", body)
+	}
+	if cap(body) >= 2*len(config) {
+		t.Errorf("expected the body to be allocated once, got a capacity of %d", cap(body))
+	}
+	if _, err := readSized(strings.NewReader(config), 10, int64(len(config))); err == nil {
+		t.Error("expected the body to exceed the limit")
+	}
+}
+
+func TestStreamLimiter(t *testing.T) {
+	limiter := newStreamLimiter(strings.NewReader(strings.Repeat("a", 10)+strings.Repeat("b", 20)), 16)
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(limiter, buf); err != nil {
+		t.Fatal(err)
+	}
+	limiter.reset()
+	if _, err := io.ReadAll(limiter); err == nil || !strings.Contains(err.Error(), "exceeds 16 bytes") {
+		t.Errorf("expected the message to exceed the limit, got %v", err)
+	}
+}
+
+func TestInitMaxResponseBytes(t *testing.T) {
+	for size, wantErr := range map[int]bool{0: false, maxDecodedBody: false, -1: true, maxDecodedBody + 1: true} {
+		config := CreateConfig()
+		config.EntryPoints = []string{"web"}
+		config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+		config.MaxResponseBytes = size
+		p, err := New(context.Background(), config, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Init(); (err != nil) != wantErr {
+			t.Errorf("maxResponseBytes %d: expected an error %t, got %v", size, wantErr, err)
+		}
+	}
+}
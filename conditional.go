@@ -0,0 +1,125 @@
+package multi_http_provider
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNotModified reports a polled endpoint answering 304 Not Modified, its
+// cached response being unchanged.
+var errNotModified = errors.New("not modified")
+
+// responseCache the last response of a polled endpoint with its validators,
+// for the conditional requests.
+type responseCache struct {
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	body         []byte
+	contentType  string
+	// the status and Cache-Control max-age expiry of the last response
+	status  int
+	expires time.Time
+}
+
+// setValidators makes req conditional on the cached response.
+func (c *responseCache) setValidators(req *http.Request) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.body == nil {
+		return
+	}
+	if c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+	if c.lastModified != "" {
+		req.Header.Set("If-Modified-Since", c.lastModified)
+	}
+}
+
+// store caches a successful response carrying validators, dropping the
+// cached one otherwise.
+func (c *responseCache) store(resp *http.Response, body []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.etag, c.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	c.body, c.contentType = nil, ""
+	if resp.StatusCode == http.StatusOK && (c.etag != "" || c.lastModified != "") {
+		c.body, c.contentType = body, resp.Header.Get("Content-Type")
+	}
+}
+
+// cached returns the cached response, nil when there is none.
+func (c *responseCache) cached() ([]byte, string) {
+	if c == nil {
+		return nil, ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.body, c.contentType
+}
+
+// record records the status and max-age of resp, the zero time without one.
+func (c *responseCache) record(resp *http.Response, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status, c.expires = resp.StatusCode, time.Time{}
+	if age, ok := maxAge(resp.Header.Get("Cache-Control")); ok {
+		c.expires = now.Add(age)
+	}
+}
+
+// expiry returns the time the last response expires, the zero time when
+// unknown.
+func (c *responseCache) expiry() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expires
+}
+
+// maxAge parses the max-age directive of a Cache-Control header, ignored with
+// no-cache or no-store.
+func maxAge(header string) (time.Duration, bool) {
+	var age time.Duration
+	found := false
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+		switch name {
+		case "no-cache", "no-store":
+			return 0, false
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				return 0, false
+			}
+			age, found = time.Duration(seconds)*time.Second, true
+		}
+	}
+	return age, found
+}
+
+// lastStatus returns the status of the last response, 0 when unknown.
+func (c *responseCache) lastStatus() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
@@ -0,0 +1,139 @@
+package multi_http_provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchConfigConditional(t *testing.T) {
+	tests := []struct {
+		desc      string
+		validator string
+		header    string
+		value     string
+	}{
+		{desc: "etag", validator: "ETag", header: "If-None-Match", value: `"v1"`},
+		{desc: "last modified", validator: "Last-Modified", header: "If-Modified-Since", value: "Wed, 14 Oct 2026 10:00:00 GMT"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			notModified := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(test.header) == test.value {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set(test.validator, test.value)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(routerConfig("api", "web")))
+			}))
+			defer srv.Close()
+
+			p := &Provider{}
+			e := endpoint{url: srv.URL, client: srv.Client(), cache: &responseCache{}}
+			body, _, err := p.fetchConfig(context.Background(), e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cached, contentType, err := p.fetchConfig(context.Background(), e)
+			if !errors.Is(err, errNotModified) {
+				t.Fatalf("expected the configuration not to be modified, got %v", err)
+			}
+			if notModified != 1 || string(cached) != string(body) || contentType != "application/json" {
+				t.Errorf("expected the cached configuration, got %d 304 and %q %s", notModified, cached, contentType)
+			}
+		})
+	}
+}
+
+func TestFetchConfigWithoutValidators(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			t.Error("expected an unconditional request")
+		}
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	defer srv.Close()
+
+	p := &Provider{}
+	e := endpoint{url: srv.URL, client: srv.Client(), cache: &responseCache{}}
+	for i := 0; i < 2; i++ {
+		if _, _, err := p.fetchConfig(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPollEndpointsUnchanged(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	defer srv.Close()
+
+	p := &Provider{maxConcurrency: 1}
+	endpoints := map[string]endpoint{"node": {url: srv.URL, mode: modePoll, client: srv.Client(), cache: &responseCache{}}}
+	if r := p.pollEndpoints(context.Background(), endpoints)[0]; r.err != nil || r.unchanged {
+		t.Fatalf("expected a changed configuration, got %v unchanged %v", r.err, r.unchanged)
+	}
+	r := p.pollEndpoints(context.Background(), endpoints)[0]
+	if r.err != nil || !r.unchanged || len(r.body) == 0 {
+		t.Errorf("expected the cached configuration unchanged, got %v unchanged %v", r.err, r.unchanged)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	tests := []struct {
+		header string
+		age    time.Duration
+		ok     bool
+	}{
+		{header: ""},
+		{header: "max-age=60", age: time.Minute, ok: true},
+		{header: "public, Max-Age=\"30\"", age: 30 * time.Second, ok: true},
+		{header: "max-age=60, no-cache"},
+		{header: "no-store"},
+		{header: "max-age=soon"},
+	}
+	for _, test := range tests {
+		age, ok := maxAge(test.header)
+		if age != test.age || ok != test.ok {
+			t.Errorf("%q: expected %s %v, got %s %v", test.header, test.age, test.ok, age, ok)
+		}
+	}
+}
+
+func TestProvideCacheControl(t *testing.T) {
+	for _, cacheControl := range []bool{false, true} {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("Cache-Control", "max-age=3600")
+			_, _ = w.Write([]byte(routerConfig("api", "web")))
+		}))
+
+		config := CreateConfig()
+		config.PollInterval = "10ms"
+		config.EntryPoints = []string{"web"}
+		config.CacheControl = cacheControl
+		config.Endpoints = map[string]Endpoint{"node": {Endpoint: srv.URL}}
+		cfgChan := startProviderConfig(t, config)
+
+		receiveConfig(t, cfgChan)
+		time.Sleep(100 * time.Millisecond)
+		if n := atomic.LoadInt32(&hits); cacheControl && n != 1 || !cacheControl && n < 2 {
+			t.Errorf("cacheControl %v: unexpected %d polls", cacheControl, n)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,143 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func isConsulURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "consul://")
+}
+
+// consulKVURL maps consul://host:port/prefix endpoints to the KV API URL of
+// the prefix.
+func consulKVURL(e Endpoint) string {
+	scheme := "http"
+	if e.Scheme == "https" {
+		scheme = "https"
+	}
+	host, prefix, _ := strings.Cut(strings.TrimPrefix(e.Endpoint, "consul://"), "/")
+	return fmt.Sprintf("%s://%s/v1/kv/%s", scheme, host, strings.TrimSuffix(prefix, "/"))
+}
+
+type consulKVPair struct {
+	Key         string
+	Value       string
+	ModifyIndex uint64
+}
+
+// consulKV watches a Consul KV prefix with blocking queries, every key below
+// the prefix holding the configuration of one node. The ACL token can be set
+// with the X-Consul-Token header.
+type consulKV struct {
+	wait    time.Duration
+	index   uint64
+	keys    map[string]uint64
+	backoff *backoff
+}
+
+func (c *consulKV) reconnect(bool) time.Duration {
+	c.index = 0
+	c.keys = nil
+	return c.backoff.next()
+}
+
+func (c *consulKV) watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error) {
+	prefix := strings.TrimPrefix(strings.SplitN(e.url, "/v1/kv/", 2)[1], "/") + "/"
+	if c.keys == nil {
+		c.keys = map[string]uint64{}
+	}
+
+	for {
+		pairs, index, err := c.query(ctx, e)
+		if err != nil {
+			return false, err
+		}
+		c.backoff.reset()
+
+		// Consul advises to reset the index when it goes backwards
+		if index < c.index {
+			index = 0
+		}
+		c.index = index
+
+		seen := map[string]bool{}
+		for _, pair := range pairs {
+			key := strings.TrimPrefix(pair.Key, prefix)
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+			seen[key] = true
+			if modified, ok := c.keys[key]; ok && modified == pair.ModifyIndex {
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(pair.Value)
+			if err != nil {
+				return false, fmt.Errorf("decoding key %s: %w", pair.Key, err)
+			}
+			c.keys[key] = pair.ModifyIndex
+			emit(key, "", value)
+		}
+		for key := range c.keys {
+			if !seen[key] {
+				delete(c.keys, key)
+				emit(key, "", nil)
+			}
+		}
+	}
+}
+
+func (c *consulKV) query(ctx context.Context, e endpoint) ([]consulKVPair, uint64, error) {
+	u, err := url.Parse(e.url)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := u.Query()
+	query.Set("recurse", "true")
+	query.Set("wait", c.wait.String())
+	if c.index > 0 {
+		query.Set("index", strconv.FormatUint(c.index, 10))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// no key below the prefix
+		return nil, index, nil
+	default:
+		return nil, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := readLimited(resp.Body, e.maxBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	var pairs []consulKVPair
+	if err := json.Unmarshal(body, &pairs); err != nil {
+		return nil, 0, fmt.Errorf("decoding KV pairs: %w", err)
+	}
+	return pairs, index, nil
+}
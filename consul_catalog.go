@@ -0,0 +1,107 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ConsulCatalog discovers the healthy instances of a service registered in
+// the Consul catalog.
+type ConsulCatalog struct {
+	Address    string `json:"address,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Datacenter string `json:"datacenter,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string `json:"ID"`
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+type consulCatalogDiscovery struct {
+	url      string
+	token    string
+	template Endpoint
+	client   *http.Client
+	maxBytes int
+}
+
+func (p *Provider) newConsulCatalogDiscovery(c *ConsulCatalog, template Endpoint) (*consulCatalogDiscovery, error) {
+	if c.Service == "" {
+		return nil, fmt.Errorf("consul catalog service must be set")
+	}
+	address := c.Address
+	if address == "" {
+		address = "http://127.0.0.1:8500"
+	}
+	client, err := p.newClient(Endpoint{Endpoint: address}, p.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"passing": {"true"}}
+	if c.Tag != "" {
+		query.Set("tag", c.Tag)
+	}
+	if c.Datacenter != "" {
+		query.Set("dc", c.Datacenter)
+	}
+	return &consulCatalogDiscovery{
+		url:      fmt.Sprintf("%s/v1/health/service/%s?%s", strings.TrimSuffix(address, "/"), url.PathEscape(c.Service), query.Encode()),
+		token:    c.Token,
+		template: template,
+		client:   client,
+		maxBytes: p.maxResponseBytes,
+	}, nil
+}
+
+func (d *consulCatalogDiscovery) discover(ctx context.Context) (map[string]Endpoint, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("X-Consul-Token", d.token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(newStreamLimiter(resp.Body, d.maxBytes)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding service entries: %w", err)
+	}
+
+	endpoints := map[string]Endpoint{}
+	for _, entry := range entries {
+		// the service address defaults to the node one when not registered
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		e := d.template
+		e.Endpoint = address
+		if entry.Service.Port != 0 {
+			e.Port = entry.Service.Port
+		}
+		endpoints[entry.Service.ID] = e
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,62 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsulCatalogDiscover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/traefik-config" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("passing") != "true" || query.Get("tag") != "edge" || query.Get("dc") != "eu1" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Errorf("unexpected token %q", r.Header.Get("X-Consul-Token"))
+		}
+		fmt.Fprint(w, `[
+			{"Node":{"Address":"10.0.0.1"},"Service":{"ID":"config-1","Address":"10.1.0.1","Port":8080}},
+			{"Node":{"Address":"10.0.0.2"},"Service":{"ID":"config-2","Address":"","Port":0}}
+		]`)
+	}))
+	defer srv.Close()
+
+	d, err := (&Provider{}).newConsulCatalogDiscovery(&ConsulCatalog{
+		Address:    srv.URL,
+		Service:    "traefik-config",
+		Tag:        "edge",
+		Datacenter: "eu1",
+		Token:      "secret",
+	}, Endpoint{Path: "/config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := d.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"config-1": "http://10.1.0.1:8080/config",
+		"config-2": "http://10.0.0.2:5000/config",
+	}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("expected %d endpoints, got %v", len(expected), endpoints)
+	}
+	for name, u := range expected {
+		if actual := endpointURL(endpoints[name]); actual != u {
+			t.Errorf("%s: expected %s, got %s", name, u, actual)
+		}
+	}
+}
+
+func TestConsulCatalogRequiresService(t *testing.T) {
+	if _, err := (&Provider{}).newConsulCatalogDiscovery(&ConsulCatalog{}, Endpoint{}); err == nil {
+		t.Error("expected an error without service")
+	}
+}
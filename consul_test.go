@@ -0,0 +1,88 @@
+package multi_http_provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func consulPairs(t *testing.T, w http.ResponseWriter, index string, pairs map[string]consulKVPair) {
+	t.Helper()
+
+	var list []consulKVPair
+	for key, pair := range pairs {
+		pair.Key = key
+		pair.Value = base64.StdEncoding.EncodeToString([]byte(pair.Value))
+		list = append(list, pair)
+	}
+	w.Header().Set("X-Consul-Index", index)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsulKV(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/traefik/nodes" || r.URL.Query().Get("recurse") != "true" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("X-Consul-Token") != "acl" {
+			t.Errorf("expected the ACL token header")
+		}
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			consulPairs(t, w, "10", map[string]consulKVPair{
+				"traefik/nodes/":     {ModifyIndex: 1},
+				"traefik/nodes/edge": {Value: routerConfig("edge", "web"), ModifyIndex: 5},
+				"traefik/nodes/core": {Value: routerConfig("core", "web"), ModifyIndex: 6},
+			})
+		case 2:
+			if r.URL.Query().Get("index") != "10" {
+				t.Errorf("expected index 10, got %s", r.URL.Query().Get("index"))
+			}
+			consulPairs(t, w, "11", map[string]consulKVPair{
+				"traefik/nodes/edge": {Value: routerConfig("edge", "web"), ModifyIndex: 5},
+			})
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"consul": {Endpoint: "consul://" + srv.Listener.Addr().String() + "/traefik/nodes", Headers: map[string]string{"X-Consul-Token": "acl"}},
+	})
+
+	// both keys are published, then core is removed
+	for {
+		config := receiveConfig(t, cfgChan)
+		_, hasEdge := config.HTTP.Routers["edge"]
+		_, hasCore := config.HTTP.Routers["core"]
+		if hasEdge && hasCore {
+			break
+		}
+	}
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["core"]; ok || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected only router edge, got %v", routerNames(config))
+	}
+}
+
+func TestConsulKVURL(t *testing.T) {
+	tests := []struct {
+		endpoint Endpoint
+		expected string
+	}{
+		{endpoint: Endpoint{Endpoint: "consul://consul:8500/traefik/nodes/"}, expected: "http://consul:8500/v1/kv/traefik/nodes"},
+		{endpoint: Endpoint{Endpoint: "consul://consul:8501/traefik", Scheme: "https"}, expected: "https://consul:8501/v1/kv/traefik"},
+	}
+	for _, test := range tests {
+		if actual := consulKVURL(test.endpoint); actual != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, actual)
+		}
+	}
+}
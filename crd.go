@@ -0,0 +1,516 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/tls"
+	"github.com/traefik/genconf/dynamic/types"
+)
+
+const formatCRD = "crd"
+
+// crdObject is a Kubernetes object of a manifest, or a List of them.
+type crdObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec  json.RawMessage `json:"spec"`
+	Items []crdObject     `json:"items"`
+}
+
+type crdRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// crdPort is a port given by number or by name.
+type crdPort string
+
+func (p *crdPort) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = crdPort(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*p = crdPort(n.String())
+	return nil
+}
+
+type crdService struct {
+	Name               string                      `json:"name"`
+	Namespace          string                      `json:"namespace"`
+	Kind               string                      `json:"kind"`
+	Port               crdPort                     `json:"port"`
+	Scheme             string                      `json:"scheme"`
+	Weight             *int                        `json:"weight"`
+	PassHostHeader     *bool                       `json:"passHostHeader"`
+	ServersTransport   string                      `json:"serversTransport"`
+	Sticky             *dynamic.Sticky             `json:"sticky"`
+	ResponseForwarding *dynamic.ResponseForwarding `json:"responseForwarding"`
+	HealthCheck        *dynamic.ServerHealthCheck  `json:"healthCheck"`
+	TerminationDelay   *int                        `json:"terminationDelay"`
+	Percent            int                         `json:"percent"`
+}
+
+type crdTLS struct {
+	SecretName   string         `json:"secretName"`
+	Options      *crdRef        `json:"options"`
+	CertResolver string         `json:"certResolver"`
+	Domains      []types.Domain `json:"domains"`
+	Passthrough  bool           `json:"passthrough"`
+}
+
+type ingressRouteSpec struct {
+	EntryPoints []string `json:"entryPoints"`
+	Routes      []struct {
+		Match       string       `json:"match"`
+		Priority    int          `json:"priority"`
+		Middlewares []crdRef     `json:"middlewares"`
+		Services    []crdService `json:"services"`
+	} `json:"routes"`
+	TLS *crdTLS `json:"tls"`
+}
+
+type kubernetesServiceSpec struct {
+	Type         string `json:"type"`
+	ExternalName string `json:"externalName"`
+	Ports        []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"ports"`
+}
+
+// crdTranslator translates Traefik CRD manifests into a configuration, as the
+// Kubernetes CRD provider does. Objects are named namespace-name.
+type crdTranslator struct {
+	config   *dynamic.Configuration
+	services map[string]kubernetesServiceSpec
+}
+
+// crdToJSON converts IngressRoute, IngressRouteTCP, Middleware,
+// MiddlewareTCP, TraefikService and TLSOption manifests, in JSON or in
+// multi-document YAML, into a configuration. Kubernetes Services referenced by
+// routes are reached at their cluster DNS name, or at their external name.
+func crdToJSON(body []byte) ([]byte, error) {
+	objects, err := decodeManifests(body)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &crdTranslator{
+		config: &dynamic.Configuration{
+			HTTP: &dynamic.HTTPConfiguration{
+				Routers:     map[string]*dynamic.Router{},
+				Services:    map[string]*dynamic.Service{},
+				Middlewares: map[string]*dynamic.Middleware{},
+			},
+		},
+		services: map[string]kubernetesServiceSpec{},
+	}
+	for _, o := range objects {
+		if o.Kind != "Service" {
+			continue
+		}
+		var spec kubernetesServiceSpec
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, fmt.Errorf("service %s: %w", o.Metadata.Name, err)
+		}
+		t.services[crdName(o.Metadata.Namespace, o.Metadata.Name)] = spec
+	}
+	for _, o := range objects {
+		if err := t.translate(o); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", o.Kind, o.Metadata.Name, err)
+		}
+	}
+	return json.Marshal(t.config)
+}
+
+// decodeManifests decodes JSON or YAML manifests, flattening lists.
+func decodeManifests(body []byte) ([]crdObject, error) {
+	var documents []json.RawMessage
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &documents); err != nil {
+			return nil, err
+		}
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		documents = []json.RawMessage{trimmed}
+	default:
+		values, err := decodeYAMLDocuments(body)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			document, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, document)
+		}
+	}
+
+	var objects []crdObject
+	var flatten func(o crdObject)
+	flatten = func(o crdObject) {
+		if strings.HasSuffix(o.Kind, "List") {
+			for _, item := range o.Items {
+				flatten(item)
+			}
+			return
+		}
+		if o.Metadata.Namespace == "" {
+			o.Metadata.Namespace = "default"
+		}
+		objects = append(objects, o)
+	}
+	for _, document := range documents {
+		var o crdObject
+		if err := json.Unmarshal(document, &o); err != nil {
+			return nil, err
+		}
+		flatten(o)
+	}
+	return objects, nil
+}
+
+func crdName(namespace, name string) string {
+	if strings.Contains(name, "@") {
+		// a reference to another provider
+		return name
+	}
+	return namespace + "-" + name
+}
+
+func (t *crdTranslator) translate(o crdObject) error {
+	namespace, name := o.Metadata.Namespace, o.Metadata.Name
+	switch o.Kind {
+	case "IngressRoute":
+		return t.ingressRoute(namespace, name, o.Spec)
+	case "IngressRouteTCP":
+		return t.ingressRouteTCP(namespace, name, o.Spec)
+	case "Middleware":
+		return t.middleware(namespace, name, o.Spec)
+	case "MiddlewareTCP":
+		var m dynamic.TCPMiddleware
+		if err := json.Unmarshal(o.Spec, &m); err != nil {
+			return err
+		}
+		t.tcp().Middlewares[crdName(namespace, name)] = &m
+	case "TraefikService":
+		return t.traefikService(namespace, name, o.Spec)
+	case "TLSOption":
+		var options tls.Options
+		if err := json.Unmarshal(o.Spec, &options); err != nil {
+			return err
+		}
+		if t.config.TLS == nil {
+			t.config.TLS = &dynamic.TLSConfiguration{Options: map[string]tls.Options{}}
+		}
+		t.config.TLS.Options[crdName(namespace, name)] = options
+	}
+	return nil
+}
+
+func (t *crdTranslator) tcp() *dynamic.TCPConfiguration {
+	if t.config.TCP == nil {
+		t.config.TCP = &dynamic.TCPConfiguration{
+			Routers:     map[string]*dynamic.TCPRouter{},
+			Services:    map[string]*dynamic.TCPService{},
+			Middlewares: map[string]*dynamic.TCPMiddleware{},
+		}
+	}
+	return t.config.TCP
+}
+
+func (t *crdTranslator) ingressRoute(namespace, name string, raw json.RawMessage) error {
+	var spec ingressRouteSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return err
+	}
+	for i, route := range spec.Routes {
+		key := crdName(namespace, name) + "-" + strconv.Itoa(i)
+		router := &dynamic.Router{EntryPoints: spec.EntryPoints, Rule: route.Match, Priority: route.Priority}
+		for _, m := range route.Middlewares {
+			router.Middlewares = append(router.Middlewares, crdName(refNamespace(m.Namespace, namespace), m.Name))
+		}
+
+		switch len(route.Services) {
+		case 0:
+			return fmt.Errorf("route %d has no service", i)
+		case 1:
+			service, err := t.serviceName(namespace, route.Services[0])
+			if err != nil {
+				return err
+			}
+			router.Service = service
+		default:
+			// several services are balanced by a weighted service named
+			// after the router
+			weighted := &dynamic.WeightedRoundRobin{}
+			for _, s := range route.Services {
+				service, err := t.serviceName(namespace, s)
+				if err != nil {
+					return err
+				}
+				weighted.Services = append(weighted.Services, dynamic.WRRService{Name: service, Weight: s.Weight})
+			}
+			t.config.HTTP.Services[key] = &dynamic.Service{Weighted: weighted}
+			router.Service = key
+		}
+
+		if tls := spec.TLS; tls != nil {
+			router.TLS = &dynamic.RouterTLSConfig{CertResolver: tls.CertResolver, Domains: tls.Domains}
+			if tls.Options != nil {
+				router.TLS.Options = crdName(refNamespace(tls.Options.Namespace, namespace), tls.Options.Name)
+			}
+			if tls.SecretName != "" {
+				logger.Warn("Ignoring the TLS secret of an IngressRoute, secrets are not exported", "secret", tls.SecretName, "ingressRoute", namespace+"/"+name)
+			}
+		}
+		t.config.HTTP.Routers[key] = router
+	}
+	return nil
+}
+
+func (t *crdTranslator) ingressRouteTCP(namespace, name string, raw json.RawMessage) error {
+	var spec struct {
+		EntryPoints []string `json:"entryPoints"`
+		Routes      []struct {
+			Match       string       `json:"match"`
+			Priority    int          `json:"priority"`
+			Middlewares []crdRef     `json:"middlewares"`
+			Services    []crdService `json:"services"`
+		} `json:"routes"`
+		TLS *crdTLS `json:"tls"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return err
+	}
+	tcp := t.tcp()
+	for i, route := range spec.Routes {
+		key := crdName(namespace, name) + "-" + strconv.Itoa(i)
+		router := &dynamic.TCPRouter{EntryPoints: spec.EntryPoints, Rule: route.Match, Priority: route.Priority}
+		for _, m := range route.Middlewares {
+			router.Middlewares = append(router.Middlewares, crdName(refNamespace(m.Namespace, namespace), m.Name))
+		}
+
+		weighted := &dynamic.TCPWeightedRoundRobin{}
+		for _, s := range route.Services {
+			address, err := t.serviceAddress(refNamespace(s.Namespace, namespace), s)
+			if err != nil {
+				return err
+			}
+			service := crdName(refNamespace(s.Namespace, namespace), s.Name) + "-" + string(s.Port)
+			tcp.Services[service] = &dynamic.TCPService{LoadBalancer: &dynamic.TCPServersLoadBalancer{
+				Servers:          []dynamic.TCPServer{{Address: address}},
+				TerminationDelay: s.TerminationDelay,
+			}}
+			weighted.Services = append(weighted.Services, dynamic.TCPWRRService{Name: service, Weight: s.Weight})
+		}
+		switch len(weighted.Services) {
+		case 0:
+			return fmt.Errorf("route %d has no service", i)
+		case 1:
+			router.Service = weighted.Services[0].Name
+		default:
+			tcp.Services[key] = &dynamic.TCPService{Weighted: weighted}
+			router.Service = key
+		}
+
+		if tls := spec.TLS; tls != nil {
+			router.TLS = &dynamic.RouterTCPTLSConfig{Passthrough: tls.Passthrough, CertResolver: tls.CertResolver, Domains: tls.Domains}
+			if tls.Options != nil {
+				router.TLS.Options = crdName(refNamespace(tls.Options.Namespace, namespace), tls.Options.Name)
+			}
+		}
+		tcp.Routers[key] = router
+	}
+	return nil
+}
+
+// middleware translates a Middleware, whose chain and errors middlewares
+// reference other objects.
+func (t *crdTranslator) middleware(namespace, name string, raw json.RawMessage) error {
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return err
+	}
+	var chain *dynamic.Chain
+	if data, ok := spec["chain"]; ok {
+		var refs struct {
+			Middlewares []crdRef `json:"middlewares"`
+		}
+		if err := json.Unmarshal(data, &refs); err != nil {
+			return err
+		}
+		chain = &dynamic.Chain{}
+		for _, m := range refs.Middlewares {
+			chain.Middlewares = append(chain.Middlewares, crdName(refNamespace(m.Namespace, namespace), m.Name))
+		}
+		delete(spec, "chain")
+	}
+	var errorPage *dynamic.ErrorPage
+	if data, ok := spec["errors"]; ok {
+		var errors struct {
+			Status  []string   `json:"status"`
+			Query   string     `json:"query"`
+			Service crdService `json:"service"`
+		}
+		if err := json.Unmarshal(data, &errors); err != nil {
+			return err
+		}
+		service, err := t.serviceName(namespace, errors.Service)
+		if err != nil {
+			return err
+		}
+		errorPage = &dynamic.ErrorPage{Status: errors.Status, Query: errors.Query, Service: service}
+		delete(spec, "errors")
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	var m dynamic.Middleware
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if chain != nil {
+		m.Chain = chain
+	}
+	if errorPage != nil {
+		m.Errors = errorPage
+	}
+	t.config.HTTP.Middlewares[crdName(namespace, name)] = &m
+	return nil
+}
+
+func (t *crdTranslator) traefikService(namespace, name string, raw json.RawMessage) error {
+	var spec struct {
+		Weighted *struct {
+			Services []crdService    `json:"services"`
+			Sticky   *dynamic.Sticky `json:"sticky"`
+		} `json:"weighted"`
+		Mirroring *struct {
+			crdService
+			MaxBodySize *int64       `json:"maxBodySize"`
+			Mirrors     []crdService `json:"mirrors"`
+		} `json:"mirroring"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return err
+	}
+
+	service := &dynamic.Service{}
+	switch {
+	case spec.Weighted != nil:
+		service.Weighted = &dynamic.WeightedRoundRobin{Sticky: spec.Weighted.Sticky}
+		for _, s := range spec.Weighted.Services {
+			name, err := t.serviceName(namespace, s)
+			if err != nil {
+				return err
+			}
+			service.Weighted.Services = append(service.Weighted.Services, dynamic.WRRService{Name: name, Weight: s.Weight})
+		}
+	case spec.Mirroring != nil:
+		main, err := t.serviceName(namespace, spec.Mirroring.crdService)
+		if err != nil {
+			return err
+		}
+		service.Mirroring = &dynamic.Mirroring{Service: main, MaxBodySize: spec.Mirroring.MaxBodySize}
+		for _, s := range spec.Mirroring.Mirrors {
+			name, err := t.serviceName(namespace, s)
+			if err != nil {
+				return err
+			}
+			service.Mirroring.Mirrors = append(service.Mirroring.Mirrors, dynamic.MirrorService{Name: name, Percent: s.Percent})
+		}
+	default:
+		return fmt.Errorf("expected a weighted or mirroring service")
+	}
+	t.config.HTTP.Services[crdName(namespace, name)] = service
+	return nil
+}
+
+// serviceName returns the name of the service a route references, adding a
+// load balancer for Kubernetes Services.
+func (t *crdTranslator) serviceName(namespace string, s crdService) (string, error) {
+	namespace = refNamespace(s.Namespace, namespace)
+	if s.Kind == "TraefikService" {
+		return crdName(namespace, s.Name), nil
+	}
+	if s.Kind != "" && s.Kind != "Service" {
+		return "", fmt.Errorf("unsupported service kind %s", s.Kind)
+	}
+
+	address, err := t.serviceAddress(namespace, s)
+	if err != nil {
+		return "", err
+	}
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if _, port, _ := net.SplitHostPort(address); port == "443" || strings.HasPrefix(string(s.Port), "https") {
+			scheme = "https"
+		}
+	}
+
+	name := crdName(namespace, s.Name) + "-" + string(s.Port)
+	t.config.HTTP.Services[name] = &dynamic.Service{LoadBalancer: &dynamic.ServersLoadBalancer{
+		Servers:            []dynamic.Server{{URL: scheme + "://" + address}},
+		PassHostHeader:     s.PassHostHeader,
+		ServersTransport:   s.ServersTransport,
+		Sticky:             s.Sticky,
+		ResponseForwarding: s.ResponseForwarding,
+		HealthCheck:        s.HealthCheck,
+	}}
+	return name, nil
+}
+
+// serviceAddress returns the address of a Kubernetes Service port, named
+// ports being resolved by the Services of the manifests.
+func (t *crdTranslator) serviceAddress(namespace string, s crdService) (string, error) {
+	if s.Name == "" {
+		return "", fmt.Errorf("service without name")
+	}
+	spec, known := t.services[crdName(namespace, s.Name)]
+	port := string(s.Port)
+	if _, err := strconv.Atoi(port); err != nil {
+		resolved := ""
+		for _, p := range spec.Ports {
+			if p.Name == port {
+				resolved = strconv.Itoa(p.Port)
+			}
+		}
+		if resolved == "" {
+			return "", fmt.Errorf("cannot resolve port %q of service %s/%s", port, namespace, s.Name)
+		}
+		port = resolved
+	}
+
+	host := s.Name + "." + namespace + ".svc"
+	if known && spec.Type == "ExternalName" && spec.ExternalName != "" {
+		host = spec.ExternalName
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func refNamespace(namespace, fallback string) string {
+	if namespace == "" {
+		return fallback
+	}
+	return namespace
+}
@@ -0,0 +1,213 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func decodeCRDs(t *testing.T, body string) *dynamic.Configuration {
+	t.Helper()
+
+	data, err := crdToJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config dynamic.Configuration
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return &config
+}
+
+const ingressRouteManifests = `apiVersion: traefik.io/v1alpha1
+kind: IngressRoute
+metadata:
+  name: whoami
+  namespace: apps
+spec:
+  entryPoints:
+    - websecure
+  routes:
+    - match: Host(` + "`whoami.example.com`" + `)
+      priority: 10
+      middlewares:
+        - name: secured
+        - name: auth@file
+      services:
+        - name: whoami
+          port: http
+    - match: PathPrefix(` + "`/canary`" + `)
+      services:
+        - name: whoami
+          port: 443
+          weight: 9
+        - name: canary
+          namespace: staging
+          kind: TraefikService
+          weight: 1
+  tls:
+    certResolver: le
+    options:
+      name: modern
+---
+apiVersion: traefik.io/v1alpha1
+kind: Middleware
+metadata:
+  name: secured
+  namespace: apps
+spec:
+  chain:
+    middlewares:
+      - name: headers
+      - name: ratelimit
+        namespace: shared
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  name: headers
+  namespace: apps
+spec:
+  headers:
+    customRequestHeaders:
+      X-Env: prod
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: whoami
+  namespace: apps
+spec:
+  ports:
+    - name: http
+      port: 8080
+---
+apiVersion: traefik.io/v1alpha1
+kind: TLSOption
+metadata:
+  name: modern
+  namespace: apps
+spec:
+  minVersion: VersionTLS13
+`
+
+func TestCRDIngressRoute(t *testing.T) {
+	config := decodeCRDs(t, ingressRouteManifests)
+
+	router := config.HTTP.Routers["apps-whoami-0"]
+	if router == nil {
+		t.Fatalf("expected router apps-whoami-0, got %v", routerNames(config))
+	}
+	if router.Rule != "Host(`whoami.example.com`)" || router.Priority != 10 || router.Service != "apps-whoami-http" {
+		t.Errorf("unexpected router %+v", router)
+	}
+	if !reflect.DeepEqual(router.EntryPoints, []string{"websecure"}) {
+		t.Errorf("unexpected entrypoints %v", router.EntryPoints)
+	}
+	if !reflect.DeepEqual(router.Middlewares, []string{"apps-secured", "auth@file"}) {
+		t.Errorf("unexpected middlewares %v", router.Middlewares)
+	}
+	if router.TLS == nil || router.TLS.CertResolver != "le" || router.TLS.Options != "apps-modern" {
+		t.Errorf("unexpected tls %+v", router.TLS)
+	}
+
+	servers := config.HTTP.Services["apps-whoami-http"].LoadBalancer.Servers
+	if !reflect.DeepEqual(servers, []dynamic.Server{{URL: "http://whoami.apps.svc:8080"}}) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+	servers = config.HTTP.Services["apps-whoami-443"].LoadBalancer.Servers
+	if !reflect.DeepEqual(servers, []dynamic.Server{{URL: "https://whoami.apps.svc:443"}}) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+
+	// several services are balanced by a weighted service named after the
+	// router
+	canary := config.HTTP.Routers["apps-whoami-1"]
+	if canary == nil || canary.Service != "apps-whoami-1" {
+		t.Fatalf("unexpected router %+v", canary)
+	}
+	weighted := config.HTTP.Services["apps-whoami-1"].Weighted
+	if weighted == nil || len(weighted.Services) != 2 ||
+		weighted.Services[0].Name != "apps-whoami-443" || *weighted.Services[0].Weight != 9 ||
+		weighted.Services[1].Name != "staging-canary" || *weighted.Services[1].Weight != 1 {
+		t.Errorf("unexpected weighted service %+v", weighted)
+	}
+
+	chain := config.HTTP.Middlewares["apps-secured"].Chain
+	if chain == nil || !reflect.DeepEqual(chain.Middlewares, []string{"apps-headers", "shared-ratelimit"}) {
+		t.Errorf("unexpected chain %+v", chain)
+	}
+	if h := config.HTTP.Middlewares["apps-headers"].Headers; h == nil || h.CustomRequestHeaders["X-Env"] != "prod" {
+		t.Errorf("unexpected headers %+v", h)
+	}
+	if options, ok := config.TLS.Options["apps-modern"]; !ok || options.MinVersion != "VersionTLS13" {
+		t.Errorf("unexpected tls options %v", config.TLS.Options)
+	}
+}
+
+func TestCRDList(t *testing.T) {
+	config := decodeCRDs(t, `{"apiVersion":"v1","kind":"List","items":[
+		{"kind":"IngressRouteTCP","metadata":{"name":"db"},
+		 "spec":{"entryPoints":["postgres"],"routes":[{"match":"HostSNI(`+"`*`"+`)","services":[{"name":"db","port":5432}]}],"tls":{"passthrough":true}}},
+		{"kind":"Service","metadata":{"name":"db"},"spec":{"type":"ExternalName","externalName":"db.example.com"}},
+		{"kind":"TraefikService","metadata":{"name":"mirror","namespace":"apps"},
+		 "spec":{"mirroring":{"name":"app","port":80,"mirrors":[{"name":"shadow","port":80,"percent":10}]}}},
+		{"kind":"Middleware","metadata":{"name":"errors","namespace":"apps"},
+		 "spec":{"errors":{"status":["500-599"],"query":"/{status}.html","service":{"name":"pages","port":80}}}}
+	]}`)
+
+	router := config.TCP.Routers["default-db-0"]
+	if router == nil || router.Service != "default-db-5432" || router.TLS == nil || !router.TLS.Passthrough {
+		t.Fatalf("unexpected tcp router %+v", router)
+	}
+	if servers := config.TCP.Services["default-db-5432"].LoadBalancer.Servers; len(servers) != 1 || servers[0].Address != "db.example.com:5432" {
+		t.Errorf("unexpected tcp servers %v", servers)
+	}
+
+	mirroring := config.HTTP.Services["apps-mirror"].Mirroring
+	if mirroring == nil || mirroring.Service != "apps-app-80" || len(mirroring.Mirrors) != 1 ||
+		mirroring.Mirrors[0] != (dynamic.MirrorService{Name: "apps-shadow-80", Percent: 10}) {
+		t.Errorf("unexpected mirroring %+v", mirroring)
+	}
+	errors := config.HTTP.Middlewares["apps-errors"].Errors
+	if errors == nil || errors.Service != "apps-pages-80" || errors.Query != "/{status}.html" {
+		t.Errorf("unexpected errors middleware %+v", errors)
+	}
+	if _, ok := config.HTTP.Services["apps-pages-80"]; !ok {
+		t.Error("expected the error pages service")
+	}
+}
+
+func TestCRDErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		body string
+	}{
+		{desc: "unresolved port", body: `{"kind":"IngressRoute","metadata":{"name":"a"},"spec":{"routes":[{"match":"Path(` + "`/`" + `)","services":[{"name":"a","port":"http"}]}]}}`},
+		{desc: "no service", body: `{"kind":"IngressRoute","metadata":{"name":"a"},"spec":{"routes":[{"match":"Path(` + "`/`" + `)"}]}}`},
+		{desc: "unsupported kind", body: `{"kind":"IngressRoute","metadata":{"name":"a"},"spec":{"routes":[{"services":[{"name":"a","kind":"Pod"}]}]}}`},
+		{desc: "empty traefik service", body: `{"kind":"TraefikService","metadata":{"name":"a"},"spec":{}}`},
+		{desc: "invalid middleware", body: `{"kind":"Middleware","metadata":{"name":"a"},"spec":{"headers":"x"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := crdToJSON([]byte(test.body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseCRDFormat(t *testing.T) {
+	p := &Provider{entrypoints: map[string]bool{"websecure": true}}
+	config := p.parseConfig(endpoint{format: formatCRD}, "application/yaml", []byte(ingressRouteManifests))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if _, ok := config.HTTP.Routers["apps-whoami-0"]; !ok {
+		t.Errorf("expected router apps-whoami-0, got %v", routerNames(config))
+	}
+}
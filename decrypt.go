@@ -0,0 +1,59 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+)
+
+// Decryption the shared AES key decrypting the configurations of an endpoint.
+type Decryption struct {
+	Key     string `json:"key,omitempty"`
+	KeyFile string `json:"keyFile,omitempty"`
+}
+
+// newDecrypter loads the base64 encoded 128, 192 or 256 bit AES key of config.
+func newDecrypter(config *Decryption, vault *vaultClient) (cipher.AEAD, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Key != "" && config.KeyFile != "" {
+		return nil, fmt.Errorf("key and keyFile are mutually exclusive")
+	}
+	encoded, err := secretValue(context.Background(), vault, config.Key, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("a key or keyFile is required")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptPayload decrypts an AES-GCM payload, the nonce followed by the
+// ciphertext and its tag, sent as is or base64 encoded.
+func decryptPayload(aead cipher.AEAD, body []byte) ([]byte, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(body))); err == nil {
+		body = decoded
+	}
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted payload too short")
+	}
+	nonce, ciphertext := body[:aead.NonceSize()], body[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
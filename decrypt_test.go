@@ -0,0 +1,106 @@
+package multi_http_provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encryptPayload(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+func TestDecryptPayload(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_KEY", base64.StdEncoding.EncodeToString(key))
+	aead, err := newDecrypter(&Decryption{Key: "${CONFIG_KEY}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte(`{"http":{}}`)
+	encrypted := encryptPayload(t, key, plaintext)
+	for _, body := range [][]byte{encrypted, []byte(base64.StdEncoding.EncodeToString(encrypted) + "\n")} {
+		actual, err := decryptPayload(aead, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != string(plaintext) {
+			t.Errorf("expected %s, got %s", plaintext, actual)
+		}
+	}
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := decryptPayload(aead, tampered); err == nil {
+		t.Error("expected an error for a tampered payload")
+	}
+	if _, err := decryptPayload(aead, plaintext); err == nil {
+		t.Error("expected an error for a plaintext payload")
+	}
+}
+
+func TestParseEncryptedConfig(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newDecrypter(&Decryption{KeyFile: keyFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yaml := "http:\n  routers:\n    app:\n      entryPoints: [web]\n      service: app\n      rule: Host(`app`)\n" +
+		"  services:\n    app:\n      loadBalancer:\n        servers:\n        - url: http://10.0.0.1\n"
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	e := endpoint{decrypter: aead, format: formatYAML}
+	config := p.parseConfig(e, "application/octet-stream", encryptPayload(t, key, []byte(yaml)))
+	if config == nil || config.HTTP.Services["app"] == nil {
+		t.Fatalf("expected the decrypted configuration, got %+v", config)
+	}
+}
+
+func TestNewDecrypterErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config *Decryption
+	}{
+		{desc: "no key", config: &Decryption{}},
+		{desc: "key and file", config: &Decryption{Key: "a", KeyFile: "/b"}},
+		{desc: "invalid base64", config: &Decryption{Key: "not base64!"}},
+		{desc: "invalid key size", config: &Decryption{Key: base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{desc: "missing file", config: &Decryption{KeyFile: "/nonexistent"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := newDecrypter(test.config, nil); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
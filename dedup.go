@@ -0,0 +1,81 @@
+package multi_http_provider
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// dedupMiddlewares collapses the HTTP middlewares with the same configuration
+// into the first of them by name, rewriting the router and chain references to
+// the others. Routers and middlewares are copied before being rewritten, the
+// node configurations sharing them.
+func dedupMiddlewares(config *dynamic.Configuration) {
+	if config == nil || config.HTTP == nil {
+		return
+	}
+	// chains become identical once their middlewares are collapsed
+	for dedupMiddlewaresOnce(config.HTTP) {
+	}
+}
+
+func dedupMiddlewaresOnce(http *dynamic.HTTPConfiguration) bool {
+
+	names := make([]string, 0, len(http.Middlewares))
+	for name := range http.Middlewares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonical := map[[sha256.Size]byte]string{}
+	renamed := map[string]string{}
+	for _, name := range names {
+		data, err := json.Marshal(http.Middlewares[name])
+		if err != nil {
+			continue
+		}
+		hash := sha256.Sum256(data)
+		if first, ok := canonical[hash]; ok {
+			renamed[name] = first
+			continue
+		}
+		canonical[hash] = name
+	}
+	if len(renamed) == 0 {
+		return false
+	}
+
+	rewrite := func(refs []string) ([]string, bool) {
+		changed := false
+		rewritten := make([]string, len(refs))
+		for i, ref := range refs {
+			if name, ok := renamed[ref]; ok {
+				ref, changed = name, true
+			}
+			rewritten[i] = ref
+		}
+		return rewritten, changed
+	}
+	for name := range renamed {
+		delete(http.Middlewares, name)
+	}
+	for name, r := range http.Routers {
+		if refs, ok := rewrite(r.Middlewares); ok {
+			c := *r
+			c.Middlewares = refs
+			http.Routers[name] = &c
+		}
+	}
+	for name, m := range http.Middlewares {
+		if m.Chain == nil {
+			continue
+		}
+		if refs, ok := rewrite(m.Chain.Middlewares); ok {
+			c := *m
+			c.Chain = &dynamic.Chain{Middlewares: refs}
+			http.Middlewares[name] = &c
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func stripPrefix(prefix string) *dynamic.Middleware {
+	return &dynamic.Middleware{StripPrefix: &dynamic.StripPrefix{Prefixes: []string{prefix}}}
+}
+
+func TestDedupMiddlewares(t *testing.T) {
+	node1 := httpConfig(
+		map[string]*dynamic.Router{"a": {Service: "s", Middlewares: []string{"strip-a", "chain-a"}}},
+		map[string]*dynamic.Service{},
+	)
+	node1.HTTP.Middlewares = map[string]*dynamic.Middleware{
+		"strip-a": stripPrefix("/api"),
+		"chain-a": {Chain: &dynamic.Chain{Middlewares: []string{"strip-a"}}},
+	}
+	node2 := httpConfig(
+		map[string]*dynamic.Router{"b": {Service: "s", Middlewares: []string{"strip-b", "chain-b", "other"}}},
+		map[string]*dynamic.Service{},
+	)
+	node2.HTTP.Middlewares = map[string]*dynamic.Middleware{
+		"strip-b": stripPrefix("/api"),
+		"chain-b": {Chain: &dynamic.Chain{Middlewares: []string{"strip-b"}}},
+		"other":   stripPrefix("/other"),
+	}
+	configs := map[string]*dynamic.Configuration{"node1": node1, "node2": node2}
+
+	config, _, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins, dedup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var middlewares []string
+	for name := range config.HTTP.Middlewares {
+		middlewares = append(middlewares, name)
+	}
+	if len(config.HTTP.Middlewares) != 3 || config.HTTP.Middlewares["strip-b"] != nil || config.HTTP.Middlewares["chain-b"] != nil {
+		t.Fatalf("expected chain-a, other and strip-a, got %v", middlewares)
+	}
+	if refs := config.HTTP.Routers["b"].Middlewares; !reflect.DeepEqual(refs, []string{"strip-a", "chain-a", "other"}) {
+		t.Errorf("unexpected router references %v", refs)
+	}
+	if refs := node2.HTTP.Routers["b"].Middlewares; !reflect.DeepEqual(refs, []string{"strip-b", "chain-b", "other"}) {
+		t.Errorf("expected the node configuration to be unchanged, got %v", refs)
+	}
+	if refs := node2.HTTP.Middlewares["chain-b"].Chain.Middlewares; refs[0] != "strip-b" {
+		t.Errorf("expected the node chain to be unchanged, got %v", refs)
+	}
+
+	config, _, _ = mergeConfig(configs, mergeOptions{policy: conflictFirstWins})
+	if len(config.HTTP.Middlewares) != 5 {
+		t.Errorf("expected the middlewares to be kept without dedup, got %d", len(config.HTTP.Middlewares))
+	}
+}
@@ -0,0 +1,165 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Discovery discovers a set of endpoints instead of listing them. Discovered
+// endpoints are configured like Template, their address and port being
+// discovered, and published as <discovery name>/<instance>.
+type Discovery struct {
+	Interval   string             `json:"interval,omitempty"`
+	Template   Endpoint           `json:"template,omitempty"`
+	SRV        string             `json:"srv,omitempty"`
+	Docker     *DockerDiscovery   `json:"docker,omitempty"`
+	Consul     *ConsulCatalog     `json:"consul,omitempty"`
+	Kubernetes *KubernetesService `json:"kubernetes,omitempty"`
+	MDNS       *MDNSDiscovery     `json:"mdns,omitempty"`
+}
+
+// discoverer lists the endpoints currently found, keyed by instance name.
+type discoverer interface {
+	discover(ctx context.Context) (map[string]Endpoint, error)
+}
+
+type discovery struct {
+	interval   time.Duration
+	prefix     string
+	discoverer discoverer
+}
+
+// discovered carries the endpoints found by a discovery.
+type discovered struct {
+	name      string
+	endpoints map[string]endpoint
+}
+
+func (p *Provider) newDiscovery(name string, d Discovery) (*discovery, error) {
+	interval := p.pollInterval
+	if d.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(d.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var discoverers []discoverer
+	if d.SRV != "" {
+		discoverers = append(discoverers, &srvDiscovery{name: d.SRV, template: d.Template, lookup: lookupSRV})
+	}
+	if d.Docker != nil {
+		docker, err := p.newDockerDiscovery(d.Docker, d.Template)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, docker)
+	}
+	if d.Consul != nil {
+		consul, err := p.newConsulCatalogDiscovery(d.Consul, d.Template)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, consul)
+	}
+	if d.Kubernetes != nil {
+		kubernetes, err := p.newKubernetesServiceDiscovery(d.Kubernetes, d.Template)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, kubernetes)
+	}
+	if d.MDNS != nil {
+		mdns, err := newMDNSDiscovery(d.MDNS, d.Template)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, mdns)
+	}
+	if len(discoverers) != 1 {
+		return nil, fmt.Errorf("exactly one discovery source must be set")
+	}
+	return &discovery{interval: interval, prefix: name + "/", discoverer: discoverers[0]}, nil
+}
+
+// runDiscovery refreshes the endpoints of a discovery every interval and
+// reports them when they change. A failed refresh keeps the endpoints previously
+// found, and endpoints are only rebuilt when their settings change.
+func (p *Provider) runDiscovery(ctx context.Context, name string, d *discovery, found chan<- discovered) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("Recovered from a panic of the discovery", "discovery", name, "error", err)
+		}
+	}()
+
+	// the specs of the endpoints found, and of the instances ignored
+	var specs, ignored map[string]Endpoint
+	var endpoints map[string]endpoint
+	for {
+		instances, err := d.discoverer.discover(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("Error discovering endpoints", "discovery", name, "error", err)
+		} else {
+			changed := specs == nil
+			nextSpecs, nextIgnored := map[string]Endpoint{}, map[string]Endpoint{}
+			nextEndpoints := map[string]endpoint{}
+			for instance, v := range instances {
+				node := d.prefix + instance
+				// an instance ignored is only reported again when it changes
+				if previous, ok := ignored[node]; ok && reflect.DeepEqual(previous, v) {
+					nextIgnored[node] = v
+					continue
+				}
+				if _, ok := p.endpoints[node]; ok {
+					logger.Warn("Ignoring a discovered endpoint already configured", "node", node)
+					nextIgnored[node] = v
+					continue
+				}
+				if e, ok := endpoints[node]; ok && reflect.DeepEqual(specs[node], v) {
+					nextSpecs[node], nextEndpoints[node] = v, e
+					continue
+				}
+				e, err := p.newEndpoint(v)
+				if err == nil {
+					err = p.validateEndpoint(e)
+				}
+				if err != nil {
+					logger.Warn("Ignoring a discovered endpoint", "node", node, "error", err)
+					nextIgnored[node] = v
+					continue
+				}
+				changed = true
+				nextSpecs[node], nextEndpoints[node] = v, e
+			}
+			// the endpoints kept are unchanged, the ones gone shrink the set
+			changed = changed || len(nextSpecs) != len(specs)
+			specs, ignored, endpoints = nextSpecs, nextIgnored, nextEndpoints
+
+			if changed {
+				select {
+				case found <- discovered{name: name, endpoints: endpoints}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		select {
+		case <-time.After(d.interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// isSubNode reports whether name is node or one of the sub-nodes it watches.
+func isSubNode(name, node string) bool {
+	return name == node || strings.HasPrefix(name, node+"/")
+}
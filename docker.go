@@ -0,0 +1,142 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const dockerLabelPrefix = "multi-http-provider."
+
+// DockerDiscovery discovers the running containers carrying a label through
+// the Docker API. The multi-http-provider.port, .path, .scheme and .network
+// labels of a container override the discovery template.
+type DockerDiscovery struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+type dockerContainer struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+type dockerDiscovery struct {
+	url      string
+	label    string
+	template Endpoint
+	client   *http.Client
+	maxBytes int
+}
+
+func (p *Provider) newDockerDiscovery(d *DockerDiscovery, template Endpoint) (*dockerDiscovery, error) {
+	host := d.Endpoint
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	client, err := p.newClient(Endpoint{Endpoint: host}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	base := host
+	switch {
+	case unixSocket(host) != "":
+		base = "http://localhost"
+	case strings.HasPrefix(host, "tcp://"):
+		base = "http://" + strings.TrimPrefix(host, "tcp://")
+	case strings.HasPrefix(host, "http://"), strings.HasPrefix(host, "https://"):
+	default:
+		return nil, fmt.Errorf("unsupported docker endpoint %q", host)
+	}
+
+	label := d.Label
+	if label == "" {
+		label = dockerLabelPrefix + "enable=true"
+	}
+	return &dockerDiscovery{url: strings.TrimSuffix(base, "/"), label: label, template: template, client: client, maxBytes: p.maxResponseBytes}, nil
+}
+
+func (d *dockerDiscovery) discover(ctx context.Context) (map[string]Endpoint, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {d.label}, "status": {"running"}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url+"/containers/json?filters="+url.QueryEscape(string(filters)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(newStreamLimiter(resp.Body, d.maxBytes)).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("decoding containers: %w", err)
+	}
+
+	endpoints := map[string]Endpoint{}
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		address := containerAddress(c)
+		if address == "" {
+			continue
+		}
+
+		e := d.template
+		e.Endpoint = address
+		if port, ok := c.Labels[dockerLabelPrefix+"port"]; ok {
+			e.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("container %s: invalid port %q", name, port)
+			}
+		}
+		if path, ok := c.Labels[dockerLabelPrefix+"path"]; ok {
+			e.Path = path
+		}
+		if scheme, ok := c.Labels[dockerLabelPrefix+"scheme"]; ok {
+			e.Scheme = scheme
+		}
+		endpoints[name] = e
+	}
+	return endpoints, nil
+}
+
+// containerAddress returns the container IP on the network set by its
+// multi-http-provider.network label, or on the first network by name.
+func containerAddress(c dockerContainer) string {
+	networks := c.NetworkSettings.Networks
+	if network, ok := c.Labels[dockerLabelPrefix+"network"]; ok {
+		return networks[network].IPAddress
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestDockerDiscover(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			t.Error(err)
+		}
+		if fmt.Sprint(filters["label"]) != "[multi-http-provider.enable=true]" {
+			t.Errorf("unexpected label filter %v", filters["label"])
+		}
+		fmt.Fprint(w, `[
+			{"Id":"1","Names":["/node1"],"Labels":{},"NetworkSettings":{"Networks":{"z":{"IPAddress":"10.0.0.9"},"a":{"IPAddress":"172.17.0.2"}}}},
+			{"Id":"2","Names":["/node2"],"Labels":{"multi-http-provider.port":"8080","multi-http-provider.path":"/config","multi-http-provider.network":"z"},
+			 "NetworkSettings":{"Networks":{"a":{"IPAddress":"172.17.0.3"},"z":{"IPAddress":"10.0.0.3"}}}},
+			{"Id":"3","Names":["/detached"],"Labels":{},"NetworkSettings":{"Networks":{}}}
+		]`)
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	p := &Provider{}
+	d, err := p.newDockerDiscovery(&DockerDiscovery{Endpoint: "unix://" + socket}, Endpoint{Port: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := d.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"node1": "http://172.17.0.2:5000/traefik/config",
+		"node2": "http://10.0.0.3:8080/config",
+	}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("expected %d endpoints, got %v", len(expected), endpoints)
+	}
+	for name, u := range expected {
+		if actual := endpointURL(endpoints[name]); actual != u {
+			t.Errorf("%s: expected %s, got %s", name, u, actual)
+		}
+	}
+}
+
+func TestDockerDiscoveryEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+		wantErr  bool
+	}{
+		{endpoint: "", expected: "http://localhost"},
+		{endpoint: "tcp://docker:2375", expected: "http://docker:2375"},
+		{endpoint: "https://docker:2376/", expected: "https://docker:2376"},
+		{endpoint: "ssh://docker", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			d, err := (&Provider{}).newDockerDiscovery(&DockerDiscovery{Endpoint: test.endpoint}, Endpoint{})
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.url != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, d.url)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// endpointsFile reads the endpoint map of the endpointsFile option, a JSON,
+// YAML or TOML file read again whenever its modification time or size changes.
+type endpointsFile struct {
+	path      string
+	modTime   time.Time
+	size      int64
+	endpoints map[string]Endpoint
+}
+
+func (f *endpointsFile) discover(context.Context) (map[string]Endpoint, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.endpoints != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.endpoints, nil
+	}
+
+	body, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		body, err = yamlToJSON(body)
+	case ".toml":
+		body, err = tomlToJSON(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	endpoints := map[string]Endpoint{}
+	if err := json.Unmarshal(body, &endpoints); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", f.path, err)
+	}
+
+	f.modTime, f.size, f.endpoints = info.ModTime(), info.Size(), endpoints
+	return endpoints, nil
+}
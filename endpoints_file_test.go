@@ -0,0 +1,76 @@
+package multi_http_provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEndpointsFileReload(t *testing.T) {
+	first := sseServer(t, "data: "+routerConfig("first", "web")+"\n\n")
+	second := sseServer(t, "data: "+routerConfig("second", "web")+"\n\n")
+
+	file := filepath.Join(t.TempDir(), "endpoints.yml")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("node1:\n  endpoint: "+first.URL+"\n  mode: sse\n", time.Now())
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.EntryPoints = []string{"web"}
+	config.EndpointsFile = file
+	cfgChan := startProviderConfig(t, config)
+
+	cfg := receiveConfig(t, cfgChan)
+	if _, ok := cfg.HTTP.Routers["first"]; !ok {
+		t.Fatalf("expected router first, got %v", routerNames(cfg))
+	}
+
+	write(`{"node2": {"endpoint": "`+second.URL+`", "mode": "sse"}}`, time.Now().Add(time.Minute))
+	for {
+		cfg := receiveConfig(t, cfgChan)
+		_, hasFirst := cfg.HTTP.Routers["first"]
+		_, hasSecond := cfg.HTTP.Routers["second"]
+		if hasSecond && !hasFirst {
+			return
+		}
+	}
+}
+
+func TestEndpointsFileDiscover(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "endpoints.json")
+	f := &endpointsFile{path: file}
+	if _, err := f.discover(t.Context()); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	if err := os.WriteFile(file, []byte(`{"node": {"endpoint": "10.0.1.2", "port": 8080}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := f.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpointURL(endpoints["node"]) != "http://10.0.1.2:8080/traefik/config" {
+		t.Errorf("unexpected endpoints %v", endpoints)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"node": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.discover(t.Context()); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
@@ -0,0 +1,172 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func isEtcdURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "etcd://")
+}
+
+// etcdURL maps etcd://host:port/key endpoints to the base URL of the etcd v3
+// JSON gateway, the key being kept as the path.
+func etcdURL(e Endpoint) string {
+	scheme := "http"
+	if e.Scheme == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + strings.TrimPrefix(e.Endpoint, "etcd://")
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdKV struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	KVs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header          etcdHeader `json:"header"`
+		Created         bool       `json:"created"`
+		Canceled        bool       `json:"canceled"`
+		CompactRevision string     `json:"compact_revision"`
+		CancelReason    string     `json:"cancel_reason"`
+		Events          []struct {
+			Type string `json:"type"`
+			KV   etcdKV `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// etcdWatch reads a key through the etcd v3 JSON gateway, then watches it
+// from the read revision so no change is missed. A deleted key removes the
+// node.
+type etcdWatch struct {
+	backoff *backoff
+}
+
+func (w *etcdWatch) reconnect(bool) time.Duration {
+	return w.backoff.next()
+}
+
+func (w *etcdWatch) watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error) {
+	base, key := etcdKey(e.url)
+	encodedKey := base64.StdEncoding.EncodeToString([]byte(key))
+
+	var rangeResp etcdRangeResponse
+	resp, err := etcdPost(ctx, e, base+"/v3/kv/range", map[string]interface{}{"key": encodedKey})
+	if err != nil {
+		return false, err
+	}
+	err = json.NewDecoder(newStreamLimiter(resp.Body, e.maxBytes)).Decode(&rangeResp)
+	resp.Body.Close()
+	if err != nil {
+		return false, fmt.Errorf("decoding range response: %w", err)
+	}
+	w.backoff.reset()
+
+	if len(rangeResp.KVs) == 0 {
+		emit("", "", nil)
+	} else {
+		value, err := base64.StdEncoding.DecodeString(rangeResp.KVs[0].Value)
+		if err != nil {
+			return true, err
+		}
+		emit("", "", value)
+	}
+
+	revision, _ := strconv.ParseInt(rangeResp.Header.Revision, 10, 64)
+	resp, err = etcdPost(ctx, e, base+"/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            encodedKey,
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	limiter := newStreamLimiter(resp.Body, e.maxBytes)
+	decoder := json.NewDecoder(limiter)
+	for {
+		limiter.reset()
+		var watchResp etcdWatchResponse
+		if err := decoder.Decode(&watchResp); err != nil {
+			if err == io.EOF {
+				return true, fmt.Errorf("watch ended")
+			}
+			return true, err
+		}
+		if watchResp.Error != nil {
+			return true, fmt.Errorf("watch error: %s", watchResp.Error.Message)
+		}
+		if watchResp.Result.Canceled {
+			return true, fmt.Errorf("watch canceled: %s", watchResp.Result.CancelReason)
+		}
+		for _, event := range watchResp.Result.Events {
+			if event.Type == "DELETE" {
+				emit("", "", nil)
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(event.KV.Value)
+			if err != nil {
+				return true, err
+			}
+			emit("", "", value)
+		}
+	}
+}
+
+// etcdKey splits an etcd URL into the gateway base URL and the watched key.
+func etcdKey(raw string) (string, string) {
+	scheme, rest, _ := strings.Cut(raw, "://")
+	host, key, _ := strings.Cut(rest, "/")
+	return scheme + "://" + host, "/" + key
+}
+
+func etcdPost(ctx context.Context, e endpoint, url string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,62 @@
+package multi_http_provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEtcdWatch(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+			return
+		}
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			if body["key"] != b64("/traefik/nodes/edge") {
+				t.Errorf("unexpected key %v", body["key"])
+			}
+			fmt.Fprintf(w, `{"header":{"revision":"41"},"kvs":[{"key":%q,"value":%q,"mod_revision":"40"}]}`,
+				b64("/traefik/nodes/edge"), b64(routerConfig("first", "web")))
+		case "/v3/watch":
+			create := body["create_request"].(map[string]interface{})
+			if create["start_revision"] != "42" {
+				t.Errorf("expected watch from revision 42, got %v", create["start_revision"])
+			}
+			fmt.Fprint(w, `{"result":{"header":{"revision":"41"},"created":true}}`+"\n")
+			fmt.Fprintf(w, `{"result":{"header":{"revision":"42"},"events":[{"kv":{"key":%q,"value":%q,"mod_revision":"42"}}]}}`+"\n",
+				b64("/traefik/nodes/edge"), b64(routerConfig("second", "web")))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"edge": {Endpoint: strings.Replace(srv.URL, "http://", "etcd://", 1) + "/traefik/nodes/edge"},
+	})
+
+	for _, router := range []string{"first", "second"} {
+		config := receiveConfig(t, cfgChan)
+		if _, ok := config.HTTP.Routers[router]; !ok {
+			t.Fatalf("expected router %s, got %v", router, routerNames(config))
+		}
+	}
+}
+
+func TestEtcdKey(t *testing.T) {
+	base, key := etcdKey(etcdURL(Endpoint{Endpoint: "etcd://etcd:2379/traefik/nodes/edge", Scheme: "https"}))
+	if base != "https://etcd:2379" || key != "/traefik/nodes/edge" {
+		t.Errorf("unexpected base %s and key %s", base, key)
+	}
+}
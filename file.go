@@ -0,0 +1,61 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// fileCheckInterval is how often watched files are checked for changes.
+const fileCheckInterval = time.Second
+
+func isFileURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "file://")
+}
+
+// fileWatcher reads the configuration of file:// endpoints, read again
+// whenever the file modification time or size changes. Files are checked
+// periodically, as plugins cannot rely on inotify.
+type fileWatcher struct {
+	path     string
+	interval time.Duration
+	backoff  *backoff
+}
+
+func (f *fileWatcher) reconnect(bool) time.Duration {
+	return f.backoff.next()
+}
+
+func (f *fileWatcher) watch(ctx context.Context, e endpoint, handle emitFunc) (bool, error) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	var modTime time.Time
+	var size int64 = -1
+	for {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return false, err
+		}
+		if limit := bodyLimit(e.maxBytes); info.Size() > int64(limit) {
+			return false, fmt.Errorf("file exceeds %d bytes, see maxResponseBytes", limit)
+		}
+		if !info.ModTime().Equal(modTime) || info.Size() != size {
+			body, err := os.ReadFile(f.path)
+			if err != nil {
+				return false, err
+			}
+			f.backoff.reset()
+			modTime, size = info.ModTime(), info.Size()
+			handle("", "", body)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
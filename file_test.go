@@ -0,0 +1,44 @@
+package multi_http_provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileEndpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "node.json")
+	if err := os.WriteFile(file, []byte(routerConfig("first", "web")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: "file://" + file},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["first"]; !ok {
+		t.Fatalf("expected router first, got %v", routerNames(config))
+	}
+
+	if err := os.WriteFile(file, []byte(routerConfig("second-router", "web")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config = receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["second-router"]; !ok {
+		t.Fatalf("expected router second-router, got %v", routerNames(config))
+	}
+}
+
+func TestFileWatcherMissingFile(t *testing.T) {
+	f := &fileWatcher{
+		path:     filepath.Join(t.TempDir(), "missing.json"),
+		interval: time.Millisecond,
+		backoff:  newBackoff(time.Second, time.Minute),
+	}
+	connected, err := f.watch(t.Context(), endpoint{}, func(string, string, []byte) {})
+	if connected || err == nil {
+		t.Fatalf("expected a missing file error, got connected=%t err=%v", connected, err)
+	}
+}
@@ -0,0 +1,107 @@
+package multi_http_provider
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Flapping detects the endpoints whose configuration changes Changes times
+// within Window, freezing their last stable configuration for Quarantine, if
+// set.
+type Flapping struct {
+	Changes    int    `json:"changes,omitempty"`
+	Window     string `json:"window,omitempty"`
+	Quarantine string `json:"quarantine,omitempty"`
+}
+
+type flapDetector struct {
+	changes            int
+	window, quarantine time.Duration
+	nodes              map[string]*flapState
+}
+
+type flapState struct {
+	hash    string
+	changes []time.Time
+	// the last configuration fetched twice in a row
+	stable      update
+	frozenUntil time.Time
+}
+
+func newFlapDetector(config *Flapping) (*flapDetector, error) {
+	if config == nil {
+		return nil, nil
+	}
+	d := &flapDetector{changes: config.Changes, window: 5 * time.Minute, nodes: map[string]*flapState{}}
+	if d.changes == 0 {
+		d.changes = 5
+	}
+	if d.changes < 2 {
+		return nil, fmt.Errorf("changes must be at least 2")
+	}
+	var err error
+	if config.Window != "" {
+		if d.window, err = time.ParseDuration(config.Window); err != nil {
+			return nil, fmt.Errorf("window: %w", err)
+		}
+	}
+	if config.Quarantine != "" {
+		if d.quarantine, err = time.ParseDuration(config.Quarantine); err != nil {
+			return nil, fmt.Errorf("quarantine: %w", err)
+		}
+	}
+	if d.window <= 0 || d.quarantine < 0 {
+		return nil, fmt.Errorf("window must be greater than 0 and quarantine positive")
+	}
+	return d, nil
+}
+
+// observe records the update of a node, returning the one to apply: the last
+// stable configuration while the node is quarantined.
+func (d *flapDetector) observe(u update, now time.Time) update {
+	if d == nil {
+		return u
+	}
+	b, _ := json.Marshal([]interface{}{u.config, u.parts})
+	hash := fmt.Sprintf("%x", sha256.Sum256(b))
+
+	s := d.nodes[u.node]
+	if s == nil {
+		s = &flapState{hash: hash, stable: u}
+		d.nodes[u.node] = s
+		return u
+	}
+	if hash == s.hash {
+		s.stable = u
+	} else {
+		s.hash = hash
+		s.changes = append(s.changes, now)
+	}
+	for len(s.changes) > 0 && now.Sub(s.changes[0]) > d.window {
+		s.changes = s.changes[1:]
+	}
+
+	if now.Before(s.frozenUntil) {
+		return s.stable
+	}
+	if len(s.changes) < d.changes {
+		return u
+	}
+	s.changes = nil
+	if d.quarantine == 0 {
+		logger.Warn("The configuration is flapping", "node", u.node)
+		return u
+	}
+	logger.Warn("The configuration is flapping, freezing its last stable one", "node", u.node, "quarantine", d.quarantine)
+	s.frozenUntil = now.Add(d.quarantine)
+	return s.stable
+}
+
+// forget drops the state of a stopped node.
+func (d *flapDetector) forget(node string) {
+	if d != nil {
+		delete(d.nodes, node)
+	}
+}
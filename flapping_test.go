@@ -0,0 +1,66 @@
+package multi_http_provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestFlapDetector(t *testing.T) {
+	d, err := newFlapDetector(&Flapping{Changes: 3, Window: "1m", Quarantine: "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := func(v string) update {
+		return update{node: "node", config: httpConfig(map[string]*dynamic.Router{v: {Service: v}}, nil)}
+	}
+	now := time.Now()
+	observe := func(v string) string {
+		now = now.Add(10 * time.Second)
+		names := routerNames(d.observe(version(v), now).config)
+		if len(names) != 1 {
+			t.Fatalf("unexpected routers %v", names)
+		}
+		return names[0]
+	}
+
+	observe("v1")
+	observe("v1")
+	if v := observe("v2"); v != "v2" {
+		t.Errorf("expected a single change to be applied, got %s", v)
+	}
+	observe("v3")
+	// the third change within the window freezes the stable v1
+	if v := observe("v4"); v != "v1" {
+		t.Errorf("expected the stable configuration, got %s", v)
+	}
+	if v := observe("v5"); v != "v1" {
+		t.Errorf("expected the node to stay quarantined, got %s", v)
+	}
+	now = now.Add(5 * time.Minute)
+	if v := observe("v5"); v != "v5" {
+		t.Errorf("expected the configuration once the quarantine is over, got %s", v)
+	}
+
+	// changes out of the window do not add up
+	now = now.Add(time.Hour)
+	for _, v := range []string{"v6", "v7"} {
+		now = now.Add(time.Minute)
+		observe(v)
+	}
+	if v := observe("v8"); v != "v8" {
+		t.Errorf("expected the spread changes to be applied, got %s", v)
+	}
+}
+
+func TestNewFlapDetector(t *testing.T) {
+	if d, err := newFlapDetector(nil); d != nil || err != nil {
+		t.Errorf("expected no detector, got %v, %v", d, err)
+	}
+	for _, config := range []*Flapping{{Changes: 1}, {Window: "often"}, {Quarantine: "-1m"}} {
+		if _, err := newFlapDetector(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
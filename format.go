@@ -0,0 +1,107 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+const (
+	formatJSON   = "json"
+	formatYAML   = "yaml"
+	formatTOML   = "toml"
+	formatNDJSON = "ndjson"
+)
+
+// contentFormat returns the format of a Content-Type, empty when unknown.
+func contentFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/x-ndjson" || mediaType == "application/ndjson" ||
+		mediaType == "application/jsonl" || mediaType == "application/x-jsonlines":
+		return formatNDJSON
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return formatJSON
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" ||
+		mediaType == "text/yaml" || mediaType == "text/x-yaml":
+		return formatYAML
+	case mediaType == "application/toml" || mediaType == "text/toml":
+		return formatTOML
+	default:
+		return ""
+	}
+}
+
+var formatMediaTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatYAML:   "application/yaml",
+	formatTOML:   "application/toml",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// accept returns the Accept header of requests to the endpoint, preferring
+// its format. Formats without a media type of their own are served as JSON.
+func (e endpoint) accept() string {
+	preferred := e.format
+	if _, ok := formatMediaTypes[preferred]; !ok {
+		preferred = formatJSON
+	}
+	accept := formatMediaTypes[preferred]
+	for _, format := range []string{formatJSON, formatYAML, formatTOML, formatNDJSON} {
+		if format != preferred {
+			accept += ", " + formatMediaTypes[format] + ";q=0.9"
+		}
+	}
+	return accept
+}
+
+// bodyFormat returns the format of a body received from the endpoint: the one
+// of its Content-Type, the endpoint format, or the one of the file extension
+// of file and S3 objects, JSON by default.
+func (e endpoint) bodyFormat(contentType string) string {
+	if e.format == formatDocker || e.format == formatCRD {
+		// container labels are served as JSON, manifests as JSON or YAML
+		return e.format
+	}
+	if format := contentFormat(contentType); format != "" {
+		return format
+	}
+	if e.format != "" {
+		return e.format
+	}
+	if isFileURL(e.url) || e.source != nil {
+		switch strings.ToLower(path.Ext(e.url)) {
+		case ".yaml", ".yml":
+			return formatYAML
+		case ".toml":
+			return formatTOML
+		case ".ndjson", ".jsonl":
+			return formatNDJSON
+		}
+	}
+	return formatJSON
+}
+
+// toJSON converts a body in format to JSON.
+func toJSON(format string, body []byte) ([]byte, error) {
+	switch format {
+	case formatJSON:
+		return body, nil
+	case formatYAML:
+		return yamlToJSON(body)
+	case formatTOML:
+		return tomlToJSON(body)
+	case formatNDJSON:
+		return ndjsonToJSON(body)
+	case formatDocker:
+		return dockerLabelsToJSON(body)
+	case formatCRD:
+		return crdToJSON(body)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
@@ -0,0 +1,146 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const yamlRouterConfig = `http:
+  routers:
+    yaml:
+      entryPoints: [web]
+      rule: PathPrefix(` + "`/yaml`" + `)
+      service: svc-yaml
+  services:
+    svc-yaml:
+      loadBalancer:
+        servers:
+          - url: http://10.0.0.1
+`
+
+func TestContentFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		{contentType: "application/json", expected: formatJSON},
+		{contentType: "application/vnd.traefik+json; charset=utf-8", expected: formatJSON},
+		{contentType: "application/yaml", expected: formatYAML},
+		{contentType: "text/x-yaml; charset=utf-8", expected: formatYAML},
+		{contentType: "application/toml", expected: formatTOML},
+		{contentType: "application/x-ndjson", expected: formatNDJSON},
+		{contentType: "text/plain", expected: ""},
+		{contentType: "", expected: ""},
+	}
+	for _, test := range tests {
+		if actual := contentFormat(test.contentType); actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.contentType, test.expected, actual)
+		}
+	}
+}
+
+func TestBodyFormat(t *testing.T) {
+	tests := []struct {
+		desc        string
+		endpoint    endpoint
+		contentType string
+		expected    string
+	}{
+		{desc: "default", endpoint: endpoint{url: "http://10.0.1.2/config.yaml"}, expected: formatJSON},
+		{desc: "content type", endpoint: endpoint{}, contentType: "application/yaml", expected: formatYAML},
+		{desc: "content type over format", endpoint: endpoint{format: formatYAML}, contentType: "application/json", expected: formatJSON},
+		{desc: "format", endpoint: endpoint{format: formatYAML}, contentType: "text/plain", expected: formatYAML},
+		{desc: "file extension", endpoint: endpoint{url: "file:///etc/traefik/node.yml"}, expected: formatYAML},
+		{desc: "toml file extension", endpoint: endpoint{url: "file:///etc/traefik/node.toml"}, expected: formatTOML},
+		{desc: "ndjson file extension", endpoint: endpoint{url: "file:///etc/traefik/node.jsonl"}, expected: formatNDJSON},
+		{desc: "object extension", endpoint: endpoint{url: "https://bucket.s3.amazonaws.com/node.yaml", source: &s3Source{}}, expected: formatYAML},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if actual := test.endpoint.bodyFormat(test.contentType); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseYAMLConfig(t *testing.T) {
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+
+	for _, e := range []struct {
+		endpoint    endpoint
+		contentType string
+	}{
+		{endpoint: endpoint{}, contentType: "application/yaml"},
+		{endpoint: endpoint{format: formatYAML}},
+	} {
+		config := p.parseConfig(e.endpoint, e.contentType, []byte(yamlRouterConfig))
+		if config == nil {
+			t.Fatal("expected a configuration")
+		}
+		if _, ok := config.HTTP.Routers["yaml"]; !ok {
+			t.Errorf("expected router yaml, got %v", routerNames(config))
+		}
+	}
+
+	if config := p.parseConfig(endpoint{}, "application/yaml", []byte("http:\n\trouters: {}\n")); config != nil {
+		t.Error("expected invalid YAML to be rejected")
+	}
+}
+
+func TestParseTOMLConfig(t *testing.T) {
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	body := `[http.routers.toml]
+  entryPoints = ["web"]
+  rule = "PathPrefix(` + "`/toml`" + `)"
+  service = "svc-toml"
+[[http.services.svc-toml.loadBalancer.servers]]
+  url = "http://10.0.0.1"
+`
+	config := p.parseConfig(endpoint{}, "application/toml", []byte(body))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if servers := config.HTTP.Services["svc-toml"].LoadBalancer.Servers; len(servers) != 1 {
+		t.Errorf("expected 1 server, got %v", servers)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	if accept := (endpoint{}).accept(); accept != "application/json, application/yaml;q=0.9, application/toml;q=0.9, application/x-ndjson;q=0.9" {
+		t.Errorf("unexpected default Accept %q", accept)
+	}
+	if accept := (endpoint{format: formatTOML}).accept(); accept != "application/toml, application/json;q=0.9, application/yaml;q=0.9, application/x-ndjson;q=0.9" {
+		t.Errorf("unexpected toml Accept %q", accept)
+	}
+}
+
+func TestFetchConfigNegotiatesFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Accept"), "application/yaml,") {
+			t.Errorf("unexpected Accept %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, routerConfig("json", "web"))
+	}))
+	defer srv.Close()
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	e := endpoint{url: srv.URL, client: srv.Client(), format: formatYAML}
+	body, contentType, err := p.fetchConfig(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the JSON response is decoded as such despite the yaml default
+	config := p.parseConfig(e, contentType, body)
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if _, ok := config.HTTP.Routers["json"]; !ok {
+		t.Errorf("expected router json, got %v", routerNames(config))
+	}
+}
@@ -0,0 +1,193 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// grpcWatchMethod is the path of the WatchConfiguration streaming method
+// described in configuration.proto.
+const grpcWatchMethod = "/multihttpprovider.v1.ConfigurationService/WatchConfiguration"
+
+func isGRPCURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "grpc://") || strings.HasPrefix(endpoint, "grpcs://")
+}
+
+// grpcURL maps grpc:// and grpcs:// endpoints to the HTTP/2 URL of the watch
+// method.
+func grpcURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	u.Scheme = "http" + strings.TrimPrefix(u.Scheme, "grpc")
+	u.Path = grpcWatchMethod
+	u.RawQuery = ""
+	return u.String()
+}
+
+// grpcStream maintains a WatchConfiguration stream on an endpoint, every
+// ConfigurationUpdate message carrying a complete configuration. Requests are
+// encoded by hand, the messages holding a field or two, to keep the plugin
+// free of generated code. Dropped streams are reopened with an exponential
+// backoff.
+type grpcStream struct {
+	node    string
+	backoff *backoff
+}
+
+func (s *grpcStream) reconnect(connected bool) time.Duration {
+	if connected {
+		s.backoff.reset()
+	}
+	return s.backoff.next()
+}
+
+func (s *grpcStream) watch(ctx context.Context, e endpoint, handle emitFunc) (bool, error) {
+	// WatchRequest{node = 1}
+	var request bytes.Buffer
+	request.Write(protoField(1, []byte(s.node)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(grpcFrame(request.Bytes())))
+	if err != nil {
+		return false, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := grpcStatus(resp.Header); err != nil {
+		return false, err
+	}
+
+	for {
+		message, err := readGRPCFrame(resp.Body, bodyLimit(e.maxBytes))
+		if err == io.EOF {
+			if err := grpcStatus(resp.Trailer); err != nil {
+				return true, err
+			}
+			return true, fmt.Errorf("stream ended")
+		}
+		if err != nil {
+			return true, err
+		}
+
+		// ConfigurationUpdate{configuration = 1, content_type = 2}
+		configuration, err := protoBytesField(message, 1)
+		if err != nil {
+			return true, err
+		}
+		contentType, err := protoBytesField(message, 2)
+		if err != nil {
+			return true, err
+		}
+		handle("", string(contentType), configuration)
+	}
+}
+
+func grpcStatus(header http.Header) error {
+	status := header.Get("Grpc-Status")
+	if status == "" || status == "0" {
+		return nil
+	}
+	message, _ := url.PathUnescape(header.Get("Grpc-Message"))
+	return fmt.Errorf("grpc status %s: %s", status, message)
+}
+
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// readGRPCFrame reads a message, rejecting those larger than limit bytes.
+func readGRPCFrame(r io.Reader, limit int) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated message")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if uint64(length) > uint64(limit) {
+		return nil, fmt.Errorf("message exceeds %d bytes, see maxResponseBytes", limit)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("truncated message")
+	}
+	return message, nil
+}
+
+// protoField encodes a length-delimited protobuf field.
+func protoField(number int, value []byte) []byte {
+	field := binary.AppendUvarint(nil, uint64(number)<<3|2)
+	field = binary.AppendUvarint(field, uint64(len(value)))
+	return append(field, value...)
+}
+
+// protoBytesField returns the last occurrence of a length-delimited field,
+// skipping every other field.
+func protoBytesField(message []byte, number int) ([]byte, error) {
+	var value []byte
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		message = message[n:]
+
+		var size uint64
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(message)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint")
+			}
+			size = uint64(n)
+		case 1:
+			size = 8
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return nil, fmt.Errorf("invalid length")
+			}
+			message = message[n:]
+			size = length
+			if int(key>>3) == number {
+				value = message[:length]
+			}
+		case 5:
+			size = 4
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		if uint64(len(message)) < size {
+			return nil, fmt.Errorf("truncated field")
+		}
+		message = message[size:]
+	}
+	return value, nil
+}
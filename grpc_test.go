@@ -0,0 +1,110 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func grpcServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGRPCWatchConfiguration(t *testing.T) {
+	srv := grpcServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcWatchMethod || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		request, err := readGRPCFrame(r.Body, maxDecodedBody)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if node, _ := protoBytesField(request, 1); string(node) != "edge" {
+			t.Errorf("expected node edge, got %q", node)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		for _, router := range []string{"first", "second"} {
+			// unknown fields must be skipped
+			var message bytes.Buffer
+			message.Write([]byte{0x18, 0x96, 0x01})
+			message.Write(protoField(1, []byte(routerConfig(router, "web"))))
+			_, _ = w.Write(grpcFrame(message.Bytes()))
+			w.(http.Flusher).Flush()
+		}
+		// a YAML configuration is read by its content_type
+		message := append(protoField(1, []byte(yamlRouterConfig)), protoField(2, []byte("application/yaml"))...)
+		_, _ = w.Write(grpcFrame(message))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"edge": {Endpoint: strings.Replace(srv.URL, "http://", "grpc://", 1)},
+	})
+
+	for _, router := range []string{"first", "second", "yaml"} {
+		config := receiveConfig(t, cfgChan)
+		if _, ok := config.HTTP.Routers[router]; !ok {
+			t.Fatalf("expected router %s, got %v", router, routerNames(config))
+		}
+	}
+}
+
+func TestGRPCStatusError(t *testing.T) {
+	srv := grpcServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "7")
+		w.Header().Set("Grpc-Message", "permission%20denied")
+	})
+
+	client, err := newClient(Endpoint{Endpoint: strings.Replace(srv.URL, "http://", "grpc://", 1)}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &grpcStream{node: "edge", backoff: newBackoff(0, 0)}
+	connected, err := s.watch(t.Context(), endpoint{url: grpcURL(strings.Replace(srv.URL, "http://", "grpc://", 1)), client: client}, func(string, string, []byte) {})
+	if connected || err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected a permission denied error, got connected=%t err=%v", connected, err)
+	}
+}
+
+func TestGRPCURL(t *testing.T) {
+	tests := map[string]string{
+		"grpc://10.0.0.1:9000":              "http://10.0.0.1:9000" + grpcWatchMethod,
+		"grpcs://config.internal:443/other": "https://config.internal:443" + grpcWatchMethod,
+	}
+	for endpoint, expected := range tests {
+		if actual := grpcURL(endpoint); actual != expected {
+			t.Errorf("%s: expected %s, got %s", endpoint, expected, actual)
+		}
+	}
+}
+
+func TestProtoBytesField(t *testing.T) {
+	message := append([]byte{0x08, 0x01, 0x15, 1, 2, 3, 4}, protoField(1, []byte("value"))...)
+	value, err := protoBytesField(message, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "value" {
+		t.Errorf("expected value, got %q", value)
+	}
+
+	if _, err := protoBytesField([]byte{0x0a, 0x10, 'a'}, 1); err == nil {
+		t.Error("expected an error on a truncated field")
+	}
+}
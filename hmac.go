@@ -0,0 +1,60 @@
+package multi_http_provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSignatureHeader = "X-Signature"
+	defaultTimestampHeader = "X-Signature-Timestamp"
+)
+
+// HMAC the shared secret signing endpoint requests.
+type HMAC struct {
+	Secret          string `json:"secret,omitempty"`
+	SecretFile      string `json:"secretFile,omitempty"`
+	Header          string `json:"header,omitempty"`
+	TimestampHeader string `json:"timestampHeader,omitempty"`
+}
+
+func (h *HMAC) validate() error {
+	if h.Secret == "" && h.SecretFile == "" {
+		return fmt.Errorf("hmac requires a secret or secretFile")
+	}
+	if h.Secret != "" && h.SecretFile != "" {
+		return fmt.Errorf("hmac secret and secretFile are mutually exclusive")
+	}
+	return nil
+}
+
+// sign sets the signature headers of req: the Unix timestamp of the request
+// and the hex encoded HMAC-SHA256 of "<timestamp>\n<method>\n<path and query>".
+func (h *HMAC) sign(req *http.Request, now time.Time, vault *vaultClient) error {
+	secret, err := secretValue(req.Context(), vault, h.Secret, h.SecretFile)
+	if err != nil {
+		return fmt.Errorf("hmac secret: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(headerOrDefault(h.TimestampHeader, defaultTimestampHeader), timestamp)
+	req.Header.Set(headerOrDefault(h.Header, defaultSignatureHeader), hmacSignature(secret, timestamp, req.Method, req.URL.RequestURI()))
+	return nil
+}
+
+func hmacSignature(secret, timestamp, method, uri string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + uri))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headerOrDefault(header, fallback string) string {
+	if header == "" {
+		return fallback
+	}
+	return header
+}
@@ -0,0 +1,77 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHMACSign(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://config.internal/traefik/config?node=edge", nil)
+	h := &HMAC{Secret: "shared"}
+	if err := h.sign(req, time.Unix(1700000000, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if ts := req.Header.Get("X-Signature-Timestamp"); ts != "1700000000" {
+		t.Errorf("unexpected timestamp %q", ts)
+	}
+	expected := "cadbe3dad91afe9bdf51161817ab6b79ae0352d4a67792a425ad0b4fc4c6b18b"
+	if signature := req.Header.Get("X-Signature"); signature != expected {
+		t.Errorf("expected signature %s, got %s", expected, signature)
+	}
+
+	h = &HMAC{Secret: "shared", Header: "X-Provider-Signature", TimestampHeader: "X-Provider-Time"}
+	if err := h.sign(req, time.Unix(1700000000, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("X-Provider-Signature") != expected || req.Header.Get("X-Provider-Time") != "1700000000" {
+		t.Errorf("expected the custom headers, got %v", req.Header)
+	}
+}
+
+func TestHMACSignedPoll(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status = http.StatusUnauthorized
+		timestamp := r.Header.Get("X-Signature-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(seconds, 0)) > 5*time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Signature") != hmacSignature("shared", timestamp, r.Method, r.URL.RequestURI()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			return
+		}
+		status = http.StatusOK
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	e := endpoint{url: srv.URL + "/traefik?node=edge", client: srv.Client(), auth: &Auth{BearerToken: "token", HMAC: &HMAC{Secret: "shared"}}}
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil || status != http.StatusOK {
+		t.Fatalf("expected the signed request to be accepted, got %d: %v", status, err)
+	}
+	e.auth.HMAC.Secret = "other"
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("expected a request signed with another secret to be rejected, got %d: %v", status, err)
+	}
+}
+
+func TestHMACValidate(t *testing.T) {
+	if err := (&Auth{HMAC: &HMAC{}}).validate(); err == nil {
+		t.Error("expected an error without secret")
+	}
+	if err := (&Auth{HMAC: &HMAC{Secret: "a", SecretFile: "/b"}}).validate(); err == nil {
+		t.Error("expected secret and secretFile to conflict")
+	}
+	if err := (&Auth{BearerToken: "a", HMAC: &HMAC{SecretFile: "/b"}}).validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
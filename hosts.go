@@ -0,0 +1,138 @@
+package multi_http_provider
+
+import (
+	"strings"
+)
+
+// ruleNode a node of a parsed router rule: a matcher, or a negation,
+// conjunction or disjunction of nodes.
+type ruleNode struct {
+	op       string // matcher, !, && or ||
+	name     string
+	args     []string
+	children []*ruleNode
+}
+
+// parseRule parses a router rule into its matchers and operators.
+func parseRule(rule string) (*ruleNode, bool) {
+	p := &ruleParser{rule: rule}
+	node, ok := p.parseOr()
+	if !ok || skipSpaces(rule, p.i) != len(rule) {
+		return nil, false
+	}
+	return node, true
+}
+
+type ruleParser struct {
+	rule string
+	i    int
+}
+
+func (p *ruleParser) consume(token string) bool {
+	p.i = skipSpaces(p.rule, p.i)
+	if strings.HasPrefix(p.rule[p.i:], token) {
+		p.i += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) parseBinary(op string, operand func() (*ruleNode, bool)) (*ruleNode, bool) {
+	node, ok := operand()
+	if !ok {
+		return nil, false
+	}
+	for p.consume(op) {
+		right, ok := operand()
+		if !ok {
+			return nil, false
+		}
+		node = &ruleNode{op: op, children: []*ruleNode{node, right}}
+	}
+	return node, true
+}
+
+func (p *ruleParser) parseOr() (*ruleNode, bool) {
+	return p.parseBinary("||", p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (*ruleNode, bool) {
+	return p.parseBinary("&&", p.parseFactor)
+}
+
+func (p *ruleParser) parseFactor() (*ruleNode, bool) {
+	if p.consume("!") {
+		child, ok := p.parseFactor()
+		if !ok {
+			return nil, false
+		}
+		return &ruleNode{op: "!", children: []*ruleNode{child}}, true
+	}
+	if p.consume("(") {
+		node, ok := p.parseOr()
+		if !ok || !p.consume(")") {
+			return nil, false
+		}
+		return node, true
+	}
+	start := p.i
+	for p.i < len(p.rule) && isMatcherChar(p.rule[p.i]) {
+		p.i++
+	}
+	if p.i == start {
+		return nil, false
+	}
+	name := p.rule[start:p.i]
+	args, end, ok := parseMatcherArgs(p.rule, p.i)
+	if !ok {
+		return nil, false
+	}
+	p.i = end
+	return &ruleNode{op: "matcher", name: name, args: args}, true
+}
+
+// hostsWithin reports whether a rule only matches hosts of domains, through
+// its matcher of hosts, Host for HTTP rules and HostSNI for TCP ones. Rules
+// not restricted by such a matcher, or that do not parse, match any host.
+func hostsWithin(rule, matcher string, domains []string) bool {
+	node, ok := parseRule(rule)
+	return ok && node.hostsWithin(matcher, domains)
+}
+
+func (n *ruleNode) hostsWithin(matcher string, domains []string) bool {
+	switch n.op {
+	case "&&":
+		return n.children[0].hostsWithin(matcher, domains) || n.children[1].hostsWithin(matcher, domains)
+	case "||":
+		return n.children[0].hostsWithin(matcher, domains) && n.children[1].hostsWithin(matcher, domains)
+	case "matcher":
+		if n.name != matcher || len(n.args) == 0 {
+			return false
+		}
+		for _, host := range n.args {
+			if !domainAllowed(host, domains) {
+				return false
+			}
+		}
+		return true
+	default:
+		// negations match every other host
+		return false
+	}
+}
+
+// domainAllowed reports whether host is one of domains, a *.example.com
+// domain allowing the subdomains of example.com.
+func domainAllowed(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		if host == domain {
+			return true
+		}
+		if strings.HasPrefix(domain, "*.") && strings.HasSuffix(host, domain[1:]) && !strings.HasPrefix(host, "*") {
+			return true
+		}
+	}
+	return false
+}
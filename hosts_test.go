@@ -0,0 +1,40 @@
+package multi_http_provider
+
+import (
+	"testing"
+)
+
+func TestHostsWithin(t *testing.T) {
+	domains := []string{"a.example.com", "*.apps.example.com"}
+	tests := []struct {
+		rule     string
+		expected bool
+	}{
+		{rule: "Host(`a.example.com`)", expected: true},
+		{rule: "Host(`A.example.com`) && PathPrefix(`/api`)", expected: true},
+		{rule: "Host(`x.apps.example.com`, `a.example.com`)", expected: true},
+		{rule: "(Host(`a.example.com`) || Host(`y.apps.example.com`)) && Method(`GET`)", expected: true},
+		{rule: "PathPrefix(`/api`) && Host(`a.example.com`)", expected: true},
+		{rule: "Host(`b.example.com`)"},
+		{rule: "Host(`a.example.com`, `b.example.com`)"},
+		{rule: "Host(`apps.example.com`)"},
+		{rule: "Host(`a.example.com`) || PathPrefix(`/`)"},
+		{rule: "!Host(`a.example.com`)"},
+		{rule: "HostRegexp(`.+`)"},
+		{rule: "PathPrefix(`/`)"},
+		{rule: "Host(`a.example.com`"},
+		{rule: ""},
+	}
+	for _, test := range tests {
+		if actual := hostsWithin(test.rule, "Host", domains); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.rule, test.expected, actual)
+		}
+	}
+
+	if !hostsWithin("HostSNI(`db.apps.example.com`)", "HostSNI", domains) {
+		t.Error("expected the tcp host to be allowed")
+	}
+	if hostsWithin("HostSNI(`*`)", "HostSNI", domains) {
+		t.Error("expected the catch-all tcp rule to be denied")
+	}
+}
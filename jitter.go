@@ -0,0 +1,31 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseJitter parses a percentage of the poll interval, such as 20%, into a
+// fraction.
+func parseJitter(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if !strings.HasSuffix(s, "%") || err != nil || percent < 0 || percent >= 100 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return percent / 100, nil
+}
+
+// jittered returns interval moved randomly by up to jitter of it, either way.
+func jittered(interval time.Duration, jitter float64) time.Duration {
+	if jitter == 0 {
+		return interval
+	}
+	return interval + time.Duration(jitter*(2*rand.Float64()-1)*float64(interval))
+}
@@ -0,0 +1,49 @@
+package multi_http_provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJitter(t *testing.T) {
+	tests := []struct {
+		value   string
+		jitter  float64
+		wantErr bool
+	}{
+		{value: "", jitter: 0},
+		{value: "20%", jitter: 0.2},
+		{value: " 5.5% ", jitter: 0.055},
+		{value: "20", wantErr: true},
+		{value: "100%", wantErr: true},
+		{value: "-1%", wantErr: true},
+		{value: "a%", wantErr: true},
+	}
+	for _, test := range tests {
+		jitter, err := parseJitter(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+			continue
+		}
+		if jitter != test.jitter {
+			t.Errorf("%q: expected %v, got %v", test.value, test.jitter, jitter)
+		}
+	}
+}
+
+func TestJittered(t *testing.T) {
+	if d := jittered(10*time.Second, 0); d != 10*time.Second {
+		t.Errorf("expected no jitter, got %s", d)
+	}
+	spread := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := jittered(10*time.Second, 0.2)
+		if d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("expected within 20%% of 10s, got %s", d)
+		}
+		spread[d] = true
+	}
+	if len(spread) < 2 {
+		t.Error("expected the delays to vary")
+	}
+}
@@ -0,0 +1,270 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jqFilter a jq-style filter: a pipeline of paths, such as .data.config,
+// .items[] or .[0], and del(path) stages removing what a path selects.
+type jqFilter []jqStage
+
+type jqStage struct {
+	del  bool
+	path []jqStep
+}
+
+// jqStep a path step: a field, an index, or every element when iterate.
+type jqStep struct {
+	field   string
+	index   int
+	isIndex bool
+	iterate bool
+}
+
+func parseJQFilter(expr string) (jqFilter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	var filter jqFilter
+	for _, s := range splitPipes(expr) {
+		s = strings.TrimSpace(s)
+		stage := jqStage{}
+		if strings.HasPrefix(s, "del(") && strings.HasSuffix(s, ")") {
+			stage.del = true
+			s = strings.TrimSpace(s[len("del(") : len(s)-1])
+		}
+		path, err := parseJQPath(s)
+		if err != nil {
+			return nil, err
+		}
+		if stage.del && len(path) == 0 {
+			return nil, fmt.Errorf("del requires a path")
+		}
+		stage.path = path
+		filter = append(filter, stage)
+	}
+	return filter, nil
+}
+
+// splitPipes splits expr on the pipes out of quotes.
+func splitPipes(expr string) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '|' && !quoted:
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseJQPath(s string) ([]jqStep, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("invalid path %q, paths start with .", s)
+	}
+	var steps []jqStep
+	i := 0
+	for i < len(s) {
+		switch {
+		case s[i] == '.' && i+1 < len(s) && s[i+1] == '"':
+			field, end, err := parseJQString(s, i+1)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, jqStep{field: field})
+			i = end
+		case s[i] == '.':
+			j := i + 1
+			for j < len(s) && (isMatcherChar(s[j]) || s[j] == '_' || s[j] == '-') {
+				j++
+			}
+			if j > i+1 {
+				steps = append(steps, jqStep{field: s[i+1 : j]})
+			} else if j < len(s) && s[j] != '[' {
+				return nil, fmt.Errorf("invalid path %q at %d", s, i)
+			}
+			i = j
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q, unclosed [", s)
+			}
+			inner := strings.TrimSpace(s[i+1 : i+end])
+			switch {
+			case inner == "":
+				steps = append(steps, jqStep{iterate: true})
+			case inner[0] == '"':
+				field, _, err := parseJQString(inner, 0)
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, jqStep{field: field})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q", inner)
+				}
+				steps = append(steps, jqStep{index: n, isIndex: true})
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("invalid path %q at %d", s, i)
+		}
+	}
+	return steps, nil
+}
+
+// parseJQString parses the quoted string at i, returning it with the position
+// after the closing quote.
+func parseJQString(s string, i int) (string, int, error) {
+	end := i + 1
+	for end < len(s) && s[end] != '"' {
+		if s[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(s) {
+		return "", 0, fmt.Errorf("unterminated string in %q", s)
+	}
+	field, err := strconv.Unquote(s[i : end+1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid string in %q: %w", s, err)
+	}
+	return field, end + 1, nil
+}
+
+// apply runs the filter on a JSON document. Several results are returned as
+// an array, published as sub-nodes.
+func (f jqFilter) apply(body []byte) ([]byte, error) {
+	if len(f) == 0 {
+		return body, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	values := []interface{}{v}
+	for _, stage := range f {
+		var next []interface{}
+		for _, v := range values {
+			if stage.del {
+				next = append(next, jqDelete(v, stage.path))
+				continue
+			}
+			selected, err := jqSelect(v, stage.path)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		values = next
+	}
+	if len(values) == 1 {
+		return json.Marshal(values[0])
+	}
+	return json.Marshal(values)
+}
+
+func jqSelect(v interface{}, path []jqStep) ([]interface{}, error) {
+	if len(path) == 0 {
+		return []interface{}{v}, nil
+	}
+	step, rest := path[0], path[1:]
+	if v == nil && !step.iterate {
+		return jqSelect(nil, rest)
+	}
+	switch {
+	case step.iterate:
+		var children []interface{}
+		switch t := v.(type) {
+		case []interface{}:
+			children = t
+		case map[string]interface{}:
+			for _, k := range sortedKeys(reflect.ValueOf(t)) {
+				children = append(children, t[k])
+			}
+		default:
+			return nil, fmt.Errorf("cannot iterate over %T", v)
+		}
+		var result []interface{}
+		for _, c := range children {
+			selected, err := jqSelect(c, rest)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, selected...)
+		}
+		return result, nil
+	case step.isIndex:
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %T with a number", v)
+		}
+		i := step.index
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 || i >= len(a) {
+			return jqSelect(nil, rest)
+		}
+		return jqSelect(a[i], rest)
+	default:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %T with %q", v, step.field)
+		}
+		return jqSelect(m[step.field], rest)
+	}
+}
+
+// jqDelete removes from v what path selects, returning the updated value.
+func jqDelete(v interface{}, path []jqStep) interface{} {
+	step, rest := path[0], path[1:]
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(reflect.ValueOf(t)) {
+			if !step.iterate && (step.isIndex || k != step.field) {
+				continue
+			}
+			if len(rest) == 0 {
+				delete(t, k)
+			} else {
+				t[k] = jqDelete(t[k], rest)
+			}
+		}
+	case []interface{}:
+		var kept []interface{}
+		for i, c := range t {
+			index := step.index
+			if index < 0 {
+				index += len(t)
+			}
+			if !step.iterate && (!step.isIndex || i != index) {
+				kept = append(kept, c)
+				continue
+			}
+			if len(rest) > 0 {
+				kept = append(kept, jqDelete(c, rest))
+			}
+		}
+		if kept == nil {
+			kept = []interface{}{}
+		}
+		return kept
+	}
+	return v
+}
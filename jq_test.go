@@ -0,0 +1,70 @@
+package multi_http_provider
+
+import (
+	"testing"
+)
+
+func TestJQFilter(t *testing.T) {
+	body := `{"metadata":{"version":3},"data":{"config":{"http":{"routers":{"a":{"priority":12345678901234567}}}},` +
+		`"items":[{"name":"x","config":{"tcp":{}}},{"name":"y","config":{"udp":{}}}],"my key":{"v":1}}}`
+
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{filter: ".", expected: `{"data":{"config":{"http":{"routers":{"a":{"priority":12345678901234567}}}},"items":[{"config":{"tcp":{}},"name":"x"},{"config":{"udp":{}},"name":"y"}],"my key":{"v":1}},"metadata":{"version":3}}`},
+		{filter: ".data.config", expected: `{"http":{"routers":{"a":{"priority":12345678901234567}}}}`},
+		{filter: `.data | ."my key"`, expected: `{"v":1}`},
+		{filter: `.data["my key"].v`, expected: `1`},
+		{filter: ".data.items[].config", expected: `[{"tcp":{}},{"udp":{}}]`},
+		{filter: ".data.items[-1].name", expected: `"y"`},
+		{filter: ".data.missing.field", expected: `null`},
+		{filter: "del(.data) | del(.metadata.version)", expected: `{"metadata":{}}`},
+		{filter: "del(.data.items[].name) | .data.items", expected: `[{"config":{"tcp":{}}},{"config":{"udp":{}}}]`},
+		{filter: "del(.data.items[0]) | .data.items[].name", expected: `"y"`},
+	}
+	for _, test := range tests {
+		f, err := parseJQFilter(test.filter)
+		if err != nil {
+			t.Fatalf("%s: %s", test.filter, err)
+		}
+		actual, err := f.apply([]byte(body))
+		if err != nil {
+			t.Fatalf("%s: %s", test.filter, err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.filter, test.expected, actual)
+		}
+	}
+}
+
+func TestJQFilterErrors(t *testing.T) {
+	for _, filter := range []string{"data", ".a[", ".a[x]", `."open`, "del(.)", ".a.!"} {
+		if _, err := parseJQFilter(filter); err == nil {
+			t.Errorf("%s: expected a parse error", filter)
+		}
+	}
+	f, err := parseJQFilter(".a[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.apply([]byte(`{"a":{"b":1}}`)); err == nil {
+		t.Error("expected an error indexing an object with a number")
+	}
+}
+
+func TestParseUpdateFilter(t *testing.T) {
+	filter, err := parseJQFilter(".result.nodes[]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"status":"ok","result":{"nodes":[` + routerConfig("a", "web") + `,` + routerConfig("b", "web") + `]}}`
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	u := p.parseUpdate("node", endpoint{filter: filter}, "", []byte(body))
+	if len(u.parts) != 2 || u.parts[0] == nil || u.parts[1] == nil {
+		t.Fatalf("expected two parts, got %+v", u)
+	}
+	if u.parts[1].HTTP.Routers["b"] == nil {
+		t.Errorf("unexpected routers %v", routerNames(u.parts[1]))
+	}
+}
@@ -0,0 +1,226 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// JWS the public keys verifying the signature of endpoints serving JWS-wrapped
+// configurations. Unsigned responses are rejected.
+type JWS struct {
+	PublicKeys []string `json:"publicKeys,omitempty"`
+}
+
+type jwsVerifier struct {
+	keys []crypto.PublicKey
+}
+
+// newJWSVerifier loads the PEM encoded public keys or certificates of the
+// files of config.
+func newJWSVerifier(config *JWS) (*jwsVerifier, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if len(config.PublicKeys) == 0 {
+		return nil, fmt.Errorf("jws requires publicKeys")
+	}
+	v := &jwsVerifier{}
+	for _, file := range config.PublicKeys {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := parsePublicKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		v.keys = append(v.keys, keys...)
+	}
+	return v, nil
+}
+
+func parsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public key found")
+	}
+	return keys, nil
+}
+
+type jwsSignature struct {
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+// verify checks the signature of a JWS in the compact or the JSON
+// serialization, returning its payload with the media type of its cty header.
+// A JSON JWS with several signatures is accepted when any of them verifies.
+func (v *jwsVerifier) verify(body []byte) ([]byte, string, error) {
+	body = bytes.TrimSpace(body)
+	var payload string
+	var signatures []jwsSignature
+	if len(body) > 0 && body[0] == '{' {
+		var object struct {
+			Payload    string         `json:"payload"`
+			Signatures []jwsSignature `json:"signatures"`
+			jwsSignature
+		}
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, "", fmt.Errorf("invalid jws: %w", err)
+		}
+		payload, signatures = object.Payload, object.Signatures
+		if object.Signature != "" {
+			signatures = append(signatures, object.jwsSignature)
+		}
+	} else {
+		parts := strings.Split(string(body), ".")
+		if len(parts) != 3 {
+			return nil, "", fmt.Errorf("invalid jws: expected 3 parts, got %d", len(parts))
+		}
+		payload = parts[1]
+		signatures = []jwsSignature{{Protected: parts[0], Signature: parts[2]}}
+	}
+	if len(signatures) == 0 {
+		return nil, "", fmt.Errorf("jws without signature")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid jws payload: %w", err)
+	}
+	for _, s := range signatures {
+		var contentType string
+		contentType, err = v.verifySignature(s, payload)
+		if err == nil {
+			return decoded, contentType, nil
+		}
+	}
+	return nil, "", err
+}
+
+func (v *jwsVerifier) verifySignature(s jwsSignature, payload string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s.Protected)
+	if err != nil {
+		return "", fmt.Errorf("invalid jws header: %w", err)
+	}
+	var header struct {
+		Alg  string          `json:"alg"`
+		Cty  string          `json:"cty"`
+		Crit []string        `json:"crit"`
+		B64  json.RawMessage `json:"b64"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", fmt.Errorf("invalid jws header: %w", err)
+	}
+	if len(header.Crit) > 0 || header.B64 != nil {
+		return "", fmt.Errorf("unsupported jws header extensions")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return "", fmt.Errorf("invalid jws signature: %w", err)
+	}
+
+	input := []byte(s.Protected + "." + payload)
+	for _, key := range v.keys {
+		ok, err := verifyJWSAlgorithm(header.Alg, key, input, signature)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			contentType := header.Cty
+			if contentType != "" && !strings.Contains(contentType, "/") {
+				contentType = "application/" + contentType
+			}
+			return contentType, nil
+		}
+	}
+	return "", fmt.Errorf("jws signature does not match any public key")
+}
+
+// verifyJWSAlgorithm verifies signature with key when key suits alg.
+func verifyJWSAlgorithm(alg string, key crypto.PublicKey, input, signature []byte) (bool, error) {
+	var hash crypto.Hash
+	var digest []byte
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+		sum := sha256.Sum256(input)
+		digest = sum[:]
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+		sum := sha512.Sum384(input)
+		digest = sum[:]
+	case strings.HasSuffix(alg, "512"):
+		hash = crypto.SHA512
+		sum := sha512.Sum512(input)
+		digest = sum[:]
+	}
+
+	switch alg {
+	case "RS256", "RS384", "RS512":
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil, nil
+	case "PS256", "PS384", "PS512":
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(k, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil, nil
+	case "ES256", "ES384", "ES512":
+		k, ok := key.(*ecdsa.PublicKey)
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		if !ok || k.Curve != curves[alg] {
+			return false, nil
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false, nil
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, digest, r, s), nil
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, input, signature), nil
+	default:
+		return false, fmt.Errorf("unsupported jws algorithm %q", alg)
+	}
+}
@@ -0,0 +1,170 @@
+package multi_http_provider
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signJWS signs payload in the compact serialization.
+func signJWS(t *testing.T, key crypto.Signer, header, payload string) string {
+	t.Helper()
+
+	input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	var signature []byte
+	var err error
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(input))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = signErr
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		digest := sha256.Sum256([]byte(input))
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestJWSVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := newJWSVerifier(&JWS{PublicKeys: []string{
+		writePublicKey(t, rsaKey.Public()), writePublicKey(t, ecKey.Public()), writePublicKey(t, edKey.Public()),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := `{"http":{}}`
+	tests := []struct {
+		desc        string
+		body        string
+		contentType string
+		wantErr     bool
+	}{
+		{desc: "RS256", body: signJWS(t, rsaKey, `{"alg":"RS256"}`, payload)},
+		{desc: "ES256", body: signJWS(t, ecKey, `{"alg":"ES256"}`, payload)},
+		{desc: "EdDSA with cty", body: signJWS(t, edKey, `{"alg":"EdDSA","cty":"json"}`, payload), contentType: "application/json"},
+		{
+			desc: "JSON serialization",
+			body: func() string {
+				parts := strings.Split(signJWS(t, edKey, `{"alg":"EdDSA"}`, payload), ".")
+				return `{"payload":"` + parts[1] + `","signatures":[{"protected":"` + parts[0] + `","signature":"AAAA"},` +
+					`{"protected":"` + parts[0] + `","signature":"` + parts[2] + `"}]}`
+			}(),
+		},
+		{desc: "unknown key", body: signJWS(t, otherKey, `{"alg":"EdDSA"}`, payload), wantErr: true},
+		{desc: "algorithm mismatch", body: signJWS(t, edKey, `{"alg":"ES256"}`, payload), wantErr: true},
+		{desc: "none algorithm", body: signJWS(t, edKey, `{"alg":"none"}`, payload), wantErr: true},
+		{desc: "critical header", body: signJWS(t, edKey, `{"alg":"EdDSA","crit":["exp"],"exp":1}`, payload), wantErr: true},
+		{desc: "unsigned configuration", body: payload, wantErr: true},
+		{desc: "tampered payload", body: func() string {
+			parts := strings.Split(signJWS(t, edKey, `{"alg":"EdDSA"}`, payload), ".")
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"http":{"routers":{}}}`)) + "." + parts[2]
+		}(), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			actual, contentType, err := v.verify([]byte(test.body))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != payload || contentType != test.contentType {
+				t.Errorf("unexpected payload %s of type %q", actual, contentType)
+			}
+		})
+	}
+}
+
+func TestParseJWSConfig(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newJWSVerifier(&JWS{PublicKeys: []string{writePublicKey(t, key.Public())}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	yaml := "http:\n  routers:\n    app:\n      entryPoints: [web]\n      service: app\n      rule: Host(`app`)\n" +
+		"  services:\n    app:\n      loadBalancer:\n        servers:\n        - url: http://10.0.0.1\n"
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	e := endpoint{jws: v}
+	config := p.parseConfig(e, "application/jose", []byte(signJWS(t, key, `{"alg":"EdDSA","cty":"yaml"}`, yaml)))
+	if config == nil || config.HTTP.Routers["app"] == nil {
+		t.Fatalf("expected the signed yaml configuration, got %+v", config)
+	}
+	if config := p.parseConfig(e, "application/yaml", []byte(yaml)); config != nil {
+		t.Error("expected the unsigned configuration to be rejected")
+	}
+}
+
+func TestNewJWSVerifierErrors(t *testing.T) {
+	if _, err := newJWSVerifier(&JWS{}); err == nil {
+		t.Error("expected an error without public keys")
+	}
+	if _, err := newJWSVerifier(&JWS{PublicKeys: []string{"/nonexistent.pem"}}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	file := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(file, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newJWSVerifier(&JWS{PublicKeys: []string{file}}); err == nil {
+		t.Error("expected an error for a file without key")
+	}
+}
@@ -0,0 +1,278 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Kubernetes the API server settings of kubernetes:// endpoints, defaulting to
+// the in-cluster service account.
+type Kubernetes struct {
+	APIServer string `json:"apiServer,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+func isKubernetesURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "kubernetes://")
+}
+
+// kubernetesObject is a kubernetes://namespace/configmaps/name[/key] or
+// kubernetes://namespace/secrets/name[/key] endpoint.
+type kubernetesObject struct {
+	apiServer string
+	tokenFile string
+	namespace string
+	resource  string
+	name      string
+	key       string
+}
+
+func parseKubernetesURL(endpoint string, config *Kubernetes) (*kubernetesObject, error) {
+	parts := strings.Split(strings.TrimPrefix(endpoint, "kubernetes://"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("kubernetes endpoints must be kubernetes://namespace/configmaps/name[/key]")
+	}
+	if parts[1] != "configmaps" && parts[1] != "secrets" {
+		return nil, fmt.Errorf("unsupported kubernetes resource %q", parts[1])
+	}
+
+	apiServer, tokenFile, err := kubernetesAPI(config)
+	if err != nil {
+		return nil, err
+	}
+	o := &kubernetesObject{
+		apiServer: apiServer,
+		tokenFile: tokenFile,
+		namespace: parts[0],
+		resource:  parts[1],
+		name:      parts[2],
+	}
+	if len(parts) == 4 {
+		o.key = parts[3]
+	}
+	return o, nil
+}
+
+// kubernetesAPI returns the API server URL and token file of config, the
+// in-cluster ones by default.
+func kubernetesAPI(config *Kubernetes) (string, string, error) {
+	apiServer := ""
+	if config != nil && config.APIServer != "" {
+		apiServer = strings.TrimSuffix(config.APIServer, "/")
+	} else if host := os.Getenv("KUBERNETES_SERVICE_HOST"); host != "" {
+		apiServer = "https://" + net.JoinHostPort(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+	} else {
+		return "", "", fmt.Errorf("kubernetes apiServer must be set outside of a cluster")
+	}
+	tokenFile := serviceAccountToken
+	if config != nil && config.TokenFile != "" {
+		tokenFile = config.TokenFile
+	}
+	return apiServer, tokenFile, nil
+}
+
+type kubernetesMetadata struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type kubernetesData struct {
+	Metadata   kubernetesMetadata `json:"metadata"`
+	Data       map[string]string  `json:"data"`
+	BinaryData map[string]string  `json:"binaryData"`
+}
+
+type kubernetesList struct {
+	Metadata kubernetesMetadata `json:"metadata"`
+	Items    []kubernetesData   `json:"items"`
+}
+
+type kubernetesEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubernetesWatch lists a ConfigMap or Secret then watches it from the listed
+// resource version, like informers do. With a key the endpoint is fed by that
+// data entry, otherwise every entry holds the configuration of one node.
+type kubernetesWatch struct {
+	object  *kubernetesObject
+	values  map[string]string
+	backoff *backoff
+}
+
+func (w *kubernetesWatch) reconnect(connected bool) time.Duration {
+	if connected {
+		w.backoff.reset()
+	} else {
+		// the nodes were removed while the API server was unreachable
+		w.values = nil
+	}
+	return w.backoff.next()
+}
+
+func (w *kubernetesWatch) watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error) {
+	resp, err := w.request(ctx, e, false, "")
+	if err != nil {
+		return false, err
+	}
+	var list kubernetesList
+	err = json.NewDecoder(newStreamLimiter(resp.Body, e.maxBytes)).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		return false, fmt.Errorf("decoding list: %w", err)
+	}
+
+	var current *kubernetesData
+	if len(list.Items) > 0 {
+		current = &list.Items[0]
+	}
+	if err := w.apply(current, emit); err != nil {
+		return true, err
+	}
+
+	resp, err = w.request(ctx, e, true, list.Metadata.ResourceVersion)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	limiter := newStreamLimiter(resp.Body, e.maxBytes)
+	decoder := json.NewDecoder(limiter)
+	for {
+		limiter.reset()
+		var event kubernetesEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return true, fmt.Errorf("watch ended")
+			}
+			return true, err
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var object kubernetesData
+			if err := json.Unmarshal(event.Object, &object); err != nil {
+				return true, err
+			}
+			if err := w.apply(&object, emit); err != nil {
+				return true, err
+			}
+		case "DELETED":
+			if err := w.apply(nil, emit); err != nil {
+				return true, err
+			}
+		case "ERROR":
+			// typically 410 Gone once the resource version is compacted,
+			// the next connection lists the object again
+			var status struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(event.Object, &status)
+			return true, fmt.Errorf("watch error: %s", status.Message)
+		}
+	}
+}
+
+// apply emits the data entries that changed since the last call, a nil
+// object removing them all.
+func (w *kubernetesWatch) apply(object *kubernetesData, emit emitFunc) error {
+	values := map[string]string{}
+	if object != nil {
+		for key, value := range object.Data {
+			if w.object.resource == "secrets" {
+				decoded, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return fmt.Errorf("decoding key %s: %w", key, err)
+				}
+				value = string(decoded)
+			}
+			values[key] = value
+		}
+		for key, value := range object.BinaryData {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("decoding key %s: %w", key, err)
+			}
+			values[key] = string(decoded)
+		}
+	}
+
+	if w.object.key != "" {
+		value, ok := values[w.object.key]
+		previous, known := w.values[w.object.key]
+		switch {
+		case !ok:
+			emit("", "", nil)
+		case !known || previous != value:
+			emit("", "", []byte(value))
+		}
+		w.values = values
+		return nil
+	}
+
+	for key, value := range values {
+		if previous, ok := w.values[key]; !ok || previous != value {
+			emit(key, "", []byte(value))
+		}
+	}
+	for key := range w.values {
+		if _, ok := values[key]; !ok {
+			emit(key, "", nil)
+		}
+	}
+	w.values = values
+	return nil
+}
+
+func (w *kubernetesWatch) request(ctx context.Context, e endpoint, watch bool, resourceVersion string) (*http.Response, error) {
+	query := url.Values{"fieldSelector": {"metadata.name=" + w.object.name}}
+	if watch {
+		query.Set("watch", "true")
+		query.Set("allowWatchBookmarks", "true")
+		query.Set("resourceVersion", resourceVersion)
+	}
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/%s?%s",
+		w.object.apiServer, url.PathEscape(w.object.namespace), w.object.resource, query.Encode())
+	return kubernetesGet(ctx, e.client, u, w.object.tokenFile, e.headers)
+}
+
+func kubernetesGet(ctx context.Context, client *http.Client, u, tokenFile string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := setHeaderValues(req, headers, nil); err != nil {
+		return nil, err
+	}
+	// service account tokens are rotated, read on every request
+	if token, err := os.ReadFile(tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,124 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// KubernetesService discovers the ready pods backing a Kubernetes Service
+// from its EndpointSlices. Port names the service port polled, the first one
+// by default.
+type KubernetesService struct {
+	Namespace string `json:"namespace,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Port      string `json:"port,omitempty"`
+	APIServer string `json:"apiServer,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	CAFile    string `json:"caFile,omitempty"`
+}
+
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+			TargetRef *struct {
+				Name string `json:"name"`
+			} `json:"targetRef"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name *string `json:"name"`
+			Port *int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+type kubernetesServiceDiscovery struct {
+	url       string
+	tokenFile string
+	port      string
+	template  Endpoint
+	client    *http.Client
+	maxBytes  int
+}
+
+func (p *Provider) newKubernetesServiceDiscovery(k *KubernetesService, template Endpoint) (*kubernetesServiceDiscovery, error) {
+	if k.Namespace == "" || k.Service == "" {
+		return nil, fmt.Errorf("kubernetes namespace and service must be set")
+	}
+	apiServer, tokenFile, err := kubernetesAPI(&Kubernetes{APIServer: k.APIServer, TokenFile: k.TokenFile})
+	if err != nil {
+		return nil, err
+	}
+	caFile := k.CAFile
+	if caFile == "" && k.APIServer == "" {
+		caFile = serviceAccountCA
+	}
+	client, err := p.newClient(Endpoint{Endpoint: apiServer, CAFile: caFile}, p.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"labelSelector": {"kubernetes.io/service-name=" + k.Service}}
+	return &kubernetesServiceDiscovery{
+		url: fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+			apiServer, url.PathEscape(k.Namespace), query.Encode()),
+		tokenFile: tokenFile,
+		port:      k.Port,
+		template:  template,
+		client:    client,
+		maxBytes:  p.maxResponseBytes,
+	}, nil
+}
+
+func (d *kubernetesServiceDiscovery) discover(ctx context.Context) (map[string]Endpoint, error) {
+	resp, err := kubernetesGet(ctx, d.client, d.url, d.tokenFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var slices endpointSliceList
+	if err := json.NewDecoder(newStreamLimiter(resp.Body, d.maxBytes)).Decode(&slices); err != nil {
+		return nil, fmt.Errorf("decoding endpoint slices: %w", err)
+	}
+
+	endpoints := map[string]Endpoint{}
+	for _, slice := range slices.Items {
+		port := 0
+		for _, p := range slice.Ports {
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if p.Port != nil && (d.port == "" || d.port == name) {
+				port = *p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			// a missing ready condition means ready
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready || len(ep.Addresses) == 0 {
+				continue
+			}
+			name := ep.Addresses[0]
+			if ep.TargetRef != nil && ep.TargetRef.Name != "" {
+				name = ep.TargetRef.Name
+			}
+			e := d.template
+			e.Endpoint = ep.Addresses[0]
+			e.Port = port
+			endpoints[name] = e
+		}
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,61 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKubernetesServiceDiscover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/edge/endpointslices" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if selector := r.URL.Query().Get("labelSelector"); selector != "kubernetes.io/service-name=config" {
+			t.Errorf("unexpected label selector %q", selector)
+		}
+		fmt.Fprint(w, `{"items":[{
+			"ports":[{"name":"metrics","port":9100},{"name":"http","port":8080}],
+			"endpoints":[
+				{"addresses":["10.1.0.1"],"conditions":{"ready":true},"targetRef":{"kind":"Pod","name":"config-abc"}},
+				{"addresses":["10.1.0.2"],"conditions":{"ready":false},"targetRef":{"kind":"Pod","name":"config-def"}},
+				{"addresses":["10.1.0.3"],"conditions":{}}
+			]
+		}]}`)
+	}))
+	defer srv.Close()
+
+	d, err := (&Provider{}).newKubernetesServiceDiscovery(&KubernetesService{
+		Namespace: "edge",
+		Service:   "config",
+		Port:      "http",
+		APIServer: srv.URL,
+	}, Endpoint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := d.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"config-abc": "http://10.1.0.1:8080/traefik/config",
+		"10.1.0.3":   "http://10.1.0.3:8080/traefik/config",
+	}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("expected %d endpoints, got %v", len(expected), endpoints)
+	}
+	for name, u := range expected {
+		if actual := endpointURL(endpoints[name]); actual != u {
+			t.Errorf("%s: expected %s, got %s", name, u, actual)
+		}
+	}
+}
+
+func TestKubernetesServiceRequiresService(t *testing.T) {
+	if _, err := (&Provider{}).newKubernetesServiceDiscovery(&KubernetesService{Namespace: "edge"}, Endpoint{}); err == nil {
+		t.Error("expected an error without service")
+	}
+}
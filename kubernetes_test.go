@@ -0,0 +1,125 @@
+package multi_http_provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubernetesConfigMapWatch(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configMap := func(version string, data map[string]string) string {
+		body, _ := json.Marshal(kubernetesData{
+			Metadata: kubernetesMetadata{Name: "traefik", ResourceVersion: version},
+			Data:     data,
+		})
+		return string(body)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/edge/configmaps" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Query().Get("fieldSelector") != "metadata.name=traefik" {
+			t.Errorf("unexpected field selector %q", r.URL.Query().Get("fieldSelector"))
+		}
+		if r.URL.Query().Get("watch") == "" {
+			fmt.Fprintf(w, `{"metadata":{"resourceVersion":"10"},"items":[%s]}`,
+				configMap("9", map[string]string{"first": routerConfig("first", "web")}))
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") != "10" {
+			t.Errorf("expected watch from resource version 10, got %q", r.URL.Query().Get("resourceVersion"))
+		}
+		fmt.Fprintf(w, `{"type":"MODIFIED","object":%s}`+"\n", configMap("11", map[string]string{
+			"first":  routerConfig("first", "web"),
+			"second": routerConfig("second", "web"),
+		}))
+		fmt.Fprintf(w, `{"type":"MODIFIED","object":%s}`+"\n", configMap("12", map[string]string{
+			"second": routerConfig("second", "web"),
+		}))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"edge": {
+			Endpoint:   "kubernetes://edge/configmaps/traefik",
+			Kubernetes: &Kubernetes{APIServer: srv.URL, TokenFile: tokenFile},
+		},
+	})
+
+	expected := [][]string{{"first"}, {"first", "second"}, {"second"}}
+	for _, routers := range expected {
+		config := receiveConfig(t, cfgChan)
+		if len(config.HTTP.Routers) != len(routers) {
+			t.Fatalf("expected routers %v, got %v", routers, routerNames(config))
+		}
+		for _, router := range routers {
+			if _, ok := config.HTTP.Routers[router]; !ok {
+				t.Fatalf("expected routers %v, got %v", routers, routerNames(config))
+			}
+		}
+	}
+}
+
+func TestKubernetesSecretKey(t *testing.T) {
+	var emitted []string
+	w := &kubernetesWatch{object: &kubernetesObject{resource: "secrets", key: "config.json"}}
+	emit := func(key, _ string, body []byte) {
+		emitted = append(emitted, fmt.Sprintf("%s=%s", key, body))
+	}
+
+	secret := &kubernetesData{Data: map[string]string{
+		"config.json": base64.StdEncoding.EncodeToString([]byte(`{}`)),
+		"other":       base64.StdEncoding.EncodeToString([]byte("ignored")),
+	}}
+	for _, object := range []*kubernetesData{secret, secret, nil} {
+		if err := w.apply(object, emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"={}", "="}
+	if fmt.Sprint(emitted) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, emitted)
+	}
+}
+
+func TestParseKubernetesURL(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	o, err := parseKubernetesURL("kubernetes://edge/secrets/traefik/config.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.apiServer != "https://10.96.0.1:443" || o.namespace != "edge" || o.resource != "secrets" ||
+		o.name != "traefik" || o.key != "config.json" || o.tokenFile != serviceAccountToken {
+		t.Errorf("unexpected object %+v", *o)
+	}
+
+	for _, endpoint := range []string{
+		"kubernetes://edge/configmaps",
+		"kubernetes://edge/pods/traefik",
+		"kubernetes:///configmaps/traefik",
+		"kubernetes://edge/configmaps/traefik/key/extra",
+	} {
+		if _, err := parseKubernetesURL(endpoint, nil); err == nil {
+			t.Errorf("%s: expected an error", endpoint)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+const formatDocker = "docker"
+
+// labeledContainer is a container as listed by /containers/json or
+// inspected by /containers/<id>/json.
+type labeledContainer struct {
+	dockerContainer
+	Name  string `json:"Name"`
+	Ports []struct {
+		PrivatePort int `json:"PrivatePort"`
+	} `json:"Ports"`
+	Config struct {
+		Labels       map[string]string   `json:"Labels"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"Config"`
+}
+
+// dockerLabelsToJSON converts containers carrying Traefik labels into a
+// configuration, the way the Traefik Docker provider does: services default
+// to one named after the container, and their servers to the container
+// address and lowest exposed port.
+func dockerLabelsToJSON(body []byte) ([]byte, error) {
+	var containers []labeledContainer
+	if err := json.Unmarshal(body, &containers); err != nil {
+		return nil, fmt.Errorf("decoding containers: %w", err)
+	}
+
+	merged := &dynamic.Configuration{}
+	for _, c := range containers {
+		if c.Labels == nil {
+			c.Labels = c.Config.Labels
+		}
+		name := c.Name
+		if name == "" && len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+		name = strings.TrimPrefix(name, "/")
+		if name == "" {
+			name = c.ID
+		}
+		if c.Labels["traefik.enable"] == "false" {
+			continue
+		}
+
+		config, err := containerConfig(name, c)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", name, err)
+		}
+		mergeContainerConfig(merged, config)
+	}
+	return json.Marshal(merged)
+}
+
+func containerConfig(name string, c labeledContainer) (*dynamic.Configuration, error) {
+	config := &dynamic.Configuration{}
+	// loadbalancer.server.port and .scheme labels by protocol and service
+	servers := map[string]map[string]map[string]string{}
+	for key, value := range c.Labels {
+		path := strings.Split(key, ".")
+		if len(path) < 2 || path[0] != "traefik" || path[1] == "enable" || path[1] == "docker" {
+			continue
+		}
+		path = path[1:]
+		if len(path) == 6 && strings.EqualFold(path[1], "services") && strings.EqualFold(path[3], "loadbalancer") && strings.EqualFold(path[4], "server") {
+			protocol, service := strings.ToLower(path[0]), path[2]
+			if servers[protocol] == nil {
+				servers[protocol] = map[string]map[string]string{}
+			}
+			if servers[protocol][service] == nil {
+				servers[protocol][service] = map[string]string{}
+			}
+			servers[protocol][service][strings.ToLower(path[5])] = value
+			ensureLabelPath(config, path[:4])
+			continue
+		}
+		if err := setLabel(reflect.ValueOf(config).Elem(), path, value); err != nil {
+			return nil, fmt.Errorf("label %s: %w", key, err)
+		}
+	}
+
+	address := c.Labels["traefik.docker.network"]
+	if address != "" {
+		address = c.NetworkSettings.Networks[address].IPAddress
+	} else {
+		address = containerAddress(c.dockerContainer)
+	}
+	port := strconv.Itoa(lowestPort(c))
+	serviceName := normalizeName(name)
+
+	if h := config.HTTP; h != nil {
+		if len(h.Services) == 0 && len(h.Routers) > 0 {
+			h.Services = map[string]*dynamic.Service{serviceName: {}}
+		}
+		for name, s := range h.Services {
+			if s.Weighted != nil || s.Mirroring != nil || s.Failover != nil {
+				continue
+			}
+			if s.LoadBalancer == nil {
+				s.LoadBalancer = &dynamic.ServersLoadBalancer{}
+			}
+			if len(s.LoadBalancer.Servers) > 0 || address == "" {
+				continue
+			}
+			server := servers["http"][name]
+			scheme, p := "http", port
+			if server["scheme"] != "" {
+				scheme = server["scheme"]
+			}
+			if server["port"] != "" {
+				p = server["port"]
+			}
+			s.LoadBalancer.Servers = []dynamic.Server{{URL: scheme + "://" + net.JoinHostPort(address, p)}}
+		}
+		// routers default to the only service of the container
+		for _, r := range h.Routers {
+			if r.Service == "" {
+				r.Service = onlyKey(h.Services)
+			}
+		}
+	}
+	if t := config.TCP; t != nil {
+		if len(t.Services) == 0 && len(t.Routers) > 0 {
+			t.Services = map[string]*dynamic.TCPService{serviceName: {}}
+		}
+		for name, s := range t.Services {
+			if s.Weighted != nil {
+				continue
+			}
+			if s.LoadBalancer == nil {
+				s.LoadBalancer = &dynamic.TCPServersLoadBalancer{}
+			}
+			if len(s.LoadBalancer.Servers) > 0 || address == "" {
+				continue
+			}
+			p := port
+			if server := servers["tcp"][name]; server["port"] != "" {
+				p = server["port"]
+			}
+			s.LoadBalancer.Servers = []dynamic.TCPServer{{Address: net.JoinHostPort(address, p)}}
+		}
+		for _, r := range t.Routers {
+			if r.Service == "" {
+				r.Service = onlyKey(t.Services)
+			}
+		}
+	}
+	if u := config.UDP; u != nil {
+		if len(u.Services) == 0 && len(u.Routers) > 0 {
+			u.Services = map[string]*dynamic.UDPService{serviceName: {}}
+		}
+		for name, s := range u.Services {
+			if s.Weighted != nil {
+				continue
+			}
+			if s.LoadBalancer == nil {
+				s.LoadBalancer = &dynamic.UDPServersLoadBalancer{}
+			}
+			if len(s.LoadBalancer.Servers) > 0 || address == "" {
+				continue
+			}
+			p := port
+			if server := servers["udp"][name]; server["port"] != "" {
+				p = server["port"]
+			}
+			s.LoadBalancer.Servers = []dynamic.UDPServer{{Address: net.JoinHostPort(address, p)}}
+		}
+		for _, r := range u.Routers {
+			if r.Service == "" {
+				r.Service = onlyKey(u.Services)
+			}
+		}
+	}
+	return config, nil
+}
+
+// onlyKey returns the key of a map holding a single entry, empty otherwise.
+func onlyKey(m interface{}) string {
+	keys := reflect.ValueOf(m).MapKeys()
+	if len(keys) != 1 {
+		return ""
+	}
+	return keys[0].String()
+}
+
+// ensureLabelPath creates the service a loadbalancer.server label refers to.
+func ensureLabelPath(config *dynamic.Configuration, path []string) {
+	_ = setLabel(reflect.ValueOf(config).Elem(), path, "true")
+}
+
+func lowestPort(c labeledContainer) int {
+	var ports []int
+	for _, p := range c.Ports {
+		ports = append(ports, p.PrivatePort)
+	}
+	for p := range c.Config.ExposedPorts {
+		port, _, _ := strings.Cut(p, "/")
+		if n, err := strconv.Atoi(port); err == nil {
+			ports = append(ports, n)
+		}
+	}
+	if len(ports) == 0 {
+		return 80
+	}
+	sort.Ints(ports)
+	return ports[0]
+}
+
+// normalizeName replaces the characters of a container name not valid in
+// configuration names.
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// mergeContainerConfig merges the configuration of a container, the servers
+// of load balancers shared by several containers being added up.
+func mergeContainerConfig(dst, src *dynamic.Configuration) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		from, to := s.Field(i), d.Field(i)
+		if from.IsNil() {
+			continue
+		}
+		if to.IsNil() {
+			to.Set(reflect.New(from.Type().Elem()))
+		}
+		from, to = from.Elem(), to.Elem()
+		for j := 0; j < from.NumField(); j++ {
+			f, t := from.Field(j), to.Field(j)
+			switch f.Kind() {
+			case reflect.Slice:
+				t.Set(reflect.AppendSlice(t, f))
+			case reflect.Map:
+				if f.Len() > 0 && t.IsNil() {
+					t.Set(reflect.MakeMap(f.Type()))
+				}
+				iter := f.MapRange()
+				for iter.Next() {
+					current := t.MapIndex(iter.Key())
+					if !current.IsValid() {
+						t.SetMapIndex(iter.Key(), iter.Value())
+						continue
+					}
+					appendServers(current, iter.Value())
+				}
+			}
+		}
+	}
+}
+
+// appendServers adds the servers of the load balancer of service to the one
+// of current, when both have one.
+func appendServers(current, service reflect.Value) {
+	if current.Kind() != reflect.Ptr || current.Elem().Kind() != reflect.Struct {
+		return
+	}
+	to := current.Elem().FieldByName("LoadBalancer")
+	from := service.Elem().FieldByName("LoadBalancer")
+	if !to.IsValid() || to.IsNil() || from.IsNil() {
+		return
+	}
+	servers := to.Elem().FieldByName("Servers")
+	servers.Set(reflect.AppendSlice(servers, from.Elem().FieldByName("Servers")))
+}
+
+// setLabel sets the value of a label at path below v, matching field names
+// case-insensitively. Slices are set from comma-separated values, or by
+// element with name[index] segments.
+func setLabel(v reflect.Value, path []string, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setLabel(v.Elem(), path, value)
+
+	case reflect.Struct:
+		if len(path) == 0 {
+			// enables an option without settings, such as tls=true
+			if value != "true" {
+				return fmt.Errorf("invalid value %q", value)
+			}
+			return nil
+		}
+		name, index, err := splitLabelIndex(path[0])
+		if err != nil {
+			return err
+		}
+		field, ok := labelField(v, name)
+		if !ok {
+			return fmt.Errorf("unknown field %s", name)
+		}
+		if index < 0 {
+			return setLabel(field, path[1:], value)
+		}
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("field %s is not a list", name)
+		}
+		if index >= field.Len() {
+			grown := reflect.MakeSlice(field.Type(), index+1, index+1)
+			reflect.Copy(grown, field)
+			field.Set(grown)
+		}
+		return setLabel(field.Index(index), path[1:], value)
+
+	case reflect.Map:
+		if len(path) == 0 {
+			return fmt.Errorf("missing key")
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if current := v.MapIndex(key); current.IsValid() {
+			elem.Set(current)
+		}
+		if err := setLabel(elem, path[1:], value); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+
+	case reflect.Interface:
+		if len(path) == 0 {
+			v.Set(reflect.ValueOf(value))
+			return nil
+		}
+		m, ok := v.Interface().(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			v.Set(reflect.ValueOf(m))
+		}
+		elem := reflect.New(v.Type()).Elem()
+		if current, ok := m[path[0]]; ok {
+			elem.Set(reflect.ValueOf(current))
+		}
+		if err := setLabel(elem, path[1:], value); err != nil {
+			return err
+		}
+		m[path[0]] = elem.Interface()
+		return nil
+	}
+
+	if len(path) > 0 {
+		return fmt.Errorf("unknown field %s", path[0])
+	}
+	if v.Kind() == reflect.Slice {
+		values := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, item := range values {
+			if err := setLabel(slice.Index(i), nil, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setLabelScalar(v, value)
+}
+
+func setLabelScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported value type %s", v.Type())
+	}
+	return nil
+}
+
+// splitLabelIndex splits a name[index] label segment, index being -1
+// without one.
+func splitLabelIndex(segment string) (string, int, error) {
+	open := strings.IndexByte(segment, '[')
+	if open < 0 || !strings.HasSuffix(segment, "]") {
+		return segment, -1, nil
+	}
+	index, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+	if err != nil || index < 0 || index > 1000 {
+		return "", 0, fmt.Errorf("invalid index in %s", segment)
+	}
+	return segment[:open], index, nil
+}
+
+// labelField returns the field of a struct named by its json name.
+func labelField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = t.Field(i).Name
+		}
+		if strings.EqualFold(tag, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
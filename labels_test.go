@@ -0,0 +1,148 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func decodeDockerLabels(t *testing.T, body string) *dynamic.Configuration {
+	t.Helper()
+
+	data, err := dockerLabelsToJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config dynamic.Configuration
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return &config
+}
+
+func TestDockerLabels(t *testing.T) {
+	config := decodeDockerLabels(t, `[
+		{"Id":"1","Names":["/whoami_1"],"Ports":[{"PrivatePort":8080},{"PrivatePort":80}],
+		 "NetworkSettings":{"Networks":{"front":{"IPAddress":"172.18.0.2"}}},
+		 "Labels":{
+			"traefik.http.routers.whoami.rule":"Host(`+"`whoami.local`"+`)",
+			"traefik.http.routers.whoami.entrypoints":"web,websecure",
+			"traefik.http.routers.whoami.priority":"10",
+			"traefik.http.routers.whoami.middlewares":"auth",
+			"traefik.http.routers.whoami.tls":"true",
+			"traefik.http.routers.whoami.tls.domains[1].main":"example.com",
+			"traefik.http.middlewares.auth.basicauth.users":"user:hash,other:hash",
+			"traefik.http.middlewares.auth.headers.customrequestheaders.X-Env":"prod",
+			"com.docker.compose.project":"demo"
+		 }},
+		{"Id":"2","Name":"/whoami_2",
+		 "Config":{"ExposedPorts":{"80/tcp":{}},"Labels":{"traefik.http.routers.whoami.rule":"ignored"}},
+		 "NetworkSettings":{"Networks":{"front":{"IPAddress":"172.18.0.3"}}}},
+		{"Id":"3","Names":["/disabled"],"Labels":{"traefik.enable":"false","traefik.http.routers.disabled.rule":"Host(`+"`x`"+`)"},
+		 "NetworkSettings":{"Networks":{"front":{"IPAddress":"172.18.0.4"}}}}
+	]`)
+
+	router := config.HTTP.Routers["whoami"]
+	if router == nil {
+		t.Fatalf("expected router whoami, got %v", routerNames(config))
+	}
+	if router.Rule != "Host(`whoami.local`)" || router.Priority != 10 || router.Service != "whoami-1" {
+		t.Errorf("unexpected router %+v", router)
+	}
+	if !reflect.DeepEqual(router.EntryPoints, []string{"web", "websecure"}) {
+		t.Errorf("unexpected entrypoints %v", router.EntryPoints)
+	}
+	if router.TLS == nil || len(router.TLS.Domains) != 2 || router.TLS.Domains[1].Main != "example.com" {
+		t.Errorf("unexpected tls %+v", router.TLS)
+	}
+	if _, ok := config.HTTP.Routers["disabled"]; ok {
+		t.Error("expected the disabled container to be ignored")
+	}
+
+	auth := config.HTTP.Middlewares["auth"]
+	if auth == nil || !reflect.DeepEqual([]string(auth.BasicAuth.Users), []string{"user:hash", "other:hash"}) {
+		t.Errorf("unexpected middleware %+v", auth)
+	}
+	if auth != nil && auth.Headers.CustomRequestHeaders["X-Env"] != "prod" {
+		t.Errorf("unexpected headers %+v", auth.Headers)
+	}
+
+	// the second container has its own default service, named after it
+	servers := config.HTTP.Services["whoami-1"].LoadBalancer.Servers
+	if !reflect.DeepEqual(servers, []dynamic.Server{{URL: "http://172.18.0.2:80"}}) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+	servers = config.HTTP.Services["whoami-2"].LoadBalancer.Servers
+	if !reflect.DeepEqual(servers, []dynamic.Server{{URL: "http://172.18.0.3:80"}}) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+}
+
+func TestDockerLabelsSharedService(t *testing.T) {
+	labels := `{"traefik.http.routers.app.rule":"PathPrefix(` + "`/`" + `)","traefik.http.routers.app.entrypoints":"web",` +
+		`"traefik.http.services.app.loadbalancer.server.port":"8080","traefik.http.services.app.loadbalancer.server.scheme":"https",` +
+		`"traefik.docker.network":"back"}`
+	config := decodeDockerLabels(t, `[
+		{"Names":["/app_1"],"Labels":`+labels+`,"NetworkSettings":{"Networks":{"back":{"IPAddress":"10.0.0.2"},"a":{"IPAddress":"172.18.0.2"}}}},
+		{"Names":["/app_2"],"Labels":`+labels+`,"NetworkSettings":{"Networks":{"back":{"IPAddress":"10.0.0.3"}}}}
+	]`)
+
+	if s := config.HTTP.Routers["app"].Service; s != "app" {
+		t.Errorf("expected router app to use service app, got %q", s)
+	}
+	servers := config.HTTP.Services["app"].LoadBalancer.Servers
+	expected := []dynamic.Server{{URL: "https://10.0.0.2:8080"}, {URL: "https://10.0.0.3:8080"}}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Errorf("unexpected servers %v", servers)
+	}
+}
+
+func TestDockerLabelsTCP(t *testing.T) {
+	config := decodeDockerLabels(t, `[
+		{"Names":["/db"],"Ports":[{"PrivatePort":5432}],"NetworkSettings":{"Networks":{"a":{"IPAddress":"10.0.0.5"}}},
+		 "Labels":{"traefik.tcp.routers.db.rule":"HostSNI(`+"`*`"+`)","traefik.tcp.routers.db.entrypoints":"postgres"}}
+	]`)
+	router := config.TCP.Routers["db"]
+	if router == nil || router.Service != "db" {
+		t.Fatalf("unexpected tcp router %+v", router)
+	}
+	if servers := config.TCP.Services["db"].LoadBalancer.Servers; len(servers) != 1 || servers[0].Address != "10.0.0.5:5432" {
+		t.Errorf("unexpected tcp servers %v", servers)
+	}
+}
+
+func TestDockerLabelsErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		label string
+	}{
+		{desc: "unknown field", label: `"traefik.http.routers.app.unknown":"x"`},
+		{desc: "invalid integer", label: `"traefik.http.routers.app.priority":"high"`},
+		{desc: "invalid boolean", label: `"traefik.http.services.app.loadbalancer.passhostheader":"maybe"`},
+		{desc: "invalid index", label: `"traefik.http.routers.app.tls.domains[x].main":"a"`},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			body := `[{"Names":["/app"],"Labels":{` + test.label + `}}]`
+			if _, err := dockerLabelsToJSON([]byte(body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseDockerFormat(t *testing.T) {
+	body := `[{"Names":["/app"],"NetworkSettings":{"Networks":{"a":{"IPAddress":"10.0.0.2"}}},` +
+		`"Labels":{"traefik.http.routers.app.rule":"Host(` + "`app`" + `)","traefik.http.routers.app.entrypoints":"web"}}]`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	config := p.parseConfig(endpoint{format: formatDocker}, "application/json", []byte(body))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if _, ok := config.HTTP.Services["app"]; !ok {
+		t.Errorf("expected service app, got %v", config.HTTP.Services)
+	}
+}
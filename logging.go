@@ -0,0 +1,51 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logLevel the level of the logs of the provider, set by its LogLevel. It is
+// process-wide, the last provider instance created setting it for all.
+var logLevel = new(slog.LevelVar)
+
+// logLevelMu guards logLevelSet, whether a provider instance set logLevel.
+var (
+	logLevelMu  sync.Mutex
+	logLevelSet bool
+)
+
+// logger the structured logger of the provider, keyed by node, endpoint,
+// status code, duration and error where they apply.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})).With("plugin", "multi-http-provider")
+
+// setLogLevel sets the level of the logs for the provider instance name,
+// warning when it replaces a different level set by another instance.
+func setLogLevel(name string, level slog.Level) {
+	logLevelMu.Lock()
+	defer logLevelMu.Unlock()
+	if previous := logLevel.Level(); logLevelSet && previous != level {
+		logger.Warn("Replacing the log level shared by the provider instances", "provider", name, "previous", previous, "level", level)
+	}
+	logLevel.Set(level)
+	logLevelSet = true
+}
+
+// parseLogLevel parses debug, info (default), warn or error.
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unsupported log level %q", s)
+	}
+}
@@ -0,0 +1,55 @@
+package multi_http_provider
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		level   slog.Level
+		wantErr bool
+	}{
+		{value: "", level: slog.LevelInfo},
+		{value: "debug", level: slog.LevelDebug},
+		{value: "WARN", level: slog.LevelWarn},
+		{value: "error", level: slog.LevelError},
+		{value: "trace", wantErr: true},
+	}
+	for _, test := range tests {
+		level, err := parseLogLevel(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+			continue
+		}
+		if level != test.level {
+			t.Errorf("%q: expected %s, got %s", test.value, test.level, level)
+		}
+	}
+}
+
+func TestNewLogLevel(t *testing.T) {
+	defer logLevel.Set(slog.LevelInfo)
+	config := CreateConfig()
+	config.LogLevel = "debug"
+	if _, err := New(context.Background(), config, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected the debug level, got %s", logLevel.Level())
+	}
+	// the level is shared, the last instance setting it
+	config.LogLevel = "warn"
+	if _, err := New(context.Background(), config, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if logLevel.Level() != slog.LevelWarn {
+		t.Errorf("expected the warn level, got %s", logLevel.Level())
+	}
+	config.LogLevel = "verbose"
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an unsupported log level error")
+	}
+}
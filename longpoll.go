@@ -0,0 +1,87 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// longPoll issues blocking queries held by the server until the endpoint
+// configuration changes or the wait time elapses, like Consul blocking
+// queries. The index of the last configuration, read from the X-Index or
+// X-Consul-Index response header, is sent back with the wait time as the
+// index and wait query parameters.
+type longPoll struct {
+	wait    time.Duration
+	index   uint64
+	backoff *backoff
+}
+
+func (l *longPoll) reconnect(bool) time.Duration {
+	// start over so the server answers immediately with its current state
+	l.index = 0
+	return l.backoff.next()
+}
+
+func (l *longPoll) watch(ctx context.Context, e endpoint, handle emitFunc) (bool, error) {
+	for {
+		body, contentType, index, err := l.query(ctx, e)
+		if err != nil {
+			return false, err
+		}
+		l.backoff.reset()
+
+		if index == 0 || index != l.index {
+			l.index = index
+			handle("", contentType, body)
+		}
+	}
+}
+
+func (l *longPoll) query(ctx context.Context, e endpoint) ([]byte, string, uint64, error) {
+	u, err := url.Parse(e.url)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	query := u.Query()
+	query.Set("wait", l.wait.String())
+	if l.index > 0 {
+		query.Set("index", strconv.FormatUint(l.index, 10))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	req.Header.Set("Accept", e.accept())
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if err := e.setHeaders(req); err != nil {
+		return nil, "", 0, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := readBody(resp, e.maxBytes)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	header := resp.Header.Get("X-Index")
+	if header == "" {
+		header = resp.Header.Get("X-Consul-Index")
+	}
+	index, _ := strconv.ParseUint(header, 10, 64)
+	return body, resp.Header.Get("Content-Type"), index, nil
+}
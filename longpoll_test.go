@@ -0,0 +1,54 @@
+package multi_http_provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLongPoll(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := r.URL.Query().Get("wait"); wait != "30s" {
+			t.Errorf("expected wait 30s, got %q", wait)
+		}
+		index := r.URL.Query().Get("index")
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			if index != "" {
+				t.Errorf("expected no index on the first query, got %q", index)
+			}
+			w.Header().Set("X-Index", "7")
+			_, _ = w.Write([]byte(routerConfig("first", "web")))
+		case 2:
+			// wait time elapsed without changes
+			w.Header().Set("X-Index", "7")
+			_, _ = w.Write([]byte(routerConfig("unchanged", "web")))
+		case 3:
+			if index != "7" {
+				t.Errorf("expected index 7, got %q", index)
+			}
+			// a YAML configuration is read by its Content-Type
+			w.Header().Set("X-Consul-Index", "8")
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write([]byte(yamlRouterConfig))
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "longpoll", Wait: "30s"},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["first"]; !ok {
+		t.Fatalf("expected router first, got %v", routerNames(config))
+	}
+	config = receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["yaml"]; !ok {
+		t.Fatalf("expected router yaml, got %v", routerNames(config))
+	}
+}
@@ -0,0 +1,261 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA    = 1
+	dnsTypePTR  = 12
+	dnsTypeSRV  = 33
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// MDNSDiscovery browses the LAN for the instances of an mDNS service type,
+// such as _traefik-config._tcp, answers being collected for Timeout.
+type MDNSDiscovery struct {
+	Service string `json:"service,omitempty"`
+	Domain  string `json:"domain,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type dnsRecord struct {
+	name   string
+	rrtype uint16
+	target string
+	port   uint16
+	ip     net.IP
+}
+
+type mdnsDiscovery struct {
+	service  string
+	timeout  time.Duration
+	template Endpoint
+	exchange func(ctx context.Context, query []byte, timeout time.Duration) ([][]byte, error)
+}
+
+func newMDNSDiscovery(m *MDNSDiscovery, template Endpoint) (*mdnsDiscovery, error) {
+	if m.Service == "" {
+		return nil, fmt.Errorf("mdns service must be set")
+	}
+	domain := m.Domain
+	if domain == "" {
+		domain = "local"
+	}
+	timeout := time.Second
+	if m.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(m.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &mdnsDiscovery{
+		service:  strings.Trim(m.Service, ".") + "." + strings.Trim(domain, ".") + ".",
+		timeout:  timeout,
+		template: template,
+		exchange: mdnsExchange,
+	}, nil
+}
+
+func (d *mdnsDiscovery) discover(ctx context.Context) (map[string]Endpoint, error) {
+	responses, err := d.exchange(ctx, dnsQuery(d.service, dnsTypePTR), d.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := map[string]bool{}
+	services := map[string]dnsRecord{}
+	addresses := map[string]net.IP{}
+	for _, response := range responses {
+		records, err := parseDNSMessage(response)
+		if err != nil {
+			continue
+		}
+		for _, r := range records {
+			switch r.rrtype {
+			case dnsTypePTR:
+				if strings.EqualFold(r.name, d.service) {
+					instances[r.target] = true
+				}
+			case dnsTypeSRV:
+				services[r.name] = r
+			case dnsTypeA, dnsTypeAAAA:
+				// prefer IPv4 addresses
+				if ip, ok := addresses[r.name]; !ok || ip.To4() == nil {
+					addresses[r.name] = r.ip
+				}
+			}
+		}
+	}
+
+	endpoints := map[string]Endpoint{}
+	for instance := range instances {
+		srv, ok := services[instance]
+		if !ok {
+			continue
+		}
+		ip, ok := addresses[srv.target]
+		if !ok {
+			continue
+		}
+		e := d.template
+		e.Endpoint = ip.String()
+		e.Port = int(srv.port)
+		name, _, _ := strings.Cut(instance, ".")
+		endpoints[name] = e
+	}
+	return endpoints, nil
+}
+
+// mdnsExchange multicasts a one-shot query and collects the answers received
+// until timeout, responders replying to the source port.
+func mdnsExchange(ctx context.Context, query []byte, timeout time.Duration) ([][]byte, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, mdnsGroup); err != nil {
+		return nil, err
+	}
+
+	var responses [][]byte
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return responses, nil
+			}
+			return responses, err
+		}
+		responses = append(responses, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func dnsQuery(name string, rrtype uint16) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	msg = appendDNSName(msg, name)
+	msg = binary.BigEndian.AppendUint16(msg, rrtype)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN)
+}
+
+func appendDNSName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+// parseDNSMessage returns the answer and additional records of a response.
+func parseDNSMessage(msg []byte) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, fmt.Errorf("short dns message")
+	}
+	if msg[2]&0x80 == 0 {
+		return nil, fmt.Errorf("not a dns response")
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	var records []dnsRecord
+	for i := 0; i < count; i++ {
+		name, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, fmt.Errorf("truncated dns record")
+		}
+		r := dnsRecord{name: name, rrtype: binary.BigEndian.Uint16(msg[next:])}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return nil, fmt.Errorf("truncated dns record")
+		}
+
+		switch r.rrtype {
+		case dnsTypePTR:
+			r.target, _, err = readDNSName(msg, data)
+		case dnsTypeSRV:
+			if length < 7 {
+				return nil, fmt.Errorf("invalid srv record")
+			}
+			r.port = binary.BigEndian.Uint16(msg[data+4:])
+			r.target, _, err = readDNSName(msg, data+6)
+		case dnsTypeA, dnsTypeAAAA:
+			r.ip = net.IP(append([]byte(nil), msg[data:data+length]...))
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+		offset = data + length
+	}
+	return records, nil
+}
+
+// readDNSName decodes the possibly compressed name at offset and returns it
+// with the offset following it.
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, fmt.Errorf("truncated dns name")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, fmt.Errorf("truncated dns name")
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, fmt.Errorf("dns name compression loop")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, fmt.Errorf("truncated dns name")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// dnsResponse encodes a response carrying the given answer records, names
+// being written uncompressed.
+func dnsResponse(records ...[]byte) []byte {
+	msg := make([]byte, 12)
+	msg[2] = 0x84 // response, authoritative
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+	return msg
+}
+
+func dnsRR(name string, rrtype uint16, data []byte) []byte {
+	rr := appendDNSName(nil, name)
+	rr = binary.BigEndian.AppendUint16(rr, rrtype)
+	rr = binary.BigEndian.AppendUint16(rr, dnsClassIN)
+	rr = binary.BigEndian.AppendUint32(rr, 120)
+	rr = binary.BigEndian.AppendUint16(rr, uint16(len(data)))
+	return append(rr, data...)
+}
+
+func srvData(port uint16, target string) []byte {
+	data := []byte{0, 0, 0, 0}
+	data = binary.BigEndian.AppendUint16(data, port)
+	return appendDNSName(data, target)
+}
+
+func TestMDNSDiscover(t *testing.T) {
+	d, err := newMDNSDiscovery(&MDNSDiscovery{Service: "_traefik-config._tcp"}, Endpoint{Path: "/config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.exchange = func(_ context.Context, query []byte, _ time.Duration) ([][]byte, error) {
+		name, _, err := readDNSName(query, 12)
+		if err != nil || name != "_traefik-config._tcp.local." {
+			t.Errorf("unexpected query name %q: %v", name, err)
+		}
+		return [][]byte{
+			dnsResponse(
+				dnsRR("_traefik-config._tcp.local.", dnsTypePTR, appendDNSName(nil, "node1._traefik-config._tcp.local.")),
+				dnsRR("node1._traefik-config._tcp.local.", dnsTypeSRV, srvData(8080, "node1.local.")),
+				dnsRR("node1.local.", dnsTypeAAAA, make([]byte, 16)),
+				dnsRR("node1.local.", dnsTypeA, []byte{192, 168, 1, 10}),
+			),
+			dnsResponse(
+				// announced without address, ignored
+				dnsRR("_traefik-config._tcp.local.", dnsTypePTR, appendDNSName(nil, "node2._traefik-config._tcp.local.")),
+				dnsRR("node2._traefik-config._tcp.local.", dnsTypeSRV, srvData(8080, "node2.local.")),
+			),
+			[]byte("garbage"),
+		}, nil
+	}
+
+	endpoints, err := d.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 {
+		t.Fatalf("expected 1 endpoint, got %v", endpoints)
+	}
+	if actual := endpointURL(endpoints["node1"]); actual != "http://192.168.1.10:8080/config" {
+		t.Errorf("unexpected endpoint url %s", actual)
+	}
+}
+
+func TestReadDNSNameCompression(t *testing.T) {
+	msg := appendDNSName(make([]byte, 12), "local.")
+	// node1 followed by a pointer to "local." at offset 12
+	msg = append(msg, 5, 'n', 'o', 'd', 'e', '1', 0xc0, 12)
+	name, next, err := readDNSName(msg, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "node1.local." || next != len(msg) {
+		t.Errorf("unexpected name %q and offset %d", name, next)
+	}
+
+	loop := append(make([]byte, 12), 0xc0, 12)
+	if _, _, err := readDNSName(loop, 12); err == nil {
+		t.Error("expected a compression loop error")
+	}
+}
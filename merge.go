@@ -0,0 +1,393 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/tls"
+)
+
+// Policies for names defined differently by several nodes.
+const (
+	conflictFirstWins = "firstWins"
+	conflictLastWins  = "lastWins"
+	conflictError     = "error"
+	conflictSkipNode  = "skipNode"
+	// services only: combine the servers of load balancers, other conflicts
+	// being resolved by the global policy
+	conflictMergeServers = "mergeServers"
+	// services only: balance between the services of the nodes
+	conflictWeighted = "weighted"
+	// HTTP services only: fall back from the service of the first node to
+	// those of the next ones
+	conflictFailover = "failover"
+)
+
+// mergeSectionNames the configuration sections with their own conflict
+// policy, the service ones accepting mergeServers and weighted.
+var mergeSectionNames = map[string]bool{
+	"routers": false, "services": true, "middlewares": false, "serversTransports": false,
+	"tcpRouters": false, "tcpServices": true, "tcpMiddlewares": false,
+	"udpRouters": false, "udpServices": true,
+	"tlsOptions": false, "tlsStores": false,
+}
+
+// merger merges the configurations of nodes, in the order they are added.
+type merger struct {
+	policy     string
+	policies   map[string]string
+	servers    bool
+	priorities map[string]int
+	weights    map[string]int
+	mirrors    map[string]int
+	config     *dynamic.Configuration
+	owners     map[string]string
+	conflicts  []string
+	// policy of the services generated by the merge, by kind/name
+	generated map[string]string
+	// last failover service of the failover services, by name
+	fallbacks map[string]string
+	// certificates merged, by certificateKey
+	certificates map[string]*tls.CertAndStores
+}
+
+func newMerger(options mergeOptions) *merger {
+	return &merger{
+		policy:     options.policy,
+		policies:   options.policies,
+		servers:    options.servers,
+		priorities: options.priorities,
+		weights:    options.weights,
+		mirrors:    options.mirrors,
+		generated:  map[string]string{},
+		fallbacks:  map[string]string{},
+		config: &dynamic.Configuration{
+			HTTP: &dynamic.HTTPConfiguration{
+				Routers:           map[string]*dynamic.Router{},
+				Services:          map[string]*dynamic.Service{},
+				Middlewares:       map[string]*dynamic.Middleware{},
+				ServersTransports: map[string]*dynamic.ServersTransport{},
+			},
+		},
+		owners:       map[string]string{},
+		certificates: map[string]*tls.CertAndStores{},
+	}
+}
+
+// mergeSection is a map of a configuration with the merged map of the same
+// kind.
+type mergeSection struct {
+	name     string
+	kind     string
+	dst, src reflect.Value
+}
+
+// sectionPolicy returns the conflict policy of s.
+func (m *merger) sectionPolicy(s mergeSection) string {
+	if policy, ok := m.policies[s.name]; ok && policy != conflictMergeServers {
+		return policy
+	}
+	return m.policy
+}
+
+func (m *merger) sections(c *dynamic.Configuration) []mergeSection {
+	var sections []mergeSection
+	if c.HTTP != nil {
+		sections = append(sections,
+			mergeSection{name: "routers", kind: "router", dst: reflect.ValueOf(m.config.HTTP.Routers), src: reflect.ValueOf(c.HTTP.Routers)},
+			mergeSection{name: "services", kind: "service", dst: reflect.ValueOf(m.config.HTTP.Services), src: reflect.ValueOf(c.HTTP.Services)},
+			mergeSection{name: "middlewares", kind: "middleware", dst: reflect.ValueOf(m.config.HTTP.Middlewares), src: reflect.ValueOf(c.HTTP.Middlewares)},
+			mergeSection{name: "serversTransports", kind: "servers transport", dst: reflect.ValueOf(m.config.HTTP.ServersTransports), src: reflect.ValueOf(c.HTTP.ServersTransports)},
+		)
+	}
+	if c.TCP != nil {
+		if m.config.TCP == nil {
+			m.config.TCP = &dynamic.TCPConfiguration{
+				Routers:     map[string]*dynamic.TCPRouter{},
+				Services:    map[string]*dynamic.TCPService{},
+				Middlewares: map[string]*dynamic.TCPMiddleware{},
+			}
+		}
+		sections = append(sections,
+			mergeSection{name: "tcpRouters", kind: "tcp router", dst: reflect.ValueOf(m.config.TCP.Routers), src: reflect.ValueOf(c.TCP.Routers)},
+			mergeSection{name: "tcpServices", kind: "tcp service", dst: reflect.ValueOf(m.config.TCP.Services), src: reflect.ValueOf(c.TCP.Services)},
+			mergeSection{name: "tcpMiddlewares", kind: "tcp middleware", dst: reflect.ValueOf(m.config.TCP.Middlewares), src: reflect.ValueOf(c.TCP.Middlewares)},
+		)
+	}
+	if c.UDP != nil {
+		if m.config.UDP == nil {
+			m.config.UDP = &dynamic.UDPConfiguration{
+				Routers:  map[string]*dynamic.UDPRouter{},
+				Services: map[string]*dynamic.UDPService{},
+			}
+		}
+		sections = append(sections,
+			mergeSection{name: "udpRouters", kind: "udp router", dst: reflect.ValueOf(m.config.UDP.Routers), src: reflect.ValueOf(c.UDP.Routers)},
+			mergeSection{name: "udpServices", kind: "udp service", dst: reflect.ValueOf(m.config.UDP.Services), src: reflect.ValueOf(c.UDP.Services)},
+		)
+	}
+	if c.TLS != nil {
+		m.initTLS()
+		sections = append(sections,
+			mergeSection{name: "tlsOptions", kind: "tls option", dst: reflect.ValueOf(m.config.TLS.Options), src: reflect.ValueOf(c.TLS.Options)},
+			mergeSection{name: "tlsStores", kind: "tls store", dst: reflect.ValueOf(m.config.TLS.Stores), src: reflect.ValueOf(c.TLS.Stores)},
+		)
+	}
+	return sections
+}
+
+func (m *merger) initTLS() {
+	if m.config.TLS == nil {
+		m.config.TLS = &dynamic.TLSConfiguration{
+			Options: map[string]tls.Options{},
+			Stores:  map[string]tls.Store{},
+		}
+	}
+}
+
+// add merges the configuration of node. Names already defined differently by
+// a node of higher priority are kept, those defined by a node of the same
+// priority are resolved by the conflict policy, the error policy failing the
+// merge. The services of mirror nodes already defined are mirrored instead.
+func (m *merger) add(node string, c *dynamic.Configuration) error {
+	sections := m.sections(c)
+	_, mirrorNode := nodeSetting(m.mirrors, node)
+	for _, s := range sections {
+		if m.sectionPolicy(s) == conflictSkipNode {
+			for _, key := range sortedKeys(s.src) {
+				if m.differs(s, key) && !m.outranked(node, s.kind+"/"+key) && !(mirrorNode && s.name == "services") {
+					m.conflict("%s %s of node %s conflicts with node %s, skipping node %s",
+						s.kind, key, node, m.owners[s.kind+"/"+key], node)
+					return nil
+				}
+			}
+		}
+	}
+
+	for _, s := range sections {
+		for _, key := range sortedKeys(s.src) {
+			owner := s.kind + "/" + key
+			value := s.src.MapIndex(reflect.ValueOf(key))
+			if mirrorNode && s.name == "services" && s.dst.MapIndex(reflect.ValueOf(key)).IsValid() {
+				m.mirror(key, node, c.HTTP.Services[key])
+				continue
+			}
+			if union, ok := m.union(s, key); ok {
+				s.dst.SetMapIndex(reflect.ValueOf(key), union)
+				continue
+			}
+			if !m.differs(s, key) {
+				if !s.dst.MapIndex(reflect.ValueOf(key)).IsValid() {
+					s.dst.SetMapIndex(reflect.ValueOf(key), value)
+					m.owners[owner] = node
+				}
+				continue
+			}
+			if m.outranked(node, owner) {
+				continue
+			}
+
+			switch m.sectionPolicy(s) {
+			case conflictLastWins:
+				m.conflict("%s %s of node %s overrides node %s", s.kind, key, node, m.owners[owner])
+				s.dst.SetMapIndex(reflect.ValueOf(key), value)
+				m.owners[owner] = node
+			case conflictWeighted:
+				m.split(s, key, node, value)
+			case conflictFailover:
+				m.failover(key, node, c.HTTP.Services[key])
+			case conflictError:
+				return fmt.Errorf("%s %s of node %s conflicts with node %s", s.kind, key, node, m.owners[owner])
+			default:
+				m.conflict("%s %s of node %s conflicts with node %s, keeping node %s",
+					s.kind, key, node, m.owners[owner], m.owners[owner])
+			}
+		}
+	}
+	if c.TLS != nil {
+		m.config.TLS.Certificates = mergeCertificates(m.config.TLS.Certificates, c.TLS.Certificates, m.certificates)
+	}
+	return nil
+}
+
+// differs reports whether key is already defined differently, services
+// combined by union not being conflicts.
+func (m *merger) differs(s mergeSection, key string) bool {
+	existing := s.dst.MapIndex(reflect.ValueOf(key))
+	if !existing.IsValid() || reflect.DeepEqual(existing.Interface(), s.src.MapIndex(reflect.ValueOf(key)).Interface()) {
+		return false
+	}
+	_, ok := m.union(s, key)
+	return !ok
+}
+
+// union returns the service key already defined differently with the servers
+// of the source service added, when servers are merged and both services are
+// load balancers differing only by their servers.
+func (m *merger) union(s mergeSection, key string) (reflect.Value, bool) {
+	existing := s.dst.MapIndex(reflect.ValueOf(key))
+	service := s.src.MapIndex(reflect.ValueOf(key))
+	servers := m.servers || m.policies[s.name] == conflictMergeServers
+	if !servers || !mergeSectionNames[s.name] || !existing.IsValid() ||
+		reflect.DeepEqual(existing.Interface(), service.Interface()) {
+		return reflect.Value{}, false
+	}
+	return unionServers(existing, service)
+}
+
+// unionServers combines two services of the same type with a load balancer,
+// the servers of b not in a being appended to those of a. The services are
+// not modified.
+func unionServers(a, b reflect.Value) (reflect.Value, bool) {
+	if a.IsNil() || b.IsNil() {
+		return reflect.Value{}, false
+	}
+	lbA, lbB := a.Elem().FieldByName("LoadBalancer"), b.Elem().FieldByName("LoadBalancer")
+	if !lbA.IsValid() || lbA.IsNil() || lbB.IsNil() {
+		return reflect.Value{}, false
+	}
+	// everything but the servers must match
+	if !reflect.DeepEqual(withField(a.Elem(), "LoadBalancer").Interface(), withField(b.Elem(), "LoadBalancer").Interface()) ||
+		!reflect.DeepEqual(withField(lbA.Elem(), "Servers").Interface(), withField(lbB.Elem(), "Servers").Interface()) {
+		return reflect.Value{}, false
+	}
+
+	serversA, serversB := lbA.Elem().FieldByName("Servers"), lbB.Elem().FieldByName("Servers")
+	servers := reflect.AppendSlice(reflect.MakeSlice(serversA.Type(), 0, serversA.Len()+serversB.Len()), serversA)
+	for i := 0; i < serversB.Len(); i++ {
+		server := serversB.Index(i)
+		known := false
+		for j := 0; j < servers.Len() && !known; j++ {
+			known = reflect.DeepEqual(servers.Index(j).Interface(), server.Interface())
+		}
+		if !known {
+			servers = reflect.Append(servers, server)
+		}
+	}
+
+	lb := reflect.New(lbA.Elem().Type())
+	lb.Elem().Set(lbA.Elem())
+	lb.Elem().FieldByName("Servers").Set(servers)
+	service := reflect.New(a.Elem().Type())
+	service.Elem().Set(a.Elem())
+	service.Elem().FieldByName("LoadBalancer").Set(lb)
+	return service, true
+}
+
+// withField returns a copy of the struct v with its field name zeroed.
+func withField(v reflect.Value, name string) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	f := c.FieldByName(name)
+	f.Set(reflect.Zero(f.Type()))
+	return c
+}
+
+// outranked reports whether the owner of a name has a higher priority than
+// node, nodes being merged by decreasing priority.
+func (m *merger) outranked(node, owner string) bool {
+	return nodePriority(m.priorities, m.owners[owner]) > nodePriority(m.priorities, node)
+}
+
+func (m *merger) conflict(format string, args ...interface{}) {
+	m.conflicts = append(m.conflicts, fmt.Sprintf(format, args...))
+}
+
+// nodePriority returns the priority of node, sub-nodes having the priority of
+// their node.
+func nodePriority(priorities map[string]int, node string) int {
+	priority, _ := nodeSetting(priorities, node)
+	return priority
+}
+
+// nodeSetting returns the value of node in values, or of its closest parent
+// node.
+func nodeSetting(values map[string]int, node string) (int, bool) {
+	value, match, found := 0, "", false
+	for name, v := range values {
+		if isSubNode(node, name) && (!found || len(name) > len(match)) {
+			value, match, found = v, name, true
+		}
+	}
+	return value, found
+}
+
+// mergeOrder sorts the nodes of configs by decreasing priority, then the nodes
+// of the order list first, in that order, an entry also covering its
+// sub-nodes, then the other nodes by name.
+func mergeOrder(configs map[string]*dynamic.Configuration, order []string, priorities map[string]int) []string {
+	rank := func(node string) int {
+		for i, name := range order {
+			if isSubNode(node, name) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	nodes := make([]string, 0, len(configs))
+	for node := range configs {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if pi, pj := nodePriority(priorities, nodes[i]), nodePriority(priorities, nodes[j]); pi != pj {
+			return pi > pj
+		}
+		ri, rj := rank(nodes[i]), rank(nodes[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return nodes[i] < nodes[j]
+	})
+	return nodes
+}
+
+func sortedKeys(v reflect.Value) []string {
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeOptions the settings of the merge of the node configurations.
+type mergeOptions struct {
+	policy  string
+	order   []string
+	servers bool
+	dedup   bool
+	// policies of the sections, by section name
+	policies map[string]string
+	// priorities of the nodes, by node name
+	priorities map[string]int
+	// weights of the nodes with one, by node name
+	weights map[string]int
+	// mirroring percents of the mirror nodes, by node name
+	mirrors map[string]int
+}
+
+// mergeConfig merges the node configurations in the merge order, returning the
+// merged configuration with the conflicts found.
+func mergeConfig(configs map[string]*dynamic.Configuration, options mergeOptions) (*dynamic.Configuration, []string, error) {
+	m := newMerger(options)
+	// mirror nodes are merged last, mirroring the services of the others
+	var nodes, mirrors []string
+	for _, node := range mergeOrder(configs, options.order, options.priorities) {
+		if _, ok := nodeSetting(options.mirrors, node); ok {
+			mirrors = append(mirrors, node)
+		} else {
+			nodes = append(nodes, node)
+		}
+	}
+	for _, node := range append(nodes, mirrors...) {
+		if err := m.add(node, configs[node]); err != nil {
+			return nil, m.conflicts, err
+		}
+	}
+	if options.dedup {
+		dedupMiddlewares(m.config)
+	}
+	return m.config, m.conflicts, nil
+}
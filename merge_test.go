@@ -0,0 +1,349 @@
+package multi_http_provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func httpConfig(routers map[string]*dynamic.Router, services map[string]*dynamic.Service) *dynamic.Configuration {
+	return &dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{
+		Routers:     routers,
+		Services:    services,
+		Middlewares: map[string]*dynamic.Middleware{},
+	}}
+}
+
+func serviceWithURL(url string) *dynamic.Service {
+	return &dynamic.Service{LoadBalancer: &dynamic.ServersLoadBalancer{Servers: []dynamic.Server{{URL: url}}}}
+}
+
+func conflictingConfigs() map[string]*dynamic.Configuration {
+	return map[string]*dynamic.Configuration{
+		"node2": httpConfig(
+			map[string]*dynamic.Router{"api": {Rule: "Host(`b`)", Service: "api"}, "web": {Rule: "Host(`web`)", Service: "api"}},
+			map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.2")},
+		),
+		"node1": httpConfig(
+			map[string]*dynamic.Router{"api": {Rule: "Host(`a`)", Service: "api"}},
+			map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.1"), "shared": serviceWithURL("http://10.0.0.9")},
+		),
+		"node3": httpConfig(
+			map[string]*dynamic.Router{"other": {Rule: "Host(`c`)", Service: "shared"}},
+			// identical definitions do not conflict
+			map[string]*dynamic.Service{"shared": serviceWithURL("http://10.0.0.9")},
+		),
+	}
+}
+
+func TestMergeConfigPolicies(t *testing.T) {
+	tests := []struct {
+		policy    string
+		rule      string
+		url       string
+		web       bool
+		conflicts int
+	}{
+		{policy: conflictFirstWins, rule: "Host(`a`)", url: "http://10.0.0.1", web: true, conflicts: 2},
+		{policy: conflictLastWins, rule: "Host(`b`)", url: "http://10.0.0.2", web: true, conflicts: 2},
+		{policy: conflictSkipNode, rule: "Host(`a`)", url: "http://10.0.0.1", web: false, conflicts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			config, conflicts, err := mergeConfig(conflictingConfigs(), mergeOptions{policy: test.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule := config.HTTP.Routers["api"].Rule; rule != test.rule {
+				t.Errorf("expected rule %s, got %s", test.rule, rule)
+			}
+			if url := config.HTTP.Services["api"].LoadBalancer.Servers[0].URL; url != test.url {
+				t.Errorf("expected url %s, got %s", test.url, url)
+			}
+			if _, ok := config.HTTP.Routers["web"]; ok != test.web {
+				t.Errorf("expected router web of node2 to be merged: %v", test.web)
+			}
+			if _, ok := config.HTTP.Routers["other"]; !ok {
+				t.Error("expected the router of node3 to be merged")
+			}
+			if len(conflicts) != test.conflicts {
+				t.Errorf("expected %d conflicts, got %v", test.conflicts, conflicts)
+			}
+			for _, conflict := range conflicts {
+				if !strings.Contains(conflict, "node1") || !strings.Contains(conflict, "node2") {
+					t.Errorf("expected the conflict to name both nodes: %s", conflict)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeConfigErrorPolicy(t *testing.T) {
+	_, _, err := mergeConfig(conflictingConfigs(), mergeOptions{policy: conflictError})
+	if err == nil || !strings.Contains(err.Error(), "router api of node node2 conflicts with node node1") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	configs := conflictingConfigs()
+	delete(configs, "node2")
+	if _, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictError}); err != nil || len(conflicts) != 0 {
+		t.Errorf("expected identical definitions to merge, got %v: %v", conflicts, err)
+	}
+}
+
+func TestMergeServers(t *testing.T) {
+	sticky := serviceWithURL("http://10.0.0.3")
+	sticky.LoadBalancer.Sticky = &dynamic.Sticky{Cookie: &dynamic.Cookie{Name: "lb"}}
+	configs := map[string]*dynamic.Configuration{
+		"node1": httpConfig(nil, map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.1"), "sticky": serviceWithURL("http://10.0.0.1")}),
+		"node2": httpConfig(nil, map[string]*dynamic.Service{"api": {LoadBalancer: &dynamic.ServersLoadBalancer{
+			Servers: []dynamic.Server{{URL: "http://10.0.0.2"}, {URL: "http://10.0.0.1"}},
+		}}}),
+		"node3": httpConfig(nil, map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.3"), "sticky": sticky}),
+	}
+
+	config, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins, servers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []dynamic.Server{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}, {URL: "http://10.0.0.3"}}
+	if servers := config.HTTP.Services["api"].LoadBalancer.Servers; !reflect.DeepEqual(servers, expected) {
+		t.Errorf("expected servers %v, got %v", expected, servers)
+	}
+	// load balancers differing by more than their servers still conflict
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "sticky") {
+		t.Errorf("expected the sticky conflict, got %v", conflicts)
+	}
+	if servers := configs["node1"].HTTP.Services["api"].LoadBalancer.Servers; len(servers) != 1 {
+		t.Errorf("expected the node configuration to be unchanged, got %v", servers)
+	}
+
+	if _, _, err := mergeConfig(configs, mergeOptions{policy: conflictError}); err == nil {
+		t.Error("expected a conflict without merging servers")
+	}
+}
+
+func TestMergePriorities(t *testing.T) {
+	configs := conflictingConfigs()
+	configs["control/0"] = httpConfig(
+		map[string]*dynamic.Router{"api": {Rule: "Host(`control`)", Service: "api"}},
+		map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.100")},
+	)
+	priorities := map[string]int{"control": 10, "node1": 1, "node2": 1}
+
+	for _, policy := range []string{conflictFirstWins, conflictLastWins, conflictSkipNode} {
+		config, conflicts, err := mergeConfig(configs, mergeOptions{policy: policy, priorities: priorities})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule := config.HTTP.Routers["api"].Rule; rule != "Host(`control`)" {
+			t.Errorf("%s: expected the control node to win, got %s", policy, rule)
+		}
+		if url := config.HTTP.Services["api"].LoadBalancer.Servers[0].URL; url != "http://10.0.0.100" {
+			t.Errorf("%s: expected the control service, got %s", policy, url)
+		}
+		if _, ok := config.HTTP.Routers["web"]; !ok {
+			t.Errorf("%s: expected names outranked only to be kept", policy)
+		}
+		// node1 and node2 have the same priority
+		for _, conflict := range conflicts {
+			if strings.Contains(conflict, "control") {
+				t.Errorf("%s: expected only ties to be reported, got %s", policy, conflict)
+			}
+		}
+	}
+
+	_, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictError, priorities: map[string]int{"control": 10, "node1": 2}})
+	if err != nil || len(conflicts) != 0 {
+		t.Errorf("expected no tie, got %v %v", conflicts, err)
+	}
+	if _, _, err := mergeConfig(configs, mergeOptions{policy: conflictError, priorities: map[string]int{"node1": 5, "node2": 5}}); err == nil {
+		t.Error("expected the tie of node1 and node2 to fail")
+	}
+}
+
+func TestMergeTCP(t *testing.T) {
+	tcp := func(address string) *dynamic.Configuration {
+		return &dynamic.Configuration{TCP: &dynamic.TCPConfiguration{
+			Routers:  map[string]*dynamic.TCPRouter{"db": {EntryPoints: []string{"db"}, Service: "db", Rule: "HostSNI(`*`)"}},
+			Services: map[string]*dynamic.TCPService{"db": {LoadBalancer: &dynamic.TCPServersLoadBalancer{Servers: []dynamic.TCPServer{{Address: address}}}}},
+		}}
+	}
+	configs := map[string]*dynamic.Configuration{"node1": tcp("10.0.0.1:5432"), "node2": tcp("10.0.0.2:5432")}
+
+	config, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TCP == nil || config.TCP.Routers["db"] == nil {
+		t.Fatal("expected the tcp router to be merged")
+	}
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "tcp service db") {
+		t.Errorf("expected the tcp service conflict, got %v", conflicts)
+	}
+
+	config, _, err = mergeConfig(configs, mergeOptions{policy: conflictFirstWins, servers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if servers := config.TCP.Services["db"].LoadBalancer.Servers; len(servers) != 2 {
+		t.Errorf("expected the servers of both nodes, got %v", servers)
+	}
+
+	config, _, _ = mergeConfig(conflictingConfigs(), mergeOptions{policy: conflictFirstWins})
+	if config.TCP != nil {
+		t.Errorf("expected no tcp configuration, got %+v", config.TCP)
+	}
+}
+
+func TestMergeUDP(t *testing.T) {
+	udp := func(address string) *dynamic.Configuration {
+		return &dynamic.Configuration{UDP: &dynamic.UDPConfiguration{
+			Routers:  map[string]*dynamic.UDPRouter{"syslog": {EntryPoints: []string{"syslog"}, Service: "syslog"}},
+			Services: map[string]*dynamic.UDPService{"syslog": {LoadBalancer: &dynamic.UDPServersLoadBalancer{Servers: []dynamic.UDPServer{{Address: address}}}}},
+		}}
+	}
+	configs := map[string]*dynamic.Configuration{"node1": udp("10.0.0.1:514"), "node2": udp("10.0.0.2:514"), "web": conflictingConfigs()["node1"]}
+
+	config, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins, servers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.UDP == nil || config.UDP.Routers["syslog"] == nil || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected the udp and http configurations to be merged, got %+v", config)
+	}
+	if servers := config.UDP.Services["syslog"].LoadBalancer.Servers; len(servers) != 2 || len(conflicts) != 0 {
+		t.Errorf("expected the servers of both nodes, got %v %v", servers, conflicts)
+	}
+
+	if _, _, err := mergeConfig(configs, mergeOptions{policy: conflictError}); err == nil || !strings.Contains(err.Error(), "udp service syslog") {
+		t.Errorf("expected the udp service conflict, got %v", err)
+	}
+}
+
+func TestMergeServersTransports(t *testing.T) {
+	transport := func(serverName string) *dynamic.Configuration {
+		config := httpConfig(nil, nil)
+		config.HTTP.ServersTransports = map[string]*dynamic.ServersTransport{"internal": {ServerName: serverName}}
+		return config
+	}
+	configs := map[string]*dynamic.Configuration{"node1": transport("a.internal"), "node2": transport("a.internal"), "node3": transport("b.internal")}
+
+	config, conflicts, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := config.HTTP.ServersTransports["internal"]; st == nil || st.ServerName != "a.internal" {
+		t.Errorf("expected the transport of node1, got %+v", st)
+	}
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "servers transport internal of node node3") {
+		t.Errorf("expected the conflict of node3, got %v", conflicts)
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	configs := map[string]*dynamic.Configuration{"b": nil, "a": nil, "edge/1": nil, "edge/0": nil, "control": nil, "z": nil}
+	tests := []struct {
+		order    []string
+		expected []string
+	}{
+		{expected: []string{"a", "b", "control", "edge/0", "edge/1", "z"}},
+		{order: []string{"control", "edge", "missing"}, expected: []string{"control", "edge/0", "edge/1", "a", "b", "z"}},
+		{order: []string{"z", "edge/1"}, expected: []string{"z", "edge/1", "a", "b", "control", "edge/0"}},
+	}
+	for _, test := range tests {
+		// the order does not depend on the map iteration
+		for i := 0; i < 5; i++ {
+			if actual := mergeOrder(configs, test.order, nil); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("%v: expected %v, got %v", test.order, test.expected, actual)
+			}
+		}
+	}
+
+	if actual := mergeOrder(configs, []string{"z"}, map[string]int{"edge": 1, "edge/1": 2}); !reflect.DeepEqual(actual, []string{"edge/1", "edge/0", "z", "a", "b", "control"}) {
+		t.Errorf("expected the nodes by priority first, got %v", actual)
+	}
+
+	config, _, err := mergeConfig(conflictingConfigs(), mergeOptions{policy: conflictFirstWins, order: []string{"node2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := config.HTTP.Routers["api"].Rule; rule != "Host(`b`)" {
+		t.Errorf("expected the router of node2 merged first, got %s", rule)
+	}
+}
+
+func TestInitConflictPolicy(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+	config.ConflictPolicy = "random"
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected an unsupported conflict policy error")
+	}
+
+	tests := []struct {
+		policies map[string]string
+		valid    bool
+	}{
+		{policies: map[string]string{"routers": conflictError, "services": conflictMergeServers, "tcpServices": conflictMergeServers}, valid: true},
+		{policies: map[string]string{"services": conflictFailover, "udpServices": conflictWeighted}, valid: true},
+		{policies: map[string]string{"tcpServices": conflictFailover}},
+		{policies: map[string]string{"middlewares": conflictMergeServers}},
+		{policies: map[string]string{"router": conflictError}},
+		{policies: map[string]string{"routers": "random"}},
+	}
+	for _, test := range tests {
+		config.ConflictPolicy = ""
+		config.ConflictPolicies = test.policies
+		p, err := New(context.Background(), config, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Init(); (err == nil) != test.valid {
+			t.Errorf("%v: expected valid %v, got %v", test.policies, test.valid, err)
+		}
+	}
+}
+
+func TestMergeSectionPolicies(t *testing.T) {
+	configs := conflictingConfigs()
+	configs["node3"].HTTP.Middlewares["auth"] = &dynamic.Middleware{BasicAuth: &dynamic.BasicAuth{Users: []string{"a"}}}
+	configs["node4"] = httpConfig(nil, map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.4")})
+	configs["node4"].HTTP.Middlewares["auth"] = &dynamic.Middleware{BasicAuth: &dynamic.BasicAuth{Users: []string{"b"}}}
+
+	options := mergeOptions{policy: conflictFirstWins, policies: map[string]string{"services": conflictMergeServers, "middlewares": conflictLastWins}}
+	config, conflicts, err := mergeConfig(configs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if servers := config.HTTP.Services["api"].LoadBalancer.Servers; len(servers) != 3 {
+		t.Errorf("expected the servers of node1, node2 and node4, got %v", servers)
+	}
+	if users := config.HTTP.Middlewares["auth"].BasicAuth.Users; users[0] != "b" {
+		t.Errorf("expected the middleware of node4 to win, got %v", users)
+	}
+	if rule := config.HTTP.Routers["api"].Rule; rule != "Host(`a`)" {
+		t.Errorf("expected the router of node1 to win, got %s", rule)
+	}
+	if len(conflicts) != 2 {
+		t.Errorf("expected the router and middleware conflicts, got %v", conflicts)
+	}
+
+	options.policies["routers"] = conflictError
+	if _, _, err := mergeConfig(configs, options); err == nil || !strings.Contains(err.Error(), "router api") {
+		t.Errorf("expected the router conflict to fail, got %v", err)
+	}
+	options.policies = map[string]string{"routers": conflictSkipNode}
+	config, _, _ = mergeConfig(configs, options)
+	if _, ok := config.HTTP.Routers["web"]; ok {
+		t.Error("expected node2 to be skipped for its router conflict")
+	}
+}
@@ -0,0 +1,221 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics the embedded listener exposing the health of the provider in the
+// Prometheus text format, on Path (default /metrics).
+type Metrics struct {
+	Address string `json:"address,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// fetchBuckets the upper bounds of the fetch duration histogram, in seconds.
+var fetchBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricsRegistry struct {
+	address string
+	path    string
+
+	mu             sync.Mutex
+	durations      map[string]*histogram
+	errors         map[string]int
+	lastSuccess    map[string]time.Time
+	publishes      int
+	publishedBytes int
+	conflicts      int
+	droppedRouters int64
+	restarts       *int64
+}
+
+type histogram struct {
+	counts []int
+	count  int
+	sum    float64
+}
+
+func newMetricsRegistry(config *Metrics, restarts *int64) *metricsRegistry {
+	if config == nil {
+		return nil
+	}
+	path := config.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return &metricsRegistry{
+		address:     config.Address,
+		path:        path,
+		durations:   map[string]*histogram{},
+		errors:      map[string]int{},
+		lastSuccess: map[string]time.Time{},
+		restarts:    restarts,
+	}
+}
+
+// fetched records a fetch of node lasting d, failed with err if not nil.
+func (m *metricsRegistry) fetched(node string, d time.Duration, err error, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.durations[node]
+	if h == nil {
+		h = &histogram{counts: make([]int, len(fetchBuckets))}
+		m.durations[node] = h
+	}
+	for i, bound := range fetchBuckets {
+		if d.Seconds() <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += d.Seconds()
+	if err != nil {
+		m.errors[node]++
+		return
+	}
+	m.lastSuccess[node] = now
+}
+
+// published records a published configuration of size bytes.
+func (m *metricsRegistry) published(size int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publishes++
+	m.publishedBytes = size
+}
+
+// merged records the conflicts of the last merge.
+func (m *metricsRegistry) merged(conflicts int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conflicts = conflicts
+}
+
+// dropped counts the routers removed by the filters.
+func (m *metricsRegistry) dropped(routers int) {
+	if m != nil && routers > 0 {
+		atomic.AddInt64(&m.droppedRouters, int64(routers))
+	}
+}
+
+// forget drops the metrics of a stopped node.
+func (m *metricsRegistry) forget(node string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.durations, node)
+	delete(m.errors, node)
+	delete(m.lastSuccess, node)
+}
+
+// write writes the metrics in the Prometheus text format.
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make([]string, 0, len(m.durations))
+	for node := range m.durations {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	fmt.Fprintln(w, "# HELP multihttp_fetch_duration_seconds Duration of the fetches of the polled endpoints.")
+	fmt.Fprintln(w, "# TYPE multihttp_fetch_duration_seconds histogram")
+	for _, node := range nodes {
+		h := m.durations[node]
+		for i, bound := range fetchBuckets {
+			fmt.Fprintf(w, "multihttp_fetch_duration_seconds_bucket{node=%q,le=\"%g\"} %d\n", node, bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "multihttp_fetch_duration_seconds_bucket{node=%q,le=\"+Inf\"} %d\n", node, h.count)
+		fmt.Fprintf(w, "multihttp_fetch_duration_seconds_sum{node=%q} %g\n", node, h.sum)
+		fmt.Fprintf(w, "multihttp_fetch_duration_seconds_count{node=%q} %d\n", node, h.count)
+	}
+	fmt.Fprintln(w, "# HELP multihttp_fetch_errors_total Failed fetches of the polled endpoints.")
+	fmt.Fprintln(w, "# TYPE multihttp_fetch_errors_total counter")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "multihttp_fetch_errors_total{node=%q} %d\n", node, m.errors[node])
+	}
+	fmt.Fprintln(w, "# HELP multihttp_last_success_timestamp_seconds Time of the last successful fetch of the polled endpoints.")
+	fmt.Fprintln(w, "# TYPE multihttp_last_success_timestamp_seconds gauge")
+	for _, node := range nodes {
+		if t, ok := m.lastSuccess[node]; ok {
+			fmt.Fprintf(w, "multihttp_last_success_timestamp_seconds{node=%q} %d\n", node, t.Unix())
+		}
+	}
+	fmt.Fprintln(w, "# HELP multihttp_publishes_total Merged configurations published to Traefik.")
+	fmt.Fprintln(w, "# TYPE multihttp_publishes_total counter")
+	fmt.Fprintf(w, "multihttp_publishes_total %d\n", m.publishes)
+	fmt.Fprintln(w, "# HELP multihttp_published_config_bytes Size of the last published configuration.")
+	fmt.Fprintln(w, "# TYPE multihttp_published_config_bytes gauge")
+	fmt.Fprintf(w, "multihttp_published_config_bytes %d\n", m.publishedBytes)
+	fmt.Fprintln(w, "# HELP multihttp_merge_conflicts Conflicts of the last merge.")
+	fmt.Fprintln(w, "# TYPE multihttp_merge_conflicts gauge")
+	fmt.Fprintf(w, "multihttp_merge_conflicts %d\n", m.conflicts)
+	fmt.Fprintln(w, "# HELP multihttp_dropped_routers_total Routers removed by the filters.")
+	fmt.Fprintln(w, "# TYPE multihttp_dropped_routers_total counter")
+	fmt.Fprintf(w, "multihttp_dropped_routers_total %d\n", atomic.LoadInt64(&m.droppedRouters))
+	fmt.Fprintln(w, "# HELP multihttp_loop_restarts_total Restarts of the configuration loop after a panic.")
+	fmt.Fprintln(w, "# TYPE multihttp_loop_restarts_total counter")
+	fmt.Fprintf(w, "multihttp_loop_restarts_total %d\n", atomic.LoadInt64(m.restarts))
+}
+
+// ServeHTTP serves the metrics on their path.
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != m.path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// serveMetrics starts the metrics listener, stopped when the context is
+// canceled.
+func (p *Provider) serveMetrics(ctx context.Context) error {
+	listener, err := net.Listen("tcp", p.metrics.address)
+	if err != nil {
+		return fmt.Errorf("starting metrics listener: %w", err)
+	}
+	server := &http.Server{Handler: p.metrics, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics listener stopped", "error", err)
+		}
+	}()
+	return nil
+}
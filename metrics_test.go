@@ -0,0 +1,80 @@
+package multi_http_provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	var restarts int64 = 2
+	m := newMetricsRegistry(&Metrics{Address: ":9100"}, &restarts)
+	now := time.Unix(1700000000, 0)
+	m.fetched("edge", 200*time.Millisecond, nil, now)
+	m.fetched("edge", 3*time.Second, errors.New("timeout"), now.Add(time.Minute))
+	m.fetched("gone", time.Second, nil, now)
+	m.forget("gone")
+	m.published(1234)
+	m.merged(3)
+	m.dropped(4)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`multihttp_fetch_duration_seconds_bucket{node="edge",le="0.1"} 0`,
+		`multihttp_fetch_duration_seconds_bucket{node="edge",le="0.25"} 1`,
+		`multihttp_fetch_duration_seconds_bucket{node="edge",le="+Inf"} 2`,
+		`multihttp_fetch_duration_seconds_sum{node="edge"} 3.2`,
+		`multihttp_fetch_errors_total{node="edge"} 1`,
+		`multihttp_last_success_timestamp_seconds{node="edge"} 1700000000`,
+		"multihttp_publishes_total 1",
+		"multihttp_published_config_bytes 1234",
+		"multihttp_merge_conflicts 3",
+		"multihttp_dropped_routers_total 4",
+		"multihttp_loop_restarts_total 2",
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("expected %s in:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "gone") {
+		t.Error("expected the metrics of a stopped node to be dropped")
+	}
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestFilterConfigDroppedRouters(t *testing.T) {
+	var restarts int64
+	p := &Provider{entrypoints: map[string]bool{"web": true}, unmatchedEntryPoints: unmatchedDrop, metrics: newMetricsRegistry(&Metrics{}, &restarts)}
+	body := `{"http":{"routers":{"a":{"entryPoints":["web"],"service":"s"},"b":{"entryPoints":["admin"],"service":"s"}},"services":{"s":{"loadBalancer":{}}}}}`
+	if config := p.filterConfig(endpoint{}, []byte(body)); config == nil || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected router a, got %+v", config)
+	}
+	if n := p.metrics.droppedRouters; n != 1 {
+		t.Errorf("expected 1 dropped router, got %d", n)
+	}
+}
+
+func TestInitMetrics(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+	config.Metrics = &Metrics{}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected the metrics address to be required")
+	}
+}
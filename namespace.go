@@ -0,0 +1,158 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// namespaceConfig prefixes the names of the routers, services and middlewares
+// of a node configuration with the node name, rewriting the references to
+// them. References to names the node does not define, and to other providers,
+// are kept.
+func namespaceConfig(node string, config *dynamic.Configuration) {
+	if config == nil {
+		return
+	}
+	prefix := normalizeName(node) + "-"
+	if config.HTTP != nil {
+		namespaceHTTP(prefix, config.HTTP)
+	}
+	if config.TCP != nil {
+		namespaceTCP(prefix, config.TCP)
+	}
+	if config.UDP != nil {
+		namespaceUDP(prefix, config.UDP)
+	}
+}
+
+// namespacer returns the function prefixing the names of defined.
+func namespacer(prefix string, defined reflect.Value) func(string) string {
+	names := map[string]bool{}
+	for _, key := range defined.MapKeys() {
+		names[key.String()] = true
+	}
+	return func(name string) string {
+		if names[name] && !strings.Contains(name, "@") {
+			return prefix + name
+		}
+		return name
+	}
+}
+
+func namespaceHTTP(prefix string, http *dynamic.HTTPConfiguration) {
+	service := namespacer(prefix, reflect.ValueOf(http.Services))
+	middleware := namespacer(prefix, reflect.ValueOf(http.Middlewares))
+	transport := namespacer(prefix, reflect.ValueOf(http.ServersTransports))
+
+	routers := map[string]*dynamic.Router{}
+	for name, r := range http.Routers {
+		r.Service = service(r.Service)
+		for i, m := range r.Middlewares {
+			r.Middlewares[i] = middleware(m)
+		}
+		routers[prefix+name] = r
+	}
+	http.Routers = routers
+
+	renamedServices := map[string]*dynamic.Service{}
+	for name, s := range http.Services {
+		if s.LoadBalancer != nil {
+			s.LoadBalancer.ServersTransport = transport(s.LoadBalancer.ServersTransport)
+		}
+		if s.Weighted != nil {
+			for i := range s.Weighted.Services {
+				s.Weighted.Services[i].Name = service(s.Weighted.Services[i].Name)
+			}
+		}
+		if s.Mirroring != nil {
+			s.Mirroring.Service = service(s.Mirroring.Service)
+			for i := range s.Mirroring.Mirrors {
+				s.Mirroring.Mirrors[i].Name = service(s.Mirroring.Mirrors[i].Name)
+			}
+		}
+		if s.Failover != nil {
+			s.Failover.Service = service(s.Failover.Service)
+			s.Failover.Fallback = service(s.Failover.Fallback)
+		}
+		renamedServices[prefix+name] = s
+	}
+	http.Services = renamedServices
+
+	renamedMiddlewares := map[string]*dynamic.Middleware{}
+	for name, m := range http.Middlewares {
+		if m.Chain != nil {
+			for i, c := range m.Chain.Middlewares {
+				m.Chain.Middlewares[i] = middleware(c)
+			}
+		}
+		if m.Errors != nil {
+			m.Errors.Service = service(m.Errors.Service)
+		}
+		renamedMiddlewares[prefix+name] = m
+	}
+	http.Middlewares = renamedMiddlewares
+
+	if http.ServersTransports != nil {
+		transports := map[string]*dynamic.ServersTransport{}
+		for name, t := range http.ServersTransports {
+			transports[prefix+name] = t
+		}
+		http.ServersTransports = transports
+	}
+}
+
+func namespaceTCP(prefix string, tcp *dynamic.TCPConfiguration) {
+	service := namespacer(prefix, reflect.ValueOf(tcp.Services))
+	middleware := namespacer(prefix, reflect.ValueOf(tcp.Middlewares))
+
+	routers := map[string]*dynamic.TCPRouter{}
+	for name, r := range tcp.Routers {
+		r.Service = service(r.Service)
+		for i, m := range r.Middlewares {
+			r.Middlewares[i] = middleware(m)
+		}
+		routers[prefix+name] = r
+	}
+	tcp.Routers = routers
+
+	services := map[string]*dynamic.TCPService{}
+	for name, s := range tcp.Services {
+		if s.Weighted != nil {
+			for i := range s.Weighted.Services {
+				s.Weighted.Services[i].Name = service(s.Weighted.Services[i].Name)
+			}
+		}
+		services[prefix+name] = s
+	}
+	tcp.Services = services
+
+	middlewares := map[string]*dynamic.TCPMiddleware{}
+	for name, m := range tcp.Middlewares {
+		middlewares[prefix+name] = m
+	}
+	tcp.Middlewares = middlewares
+}
+
+func namespaceUDP(prefix string, udp *dynamic.UDPConfiguration) {
+	service := namespacer(prefix, reflect.ValueOf(udp.Services))
+
+	routers := map[string]*dynamic.UDPRouter{}
+	for name, r := range udp.Routers {
+		r.Service = service(r.Service)
+		routers[prefix+name] = r
+	}
+	udp.Routers = routers
+
+	services := map[string]*dynamic.UDPService{}
+	for name, s := range udp.Services {
+		if s.Weighted != nil {
+			for i := range s.Weighted.Services {
+				s.Weighted.Services[i].Name = service(s.Weighted.Services[i].Name)
+			}
+		}
+		services[prefix+name] = s
+	}
+	udp.Services = services
+}
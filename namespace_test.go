@@ -0,0 +1,140 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestNamespaceConfig(t *testing.T) {
+	config := &dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{
+		Routers: map[string]*dynamic.Router{
+			"api": {Service: "api", Middlewares: []string{"secured", "auth@file", "global"}},
+			"ext": {Service: "other@docker"},
+		},
+		Services: map[string]*dynamic.Service{
+			"api":     {Weighted: &dynamic.WeightedRoundRobin{Services: []dynamic.WRRService{{Name: "v1"}, {Name: "v2@file"}}}},
+			"v1":      {Failover: &dynamic.Failover{Service: "main", Fallback: "backup"}},
+			"main":    {Mirroring: &dynamic.Mirroring{Service: "backup", Mirrors: []dynamic.MirrorService{{Name: "main"}}}},
+			"backup":  {LoadBalancer: &dynamic.ServersLoadBalancer{}},
+			"errorsv": {LoadBalancer: &dynamic.ServersLoadBalancer{}},
+		},
+		Middlewares: map[string]*dynamic.Middleware{
+			"secured": {Chain: &dynamic.Chain{Middlewares: []string{"errors", "global"}}},
+			"errors":  {Errors: &dynamic.ErrorPage{Service: "errorsv"}},
+		},
+	}}
+	namespaceConfig("edge/1", config)
+
+	api := config.HTTP.Routers["edge-1-api"]
+	if api == nil {
+		t.Fatalf("expected router edge-1-api, got %v", routerNames(config))
+	}
+	if api.Service != "edge-1-api" {
+		t.Errorf("unexpected service %s", api.Service)
+	}
+	// global is not defined by the node, it is kept as is
+	if !reflect.DeepEqual(api.Middlewares, []string{"edge-1-secured", "auth@file", "global"}) {
+		t.Errorf("unexpected middlewares %v", api.Middlewares)
+	}
+	if s := config.HTTP.Routers["edge-1-ext"].Service; s != "other@docker" {
+		t.Errorf("expected references to other providers to be kept, got %s", s)
+	}
+
+	services := config.HTTP.Services
+	if w := services["edge-1-api"].Weighted.Services; w[0].Name != "edge-1-v1" || w[1].Name != "v2@file" {
+		t.Errorf("unexpected weighted services %v", w)
+	}
+	if f := services["edge-1-v1"].Failover; f.Service != "edge-1-main" || f.Fallback != "edge-1-backup" {
+		t.Errorf("unexpected failover %+v", f)
+	}
+	if m := services["edge-1-main"].Mirroring; m.Service != "edge-1-backup" || m.Mirrors[0].Name != "edge-1-main" {
+		t.Errorf("unexpected mirroring %+v", m)
+	}
+
+	middlewares := config.HTTP.Middlewares
+	if c := middlewares["edge-1-secured"].Chain.Middlewares; !reflect.DeepEqual(c, []string{"edge-1-errors", "global"}) {
+		t.Errorf("unexpected chain %v", c)
+	}
+	if s := middlewares["edge-1-errors"].Errors.Service; s != "edge-1-errorsv" {
+		t.Errorf("unexpected errors service %s", s)
+	}
+}
+
+func TestNamespaceConfigServersTransports(t *testing.T) {
+	config := httpConfig(nil, map[string]*dynamic.Service{
+		"api":   {LoadBalancer: &dynamic.ServersLoadBalancer{ServersTransport: "internal"}},
+		"other": {LoadBalancer: &dynamic.ServersLoadBalancer{ServersTransport: "shared@file"}},
+	})
+	config.HTTP.ServersTransports = map[string]*dynamic.ServersTransport{"internal": {}}
+
+	namespaceConfig("edge", config)
+	if _, ok := config.HTTP.ServersTransports["edge-internal"]; !ok {
+		t.Errorf("expected the namespaced transport, got %v", config.HTTP.ServersTransports)
+	}
+	if st := config.HTTP.Services["edge-api"].LoadBalancer.ServersTransport; st != "edge-internal" {
+		t.Errorf("unexpected transport reference %s", st)
+	}
+	if st := config.HTTP.Services["edge-other"].LoadBalancer.ServersTransport; st != "shared@file" {
+		t.Errorf("expected the reference to another provider to be kept, got %s", st)
+	}
+}
+
+func TestNamespaceConfigTCP(t *testing.T) {
+	config := &dynamic.Configuration{TCP: &dynamic.TCPConfiguration{
+		Routers: map[string]*dynamic.TCPRouter{"db": {Service: "db", Middlewares: []string{"allow", "global@file"}}},
+		Services: map[string]*dynamic.TCPService{
+			"db":    {LoadBalancer: &dynamic.TCPServersLoadBalancer{}},
+			"split": {Weighted: &dynamic.TCPWeightedRoundRobin{Services: []dynamic.TCPWRRService{{Name: "db"}, {Name: "other"}}}},
+		},
+		Middlewares: map[string]*dynamic.TCPMiddleware{"allow": {}},
+	}}
+
+	namespaceConfig("edge", config)
+	r := config.TCP.Routers["edge-db"]
+	if r == nil || r.Service != "edge-db" || !reflect.DeepEqual(r.Middlewares, []string{"edge-allow", "global@file"}) {
+		t.Fatalf("unexpected router %+v", r)
+	}
+	if w := config.TCP.Services["edge-split"].Weighted.Services; w[0].Name != "edge-db" || w[1].Name != "other" {
+		t.Errorf("unexpected weighted services %v", w)
+	}
+	if _, ok := config.TCP.Middlewares["edge-allow"]; !ok {
+		t.Errorf("expected the namespaced middleware, got %v", config.TCP.Middlewares)
+	}
+}
+
+func TestNamespaceConfigUDP(t *testing.T) {
+	config := &dynamic.Configuration{UDP: &dynamic.UDPConfiguration{
+		Routers: map[string]*dynamic.UDPRouter{"syslog": {Service: "syslog"}, "external": {Service: "syslog@file"}},
+		Services: map[string]*dynamic.UDPService{
+			"syslog": {LoadBalancer: &dynamic.UDPServersLoadBalancer{}},
+			"split":  {Weighted: &dynamic.UDPWeightedRoundRobin{Services: []dynamic.UDPWRRService{{Name: "syslog"}}}},
+		},
+	}}
+
+	namespaceConfig("edge", config)
+	if r := config.UDP.Routers["edge-syslog"]; r == nil || r.Service != "edge-syslog" {
+		t.Fatalf("unexpected router %+v", r)
+	}
+	if r := config.UDP.Routers["edge-external"]; r == nil || r.Service != "syslog@file" {
+		t.Errorf("expected the reference to another provider to be kept, got %+v", r)
+	}
+	if w := config.UDP.Services["edge-split"].Weighted.Services; w[0].Name != "edge-syslog" {
+		t.Errorf("unexpected weighted services %v", w)
+	}
+}
+
+func TestParseUpdateNamespace(t *testing.T) {
+	body := `[{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api","rule":"Path(` + "`/`" + `)"}},` +
+		`"services":{"api":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}}}]`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	u := p.parseUpdate("node1", endpoint{namespace: true}, "", []byte(body))
+	if len(u.parts) != 1 || u.parts[0] == nil {
+		t.Fatalf("expected one part, got %+v", u)
+	}
+	if r := u.parts[0].HTTP.Routers["node1-api"]; r == nil || r.Service != "node1-api" {
+		t.Errorf("expected the namespaced router, got %v", routerNames(u.parts[0]))
+	}
+}
@@ -0,0 +1,43 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ndjsonToJSON assembles newline-delimited JSON fragments, each a partial
+// configuration such as a single router or service, into one document.
+// Fragments are merged recursively, later values replacing earlier ones.
+func ndjsonToJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	config := map[string]interface{}{}
+	for line := 1; ; line++ {
+		var fragment map[string]interface{}
+		err := decoder.Decode(&fragment)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fragment %d: %w", line, err)
+		}
+		mergeFragment(config, fragment)
+	}
+	return json.Marshal(config)
+}
+
+func mergeFragment(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if from, ok := v.(map[string]interface{}); ok {
+			if to, ok := dst[k].(map[string]interface{}); ok {
+				mergeFragment(to, from)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,71 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNDJSONToJSON(t *testing.T) {
+	tests := []struct {
+		desc     string
+		body     string
+		expected string
+		wantErr  bool
+	}{
+		{
+			desc: "fragments",
+			body: `{"http":{"routers":{"a":{"service":"a","entryPoints":["web"]}}}}
+{"http":{"services":{"a":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}}}
+
+{"http":{"routers":{"b":{"service":"a","priority":10}}}}
+`,
+			expected: `{"http":{"routers":{"a":{"entryPoints":["web"],"service":"a"},"b":{"priority":10,"service":"a"}},"services":{"a":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}}}`,
+		},
+		{
+			desc:     "later values replace earlier ones",
+			body:     `{"http":{"routers":{"a":{"service":"a","rule":"Host(` + "`a`" + `)"}}}}` + "\n" + `{"http":{"routers":{"a":{"service":"b"}}}}`,
+			expected: `{"http":{"routers":{"a":{"rule":"Host(` + "`a`" + `)","service":"b"}}}}`,
+		},
+		{desc: "empty", body: "", expected: `{}`},
+		{desc: "not an object", body: `{"http":{}}` + "\n" + `["a"]`, wantErr: true},
+		{desc: "truncated", body: `{"http":{"routers":`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			actual, err := ndjsonToJSON([]byte(test.body))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var a, e interface{}
+			if err := json.Unmarshal(actual, &a); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &e); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(a, e) {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseNDJSONConfig(t *testing.T) {
+	body := routerConfig("first", "web") + "\n" + routerConfig("second", "web") + "\n"
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	config := p.parseConfig(endpoint{}, "application/x-ndjson", []byte(body))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if len(config.HTTP.Routers) != 2 || len(config.HTTP.Services) != 2 {
+		t.Errorf("expected 2 routers and services, got %v", routerNames(config))
+	}
+}
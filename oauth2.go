@@ -0,0 +1,129 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokens are renewed this long before they expire, or halfway through
+	// their lifetime when shorter
+	oauth2ExpiryDelta = time.Minute
+	// lifetime of tokens returned without expires_in
+	oauth2DefaultLifetime = 5 * time.Minute
+)
+
+// OAuth2 the client credentials used to obtain endpoint tokens from an OAuth2
+// token URL.
+type OAuth2 struct {
+	TokenURL         string   `json:"tokenURL,omitempty"`
+	ClientID         string   `json:"clientID,omitempty"`
+	ClientSecret     string   `json:"clientSecret,omitempty"`
+	ClientSecretFile string   `json:"clientSecretFile,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	Audience         string   `json:"audience,omitempty"`
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+func (o *OAuth2) validate() error {
+	if o.ClientID == "" {
+		return fmt.Errorf("oauth2 clientID is required")
+	}
+	if o.ClientSecret != "" && o.ClientSecretFile != "" {
+		return fmt.Errorf("oauth2 clientSecret and clientSecretFile are mutually exclusive")
+	}
+	return validateURL(o.TokenURL)
+}
+
+// accessToken returns the cached token, requesting a new one with the client
+// credentials grant when it is about to expire.
+func (o *OAuth2) accessToken(ctx context.Context, client *http.Client, vault *vaultClient) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != "" && time.Now().Before(o.refreshAt) {
+		return o.token, nil
+	}
+	token, lifetime, err := o.requestToken(ctx, client, vault)
+	if err != nil {
+		return "", err
+	}
+	delta := oauth2ExpiryDelta
+	if lifetime/2 < delta {
+		delta = lifetime / 2
+	}
+	o.token = token
+	o.refreshAt = time.Now().Add(lifetime - delta)
+	return token, nil
+}
+
+func (o *OAuth2) requestToken(ctx context.Context, client *http.Client, vault *vaultClient) (string, time.Duration, error) {
+	secret, err := secretValue(ctx, vault, o.ClientSecret, o.ClientSecretFile)
+	if err != nil {
+		return "", 0, fmt.Errorf("client secret: %w", err)
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	if o.Audience != "" {
+		form.Set("audience", o.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(expandVars(o.ClientID)), url.QueryEscape(secret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, err
+	}
+	var token struct {
+		AccessToken      string      `json:"access_token"`
+		TokenType        string      `json:"token_type"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("token response with status %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token request failed with status %s: %s %s", resp.Status, token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response without access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type %q", token.TokenType)
+	}
+
+	lifetime := oauth2DefaultLifetime
+	if token.ExpiresIn != "" {
+		seconds, err := token.ExpiresIn.Int64()
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid expires_in %q", token.ExpiresIn)
+		}
+		lifetime = time.Duration(seconds) * time.Second
+	}
+	return token.AccessToken, lifetime, nil
+}
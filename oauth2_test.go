@@ -0,0 +1,112 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTokenServer(t *testing.T, expiresIn string, requests *int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(requests, 1)
+		id, secret, _ := r.BasicAuth()
+		if id != "provider" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "config:read traefik" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-` + string(rune('0'+n)) + `","token_type":"Bearer"` + expiresIn + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var requests int32
+	tokens := newTokenServer(t, `,"expires_in":3600`, &requests)
+
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	o := &OAuth2{TokenURL: tokens.URL, ClientID: "provider", ClientSecret: "s3cret", Scopes: []string{"config:read", "traefik"}}
+	e := endpoint{url: srv.URL, client: srv.Client(), auth: &Auth{OAuth2: o}}
+	for i := 0; i < 3; i++ {
+		if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "Bearer token-1" {
+			t.Errorf("expected the cached token, got %q", authorization)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 token request, got %d", n)
+	}
+
+	// the token is renewed once it is about to expire
+	o.mu.Lock()
+	o.refreshAt = time.Now().Add(-time.Second)
+	o.mu.Unlock()
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer token-2" {
+		t.Errorf("expected a renewed token, got %q", authorization)
+	}
+}
+
+func TestOAuth2DefaultLifetime(t *testing.T) {
+	var requests int32
+	tokens := newTokenServer(t, "", &requests)
+
+	o := &OAuth2{TokenURL: tokens.URL, ClientID: "provider", ClientSecret: "s3cret", Scopes: []string{"config:read", "traefik"}}
+	if _, err := o.accessToken(context.Background(), tokens.Client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(o.refreshAt); d < oauth2DefaultLifetime-oauth2ExpiryDelta-time.Minute || d > oauth2DefaultLifetime {
+		t.Errorf("unexpected refresh delay %s", d)
+	}
+}
+
+func TestOAuth2Errors(t *testing.T) {
+	var requests int32
+	tokens := newTokenServer(t, "", &requests)
+
+	o := &OAuth2{TokenURL: tokens.URL, ClientID: "provider", ClientSecret: "wrong"}
+	if _, err := o.accessToken(context.Background(), tokens.Client(), nil); err == nil {
+		t.Error("expected an error for rejected credentials")
+	}
+
+	tests := []struct {
+		desc   string
+		oauth2 *OAuth2
+	}{
+		{desc: "missing client id", oauth2: &OAuth2{TokenURL: "https://idp.internal/token"}},
+		{desc: "invalid token url", oauth2: &OAuth2{TokenURL: "idp.internal/token", ClientID: "a"}},
+		{desc: "secret and file", oauth2: &OAuth2{TokenURL: "https://idp.internal/token", ClientID: "a", ClientSecret: "b", ClientSecretFile: "/c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := (&Auth{OAuth2: test.oauth2}).validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if err := (&Auth{Username: "a", OAuth2: &OAuth2{TokenURL: "https://idp.internal/token", ClientID: "a"}}).validate(); err == nil {
+		t.Error("expected oauth2 and basic credentials to conflict")
+	}
+}
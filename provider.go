@@ -1,43 +1,340 @@
 package multi_http_provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/types"
 )
 
 type Endpoint struct {
-	Endpoint string            `json:"endpoint,omitempty"`
-	Headers  map[string]string `json:"headers,omitempty"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	Scheme     string            `json:"scheme,omitempty"`
+	Port       int               `json:"port,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	ClientCert string            `json:"clientCert,omitempty"`
+	ClientKey  string            `json:"clientKey,omitempty"`
+	CAFile     string            `json:"caFile,omitempty"`
+	Proxy      *Proxy            `json:"proxy,omitempty"`
+	Mode       string            `json:"mode,omitempty"`
+	Wait       string            `json:"wait,omitempty"`
+	S3         *S3               `json:"s3,omitempty"`
+	Kubernetes *Kubernetes       `json:"kubernetes,omitempty"`
+	Format     string            `json:"format,omitempty"`
+	Auth       *Auth             `json:"auth,omitempty"`
+	JWS        *JWS              `json:"jws,omitempty"`
+	Decryption *Decryption       `json:"decryption,omitempty"`
+	Namespace  bool              `json:"namespace,omitempty"`
+	// AllowRouters and DenyRouters filter the routers of the node by name,
+	// with regular expressions, on top of those of the provider.
+	AllowRouters []string `json:"allowRouters,omitempty"`
+	DenyRouters  []string `json:"denyRouters,omitempty"`
+	// AllowedDomains the hosts the routers of the node may match, a
+	// *.example.com domain allowing the subdomains of example.com.
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+	// Priority of the node on name conflicts, the highest winning.
+	Priority int `json:"priority,omitempty"`
+	// EntryPoints the routers of the node may use, overriding the
+	// entrypoints of the provider.
+	EntryPoints []string `json:"entrypoints,omitempty"`
+	// Weight of the node in the services split by the weighted policy.
+	Weight *int `json:"weight,omitempty"`
+	// MirrorPercent makes the node a mirror, receiving this percentage of the
+	// requests to the same-named services of the other nodes.
+	MirrorPercent *int `json:"mirrorPercent,omitempty"`
+	// InjectMiddlewares prepends these middlewares to the routers of the
+	// node, after those of the provider.
+	InjectMiddlewares []string `json:"injectMiddlewares,omitempty"`
+	// RewriteServers points the load balancer servers of the node at the
+	// node, for nodes reporting backends only they can reach.
+	RewriteServers *RewriteServers `json:"rewriteServers,omitempty"`
+	// RouterPriorityOffset is added to the priorities of the routers of the
+	// node, so that its routes outrank or yield to overlapping ones.
+	RouterPriorityOffset int `json:"routerPriorityOffset,omitempty"`
+	// PathPrefix mounts the HTTP routers of the node under this path,
+	// stripping it before the requests reach their middlewares.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// Filter a jq-style filter selecting the configuration in the JSON
+	// response, such as .data.config or del(.metadata).
+	Filter string `json:"filter,omitempty"`
+	// Retry the retries of the failed fetches, overriding those of the
+	// provider.
+	Retry *Retry `json:"retry,omitempty"`
+	// PollInterval and PollTimeout override those of the provider for the
+	// node, when polled.
+	PollInterval string `json:"pollInterval,omitempty"`
+	PollTimeout  string `json:"pollTimeout,omitempty"`
 }
 
 // Config the plugin configuration.
 type Config struct {
-	PollInterval string              `json:"pollInterval,omitempty"`
-	PollTimeout  string              `json:"pollTimeout,omitempty"`
-	EntryPoints  []string            `json:"entrypoints,omitempty"`
-	Endpoints    map[string]Endpoint `json:"endpoints,omitempty"`
+	PollInterval  string               `json:"pollInterval,omitempty"`
+	PollTimeout   string               `json:"pollTimeout,omitempty"`
+	EntryPoints   []string             `json:"entrypoints,omitempty"`
+	Endpoints     map[string]Endpoint  `json:"endpoints,omitempty"`
+	TLS           *ClientTLS           `json:"tls,omitempty"`
+	Proxy         *Proxy               `json:"proxy,omitempty"`
+	Webhook       *Webhook             `json:"webhook,omitempty"`
+	Discovery     map[string]Discovery `json:"discovery,omitempty"`
+	EndpointsFile string               `json:"endpointsFile,omitempty"`
+	Vault         *Vault               `json:"vault,omitempty"`
+	// PollJitter moves each poll randomly by up to this percentage of
+	// PollInterval, such as 20%, so instances do not poll in lockstep.
+	PollJitter string `json:"pollJitter,omitempty"`
+	// MaxConcurrency the number of endpoints polled at the same time.
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// Tracing exports the traces of the poll cycles over OTLP/HTTP.
+	Tracing *Tracing `json:"tracing,omitempty"`
+	// LogLevel the level of the logs: debug, info (default), warn or error,
+	// shared by the provider instances of the process.
+	LogLevel string `json:"logLevel,omitempty"`
+	// Metrics the listener exposing the health of the provider to
+	// Prometheus.
+	Metrics *Metrics `json:"metrics,omitempty"`
+	// Status the listener exposing the state of the endpoints and the merged
+	// configuration.
+	Status *Status `json:"status,omitempty"`
+	// HTTPClient tunes the connections to the endpoints.
+	HTTPClient *HTTPClient `json:"httpClient,omitempty"`
+	// MaxResponseBytes rejects the responses of the endpoints larger than
+	// this, decompressed or not.
+	MaxResponseBytes int `json:"maxResponseBytes,omitempty"`
+	// Retry the default retries of the polled endpoints.
+	Retry *Retry `json:"retry,omitempty"`
+	// KeepLastKnownGood keeps publishing the last configuration of the
+	// polled endpoints failing to respond.
+	KeepLastKnownGood bool `json:"keepLastKnownGood,omitempty"`
+	// StaleTTL evicts the last known configuration of an endpoint failing
+	// for longer, such as 1h.
+	StaleTTL string `json:"staleTTL,omitempty"`
+	// CircuitBreaker stops polling the endpoints failing repeatedly.
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+	// Flapping detects the endpoints whose configuration keeps changing.
+	Flapping *Flapping `json:"flapping,omitempty"`
+	// MinEndpoints the polled endpoints, a number or a percentage such as
+	// 50%, that must respond in a cycle for the configuration to be
+	// published.
+	MinEndpoints string `json:"minEndpoints,omitempty"`
+	// CacheControl defers the next poll of an endpoint until its response
+	// expires, per its Cache-Control max-age.
+	CacheControl bool `json:"cacheControl,omitempty"`
+	// Debounce delays the publishing of the merged configuration until the
+	// nodes have been quiet for this long, such as 2s.
+	Debounce string `json:"debounce,omitempty"`
+	// AllowEmpty publishes merged configurations without routers after
+	// configurations with routers, and when no node has a configuration.
+	AllowEmpty bool `json:"allowEmpty,omitempty"`
+	// UnmatchedEntryPointPolicy handles the routers without a configured
+	// entrypoint: drop (default), keep or reassign to DefaultEntryPoints.
+	UnmatchedEntryPointPolicy string `json:"unmatchedEntryPointPolicy,omitempty"`
+	// DefaultEntryPoints of reassigned routers, the entrypoints by default.
+	DefaultEntryPoints []string `json:"defaultEntryPoints,omitempty"`
+	// AssignEmptyEntryPoints publishes the routers without entrypoints on
+	// DefaultEntryPoints rather than treating them as unmatched.
+	AssignEmptyEntryPoints bool `json:"assignEmptyEntryPoints,omitempty"`
+	// AllowRouters and DenyRouters filter the routers of all nodes by name,
+	// with regular expressions.
+	AllowRouters []string `json:"allowRouters,omitempty"`
+	DenyRouters  []string `json:"denyRouters,omitempty"`
+	// EntryPointMapping renames the router entrypoints before filtering.
+	EntryPointMapping map[string]string `json:"entryPointMapping,omitempty"`
+	// InjectMiddlewares prepends these middlewares to the routers of all
+	// nodes, such as security-headers@file.
+	InjectMiddlewares []string `json:"injectMiddlewares,omitempty"`
+	// StripMiddlewares removes the middlewares matching these names or
+	// regular expressions from the routers of all nodes.
+	StripMiddlewares []string `json:"stripMiddlewares,omitempty"`
+	// RewriteMiddlewares replaces the middlewares matching a name or regular
+	// expression, expanding $1 style references, such as auth: auth@file.
+	RewriteMiddlewares map[string]string `json:"rewriteMiddlewares,omitempty"`
+	// ForceTLS replaces the TLS configuration of every HTTP router, such as
+	// with a certResolver and domains, so no router is served in plaintext.
+	ForceTLS *dynamic.RouterTLSConfig `json:"forceTLS,omitempty"`
+	// StrictReferences drops the routers referencing services or
+	// middlewares their node does not define, but for SharedReferences,
+	// names or regular expressions such as .*@file.
+	StrictReferences bool     `json:"strictReferences,omitempty"`
+	SharedReferences []string `json:"sharedReferences,omitempty"`
+	// Template the text/template file rendering the JSON configuration of
+	// each node before it is filtered, from its node, endpoint and config.
+	Template string `json:"template,omitempty"`
+	// Transformers the names of the registered transformers mutating the
+	// configuration of each node, in order, see RegisterTransformer.
+	Transformers []string `json:"transformers,omitempty"`
+	// ConflictPolicy resolves names defined differently by several nodes:
+	// firstWins (default), lastWins, error or skipNode.
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+	// Namespace prefixes the names defined by every node with the node name.
+	Namespace bool `json:"namespace,omitempty"`
+	// MergeOrder lists the nodes merged first, the others following by name.
+	MergeOrder []string `json:"mergeOrder,omitempty"`
+	// MergeServers combines the servers of same-named load balancer services.
+	MergeServers bool `json:"mergeServers,omitempty"`
+	// ConflictPolicies overrides the conflict policy of sections: routers,
+	// services, middlewares, serversTransports, tcpRouters, tcpServices,
+	// tcpMiddlewares, udpRouters, udpServices, tlsOptions and tlsStores.
+	// Services also accept mergeServers.
+	ConflictPolicies map[string]string `json:"conflictPolicies,omitempty"`
+	// DedupMiddlewares collapses the middlewares configured identically.
+	DedupMiddlewares bool `json:"dedupMiddlewares,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
 func CreateConfig() *Config {
 	return &Config{
-		PollInterval: "15s",
-		PollTimeout:  "10s",
-		Endpoints:    map[string]Endpoint{},
-		EntryPoints:  []string{},
+		PollInterval:     "15s",
+		PollTimeout:      "10s",
+		MaxConcurrency:   8,
+		MaxResponseBytes: 32 << 20,
+		Endpoints:        map[string]Endpoint{},
+		EntryPoints:      []string{},
 	}
 }
 
+// restartBackoff the delay before restarting the configuration loop after a
+// panic, doubled after each restart up to maxRestartBackoff.
+var (
+	restartBackoff    = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// Policies for routers without a configured entrypoint.
+const (
+	unmatchedDrop     = "drop"
+	unmatchedKeep     = "keep"
+	unmatchedReassign = "reassign"
+)
+
+const (
+	modePoll       = "poll"
+	modeSSE        = "sse"
+	modeWebSocket  = "websocket"
+	modeLongPoll   = "longpoll"
+	modeGRPC       = "grpc"
+	modeWebhook    = "webhook"
+	modeFile       = "file"
+	modeConsul     = "consul"
+	modeEtcd       = "etcd"
+	modeRedis      = "redis"
+	modeKubernetes = "kubernetes"
+)
+
 type endpoint struct {
-	endpoint string
-	headers  map[string]string
+	url         string
+	mode        string
+	wait        time.Duration
+	socket      string
+	headers     map[string]string
+	client      *http.Client
+	source      source
+	kubernetes  *kubernetesObject
+	format      string
+	auth        *Auth
+	jws         *jwsVerifier
+	decrypter   cipher.AEAD
+	vault       *vaultClient
+	namespace   bool
+	priority    int
+	weight      *int
+	mirror      *int
+	entrypoints []string
+	routers     *routerFilter
+	domains     []string
+	inject      []string
+	servers     *serverRewriter
+	offset      int
+	pathPrefix  string
+	filter      jqFilter
+	retry       *retryPolicy
+	cache       *responseCache
+	maxBytes    int
+	// the poll interval and timeout of the node, those of the provider when 0
+	interval time.Duration
+	timeout  time.Duration
+	// the span of the poll cycle parsing the response, if traced
+	span *span
+}
+
+// source fetches the configuration of polled endpoints not served over plain
+// HTTP GET requests.
+type source interface {
+	fetch(ctx context.Context, e endpoint) ([]byte, error)
+}
+
+// setHeaders sets the endpoint headers and credentials on req, their ${VAR}
+// references being expanded and their files read on every request.
+func (e endpoint) setHeaders(req *http.Request) error {
+	if err := setHeaderValues(req, e.headers, e.vault); err != nil {
+		return err
+	}
+	return e.auth.authorize(req, e.client, e.vault)
+}
+
+// setHeaderValues sets headers on req. Values of the form file:<path> are
+// replaced with the trimmed content of the file, vault:<path>#<field> ones with
+// the Vault secret, the others have their ${VAR} references expanded.
+func setHeaderValues(req *http.Request, headers map[string]string, vault *vaultClient) error {
+	for k, v := range headers {
+		var file string
+		if path, ok := strings.CutPrefix(v, "file:"); ok {
+			file = path
+		}
+		value, err := secretValue(req.Context(), vault, v, file)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+		req.Header.Set(k, value)
+	}
+	return nil
+}
+
+// expandVars replaces the ${VAR} references of s with the value of the VAR
+// environment variable, empty when unset.
+func expandVars(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		b.WriteString(os.Getenv(s[start+2 : start+end]))
+		s = s[start+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func (e endpoint) String() string {
+	if e.socket != "" {
+		return "unix://" + e.socket
+	}
+	return e.url
 }
 
 // Provider a simple provider plugin.
@@ -46,8 +343,52 @@ type Provider struct {
 	pollInterval time.Duration
 	pollTimeout  time.Duration
 	endpoints    map[string]endpoint
+	discoveries  map[string]*discovery
 	entrypoints  map[string]bool
+	webhook      *Webhook
+	tls          *ClientTLS
+	roots        *x509.CertPool
+	proxy        *Proxy
+	httpClient   *HTTPClient
+	transports   transportCache
+	vault        *vaultClient
+	merge        mergeOptions
+	namespace    bool
 	cancel       func()
+	// closed once the configuration loop has returned
+	done chan struct{}
+	// the restarts of the configuration loop after a panic
+	restarts int64
+	metrics  *metricsRegistry
+	status   *statusRegistry
+	tracer   *tracer
+
+	// endpoints polled at the same time, retrying as configured by default
+	pollJitter        float64
+	cacheControl      bool
+	debounce          time.Duration
+	maxConcurrency    int
+	maxResponseBytes  int
+	retry             *Retry
+	keepLastKnownGood bool
+	staleTTL          time.Duration
+	breaker           *circuitBreaker
+	flapping          *flapDetector
+	minEndpoints      *quorum
+	allowEmpty        bool
+	// routers without a configured entrypoint
+	unmatchedEntryPoints string
+	defaultEntryPoints   []string
+	entrypointMapping    map[string]string
+	// routers without entrypoints are published on the default ones
+	assignEmptyEntryPoints bool
+	routers                *routerFilter
+	inject                 []string
+	middlewares            *middlewareRewriter
+	forceTLS               *dynamic.RouterTLSConfig
+	references             *referenceChecker
+	template               *template.Template
+	transformers           []namedTransformer
 }
 
 // New creates a new Provider plugin.
@@ -62,27 +403,374 @@ func New(ctx context.Context, config *Config, name string) (*Provider, error) {
 		return nil, err
 	}
 
-	endpoints := map[string]endpoint{}
+	roots, err := config.TLS.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		name:         name,
+		pollInterval: pi,
+		pollTimeout:  pt,
+		endpoints:    map[string]endpoint{},
+		discoveries:  map[string]*discovery{},
+		entrypoints:  map[string]bool{},
+		webhook:      config.Webhook,
+		tls:          config.TLS,
+		roots:        roots,
+		proxy:        config.Proxy,
+		httpClient:   config.HTTPClient,
+		namespace:    config.Namespace,
+		merge: mergeOptions{
+			policy:   config.ConflictPolicy,
+			order:    config.MergeOrder,
+			servers:  config.MergeServers,
+			dedup:    config.DedupMiddlewares,
+			policies: config.ConflictPolicies,
+		},
+	}
+	if p.merge.policy == "" {
+		p.merge.policy = conflictFirstWins
+	}
+	if p.routers, err = newRouterFilter(config.AllowRouters, config.DenyRouters); err != nil {
+		return nil, err
+	}
+	if p.pollJitter, err = parseJitter(config.PollJitter); err != nil {
+		return nil, fmt.Errorf("pollJitter: %w", err)
+	}
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	setLogLevel(name, level)
+	p.metrics = newMetricsRegistry(config.Metrics, &p.restarts)
+	p.status = newStatusRegistry(config.Status)
+	p.maxConcurrency = config.MaxConcurrency
+	p.maxResponseBytes = config.MaxResponseBytes
+	p.cacheControl = config.CacheControl
+	p.retry = config.Retry
+	p.keepLastKnownGood = config.KeepLastKnownGood
+	if p.breaker, err = newCircuitBreaker(config.CircuitBreaker); err != nil {
+		return nil, fmt.Errorf("circuitBreaker: %w", err)
+	}
+	if p.flapping, err = newFlapDetector(config.Flapping); err != nil {
+		return nil, fmt.Errorf("flapping: %w", err)
+	}
+	if p.minEndpoints, err = parseQuorum(config.MinEndpoints); err != nil {
+		return nil, fmt.Errorf("minEndpoints: %w", err)
+	}
+	p.allowEmpty = config.AllowEmpty
+	if config.Debounce != "" {
+		if p.debounce, err = time.ParseDuration(config.Debounce); err != nil {
+			return nil, fmt.Errorf("debounce: %w", err)
+		}
+	}
+	if config.StaleTTL != "" {
+		if p.staleTTL, err = time.ParseDuration(config.StaleTTL); err != nil {
+			return nil, fmt.Errorf("staleTTL: %w", err)
+		}
+	}
+	p.inject = config.InjectMiddlewares
+	p.forceTLS = config.ForceTLS
+	if p.template, err = newTransformTemplate(config.Template); err != nil {
+		return nil, err
+	}
+	if p.transformers, err = lookupTransformers(config.Transformers); err != nil {
+		return nil, err
+	}
+	if p.references, err = newReferenceChecker(config.StrictReferences, config.SharedReferences); err != nil {
+		return nil, err
+	}
+	if p.middlewares, err = newMiddlewareRewriter(config.StripMiddlewares, config.RewriteMiddlewares); err != nil {
+		return nil, err
+	}
+	if config.Vault != nil {
+		client, err := p.newClient(Endpoint{Endpoint: config.Vault.Address, CAFile: config.Vault.CAFile}, p.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+		p.vault, err = newVaultClient(config.Vault, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Tracing != nil {
+		client, err := p.newClient(Endpoint{Endpoint: config.Tracing.Endpoint}, p.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		p.tracer = newTracer(config.Tracing, client)
+	}
 	for k, v := range config.Endpoints {
-		endpoints[k] = endpoint{
-			endpoint: v.Endpoint,
-			headers:  v.Headers,
+		e, err := p.newEndpoint(v)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", k, err)
+		}
+		p.endpoints[k] = e
+	}
+	for k, v := range config.Discovery {
+		d, err := p.newDiscovery(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("discovery %s: %w", k, err)
+		}
+		p.discoveries[k] = d
+	}
+	if config.EndpointsFile != "" {
+		p.discoveries[config.EndpointsFile] = &discovery{
+			interval:   fileCheckInterval,
+			discoverer: &endpointsFile{path: config.EndpointsFile},
 		}
 	}
-	entrypoints := map[string]bool{}
 	for _, entrypoint := range config.EntryPoints {
-		entrypoints[entrypoint] = true
+		p.entrypoints[entrypoint] = true
 	}
+	p.unmatchedEntryPoints = config.UnmatchedEntryPointPolicy
+	if p.unmatchedEntryPoints == "" {
+		p.unmatchedEntryPoints = unmatchedDrop
+	}
+	p.entrypointMapping = config.EntryPointMapping
+	p.assignEmptyEntryPoints = config.AssignEmptyEntryPoints
+	p.defaultEntryPoints = config.DefaultEntryPoints
+	if len(p.defaultEntryPoints) == 0 {
+		p.defaultEntryPoints = config.EntryPoints
+	}
+	return p, nil
+}
 
-	return &Provider{
-		name:         name,
-		pollInterval: pi,
-		pollTimeout:  pt,
-		endpoints:    endpoints,
-		entrypoints:  entrypoints,
+// newEndpoint prepares the client and URL of an endpoint.
+func (p *Provider) newEndpoint(v Endpoint) (endpoint, error) {
+	v.Endpoint = expandVars(v.Endpoint)
+	v.Path = expandVars(v.Path)
+	var object *kubernetesObject
+	if isKubernetesURL(v.Endpoint) {
+		var err error
+		object, err = parseKubernetesURL(v.Endpoint, v.Kubernetes)
+		if err != nil {
+			return endpoint{}, err
+		}
+		if v.CAFile == "" && (v.Kubernetes == nil || v.Kubernetes.APIServer == "") {
+			v.CAFile = serviceAccountCA
+		}
+	}
+	client, err := p.newClient(v, p.proxy)
+	if err != nil {
+		return endpoint{}, err
+	}
+	wait := 5 * time.Minute
+	if v.Wait != "" {
+		wait, err = time.ParseDuration(v.Wait)
+		if err != nil {
+			return endpoint{}, err
+		}
+	}
+	jws, err := newJWSVerifier(v.JWS)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("jws: %w", err)
+	}
+	decrypter, err := newDecrypter(v.Decryption, p.vault)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("decryption: %w", err)
+	}
+	routers, err := newRouterFilter(v.AllowRouters, v.DenyRouters)
+	if err != nil {
+		return endpoint{}, err
+	}
+	address := v.Endpoint
+	if unixSocket(v.Endpoint) == "" && !strings.Contains(address, "://") {
+		address = endpointURL(v)
+	}
+	servers, err := newServerRewriter(v.RewriteServers, address)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("rewriteServers: %w", err)
+	}
+	filter, err := parseJQFilter(v.Filter)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("filter: %w", err)
+	}
+	retryConfig := v.Retry
+	if retryConfig == nil {
+		retryConfig = p.retry
+	}
+	retry, err := newRetryPolicy(retryConfig)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("retry: %w", err)
+	}
+	var interval, timeout time.Duration
+	if v.PollInterval != "" {
+		if interval, err = time.ParseDuration(v.PollInterval); err != nil {
+			return endpoint{}, fmt.Errorf("pollInterval: %w", err)
+		}
+	}
+	if v.PollTimeout != "" {
+		if timeout, err = time.ParseDuration(v.PollTimeout); err != nil {
+			return endpoint{}, fmt.Errorf("pollTimeout: %w", err)
+		}
+	}
+	var src source
+	u := endpointURL(v)
+	if isS3URL(v.Endpoint) {
+		s3 := v.S3
+		if s3 == nil {
+			s3 = &S3{}
+		}
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(v.Endpoint, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return endpoint{}, fmt.Errorf("s3 endpoints must be s3://bucket/key")
+		}
+		src = newS3Source(s3)
+		u = s3ObjectURL(v.Endpoint, s3)
+	}
+	if isRedisURL(v.Endpoint) {
+		target, err := parseRedisURL(v.Endpoint)
+		if err != nil {
+			return endpoint{}, err
+		}
+		src = &redisSource{target: target}
+	}
+	return endpoint{
+		url:         u,
+		source:      src,
+		wait:        wait,
+		mode:        endpointMode(v),
+		socket:      unixSocket(v.Endpoint),
+		headers:     v.Headers,
+		client:      client,
+		kubernetes:  object,
+		format:      v.Format,
+		auth:        v.Auth,
+		jws:         jws,
+		decrypter:   decrypter,
+		vault:       p.vault,
+		namespace:   v.Namespace || p.namespace,
+		priority:    v.Priority,
+		weight:      v.Weight,
+		mirror:      v.MirrorPercent,
+		entrypoints: v.EntryPoints,
+		routers:     routers,
+		domains:     v.AllowedDomains,
+		inject:      v.InjectMiddlewares,
+		servers:     servers,
+		offset:      v.RouterPriorityOffset,
+		pathPrefix:  strings.TrimSuffix(v.PathPrefix, "/"),
+		filter:      filter,
+		retry:       retry,
+		cache:       &responseCache{},
+		maxBytes:    p.maxResponseBytes,
+		interval:    interval,
+		timeout:     timeout,
 	}, nil
 }
 
+// endpointMode returns the endpoint mode, WebSocket, gRPC, file, Consul, etcd,
+// Redis channel and Kubernetes URLs implying their mode.
+func endpointMode(e Endpoint) string {
+	if e.Mode != "" {
+		return e.Mode
+	}
+	if isWebSocketURL(e.Endpoint) || e.Scheme == "ws" || e.Scheme == "wss" {
+		return modeWebSocket
+	}
+	if isGRPCURL(e.Endpoint) {
+		return modeGRPC
+	}
+	if isFileURL(e.Endpoint) {
+		return modeFile
+	}
+	if isConsulURL(e.Endpoint) {
+		return modeConsul
+	}
+	if isEtcdURL(e.Endpoint) {
+		return modeEtcd
+	}
+	if isRedisURL(e.Endpoint) && strings.Contains(e.Endpoint, "channel=") {
+		return modeRedis
+	}
+	if isKubernetesURL(e.Endpoint) {
+		return modeKubernetes
+	}
+	return modePoll
+}
+
+// endpointURL builds the URL polled for an endpoint. A full URL given in
+// Endpoint is used as is, otherwise it is built from the host, scheme, port
+// and path settings. Unix socket endpoints are requested on the configured
+// path of a placeholder host, the socket being dialed by the client.
+// WebSocket URLs are mapped to their HTTP equivalent used for the handshake,
+// gRPC ones to the URL of the watch method.
+func endpointURL(e Endpoint) string {
+	path := e.Path
+	if path == "" {
+		path = "/traefik/config"
+	} else if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if unixSocket(e.Endpoint) != "" {
+		return "http://localhost" + path
+	}
+	if isWebSocketURL(e.Endpoint) {
+		return "http" + strings.TrimPrefix(e.Endpoint, "ws")
+	}
+	if isGRPCURL(e.Endpoint) {
+		return grpcURL(e.Endpoint)
+	}
+	if isFileURL(e.Endpoint) || isS3URL(e.Endpoint) || isRedisURL(e.Endpoint) || isKubernetesURL(e.Endpoint) {
+		return e.Endpoint
+	}
+	if isConsulURL(e.Endpoint) {
+		return consulKVURL(e)
+	}
+	if isEtcdURL(e.Endpoint) {
+		return etcdURL(e)
+	}
+	if strings.Contains(e.Endpoint, "://") {
+		return e.Endpoint
+	}
+	scheme := e.Scheme
+	switch scheme {
+	case "":
+		scheme = "http"
+	case "ws", "wss":
+		scheme = "http" + strings.TrimPrefix(scheme, "ws")
+	}
+	port := e.Port
+	if port == 0 {
+		port = 5000
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(e.Endpoint, strconv.Itoa(port)), path)
+}
+
+func isWebSocketURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "ws://") || strings.HasPrefix(endpoint, "wss://")
+}
+
+// unixSocket returns the socket path of unix:///path/to/socket endpoints.
+func unixSocket(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "unix://") {
+		return ""
+	}
+	return strings.TrimPrefix(endpoint, "unix://")
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host in url %q", raw)
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("port %s out of range", port)
+		}
+	}
+	return nil
+}
+
 // Init the provider.
 func (p *Provider) Init() error {
 	if p.pollInterval <= 0 {
@@ -91,157 +779,1292 @@ func (p *Provider) Init() error {
 	if p.pollTimeout <= 0 {
 		return fmt.Errorf("poll timeout must be greater than 0")
 	}
-	if len(p.endpoints) <= 0 {
+	if p.maxConcurrency <= 0 {
+		return fmt.Errorf("maxConcurrency must be greater than 0")
+	}
+	if p.maxResponseBytes < 0 || p.maxResponseBytes > maxDecodedBody {
+		return fmt.Errorf("maxResponseBytes must be between 0 and %d", maxDecodedBody)
+	}
+	if p.debounce < 0 || p.debounce >= p.pollInterval {
+		return fmt.Errorf("debounce must be positive and shorter than the poll interval")
+	}
+	if p.staleTTL < 0 || p.staleTTL > 0 && !p.keepLastKnownGood {
+		return fmt.Errorf("staleTTL must be positive and requires keepLastKnownGood")
+	}
+	if len(p.endpoints) <= 0 && len(p.discoveries) <= 0 {
 		return fmt.Errorf("must provide at least 1 endpoint")
 	}
 	if len(p.entrypoints) <= 0 {
 		return fmt.Errorf("must specify at least one entrypoint")
 	}
+	if p.webhook != nil && p.webhook.Address == "" {
+		return fmt.Errorf("webhook address must be set")
+	}
+	if p.webhook != nil && p.webhook.Token == "" && !p.webhook.Insecure && !isLoopbackAddress(p.webhook.Address) {
+		return fmt.Errorf("webhook token must be set unless its address is a loopback one or insecure is set")
+	}
+	if p.metrics != nil && p.metrics.address == "" {
+		return fmt.Errorf("metrics address must be set")
+	}
+	if p.status != nil && p.status.address == "" {
+		return fmt.Errorf("status address must be set")
+	}
+	if p.status != nil && p.status.router != nil && p.status.router.EntryPoint == "" {
+		return fmt.Errorf("status router entrypoint must be set")
+	}
+	if p.tracer != nil {
+		if err := validateURL(p.tracer.url); err != nil {
+			return fmt.Errorf("tracing: %w", err)
+		}
+	}
+	switch p.merge.policy {
+	case conflictFirstWins, conflictLastWins, conflictError, conflictSkipNode:
+	default:
+		return fmt.Errorf("unsupported conflict policy %q", p.merge.policy)
+	}
+	switch p.unmatchedEntryPoints {
+	case unmatchedDrop, unmatchedKeep:
+	case unmatchedReassign:
+		if len(p.defaultEntryPoints) == 0 {
+			return fmt.Errorf("the reassign unmatched entrypoint policy requires defaultEntryPoints or entrypoints")
+		}
+	default:
+		return fmt.Errorf("unsupported unmatched entrypoint policy %q", p.unmatchedEntryPoints)
+	}
+	for section, policy := range p.merge.policies {
+		services, ok := mergeSectionNames[section]
+		if !ok {
+			return fmt.Errorf("unsupported conflict policy section %q", section)
+		}
+		switch {
+		case policy == conflictFirstWins, policy == conflictLastWins, policy == conflictError, policy == conflictSkipNode:
+		case (policy == conflictMergeServers || policy == conflictWeighted) && services:
+		case policy == conflictFailover && section == "services":
+		default:
+			return fmt.Errorf("unsupported conflict policy %q for %s", policy, section)
+		}
+	}
+	for name, e := range p.endpoints {
+		if err := p.validateEndpoint(e); err != nil {
+			return fmt.Errorf("endpoint %s: %w", name, err)
+		}
+	}
+	for name, d := range p.discoveries {
+		if d.prefix == "" {
+			continue
+		}
+		for node := range p.endpoints {
+			if isSubNode(node, name) || isSubNode(name, node) {
+				return fmt.Errorf("discovery %s conflicts with endpoint %s", name, node)
+			}
+		}
+	}
 	return nil
 }
 
+func (p *Provider) validateEndpoint(e endpoint) error {
+	switch e.format {
+	case "", formatJSON, formatYAML, formatTOML, formatNDJSON, formatDocker, formatCRD:
+	default:
+		return fmt.Errorf("unsupported format %q", e.format)
+	}
+	if err := e.auth.validate(); err != nil {
+		return err
+	}
+	if e.mirror != nil && (*e.mirror < 0 || *e.mirror > 100) {
+		return fmt.Errorf("mirrorPercent must be between 0 and 100")
+	}
+	if e.pathPrefix != "" && (!strings.HasPrefix(e.pathPrefix, "/") || strings.ContainsAny(e.pathPrefix, "`")) {
+		return fmt.Errorf("pathPrefix must be an absolute path")
+	}
+	if e.interval < 0 || e.timeout < 0 {
+		return fmt.Errorf("pollInterval and pollTimeout must not be negative")
+	}
+	if e.socket != "" && !strings.HasPrefix(e.socket, "/") {
+		return fmt.Errorf("unix socket path must be absolute")
+	}
+	switch e.mode {
+	case modePoll, modeSSE, modeWebSocket, modeLongPoll, modeGRPC, modeConsul, modeEtcd, modeRedis:
+	case modeKubernetes:
+		if e.kubernetes == nil {
+			return fmt.Errorf("kubernetes mode requires a kubernetes:// endpoint")
+		}
+		return nil
+	case modeWebhook:
+		if p.webhook == nil {
+			return fmt.Errorf("webhook mode requires the webhook listener")
+		}
+		return nil
+	case modeFile:
+		if !strings.HasPrefix(strings.TrimPrefix(e.url, "file://"), "/") {
+			return fmt.Errorf("file path must be absolute")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported mode %q", e.mode)
+	}
+	if e.wait <= 0 {
+		return fmt.Errorf("wait must be greater than 0")
+	}
+	if isRedisURL(e.url) {
+		return nil
+	}
+	return validateURL(e.url)
+}
+
 // Provide creates and send dynamic configuration.
 func (p *Provider) Provide(cfgChan chan<- json.Marshaler) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	p.cancel = cancel
 
+	updates := make(chan update)
+	if p.webhook != nil {
+		if err := p.serveWebhook(ctx, updates); err != nil {
+			cancel()
+			return err
+		}
+	}
+	if p.metrics != nil {
+		if err := p.serveMetrics(ctx); err != nil {
+			cancel()
+			return err
+		}
+	}
+	if p.status != nil {
+		if err := p.serveStatus(ctx); err != nil {
+			cancel()
+			return err
+		}
+	}
+
+	// done is only waited for once the loop runs
+	p.done = make(chan struct{})
 	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				log.Print(err)
+		defer close(p.done)
+		backoff := restartBackoff
+		for {
+			started := time.Now()
+			if !p.runLoadConfiguration(ctx, cfgChan, updates) {
+				return
 			}
-		}()
-
-		p.loadConfiguration(ctx, cfgChan)
+			restarts := atomic.AddInt64(&p.restarts, 1)
+			// a loop that ran for a while panicked on something new
+			if time.Since(started) > maxRestartBackoff {
+				backoff = restartBackoff
+			}
+			logger.Warn("Restarting the configuration loop", "backoff", backoff, "restarts", restarts)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+		}
 	}()
 
 	return nil
 }
 
-func (p *Provider) fetchConfig(endpoint string) ([]byte, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s:5000/traefik/config", endpoint))
+// runLoadConfiguration runs the configuration loop until ctx is done,
+// reporting whether it panicked. The watchers and discoveries of the loop are
+// stopped with it.
+func (p *Provider) runLoadConfiguration(ctx context.Context, cfgChan chan<- json.Marshaler, updates chan update) (panicked bool) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("Recovered from a panic of the configuration loop", "error", err)
+			panicked = ctx.Err() == nil
+		}
+	}()
+
+	p.loadConfiguration(runCtx, cfgChan, updates)
+	return false
+}
+
+// fetchConfig returns the configuration of a polled endpoint with its
+// Content-Type, empty when unknown, retrying the failed fetches per the retry
+// policy of the endpoint. The cached configuration is returned with
+// errNotModified when the endpoint reports it unchanged.
+func (p *Provider) fetchConfig(ctx context.Context, e endpoint) ([]byte, string, error) {
+	r := polled{e: e}
+	p.fetch(ctx, &r, false)
+	return r.body, r.contentType, r.err
+}
+
+// fetch fetches the configuration of r like fetchConfig, decoding it as it
+// is read when stream is set and nothing needs the whole response.
+func (p *Provider) fetch(ctx context.Context, r *polled, stream bool) {
+	notModified := false
+	r.err = r.e.retry.do(ctx, func() error {
+		err := p.fetchOnce(ctx, r, stream)
+		if errors.Is(err, errNotModified) {
+			notModified = true
+			return nil
+		}
+		return err
+	})
+	if r.err == nil && notModified {
+		r.body, r.contentType = r.e.cache.cached()
+		r.config, r.decoded = nil, false
+		r.err = errNotModified
+	}
+}
+
+// fetchOnce fetches the configuration of a polled endpoint into r, giving up
+// after the poll timeout.
+func (p *Provider) fetchOnce(ctx context.Context, r *polled, stream bool) error {
+	e := r.e
+	r.body, r.contentType, r.config, r.decoded = []byte{}, "", nil, false
+	timeout := e.timeout
+	if timeout == 0 {
+		timeout = p.pollTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if e.source != nil {
+		body, err := e.source.fetch(ctx, e)
+		if err == nil {
+			r.body = body
+		}
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url, nil)
 	if err != nil {
-		return []byte{}, err
+		return err
+	}
+	req.Header.Set("Accept", e.accept())
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if err := e.setHeaders(req); err != nil {
+		return err
+	}
+	e.cache.setValidators(req)
+	fetch := spanFromContext(ctx)
+	if fetch != nil {
+		req.Header.Set("traceparent", fetch.traceparent())
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
+	logger.Debug("Fetched the config body", "endpoint", e, "status", resp.StatusCode)
+	fetch.set("http.status_code", resp.StatusCode)
+	e.cache.record(resp, time.Now())
+	if e.retry != nil && e.retry.retryableStatus[resp.StatusCode] {
+		return &statusError{code: resp.StatusCode}
+	}
+	if cached, _ := e.cache.cached(); resp.StatusCode == http.StatusNotModified && cached != nil {
+		return errNotModified
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	// a response carrying validators is kept whole for the conditional requests
+	if stream && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" && e.bodyFormat(contentType) == formatJSON {
+		reader, err := streamBody(resp)
+		if err != nil {
+			return err
+		}
+		if reader != nil {
+			return r.decode(reader, contentType)
+		}
+	}
+	body, err := readBody(resp, e.maxBytes)
 	if err != nil {
-		return []byte{}, err
+		return err
 	}
-	return body, nil
+	e.cache.store(resp, body)
+	r.body, r.contentType = body, contentType
+	return nil
 }
 
-func (p *Provider) loadConfiguration(ctx context.Context, cfgChan chan<- json.Marshaler) {
-	ticker := time.NewTicker(p.pollInterval)
-	defer ticker.Stop()
+// streams reports whether the responses of e may be decoded as they are
+// read, with no decryption, signature, filter or template needing the whole
+// body.
+func (p *Provider) streams(e endpoint) bool {
+	return e.source == nil && e.decrypter == nil && e.jws == nil && len(e.filter) == 0 && p.template == nil
+}
+
+// polled the response of a polled endpoint.
+type polled struct {
+	node        string
+	e           endpoint
+	body        []byte
+	contentType string
+	// the configuration decoded as the response was read, in place of body
+	config  *dynamic.Configuration
+	decoded bool
+	// the endpoint reported its configuration unchanged
+	unchanged bool
+	duration  time.Duration
+	err       error
+}
 
+// decode decodes the JSON configuration read from reader. An array of
+// configurations is read whole, to be parsed like any other body, and a
+// response that is not a configuration is published as none, as when parsed.
+func (r *polled) decode(reader io.Reader, contentType string) (err error) {
+	span := r.e.span.child("decode")
+	span.set("url.full", r.e.url)
+	defer func() { span.finish(err) }()
+	limited := newStreamLimiter(reader, r.e.maxBytes)
+	buffered := bufio.NewReader(limited)
 	for {
-		select {
-		case <-ticker.C:
-			configs := map[string]*dynamic.Configuration{}
-			for node, e := range p.endpoints {
-				body, err := p.fetchConfig(e.endpoint)
-				if err != nil {
-					log.Printf("Error fetching config body from %s: %s", e.endpoint, err)
-					continue
+		b, err := buffered.Peek(1)
+		if err != nil || !isJSONSpace(b[0]) {
+			break
+		}
+		_, _ = buffered.Discard(1)
+	}
+	if b, err := buffered.Peek(1); err == nil && b[0] == '[' {
+		body, err := readLimited(buffered, r.e.maxBytes)
+		if err != nil {
+			return err
+		}
+		r.body, r.contentType = body, contentType
+		return nil
+	}
+
+	var config dynamic.Configuration
+	decoder := json.NewDecoder(buffered)
+	err = decoder.Decode(&config)
+	if err == nil {
+		if _, err = decoder.Token(); err == nil {
+			err = errTrailingData
+		} else if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if limited.n > limited.limit {
+		return fmt.Errorf("response exceeds %d bytes, see maxResponseBytes", limited.limit)
+	}
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		r.config = &config
+	case errors.Is(err, io.EOF) || errors.As(err, &syntaxError) || errors.As(err, &typeError) || errors.Is(err, errTrailingData):
+		logger.Error("Error decoding the body into a dynamic configuration", "endpoint", r.e, "error", err)
+	default:
+		return err
+	}
+	r.decoded = true
+	return nil
+}
+
+// errTrailingData reports a configuration followed by more JSON values.
+var errTrailingData = errors.New("invalid data after the configuration")
+
+// isJSONSpace reports whether b is JSON whitespace.
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// pollEndpoints fetches the polled endpoints concurrently, at most
+// maxConcurrency at a time, returning their responses by node name.
+func (p *Provider) pollEndpoints(ctx context.Context, endpoints map[string]endpoint) []polled {
+	var results []polled
+	for node, e := range endpoints {
+		if e.mode == modePoll {
+			results = append(results, polled{node: node, e: e})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].node < results[j].node })
+
+	limit := p.maxConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *polled) {
+			defer func() {
+				if err := recover(); err != nil {
+					r.err = fmt.Errorf("panic fetching the configuration: %v", err)
 				}
-				var config dynamic.Configuration
-				err = json.Unmarshal(body, &config)
-				if err != nil {
-					log.Printf("Error decoding body from %s into dynamic configuration: %s", e.endpoint, err)
-					continue
+				<-sem
+				wg.Done()
+			}()
+			// the span of the cycle, decoding the streamed responses
+			r.e.span = spanFromContext(ctx)
+			fetch := r.e.span.child("fetch")
+			fetch.set("node", r.node)
+			fetch.set("url.full", r.e.url)
+			start := time.Now()
+			p.fetch(contextWithSpan(ctx, fetch), r, p.streams(r.e))
+			r.duration = time.Since(start)
+			if errors.Is(r.err, errNotModified) {
+				fetch.finish(nil)
+			} else {
+				fetch.finish(r.err)
+			}
+			if errors.Is(r.err, errNotModified) {
+				r.err, r.unchanged = nil, true
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// update carries a configuration pushed by an endpoint. A nil configuration
+// removes the node from the merged configuration, parts are published as the
+// sub-nodes node/0, node/1... Updates of a watcher are ignored once done is
+// closed, the endpoint being gone.
+type update struct {
+	node   string
+	config *dynamic.Configuration
+	parts  []*dynamic.Configuration
+	done   <-chan struct{}
+}
+
+// empty reports whether the update publishes no configuration.
+func (u update) empty() bool {
+	if u.config != nil {
+		return false
+	}
+	for _, config := range u.parts {
+		if config != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Provider) loadConfiguration(ctx context.Context, cfgChan chan<- json.Marshaler, updates chan update) {
+	configs := map[string]*dynamic.Configuration{}
+	// number of parts published by each node
+	parts := map[string]int{}
+	active := map[string]endpoint{}
+	stops := map[string]func(){}
+	// the last successful fetch and the next poll of the polled nodes
+	fetched := map[string]time.Time{}
+	next := map[string]time.Time{}
+	start := func(node string, e endpoint) {
+		active[node] = e
+		p.status.started(node, e)
+		if e.mode == modePoll {
+			next[node] = time.Now()
+		}
+		if w := p.newWatcher(node, e); w != nil {
+			watchCtx, cancel := context.WithCancel(ctx)
+			stops[node] = cancel
+			go p.runWatcher(watchCtx, node, e, w, updates)
+		}
+	}
+	stop := func(node string) {
+		if cancel, ok := stops[node]; ok {
+			cancel()
+			delete(stops, node)
+		}
+		delete(active, node)
+		delete(fetched, node)
+		delete(next, node)
+		p.breaker.forget(node)
+		p.flapping.forget(node)
+		p.metrics.forget(node)
+		p.status.forget(node)
+		for name := range configs {
+			if isSubNode(name, node) {
+				delete(configs, name)
+			}
+		}
+		for name := range parts {
+			if isSubNode(name, node) {
+				delete(parts, name)
+			}
+		}
+	}
+	apply := func(u update) {
+		for i := 0; i < parts[u.node]; i++ {
+			delete(configs, u.node+"/"+strconv.Itoa(i))
+		}
+		delete(parts, u.node)
+		delete(configs, u.node)
+		if u.config != nil {
+			configs[u.node] = u.config
+		}
+		for i, config := range u.parts {
+			if config != nil {
+				configs[u.node+"/"+strconv.Itoa(i)] = config
+			}
+		}
+		if len(u.parts) > 0 {
+			parts[u.node] = len(u.parts)
+		}
+	}
+	// failed removes the configuration of a node failing to respond, unless
+	// its last known one is kept, logging quietly nothing but evictions.
+	failed := func(node string, quiet bool) {
+		if p.keepLastKnownGood && (configs[node] != nil || parts[node] > 0) {
+			age := time.Since(fetched[node])
+			if p.staleTTL == 0 || age <= p.staleTTL {
+				if !quiet {
+					logger.Info("Keeping the last known configuration", "node", node)
 				}
-				if config.HTTP == nil {
-					log.Printf("No http configs from endpoint %s", e.endpoint)
+				return
+			}
+			logger.Warn("Evicting the last known configuration", "node", node, "age", age.Round(time.Millisecond))
+		}
+		apply(update{node: node})
+	}
+
+	for node, e := range p.endpoints {
+		start(node, e)
+	}
+	found := make(chan discovered)
+	for name, d := range p.discoveries {
+		go p.runDiscovery(ctx, name, d, found)
+	}
+	discoveredNodes := map[string]map[string]bool{}
+	reported := map[string]bool{}
+	// whether the last published configuration had routers, and one without
+	// was withheld since
+	publishedRouters, withheld := false, false
+	// the hash of the last published configuration
+	published := ""
+	// fires once the updates have been quiet for the debounce delay
+	var debounced <-chan time.Time
+
+	// the endpoints are first polled right away, then each on its interval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	schedule := func() {
+		wait := p.pollInterval
+		for _, at := range next {
+			if d := time.Until(at); d < wait {
+				wait = d
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+
+	for {
+		flush := false
+		// the trace of the poll cycle, if any
+		var cycle *span
+		select {
+		case <-debounced:
+			debounced, flush = nil, true
+		case <-timer.C:
+			now := time.Now()
+			cycle = p.tracer.start(nil, "poll cycle")
+			polledEndpoints := map[string]endpoint{}
+			total, responded := 0, 0
+			for node, e := range active {
+				if e.mode != modePoll || now.Before(next[node]) {
 					continue
 				}
-				// https://pkg.go.dev/github.com/traefik/traefik/v3@v3.1.6/pkg/config/dynamic#Configuration
-
-				// remove routers not matching entrypoints
-				toDelete := map[string]string{}
-				for k, v := range config.HTTP.Routers {
-					var entrypoints []string
-					for _, e := range v.EntryPoints {
-						if _, ok := p.entrypoints[e]; ok {
-							entrypoints = append(entrypoints, e)
-						}
-					}
-					if len(entrypoints) == 0 {
-						toDelete[k] = v.Service
-					}
-					v.EntryPoints = entrypoints
+				interval := e.interval
+				if interval == 0 {
+					interval = p.pollInterval
 				}
-				for k, v := range toDelete {
-					delete(config.HTTP.Routers, k)
-					delete(config.HTTP.Services, v)
+				next[node] = now.Add(jittered(interval, p.pollJitter))
+				total++
+				if p.breaker.allow(node, now) {
+					polledEndpoints[node] = e
+				} else {
+					failed(node, true)
 				}
-
-				// handle unused middlewres
-				usedMiddlewares := map[string]bool{}
-				for _, v := range config.HTTP.Routers {
-					for _, m := range v.Middlewares {
-						usedMiddlewares[m] = true
-						mw, ok := config.HTTP.Middlewares[m]
-						if ok && mw.Chain != nil {
-							for _, c := range mw.Chain.Middlewares {
-								usedMiddlewares[c] = true
-							}
+			}
+			cycle.set("endpoints", total)
+			for _, r := range p.pollEndpoints(contextWithSpan(ctx, cycle), polledEndpoints) {
+				// the configuration of an unchanged node is not parsed again
+				parse := !r.unchanged || configs[r.node] == nil && parts[r.node] == 0
+				var u update
+				if r.err == nil && parse {
+					e := r.e
+					e.span = cycle
+					u, r.err = safeUpdate(r.node, func() update {
+						if r.decoded {
+							return update{node: r.node, config: p.prepareConfig(r.node, e, r.config)}
 						}
-					}
+						return p.parseUpdate(r.node, e, r.contentType, r.body)
+					})
 				}
-				toDeleteMiddleware := map[string]bool{}
-				for k := range config.HTTP.Middlewares {
-					if _, ok := usedMiddlewares[k]; !ok {
-						toDeleteMiddleware[k] = true
+				p.metrics.fetched(r.node, r.duration, r.err, now)
+				p.status.fetched(r.node, r.e.cache.lastStatus(), r.err, now)
+				if r.err != nil {
+					switch p.breaker.failure(r.node, now) {
+					case circuitClosed:
+						logger.Error("Error fetching the config body", "node", r.node, "endpoint", r.e, "duration", r.duration, "error", r.err)
+						failed(r.node, false)
+					case circuitOpened:
+						logger.Error("Error fetching the config body, opening the circuit", "node", r.node, "endpoint", r.e, "duration", r.duration, "error", r.err)
+						failed(r.node, false)
+					default:
+						failed(r.node, true)
 					}
+					continue
 				}
-				for k := range toDeleteMiddleware {
-					delete(config.HTTP.Middlewares, k)
+				// the endpoint is not polled before its response expires
+				if expires := r.e.cache.expiry(); p.cacheControl && expires.After(next[r.node]) {
+					next[r.node] = expires
 				}
-
-				if len(config.HTTP.Routers) == 0 && len(config.HTTP.Middlewares) == 0 && len(config.HTTP.Services) == 0 {
-					log.Printf("No configuration present after filtering entrypoints from %s", e.endpoint)
+				if p.breaker.success(r.node) {
+					logger.Info("Endpoint is back, closing the circuit", "node", r.node, "endpoint", r.e)
+				}
+				logger.Debug("Polled endpoint", "node", r.node, "endpoint", r.e, "duration", r.duration, "unchanged", r.unchanged)
+				fetched[r.node] = now
+				responded++
+				if parse {
+					apply(p.flapping.observe(u, now))
+				}
+			}
+			schedule()
+			// the current configuration is kept without a quorum
+			if required := p.minEndpoints.required(total); responded < required {
+				logger.Warn("Not enough endpoints responded, not publishing", "responded", responded, "total", total, "required", required)
+				cycle.finish(fmt.Errorf("%d of %d endpoints responded, %d required", responded, total, required))
+				continue
+			}
+		case d := <-found:
+			nodes := map[string]bool{}
+			for node, e := range d.endpoints {
+				nodes[node] = true
+				// unchanged endpoints are reported with the same client
+				if current, ok := active[node]; ok && current.client == e.client {
 					continue
 				}
-				configs[node] = &config
+				if _, ok := active[node]; ok {
+					stop(node)
+				}
+				logger.Info("Starting endpoint", "node", node, "endpoint", e)
+				start(node, e)
+			}
+			for node := range discoveredNodes[d.name] {
+				if !nodes[node] {
+					logger.Info("Endpoint is gone", "node", node)
+					stop(node)
+				}
 			}
-			if len(configs) > 0 {
-				config := mergeConfig(configs)
-				cfgChan <- dynamic.JSONPayload{Configuration: config}
+			discoveredNodes[d.name] = nodes
+			schedule()
+		case u := <-updates:
+			if isDone(u.done) {
+				continue
 			}
+			apply(p.flapping.observe(u, time.Now()))
 		case <-ctx.Done():
 			return
 		}
+		if p.debounce > 0 && !flush {
+			debounced = time.After(p.debounce)
+			cycle.finish(nil)
+			continue
+		}
+		if len(configs) == 0 && !p.allowEmpty {
+			cycle.finish(nil)
+		}
+		if len(configs) > 0 || p.allowEmpty {
+			options := p.merge
+			options.priorities = map[string]int{}
+			options.weights = map[string]int{}
+			options.mirrors = map[string]int{}
+			for node, e := range active {
+				if e.mirror != nil {
+					options.mirrors[node] = *e.mirror
+				}
+				options.priorities[node] = e.priority
+				if e.weight != nil {
+					options.weights[node] = *e.weight
+				}
+			}
+			merge := p.tracer.start(cycle, "merge")
+			config, conflicts, err := mergeConfig(configs, options)
+			p.metrics.merged(len(conflicts))
+			p.status.merged(configs)
+			merge.set("nodes", len(configs))
+			merge.set("conflicts", len(conflicts))
+			merge.finish(err)
+			cycle.finish(nil)
+			if err != nil {
+				conflicts = append(conflicts, err.Error()+", not publishing the merged configuration")
+			}
+			// conflicts are logged once, until they are resolved
+			current := map[string]bool{}
+			for _, conflict := range conflicts {
+				if !reported[conflict] {
+					logger.Warn("Conflict", "conflict", conflict)
+				}
+				current[conflict] = true
+			}
+			reported = current
+			if err != nil {
+				continue
+			}
+			// the routers are not all removed at once unless allowed
+			routers := countRouters(config)
+			if routers == 0 && publishedRouters && !p.allowEmpty {
+				if !withheld {
+					logger.Warn("Not publishing a configuration without routers, set allowEmpty to publish it")
+				}
+				withheld = true
+				continue
+			}
+			withheld = false
+			p.status.route(config)
+			// an unchanged configuration is not published again
+			b, err := json.Marshal(config)
+			if err != nil {
+				logger.Error("Error marshaling the merged configuration", "error", err)
+				continue
+			}
+			hash := fmt.Sprintf("%x", sha256.Sum256(b))
+			if hash == published {
+				continue
+			}
+			published, publishedRouters = hash, routers > 0
+			p.metrics.published(len(b))
+			p.status.publish(config, time.Now())
+			select {
+			case cfgChan <- dynamic.JSONPayload{Configuration: config}:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
 }
 
-func mergeConfig(configs map[string]*dynamic.Configuration) *dynamic.Configuration {
-	newConfig := &dynamic.Configuration{
-		HTTP: &dynamic.HTTPConfiguration{
-			Routers:     map[string]*dynamic.Router{},
-			Services:    map[string]*dynamic.Service{},
-			Middlewares: map[string]*dynamic.Middleware{},
-		},
+// countRouters returns the number of HTTP, TCP and UDP routers of config.
+func countRouters(config *dynamic.Configuration) int {
+	n := 0
+	if config.HTTP != nil {
+		n += len(config.HTTP.Routers)
+	}
+	if config.TCP != nil {
+		n += len(config.TCP.Routers)
+	}
+	if config.UDP != nil {
+		n += len(config.UDP.Routers)
+	}
+	return n
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseUpdate decodes an endpoint response into an update of node. An array
+// of configurations is published as the sub-nodes node/0, node/1... The
+// template, if any, transforms each configuration before it is filtered, the
+// transformers after.
+func (p *Provider) parseUpdate(node string, e endpoint, contentType string, body []byte) update {
+	u := update{node: node}
+	body, ok := p.decodeBody(e, contentType, body)
+	if !ok {
+		return u
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		if body, ok = p.transform(node, e, body); !ok {
+			return u
+		}
+		u.config = p.prepareConfig(node, e, p.decodeConfig(e, body))
+		return u
+	}
+
+	var documents []json.RawMessage
+	if err := json.Unmarshal(body, &documents); err != nil {
+		logger.Error("Error decoding the body into configurations", "endpoint", e, "error", err)
+		return u
+	}
+	u.parts = make([]*dynamic.Configuration, len(documents))
+	for i, document := range documents {
+		document, ok := p.transform(node, e, document)
+		if !ok {
+			continue
+		}
+		u.parts[i] = p.prepareConfig(node, e, p.decodeConfig(e, document))
+	}
+	return u
+}
+
+// prepareConfig filters a decoded configuration of node, namespacing and
+// transforming it. It returns nil when nothing is left to publish.
+func (p *Provider) prepareConfig(node string, e endpoint, config *dynamic.Configuration) *dynamic.Configuration {
+	config = p.filterDecoded(e, config)
+	if e.namespace {
+		namespaceConfig(node, config)
+	}
+	return p.applyTransformers(node, config)
+}
+
+// safeParseUpdate parses a configuration like parseUpdate, returning an error
+// rather than panicking so a bad payload only fails its node.
+func (p *Provider) safeParseUpdate(node string, e endpoint, contentType string, body []byte) (update, error) {
+	return safeUpdate(node, func() update { return p.parseUpdate(node, e, contentType, body) })
+}
+
+// safeUpdate returns the update of node built by parse, recovering its panic.
+func safeUpdate(node string, parse func() update) (u update, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			u, err = update{node: node}, fmt.Errorf("panic parsing the configuration: %v", r)
+		}
+	}()
+	return parse(), nil
+}
+
+// parseConfig decodes an endpoint response holding a single configuration.
+func (p *Provider) parseConfig(e endpoint, contentType string, body []byte) *dynamic.Configuration {
+	body, ok := p.decodeBody(e, contentType, body)
+	if !ok {
+		return nil
+	}
+	return p.filterConfig(e, body)
+}
+
+// decodeBody converts an endpoint response to JSON, in the format of its
+// Content-Type or the endpoint one. Encrypted responses are decrypted first,
+// in the endpoint format, and responses of endpoints verifying JWS signatures
+// are replaced with their verified payload, in the format of its cty header.
+// The filter of the endpoint, if any, then selects the configuration.
+func (p *Provider) decodeBody(e endpoint, contentType string, body []byte) (_ []byte, ok bool) {
+	span := e.span.child("decode")
+	span.set("url.full", e.url)
+	defer func() {
+		if !ok {
+			span.finish(fmt.Errorf("response rejected"))
+			return
+		}
+		span.finish(nil)
+	}()
+	if e.decrypter != nil {
+		plaintext, err := decryptPayload(e.decrypter, body)
+		if err != nil {
+			logger.Error("Rejecting the response", "endpoint", e, "error", err)
+			return nil, false
+		}
+		body, contentType = plaintext, ""
+	}
+	if e.jws != nil {
+		payload, payloadType, err := e.jws.verify(body)
+		if err != nil {
+			logger.Error("Rejecting the response", "endpoint", e, "error", err)
+			return nil, false
+		}
+		body, contentType = payload, payloadType
+	}
+	format := e.bodyFormat(contentType)
+	body, err := toJSON(format, body)
+	if err != nil {
+		logger.Error("Error decoding the body", "format", format, "endpoint", e, "contentType", contentType, "error", err)
+		return nil, false
+	}
+	if body, err = e.filter.apply(body); err != nil {
+		logger.Error("Error filtering the body", "endpoint", e, "error", err)
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeConfig decodes a JSON configuration, nil when the body is not one.
+func (p *Provider) decodeConfig(e endpoint, body []byte) *dynamic.Configuration {
+	var config dynamic.Configuration
+	if err := json.Unmarshal(body, &config); err != nil {
+		logger.Error("Error decoding the body into a dynamic configuration", "endpoint", e, "error", err)
+		return nil
+	}
+	return &config
+}
+
+// filterConfig decodes a JSON configuration and filters it against the
+// configured entrypoints. It returns nil when nothing is left to publish.
+func (p *Provider) filterConfig(e endpoint, body []byte) *dynamic.Configuration {
+	return p.filterDecoded(e, p.decodeConfig(e, body))
+}
+
+// filterDecoded filters a decoded configuration like filterConfig.
+func (p *Provider) filterDecoded(e endpoint, config *dynamic.Configuration) *dynamic.Configuration {
+	if config == nil {
+		return nil
+	}
+	span := e.span.child("filter")
+	span.set("url.full", e.url)
+	defer span.finish(nil)
+	if translateV2(config) {
+		logger.Info("Translated a Traefik v2 configuration", "endpoint", e)
+	}
+	if config.HTTP == nil && config.TCP == nil && config.UDP == nil && config.TLS == nil {
+		logger.Warn("No configuration from the endpoint", "endpoint", e)
+		return nil
+	}
+	routers := countRouters(config)
+	// https://pkg.go.dev/github.com/traefik/traefik/v3@v3.1.6/pkg/config/dynamic#Configuration
+	if config.HTTP == nil {
+		config.HTTP = &dynamic.HTTPConfiguration{}
+	}
+	p.filterHTTP(e, config.HTTP)
+	if config.TCP != nil {
+		p.filterTCP(e, config.TCP)
+	}
+	if config.UDP != nil {
+		p.filterUDP(e, config.UDP)
+	}
+	e.servers.rewrite(config)
+	p.metrics.dropped(routers - countRouters(config))
+	span.set("routers", countRouters(config))
+	span.set("droppedRouters", routers-countRouters(config))
+
+	if isEmptyConfig(config) {
+		logger.Warn("No configuration left after filtering", "endpoint", e)
+		return nil
+	}
+	return config
+}
+
+// isEmptyConfig reports whether config defines no router, service,
+// middleware or TLS setting.
+func isEmptyConfig(config *dynamic.Configuration) bool {
+	if config.HTTP != nil && (len(config.HTTP.Routers) > 0 || len(config.HTTP.Services) > 0 || len(config.HTTP.Middlewares) > 0) {
+		return false
+	}
+	if config.TCP != nil && (len(config.TCP.Routers) > 0 || len(config.TCP.Services) > 0 || len(config.TCP.Middlewares) > 0) {
+		return false
+	}
+	if config.TLS != nil && (len(config.TLS.Certificates) > 0 || len(config.TLS.Options) > 0 || len(config.TLS.Stores) > 0) {
+		return false
+	}
+	return config.UDP == nil || len(config.UDP.Routers) == 0 && len(config.UDP.Services) == 0
+}
+
+// routerEntryPoints returns the configured entrypoints among the entrypoints
+// of a router of e, once mapped, and whether the router is kept. Routers
+// without one are dropped, kept as they are or reassigned to the default
+// entrypoints by the unmatched entrypoint policy. The entrypoints of an
+// endpoint override those of the provider, and are its default ones.
+func (p *Provider) routerEntryPoints(e endpoint, entrypoints []string) ([]string, bool) {
+	allowed := func(name string) bool { return p.entrypoints[name] }
+	defaults := p.defaultEntryPoints
+	if len(e.entrypoints) > 0 {
+		allowed = func(name string) bool { return containsString(e.entrypoints, name) }
+		defaults = e.entrypoints
+	}
+	if len(entrypoints) == 0 && p.assignEmptyEntryPoints && len(defaults) > 0 {
+		return append([]string(nil), defaults...), true
+	}
+	if len(p.entrypointMapping) > 0 {
+		mapped := make([]string, 0, len(entrypoints))
+		for _, name := range entrypoints {
+			if to, ok := p.entrypointMapping[name]; ok {
+				name = to
+			}
+			if !containsString(mapped, name) {
+				mapped = append(mapped, name)
+			}
+		}
+		entrypoints = mapped
+	}
+
+	var filtered []string
+	for _, name := range entrypoints {
+		if allowed(name) {
+			filtered = append(filtered, name)
+		}
+	}
+	if len(filtered) > 0 {
+		return filtered, true
+	}
+	switch p.unmatchedEntryPoints {
+	case unmatchedKeep:
+		return entrypoints, true
+	case unmatchedReassign:
+		return append([]string(nil), defaults...), true
+	default:
+		return nil, false
+	}
+}
+
+// routerAllowed reports whether the router name of e passes the router
+// filters of the provider and of e.
+func (p *Provider) routerAllowed(e endpoint, name string) bool {
+	if p.routers.allows(name) && e.routers.allows(name) {
+		return true
+	}
+	logger.Info("Dropping a router denied by the router filters", "router", name, "endpoint", e)
+	return false
+}
+
+// hostsAllowed reports whether the rule of the router name only matches the
+// allowed domains of e, if any, through its matcher of hosts.
+func (e endpoint) hostsAllowed(name, rule, matcher string) bool {
+	if len(e.domains) == 0 || hostsWithin(rule, matcher, e.domains) {
+		return true
+	}
+	logger.Warn("Dropping a router whose rule is not restricted to the allowed domains", "router", name, "endpoint", e, "rule", rule)
+	return false
+}
+
+// filterHTTP removes the HTTP routers not matching the entrypoints, the router
+// filters, the allowed domains or the strict references, with their services no
+// remaining router uses, the middlewares no router uses and the servers
+// transports no service uses. The middleware references of the routers are
+// stripped and rewritten first, the injected middlewares prepended last, and
+// the forced TLS configuration replaces theirs. With a path prefix, the rules
+// are wrapped and a stripPrefix middleware is added.
+func (p *Provider) filterHTTP(e endpoint, config *dynamic.HTTPConfiguration) {
+	// drop null entries, they carry no configuration
+	for k, v := range config.Routers {
+		if v == nil {
+			delete(config.Routers, k)
+		}
+	}
+	for k, v := range config.Services {
+		if v == nil {
+			delete(config.Services, k)
+		}
+	}
+	for k, v := range config.Middlewares {
+		if v == nil {
+			delete(config.Middlewares, k)
+		}
+	}
+
+	// remove routers not matching entrypoints
+	deletedServices := map[string]bool{}
+	for k, v := range config.Routers {
+		entrypoints, ok := p.routerEntryPoints(e, v.EntryPoints)
+		if !ok || !p.routerAllowed(e, k) || !e.hostsAllowed(k, v.Rule, "Host") {
+			delete(config.Routers, k)
+			deletedServices[v.Service] = true
+			continue
+		}
+		// the references are checked once stripped and rewritten
+		v.Middlewares = p.middlewares.apply(v.Middlewares)
+		if !p.references.httpRouter(e, k, v, config) {
+			delete(config.Routers, k)
+			deletedServices[v.Service] = true
+			continue
+		}
+		v.EntryPoints = entrypoints
+		v.Rule = e.prefixRule(v.Rule)
+		v.Priority = e.routerPriority(v.Priority, v.Rule)
+		if e.pathPrefix != "" {
+			v.Middlewares = append([]string{stripPrefixName(e.pathPrefix)}, v.Middlewares...)
+		}
+		if p.forceTLS != nil {
+			forced := *p.forceTLS
+			forced.Domains = append([]types.Domain{}, p.forceTLS.Domains...)
+			v.TLS = &forced
+		}
+	}
+
+	if e.pathPrefix != "" && len(config.Routers) > 0 {
+		if config.Middlewares == nil {
+			config.Middlewares = map[string]*dynamic.Middleware{}
+		}
+		config.Middlewares[stripPrefixName(e.pathPrefix)] = &dynamic.Middleware{
+			StripPrefix: &dynamic.StripPrefix{Prefixes: []string{e.pathPrefix}},
+		}
+	}
+
+	// the services of removed routers and the middlewares are kept when a
+	// remaining router still uses them
+	usedServices, usedMiddlewares := httpReferences(config)
+	for k := range deletedServices {
+		if !usedServices[k] {
+			delete(config.Services, k)
+		}
+	}
+	for k := range config.Middlewares {
+		if !usedMiddlewares[k] {
+			delete(config.Middlewares, k)
+		}
+	}
+
+	usedTransports := map[string]bool{}
+	for _, v := range config.Services {
+		if v.LoadBalancer != nil && v.LoadBalancer.ServersTransport != "" {
+			usedTransports[v.LoadBalancer.ServersTransport] = true
+		}
 	}
-	for _, c := range configs {
-		for name, m := range c.HTTP.Middlewares {
-			if _, ok := newConfig.HTTP.Middlewares[name]; !ok {
-				newConfig.HTTP.Middlewares[name] = m
+	for k, v := range config.ServersTransports {
+		if v == nil || !usedTransports[k] {
+			delete(config.ServersTransports, k)
+		}
+	}
+
+	// injected after the cleanup, they reference middlewares of other
+	// providers
+	p.injectMiddlewares(e, config.Routers)
+}
+
+// httpReferences returns the services and middlewares the routers of config
+// use, directly or through other services and middlewares.
+func httpReferences(config *dynamic.HTTPConfiguration) (map[string]bool, map[string]bool) {
+	services := map[string]bool{}
+	middlewares := map[string]bool{}
+	var useService func(name string)
+	var useMiddleware func(name string)
+	useService = func(name string) {
+		if services[name] {
+			return
+		}
+		services[name] = true
+		s := config.Services[name]
+		if s == nil {
+			return
+		}
+		if s.Weighted != nil {
+			for _, w := range s.Weighted.Services {
+				useService(w.Name)
 			}
 		}
-		for name, m := range c.HTTP.Services {
-			if _, ok := newConfig.HTTP.Services[name]; !ok {
-				newConfig.HTTP.Services[name] = m
+		if s.Mirroring != nil {
+			useService(s.Mirroring.Service)
+			for _, m := range s.Mirroring.Mirrors {
+				useService(m.Name)
 			}
 		}
-		for name, m := range c.HTTP.Routers {
-			if _, ok := newConfig.HTTP.Routers[name]; !ok {
-				newConfig.HTTP.Routers[name] = m
+		if s.Failover != nil {
+			useService(s.Failover.Service)
+			useService(s.Failover.Fallback)
+		}
+	}
+	useMiddleware = func(name string) {
+		if middlewares[name] {
+			return
+		}
+		middlewares[name] = true
+		m := config.Middlewares[name]
+		if m == nil {
+			return
+		}
+		if m.Chain != nil {
+			for _, c := range m.Chain.Middlewares {
+				useMiddleware(c)
 			}
 		}
+		if m.Errors != nil {
+			useService(m.Errors.Service)
+		}
+	}
+	for _, r := range config.Routers {
+		useService(r.Service)
+		for _, m := range r.Middlewares {
+			useMiddleware(m)
+		}
+	}
+	return services, middlewares
+}
+
+// filterTCP removes the TCP routers not matching the entrypoints, the router
+// filters, the allowed domains or the strict references, with their services no
+// remaining router uses, and the middlewares no router uses.
+func (p *Provider) filterTCP(e endpoint, config *dynamic.TCPConfiguration) {
+	for k, v := range config.Routers {
+		if v == nil {
+			delete(config.Routers, k)
+		}
+	}
+	for k, v := range config.Services {
+		if v == nil {
+			delete(config.Services, k)
+		}
+	}
+	for k, v := range config.Middlewares {
+		if v == nil {
+			delete(config.Middlewares, k)
+		}
+	}
+
+	deletedServices := map[string]bool{}
+	for k, v := range config.Routers {
+		entrypoints, ok := p.routerEntryPoints(e, v.EntryPoints)
+		if !ok || !p.routerAllowed(e, k) || !e.hostsAllowed(k, v.Rule, "HostSNI") || !p.references.tcpRouter(e, k, v, config) {
+			delete(config.Routers, k)
+			deletedServices[v.Service] = true
+			continue
+		}
+		v.EntryPoints = entrypoints
+		v.Priority = e.routerPriority(v.Priority, v.Rule)
+	}
+
+	usedServices := map[string]bool{}
+	usedMiddlewares := map[string]bool{}
+	for _, v := range config.Routers {
+		usedServices[v.Service] = true
+		if s := config.Services[v.Service]; s != nil && s.Weighted != nil {
+			for _, w := range s.Weighted.Services {
+				usedServices[w.Name] = true
+			}
+		}
+		for _, m := range v.Middlewares {
+			usedMiddlewares[m] = true
+		}
+	}
+	for k := range deletedServices {
+		if !usedServices[k] {
+			delete(config.Services, k)
+		}
+	}
+	for k := range config.Middlewares {
+		if !usedMiddlewares[k] {
+			delete(config.Middlewares, k)
+		}
+	}
+}
+
+// filterUDP removes the UDP routers not matching the entrypoints or the router
+// filters, with their services no remaining router uses.
+func (p *Provider) filterUDP(e endpoint, config *dynamic.UDPConfiguration) {
+	for k, v := range config.Routers {
+		if v == nil {
+			delete(config.Routers, k)
+		}
+	}
+	for k, v := range config.Services {
+		if v == nil {
+			delete(config.Services, k)
+		}
+	}
+
+	deletedServices := map[string]bool{}
+	for k, v := range config.Routers {
+		entrypoints, ok := p.routerEntryPoints(e, v.EntryPoints)
+		if !ok || !p.routerAllowed(e, k) {
+			delete(config.Routers, k)
+			deletedServices[v.Service] = true
+			continue
+		}
+		v.EntryPoints = entrypoints
+	}
+
+	usedServices := map[string]bool{}
+	for _, v := range config.Routers {
+		usedServices[v.Service] = true
+		if s := config.Services[v.Service]; s != nil && s.Weighted != nil {
+			for _, w := range s.Weighted.Services {
+				usedServices[w.Name] = true
+			}
+		}
+	}
+	for k := range deletedServices {
+		if !usedServices[k] {
+			delete(config.Services, k)
+		}
 	}
-	return newConfig
 }
 
 type ConfigMarshaler struct {
@@ -257,6 +2080,13 @@ func (c ConfigMarshaler) MarshalJSON() ([]byte, error) {
 
 // Stop to stop the provider and the related go routines.
 func (p *Provider) Stop() error {
+	if p.cancel == nil {
+		return nil
+	}
 	p.cancel()
+	// the in-flight requests are canceled with the context of the loop
+	if p.done != nil {
+		<-p.done
+	}
 	return nil
 }
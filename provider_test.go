@@ -0,0 +1,1134 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/types"
+)
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		desc     string
+		endpoint Endpoint
+		expected string
+	}{
+		{
+			desc:     "host only",
+			endpoint: Endpoint{Endpoint: "10.0.1.2"},
+			expected: "http://10.0.1.2:5000/traefik/config",
+		},
+		{
+			desc:     "https scheme",
+			endpoint: Endpoint{Endpoint: "config.internal", Scheme: "https"},
+			expected: "https://config.internal:5000/traefik/config",
+		},
+		{
+			desc:     "port and path",
+			endpoint: Endpoint{Endpoint: "config.internal", Port: 8443, Path: "/api/traefik"},
+			expected: "http://config.internal:8443/api/traefik",
+		},
+		{
+			desc:     "relative path",
+			endpoint: Endpoint{Endpoint: "config.internal", Path: "api/traefik"},
+			expected: "http://config.internal:5000/api/traefik",
+		},
+		{
+			desc:     "ipv6 host",
+			endpoint: Endpoint{Endpoint: "fd00::1", Port: 8080},
+			expected: "http://[fd00::1]:8080/traefik/config",
+		},
+		{
+			desc:     "full url",
+			endpoint: Endpoint{Endpoint: "https://config.internal:8443/traefik?node=edge", Port: 9000, Path: "/ignored"},
+			expected: "https://config.internal:8443/traefik?node=edge",
+		},
+		{
+			desc:     "websocket url",
+			endpoint: Endpoint{Endpoint: "wss://config.internal/traefik/ws"},
+			expected: "https://config.internal/traefik/ws",
+		},
+		{
+			desc:     "websocket scheme",
+			endpoint: Endpoint{Endpoint: "config.internal", Scheme: "ws"},
+			expected: "http://config.internal:5000/traefik/config",
+		},
+		{
+			desc:     "unix socket",
+			endpoint: Endpoint{Endpoint: "unix:///var/run/config.sock"},
+			expected: "http://localhost/traefik/config",
+		},
+		{
+			desc:     "unix socket with path",
+			endpoint: Endpoint{Endpoint: "unix:///var/run/config.sock", Path: "/config?format=json"},
+			expected: "http://localhost/config?format=json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if actual := endpointURL(test.endpoint); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "http://10.0.1.2:5000/traefik/config"},
+		{url: "https://config.internal/traefik"},
+		{url: "http://[fd00::1]:8080/traefik/config"},
+		{url: "http://config.internal:65535/"},
+		{url: "ftp://config.internal/traefik", wantErr: true},
+		{url: "config.internal:5000", wantErr: true},
+		{url: "http:///traefik/config", wantErr: true},
+		{url: "http://config.internal:0/", wantErr: true},
+		{url: "http://config.internal:65536/", wantErr: true},
+		{url: "http://config.internal:abc/", wantErr: true},
+		{url: "http://config internal/", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := validateURL(test.url)
+			if test.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "unix:///var/run/config.sock", expected: "/var/run/config.sock"},
+		{endpoint: "unix://relative.sock", expected: "relative.sock"},
+		{endpoint: "http://config.internal/", expected: ""},
+		{endpoint: "10.0.1.2", expected: ""},
+		{endpoint: "/var/run/unix://config.sock", expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			if actual := unixSocket(test.endpoint); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		desc     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{desc: "host", endpoint: Endpoint{Endpoint: "10.0.1.2"}},
+		{desc: "full url", endpoint: Endpoint{Endpoint: "https://config.internal/traefik"}},
+		{desc: "unix socket", endpoint: Endpoint{Endpoint: "unix:///var/run/config.sock"}},
+		{desc: "sse mode", endpoint: Endpoint{Endpoint: "10.0.1.2", Mode: "sse"}},
+		{desc: "websocket url", endpoint: Endpoint{Endpoint: "ws://10.0.1.2:8080/ws"}},
+		{desc: "grpc url", endpoint: Endpoint{Endpoint: "grpc://10.0.1.2:9000"}},
+		{desc: "file url", endpoint: Endpoint{Endpoint: "file:///etc/traefik/node.json"}},
+		{desc: "relative file url", endpoint: Endpoint{Endpoint: "file://node.json"}, wantErr: true},
+		{desc: "s3 url", endpoint: Endpoint{Endpoint: "s3://bucket/nodes/edge.json"}},
+		{desc: "consul url", endpoint: Endpoint{Endpoint: "consul://consul:8500/traefik/nodes"}},
+		{desc: "etcd url", endpoint: Endpoint{Endpoint: "etcd://etcd:2379/traefik/nodes/edge"}},
+		{desc: "redis url", endpoint: Endpoint{Endpoint: "redis://redis:6379/traefik/node"}},
+		{desc: "redis channel url", endpoint: Endpoint{Endpoint: "rediss://redis/traefik/node?channel=traefik"}},
+		{desc: "kubernetes url", endpoint: Endpoint{Endpoint: "kubernetes://edge/configmaps/traefik", Kubernetes: &Kubernetes{APIServer: "https://10.96.0.1"}}},
+		{desc: "kubernetes mode without kubernetes url", endpoint: Endpoint{Endpoint: "10.0.1.2", Mode: "kubernetes"}, wantErr: true},
+		{desc: "longpoll mode", endpoint: Endpoint{Endpoint: "10.0.1.2", Mode: "longpoll", Wait: "1m"}},
+		{desc: "unsupported scheme", endpoint: Endpoint{Endpoint: "10.0.1.2", Scheme: "ftp"}, wantErr: true},
+		{desc: "port out of range", endpoint: Endpoint{Endpoint: "10.0.1.2", Port: 70000}, wantErr: true},
+		{desc: "relative unix socket", endpoint: Endpoint{Endpoint: "unix://config.sock"}, wantErr: true},
+		{desc: "yaml format", endpoint: Endpoint{Endpoint: "10.0.1.2", Format: "yaml"}},
+		{desc: "unsupported format", endpoint: Endpoint{Endpoint: "10.0.1.2", Format: "xml"}, wantErr: true},
+		{desc: "bearer token", endpoint: Endpoint{Endpoint: "10.0.1.2", Auth: &Auth{BearerTokenFile: "/run/secrets/token"}}},
+		{desc: "conflicting bearer tokens", endpoint: Endpoint{Endpoint: "10.0.1.2", Auth: &Auth{BearerToken: "a", BearerTokenFile: "/b"}}, wantErr: true},
+		{desc: "unsupported mode", endpoint: Endpoint{Endpoint: "10.0.1.2", Mode: "push"}, wantErr: true},
+		{desc: "mirror percent", endpoint: Endpoint{Endpoint: "10.0.1.2", MirrorPercent: intPtr(10)}},
+		{desc: "mirror percent out of range", endpoint: Endpoint{Endpoint: "10.0.1.2", MirrorPercent: intPtr(150)}, wantErr: true},
+		{desc: "path prefix", endpoint: Endpoint{Endpoint: "10.0.1.2", PathPrefix: "/node1/"}},
+		{desc: "relative path prefix", endpoint: Endpoint{Endpoint: "10.0.1.2", PathPrefix: "node1"}, wantErr: true},
+		{desc: "poll interval and timeout", endpoint: Endpoint{Endpoint: "10.0.1.2", PollInterval: "1m", PollTimeout: "30s"}},
+		{desc: "negative poll interval", endpoint: Endpoint{Endpoint: "10.0.1.2", PollInterval: "-1m"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config := CreateConfig()
+			config.EntryPoints = []string{"web"}
+			config.Endpoints["node"] = test.endpoint
+
+			p, err := New(context.Background(), config, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Init()
+			if test.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	t.Setenv("CONFIG_HOST", "config.internal")
+	t.Setenv("CONFIG_TOKEN", "secret")
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "${CONFIG_HOST}", expected: "config.internal"},
+		{value: "https://${CONFIG_HOST}:8443/${CONFIG_UNSET}nodes", expected: "https://config.internal:8443/nodes"},
+		{value: "Bearer ${CONFIG_TOKEN}", expected: "Bearer secret"},
+		{value: "$CONFIG_HOST and ${unterminated", expected: "$CONFIG_HOST and ${unterminated"},
+	}
+	for _, test := range tests {
+		if actual := expandVars(test.value); actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestNewExpandsEndpointVars(t *testing.T) {
+	t.Setenv("CONFIG_HOST", "config.internal")
+	t.Setenv("CONFIG_PATH", "/edge")
+
+	config := CreateConfig()
+	config.Endpoints["node"] = Endpoint{Endpoint: "${CONFIG_HOST}", Path: "${CONFIG_PATH}"}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := p.endpoints["node"].url; u != "http://config.internal:5000/edge" {
+		t.Errorf("unexpected url %s", u)
+	}
+}
+
+func TestParseUpdate(t *testing.T) {
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+
+	u := p.parseUpdate("node", endpoint{}, "", []byte(routerConfig("single", "web")))
+	if u.config == nil || u.parts != nil {
+		t.Fatalf("expected a single configuration, got %+v", u)
+	}
+
+	body := "[" + routerConfig("first", "web") + "," + routerConfig("other", "websecure") + "," + routerConfig("third", "web") + "]"
+	u = p.parseUpdate("node", endpoint{}, "", []byte(body))
+	if u.config != nil || len(u.parts) != 3 {
+		t.Fatalf("expected 3 parts, got %+v", u)
+	}
+	if u.parts[0] == nil || u.parts[1] != nil || u.parts[2] == nil {
+		t.Errorf("expected the websecure part to be filtered out, got %v", u.parts)
+	}
+	if _, ok := u.parts[2].HTTP.Routers["third"]; !ok {
+		t.Errorf("expected router third in part 2, got %v", routerNames(u.parts[2]))
+	}
+
+	if u = p.parseUpdate("node", endpoint{}, "", []byte(`[{"http":`)); !u.empty() {
+		t.Errorf("expected an empty update, got %+v", u)
+	}
+}
+
+func TestFilterConfigSharedReferences(t *testing.T) {
+	body := `{"http":{"routers":{` +
+		`"kept":{"entryPoints":["web"],"service":"split","middlewares":["secure"]},` +
+		`"deleted":{"entryPoints":["admin"],"service":"api","middlewares":["secure","auth"]},` +
+		`"deleted-too":{"entryPoints":["admin"],"service":"admin","middlewares":["auth"]}},` +
+		`"services":{"split":{"weighted":{"services":[{"name":"api","weight":1}]}},` +
+		`"api":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}},` +
+		`"admin":{"loadBalancer":{"servers":[{"url":"http://10.0.0.2"}]}},` +
+		`"errors":{"loadBalancer":{"servers":[{"url":"http://10.0.0.3"}]}}},` +
+		`"middlewares":{"secure":{"chain":{"middlewares":["headers"]}},"headers":{"chain":{"middlewares":["pages"]}},` +
+		`"pages":{"errors":{"status":["500"],"service":"errors","query":"/"}},"auth":{"basicAuth":{"users":["a:b"]}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	// the result must not depend on the map iteration order
+	for i := 0; i < 20; i++ {
+		config := p.filterConfig(endpoint{}, []byte(body))
+		if config == nil {
+			t.Fatal("expected a configuration")
+		}
+		for _, name := range []string{"split", "api", "errors"} {
+			if _, ok := config.HTTP.Services[name]; !ok {
+				t.Fatalf("expected service %s used by router kept to be retained, got %v", name, config.HTTP.Services)
+			}
+		}
+		if _, ok := config.HTTP.Services["admin"]; ok {
+			t.Fatal("expected the service of the deleted router only to be removed")
+		}
+		for _, name := range []string{"secure", "headers", "pages"} {
+			if _, ok := config.HTTP.Middlewares[name]; !ok {
+				t.Fatalf("expected middleware %s used by router kept to be retained, got %v", name, config.HTTP.Middlewares)
+			}
+		}
+		if _, ok := config.HTTP.Middlewares["auth"]; ok {
+			t.Fatal("expected the middleware of the deleted routers only to be removed")
+		}
+	}
+}
+
+func TestFilterConfigTCPSharedServices(t *testing.T) {
+	body := `{"tcp":{"routers":{"kept":{"entryPoints":["db"],"service":"db"},"deleted":{"entryPoints":["other"],"service":"db"}},` +
+		`"services":{"db":{"loadBalancer":{"servers":[{"address":"10.0.0.1:5432"}]}}}},` +
+		`"udp":{"routers":{"kept":{"entryPoints":["db"],"service":"dns"},"deleted":{"entryPoints":["other"],"service":"dns"}},` +
+		`"services":{"dns":{"loadBalancer":{"servers":[{"address":"10.0.0.1:53"}]}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"db": true}}
+	for i := 0; i < 20; i++ {
+		config := p.filterConfig(endpoint{}, []byte(body))
+		if config == nil || config.TCP.Services["db"] == nil || config.UDP.Services["dns"] == nil {
+			t.Fatalf("expected the shared services to be retained, got %+v", config)
+		}
+	}
+}
+
+func TestUnmatchedEntryPointPolicy(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["internal"],"service":"api"}},` +
+		`"services":{"api":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}},` +
+		`"tcp":{"routers":{"db":{"entryPoints":["internal"],"service":"db"}},"services":{"db":{"loadBalancer":{}}}}}`
+	tests := []struct {
+		policy      string
+		defaults    []string
+		entrypoints []string
+	}{
+		{policy: unmatchedDrop},
+		{policy: unmatchedKeep, entrypoints: []string{"internal"}},
+		{policy: unmatchedReassign, entrypoints: []string{"web"}},
+		{policy: unmatchedReassign, defaults: []string{"websecure"}, entrypoints: []string{"websecure"}},
+	}
+	for _, test := range tests {
+		config := CreateConfig()
+		config.EntryPoints = []string{"web"}
+		config.UnmatchedEntryPointPolicy = test.policy
+		config.DefaultEntryPoints = test.defaults
+		p, err := New(context.Background(), config, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := p.filterConfig(endpoint{}, []byte(body))
+		if test.entrypoints == nil {
+			if c != nil {
+				t.Errorf("%s: expected the routers to be dropped, got %v", test.policy, routerNames(c))
+			}
+			continue
+		}
+		if c == nil || c.HTTP.Routers["api"] == nil || c.HTTP.Services["api"] == nil || c.TCP.Routers["db"] == nil {
+			t.Fatalf("%s: expected the routers and services to be kept, got %+v", test.policy, c)
+		}
+		if eps := c.HTTP.Routers["api"].EntryPoints; !reflect.DeepEqual(eps, test.entrypoints) {
+			t.Errorf("%s: expected entrypoints %v, got %v", test.policy, test.entrypoints, eps)
+		}
+		if eps := c.TCP.Routers["db"].EntryPoints; !reflect.DeepEqual(eps, test.entrypoints) {
+			t.Errorf("%s: expected tcp entrypoints %v, got %v", test.policy, test.entrypoints, eps)
+		}
+	}
+
+	config := CreateConfig()
+	config.UnmatchedEntryPointPolicy = "move"
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected an unsupported policy error")
+	}
+	config.UnmatchedEntryPointPolicy = unmatchedReassign
+	if p, _ = New(context.Background(), config, "test"); p.Init() == nil {
+		t.Error("expected reassign without entrypoints to fail")
+	}
+}
+
+func TestEntryPointMapping(t *testing.T) {
+	p := &Provider{
+		entrypoints:       map[string]bool{"web": true, "websecure": true},
+		entrypointMapping: map[string]string{"web": "websecure", "internal": "web", "http": "websecure"},
+	}
+	tests := []struct {
+		entrypoints []string
+		expected    []string
+	}{
+		{entrypoints: []string{"internal"}, expected: []string{"web"}},
+		{entrypoints: []string{"web", "http", "websecure"}, expected: []string{"websecure"}},
+		{entrypoints: []string{"internal", "web"}, expected: []string{"web", "websecure"}},
+		{entrypoints: []string{"admin"}},
+	}
+	for _, test := range tests {
+		actual, ok := p.routerEntryPoints(endpoint{}, test.entrypoints)
+		if ok != (test.expected != nil) || !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.entrypoints, test.expected, actual)
+		}
+	}
+
+	config := p.filterConfig(endpoint{}, []byte(routerConfig("api", "internal")))
+	if config == nil || !reflect.DeepEqual(config.HTTP.Routers["api"].EntryPoints, []string{"web"}) {
+		t.Errorf("expected the router to be published on web, got %+v", config)
+	}
+}
+
+func TestAssignEmptyEntryPoints(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"service":"api"},"admin":{"entryPoints":["admin"],"service":"admin"}}}}`
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web", "websecure"}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := p.filterConfig(endpoint{}, []byte(body)); c != nil {
+		t.Errorf("expected routers without entrypoints to be dropped, got %v", routerNames(c))
+	}
+
+	config.AssignEmptyEntryPoints = true
+	if p, err = New(context.Background(), config, "test"); err != nil {
+		t.Fatal(err)
+	}
+	c := p.filterConfig(endpoint{}, []byte(body))
+	if c == nil || len(c.HTTP.Routers) != 1 {
+		t.Fatalf("expected router api only, got %+v", c)
+	}
+	if eps := c.HTTP.Routers["api"].EntryPoints; !reflect.DeepEqual(eps, []string{"web", "websecure"}) {
+		t.Errorf("expected the configured entrypoints, got %v", eps)
+	}
+}
+
+func TestEndpointEntryPoints(t *testing.T) {
+	body := `{"http":{"routers":{"public":{"entryPoints":["websecure"],"service":"api"},"private":{"entryPoints":["internal"],"service":"api"},` +
+		`"unnamed":{"service":"api"}},"services":{"api":{"loadBalancer":{}}}}}`
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web", "websecure", "internal"}
+	config.AssignEmptyEntryPoints = true
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := p.filterConfig(endpoint{}, []byte(body))
+	if c == nil || len(c.HTTP.Routers) != 3 {
+		t.Fatalf("expected all routers on the provider entrypoints, got %+v", c)
+	}
+	c = p.filterConfig(endpoint{entrypoints: []string{"websecure"}}, []byte(body))
+	if c == nil || c.HTTP.Routers["private"] != nil || c.HTTP.Routers["public"] == nil {
+		t.Fatalf("expected the dmz node to publish on websecure only, got %+v", c)
+	}
+	if eps := c.HTTP.Routers["unnamed"].EntryPoints; !reflect.DeepEqual(eps, []string{"websecure"}) {
+		t.Errorf("expected the endpoint entrypoints to be assigned, got %v", eps)
+	}
+}
+
+func TestFilterConfigRouterFilters(t *testing.T) {
+	body := `{"http":{"routers":{"edge-api":{"entryPoints":["web"],"service":"api"},"billing":{"entryPoints":["web"],"service":"billing"},` +
+		`"edge-debug":{"entryPoints":["web"],"service":"api"}},` +
+		`"services":{"api":{"loadBalancer":{}},"billing":{"loadBalancer":{}}}},` +
+		`"tcp":{"routers":{"db":{"entryPoints":["web"],"service":"db"}},"services":{"db":{"loadBalancer":{}}}}}`
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.DenyRouters = []string{"-debug$"}
+	config.Endpoints["edge"] = Endpoint{Endpoint: "10.0.0.1", AllowRouters: []string{"^edge-"}}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := p.filterConfig(p.endpoints["edge"], []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	if names := routerNames(c); len(names) != 1 || names[0] != "edge-api" {
+		t.Errorf("expected router edge-api only, got %v", names)
+	}
+	if _, ok := c.HTTP.Services["billing"]; ok {
+		t.Error("expected the service of the denied router to be removed")
+	}
+	if c.TCP != nil && len(c.TCP.Routers) != 0 {
+		t.Errorf("expected the tcp router outside of the edge names to be removed, got %v", c.TCP.Routers)
+	}
+
+	c = p.filterConfig(endpoint{}, []byte(body))
+	if c == nil || c.HTTP.Routers["billing"] == nil || c.HTTP.Routers["edge-debug"] != nil {
+		t.Errorf("expected the global deny list only for other endpoints, got %+v", c)
+	}
+
+	config.Endpoints["edge"] = Endpoint{Endpoint: "10.0.0.1", DenyRouters: []string{"["}}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}
+
+func TestFilterConfigAllowedDomains(t *testing.T) {
+	body := `{"http":{"routers":{"own":{"entryPoints":["web"],"service":"own","rule":"Host(` + "`a.example.com`" + `)"},` +
+		`"claim":{"entryPoints":["web"],"service":"claim","rule":"Host(` + "`b.example.com`" + `)"}},` +
+		`"services":{"own":{"loadBalancer":{}},"claim":{"loadBalancer":{}}}},` +
+		`"tcp":{"routers":{"any":{"entryPoints":["web"],"service":"any","rule":"HostSNI(` + "`*`" + `)"}},"services":{"any":{"loadBalancer":{}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	c := p.filterConfig(endpoint{domains: []string{"a.example.com"}}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	if names := routerNames(c); len(names) != 1 || names[0] != "own" {
+		t.Errorf("expected router own only, got %v", names)
+	}
+	if _, ok := c.HTTP.Services["claim"]; ok {
+		t.Error("expected the service of the dropped router to be removed")
+	}
+	if len(c.TCP.Routers) != 0 {
+		t.Errorf("expected the catch-all tcp router to be dropped, got %v", c.TCP.Routers)
+	}
+
+	if c := p.filterConfig(endpoint{}, []byte(body)); c == nil || len(c.HTTP.Routers) != 2 {
+		t.Error("expected every host without allowed domains")
+	}
+}
+
+func TestFilterConfigInjectMiddlewares(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api","middlewares":["auth","ratelimit@file"]},` +
+		`"web":{"entryPoints":["web"],"service":"api"}},` +
+		`"services":{"api":{"loadBalancer":{}}},"middlewares":{"auth":{"basicAuth":{}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}, inject: []string{"security-headers@file", "ratelimit@file"}}
+	c := p.filterConfig(endpoint{inject: []string{"audit@file", "security-headers@file"}}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	expected := []string{"security-headers@file", "ratelimit@file", "audit@file", "auth"}
+	if m := c.HTTP.Routers["api"].Middlewares; !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	if m := c.HTTP.Routers["web"].Middlewares; !reflect.DeepEqual(m, expected[:3]) {
+		t.Errorf("expected %v, got %v", expected[:3], m)
+	}
+	if _, ok := c.HTTP.Middlewares["auth"]; !ok {
+		t.Error("expected the node middleware to be kept")
+	}
+}
+
+func TestFilterConfigRewriteMiddlewares(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api","middlewares":["local-auth","compress","ratelimit"]}},` +
+		`"services":{"api":{"loadBalancer":{}}},"middlewares":{"local-auth":{"basicAuth":{}},"compress":{"compress":{}},"ratelimit":{"rateLimit":{}}}}}`
+
+	rewriter, err := newMiddlewareRewriter([]string{".*-auth"}, map[string]string{"ratelimit": "ratelimit@file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{entrypoints: map[string]bool{"web": true}, middlewares: rewriter, inject: []string{"auth@file"}}
+	c := p.filterConfig(endpoint{}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	expected := []string{"auth@file", "compress", "ratelimit@file"}
+	if m := c.HTTP.Routers["api"].Middlewares; !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	if len(c.HTTP.Middlewares) != 1 || c.HTTP.Middlewares["compress"] == nil {
+		t.Errorf("expected the replaced middlewares to be removed, got %v", c.HTTP.Middlewares)
+	}
+}
+
+func TestFilterConfigForceTLS(t *testing.T) {
+	body := `{"http":{"routers":{"plain":{"entryPoints":["web"],"service":"api"},` +
+		`"own":{"entryPoints":["web"],"service":"api","tls":{"certResolver":"node"}}},"services":{"api":{"loadBalancer":{}}}}}`
+
+	forced := &dynamic.RouterTLSConfig{CertResolver: "le", Domains: []types.Domain{{Main: "example.com", SANs: []string{"*.example.com"}}}}
+	p := &Provider{entrypoints: map[string]bool{"web": true}, forceTLS: forced}
+	c := p.filterConfig(endpoint{}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	for name, r := range c.HTTP.Routers {
+		if !reflect.DeepEqual(r.TLS, forced) {
+			t.Errorf("%s: expected the forced tls, got %+v", name, r.TLS)
+		}
+		if r.TLS == forced {
+			t.Errorf("%s: expected a copy of the forced tls", name)
+		}
+	}
+}
+
+func TestFilterConfigRouterPriorityOffset(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api","priority":10}},"services":{"api":{"loadBalancer":{}}}},` +
+		`"tcp":{"routers":{"db":{"entryPoints":["web"],"service":"db","rule":"HostSNI(` + "`*`" + `)"}},"services":{"db":{"loadBalancer":{}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	c := p.filterConfig(endpoint{offset: 100}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	if priority := c.HTTP.Routers["api"].Priority; priority != 110 {
+		t.Errorf("expected priority 110, got %d", priority)
+	}
+	if priority := c.TCP.Routers["db"].Priority; priority != 112 {
+		t.Errorf("expected the rule length plus the offset, got %d", priority)
+	}
+}
+
+func TestFilterConfigPathPrefix(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api","rule":"PathPrefix(` + "`/`" + `)","middlewares":["auth"]}},` +
+		`"services":{"api":{"loadBalancer":{}}},"middlewares":{"auth":{"basicAuth":{}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	c := p.filterConfig(endpoint{pathPrefix: "/node1"}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	r := c.HTTP.Routers["api"]
+	if r.Rule != "PathPrefix(`/node1`) && (PathPrefix(`/node1/`))" {
+		t.Errorf("unexpected rule %s", r.Rule)
+	}
+	if !reflect.DeepEqual(r.Middlewares, []string{"strip-node1", "auth"}) {
+		t.Errorf("unexpected middlewares %v", r.Middlewares)
+	}
+	m := c.HTTP.Middlewares["strip-node1"]
+	if m == nil || m.StripPrefix == nil || !reflect.DeepEqual(m.StripPrefix.Prefixes, []string{"/node1"}) {
+		t.Errorf("expected the stripPrefix middleware, got %+v", m)
+	}
+}
+
+func TestFilterConfigTCP(t *testing.T) {
+	body := `{"tcp":{` +
+		`"routers":{"db":{"entryPoints":["db","other"],"service":"db","middlewares":["allow"],"rule":"HostSNI(` + "`*`" + `)"},` +
+		`"other":{"entryPoints":["other"],"service":"other","rule":"HostSNI(` + "`*`" + `)"}},` +
+		`"services":{"db":{"loadBalancer":{"servers":[{"address":"10.0.0.1:5432"}]}},"other":{"loadBalancer":{"servers":[{"address":"10.0.0.2:1"}]}}},` +
+		`"middlewares":{"allow":{"ipAllowList":{"sourceRange":["10.0.0.0/8"]}},"unused":{"inFlightConn":{"amount":1}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"db": true}}
+	config := p.filterConfig(endpoint{}, []byte(body))
+	if config == nil || config.TCP == nil {
+		t.Fatal("expected a tcp configuration")
+	}
+	r := config.TCP.Routers["db"]
+	if r == nil || len(config.TCP.Routers) != 1 || !reflect.DeepEqual(r.EntryPoints, []string{"db"}) {
+		t.Errorf("expected router db on entrypoint db only, got %+v", config.TCP.Routers)
+	}
+	if _, ok := config.TCP.Services["other"]; ok || len(config.TCP.Services) != 1 {
+		t.Errorf("expected the service of router other to be removed, got %v", config.TCP.Services)
+	}
+	if _, ok := config.TCP.Middlewares["unused"]; ok || len(config.TCP.Middlewares) != 1 {
+		t.Errorf("expected the unused middleware to be removed, got %v", config.TCP.Middlewares)
+	}
+
+	if config := p.filterConfig(endpoint{}, []byte(`{"tcp":{"routers":{"other":{"entryPoints":["other"],"service":"other"}}}}`)); config != nil {
+		t.Errorf("expected nothing left to publish, got %+v", config)
+	}
+}
+
+func TestFilterConfigUDP(t *testing.T) {
+	body := `{"udp":{"routers":{"syslog":{"entryPoints":["syslog"],"service":"syslog"},"game":{"entryPoints":["game"],"service":"game"}},` +
+		`"services":{"syslog":{"loadBalancer":{"servers":[{"address":"10.0.0.1:514"}]}},"game":{"loadBalancer":{"servers":[{"address":"10.0.0.2:27015"}]}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"syslog": true}}
+	config := p.filterConfig(endpoint{}, []byte(body))
+	if config == nil || config.UDP == nil {
+		t.Fatal("expected a udp configuration")
+	}
+	if _, ok := config.UDP.Routers["syslog"]; !ok || len(config.UDP.Routers) != 1 {
+		t.Errorf("expected router syslog only, got %v", config.UDP.Routers)
+	}
+	if _, ok := config.UDP.Services["game"]; ok || len(config.UDP.Services) != 1 {
+		t.Errorf("expected the service of router game to be removed, got %v", config.UDP.Services)
+	}
+}
+
+func TestFilterConfigTLS(t *testing.T) {
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	config := p.filterConfig(endpoint{}, []byte(`{"tls":{"certificates":[{"certFile":"/certs/edge.crt","keyFile":"/certs/edge.key"}]}}`))
+	if config == nil || config.TLS == nil || len(config.TLS.Certificates) != 1 {
+		t.Fatalf("expected the certificates to be published, got %+v", config)
+	}
+}
+
+func TestFilterConfigServersTransports(t *testing.T) {
+	body := `{"http":{"routers":{"api":{"entryPoints":["web"],"service":"api"},"admin":{"entryPoints":["admin"],"service":"admin"}},` +
+		`"services":{"api":{"loadBalancer":{"serversTransport":"internal","servers":[{"url":"https://10.0.0.1"}]}},` +
+		`"admin":{"loadBalancer":{"serversTransport":"mtls","servers":[{"url":"https://10.0.0.2"}]}},` +
+		`"spare":{"loadBalancer":{"serversTransport":"internal","servers":[{"url":"https://10.0.0.3"}]}}},` +
+		`"serversTransports":{"internal":{"serverName":"api.internal"},"mtls":{"serverName":"admin.internal"},"unused":{}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	config := p.filterConfig(endpoint{}, []byte(body))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	transports := config.HTTP.ServersTransports
+	if _, ok := transports["internal"]; !ok || len(transports) != 1 {
+		t.Errorf("expected only the transport of the remaining services, got %v", transports)
+	}
+}
+
+func TestArrayPartsReplacedOnUpdate(t *testing.T) {
+	srv := sseServer(t,
+		"data: ["+routerConfig("first", "web")+","+routerConfig("second", "web")+"]\n\n",
+		"data: ["+routerConfig("third", "web")+"]\n\n",
+	)
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "sse"},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if len(config.HTTP.Routers) != 2 {
+		t.Fatalf("expected routers first and second, got %v", routerNames(config))
+	}
+
+	config = receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["third"]; !ok || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected router third only, got %v", routerNames(config))
+	}
+}
+
+func TestSetHeadersFromFiles(t *testing.T) {
+	t.Setenv("CONFIG_ENV", "prod")
+	secret := filepath.Join(t.TempDir(), "token")
+	e := endpoint{headers: map[string]string{"Authorization": "file:" + secret, "X-Env": "${CONFIG_ENV}"}}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := e.setHeaders(req); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	// the file is read again on every request
+	for _, token := range []string{"Bearer first\n", "Bearer second"} {
+		if err := os.WriteFile(secret, []byte(token), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.setHeaders(req); err != nil {
+			t.Fatal(err)
+		}
+		if actual := req.Header.Get("Authorization"); actual != strings.TrimSpace(token) {
+			t.Errorf("expected %q, got %q", strings.TrimSpace(token), actual)
+		}
+	}
+	if env := req.Header.Get("X-Env"); env != "prod" {
+		t.Errorf("expected the expanded header, got %q", env)
+	}
+}
+
+func TestPollEndpointsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		_, _ = w.Write([]byte(routerConfig(strings.TrimPrefix(r.URL.Path, "/"), "web")))
+	}))
+	defer srv.Close()
+
+	endpoints := map[string]endpoint{"sse": {mode: modeSSE, url: srv.URL}}
+	for _, node := range []string{"d", "b", "a", "c", "e"} {
+		endpoints[node] = endpoint{mode: modePoll, url: srv.URL + "/" + node, client: srv.Client()}
+	}
+	p := &Provider{maxConcurrency: 2}
+	results := p.pollEndpoints(context.Background(), endpoints)
+	if len(results) != 5 {
+		t.Fatalf("expected the polled endpoints only, got %d results", len(results))
+	}
+	for i, node := range []string{"a", "b", "c", "d", "e"} {
+		if r := results[i]; r.node != node || r.err != nil || !r.decoded || r.config == nil || r.config.HTTP.Routers[node] == nil {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 concurrent requests, got %d", peak)
+	}
+}
+
+func TestProvideKeepLastKnownGood(t *testing.T) {
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("flaky", "web")))
+	}))
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("stable", "web")))
+	}))
+	defer stable.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "20ms"
+	config.EntryPoints = []string{"web"}
+	config.KeepLastKnownGood = true
+	config.Endpoints = map[string]Endpoint{"flaky": {Endpoint: flaky.URL}, "stable": {Endpoint: stable.URL}}
+	cfgChan := startProviderConfig(t, config)
+
+	for len(routerNames(receiveConfig(t, cfgChan))) != 2 {
+	}
+	flaky.Close()
+	// the configuration is unchanged, hence not published again
+	select {
+	case m := <-cfgChan:
+		body, _ := m.MarshalJSON()
+		t.Fatalf("expected the last configuration of flaky to be kept, got %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProvideStaleTTL(t *testing.T) {
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("flaky", "web")))
+	}))
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("stable", "web")))
+	}))
+	defer stable.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "20ms"
+	config.EntryPoints = []string{"web"}
+	config.KeepLastKnownGood = true
+	config.StaleTTL = "100ms"
+	config.Endpoints = map[string]Endpoint{"flaky": {Endpoint: flaky.URL}, "stable": {Endpoint: stable.URL}}
+	cfgChan := startProviderConfig(t, config)
+
+	for len(routerNames(receiveConfig(t, cfgChan))) != 2 {
+	}
+	flaky.Close()
+	closed := time.Now()
+	for {
+		names := routerNames(receiveConfig(t, cfgChan))
+		if reflect.DeepEqual(names, []string{"stable"}) {
+			break
+		}
+		if time.Since(closed) > 2*time.Second {
+			t.Fatalf("expected the stale configuration to be evicted, got %v", names)
+		}
+	}
+	if elapsed := time.Since(closed); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the configuration to be kept for the stale TTL, evicted after %s", elapsed)
+	}
+}
+
+func TestInitStaleTTL(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+	config.StaleTTL = "1h"
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected staleTTL to require keepLastKnownGood")
+	}
+	config.KeepLastKnownGood = true
+	if p, err = New(context.Background(), config, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestProvideAllowEmpty(t *testing.T) {
+	for _, allowEmpty := range []bool{false, true} {
+		var empty int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(&empty) == 1 {
+				_, _ = w.Write([]byte(`{"http":{"services":{"api":{"loadBalancer":{}}}}}`))
+				return
+			}
+			_, _ = w.Write([]byte(routerConfig("api", "web")))
+		}))
+
+		config := CreateConfig()
+		config.PollInterval = "10ms"
+		config.EntryPoints = []string{"web"}
+		config.AllowEmpty = allowEmpty
+		config.Endpoints = map[string]Endpoint{"node": {Endpoint: srv.URL}}
+		cfgChan := startProviderConfig(t, config)
+
+		if names := routerNames(receiveConfig(t, cfgChan)); len(names) != 1 {
+			t.Fatalf("expected router api, got %v", names)
+		}
+		atomic.StoreInt32(&empty, 1)
+		published := false
+		timeout := time.After(200 * time.Millisecond)
+	wait:
+		for {
+			select {
+			case m := <-cfgChan:
+				body, _ := m.MarshalJSON()
+				if !strings.Contains(string(body), "routers") {
+					published = true
+					break wait
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+		if published != allowEmpty {
+			t.Errorf("allowEmpty %v: expected a configuration without routers published %v, got %v", allowEmpty, allowEmpty, published)
+		}
+		srv.Close()
+	}
+}
+
+func TestProvideInitialFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	defer srv.Close()
+
+	// polled right away rather than after the interval
+	cfgChan := startProvider(t, map[string]Endpoint{"node": {Endpoint: srv.URL}})
+	if names := routerNames(receiveConfig(t, cfgChan)); len(names) != 1 || names[0] != "api" {
+		t.Errorf("expected router api, got %v", names)
+	}
+}
+
+func TestEndpointPollInterval(t *testing.T) {
+	var fast, slow int32
+	serve := func(hits *int32, router string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(hits, 1)
+			_, _ = w.Write([]byte(routerConfig(router, "web")))
+		}))
+	}
+	fastSrv, slowSrv := serve(&fast, "fast"), serve(&slow, "slow")
+	defer fastSrv.Close()
+	defer slowSrv.Close()
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"fast": {Endpoint: fastSrv.URL, PollInterval: "20ms"},
+		"slow": {Endpoint: slowSrv.URL},
+	})
+	deadline := time.After(300 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case <-cfgChan:
+		case <-deadline:
+			done = true
+		}
+	}
+	if n := atomic.LoadInt32(&fast); n < 3 {
+		t.Errorf("expected the fast endpoint to be polled on its interval, got %d polls", n)
+	}
+	if n := atomic.LoadInt32(&slow); n != 1 {
+		t.Errorf("expected the slow endpoint to be polled once, got %d polls", n)
+	}
+}
+
+func TestProvidePublishesChanges(t *testing.T) {
+	var router atomic.Value
+	router.Store("api")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig(router.Load().(string), "web")))
+	}))
+	defer srv.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "10ms"
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"node": {Endpoint: srv.URL}}
+	cfgChan := startProviderConfig(t, config)
+
+	receiveConfig(t, cfgChan)
+	select {
+	case <-cfgChan:
+		t.Fatal("expected an unchanged configuration not to be published again")
+	case <-time.After(100 * time.Millisecond):
+	}
+	router.Store("web")
+	if names := routerNames(receiveConfig(t, cfgChan)); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("expected the changed configuration, got %v", names)
+	}
+}
+
+func TestLoadConfigurationDebounce(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Debounce = "50ms"
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2", Mode: "sse"}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	p.endpoints = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfgChan := make(chan json.Marshaler)
+	updates := make(chan update)
+	go p.loadConfiguration(ctx, cfgChan, updates)
+
+	for _, node := range []string{"a", "b", "c"} {
+		var cfg dynamic.Configuration
+		if err := json.Unmarshal([]byte(routerConfig(node, "web")), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		updates <- update{node: node, config: &cfg}
+	}
+	names := routerNames(receiveConfig(t, cfgChan))
+	if sort.Strings(names); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("expected the burst of updates to be published at once, got %v", names)
+	}
+}
+
+func TestInitDebounce(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+	config.Debounce = "1m"
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected debounce to be shorter than the poll interval")
+	}
+}
+
+func TestStopCancelsInFlightRequests(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer srv.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.PollTimeout = "1h"
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"node": {Endpoint: srv.URL}}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Provide(make(chan json.Marshaler)); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		_ = p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Stop to return")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the in-flight request to be canceled")
+	}
+}
+
+func TestLoadConfigurationRecoversNodePanic(t *testing.T) {
+	RegisterTransformer("panic-bad", TransformerFunc(func(node string, cfg *dynamic.Configuration) error {
+		if node == "bad" {
+			panic("bad payload")
+		}
+		return nil
+	}))
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("broken", "web")))
+	}))
+	defer bad.Close()
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Transformers = []string{"panic-bad"}
+	config.Endpoints = map[string]Endpoint{"good": {Endpoint: good.URL}, "bad": {Endpoint: bad.URL}}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	cfgChan := make(chan json.Marshaler)
+	if err := p.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	if names := routerNames(receiveConfig(t, cfgChan)); len(names) != 1 || names[0] != "api" {
+		t.Errorf("expected router api of the good node, got %v", names)
+	}
+	if n := atomic.LoadInt64(&p.restarts); n != 0 {
+		t.Errorf("expected the loop not to restart, got %d restarts", n)
+	}
+}
+
+func TestStopAfterFailedProvide(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"node": {Endpoint: "10.0.1.2"}}
+	config.Status = &Status{Address: ln.Addr().String()}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Errorf("expected Stop to be a no-op before Provide, got %v", err)
+	}
+	if err := p.Provide(make(chan json.Marshaler)); err == nil {
+		t.Fatal("expected an error for an address in use")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		_ = p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Stop to return after a failed Provide")
+	}
+}
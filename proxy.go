@@ -0,0 +1,79 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Proxy the outbound proxy used to reach endpoints.
+type Proxy struct {
+	URL     string   `json:"url,omitempty"`
+	NoProxy []string `json:"noProxy,omitempty"`
+}
+
+// proxyFunc returns the http.Transport proxy selector. Hosts matching one of
+// the NoProxy entries are dialed directly. Entries can be host names, which
+// also match their subdomains, domain suffixes matching only subdomains
+// (".internal"), IP addresses, CIDR ranges or "*".
+// Without URL every host is dialed directly.
+func (p *Proxy) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if p.URL == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", p.URL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	var nets []*net.IPNet
+	var hosts []string
+	for _, entry := range p.NoProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		hosts = append(hosts, entry)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(strings.ToLower(req.URL.Hostname()), hosts, nets) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+func bypassProxy(host string, hosts []string, nets []*net.IPNet) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, h := range hosts {
+		if h == "*" || h == host {
+			return true
+		}
+		suffix := h
+		if !strings.HasPrefix(suffix, ".") {
+			suffix = "." + suffix
+		}
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
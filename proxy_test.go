@@ -0,0 +1,114 @@
+package multi_http_provider
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	proxy := &Proxy{
+		URL:     "http://proxy.internal:3128",
+		NoProxy: []string{".cluster.local", "Example.com", "10.0.0.0/8", "192.168.1.10", " ", "::1"},
+	}
+	proxyFunc, err := proxy.proxyFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url    string
+		direct bool
+	}{
+		{url: "http://config.internal/traefik", direct: false},
+		{url: "http://svc.ns.svc.cluster.local/", direct: true},
+		{url: "http://cluster.local/", direct: false},
+		{url: "http://notcluster.local/", direct: false},
+		{url: "https://example.com/", direct: true},
+		{url: "https://api.EXAMPLE.com/", direct: true},
+		{url: "https://badexample.com/", direct: false},
+		{url: "http://10.1.2.3:5000/", direct: true},
+		{url: "http://11.1.2.3:5000/", direct: false},
+		{url: "http://192.168.1.10/", direct: true},
+		{url: "http://192.168.1.11/", direct: false},
+		{url: "http://[::1]:5000/", direct: true},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxyURL, err := proxyFunc(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if direct := proxyURL == nil; direct != test.direct {
+				t.Errorf("expected direct=%t, got proxy %v", test.direct, proxyURL)
+			}
+		})
+	}
+}
+
+func TestProxyFuncWildcard(t *testing.T) {
+	proxyFunc, err := (&Proxy{URL: "http://proxy.internal:3128", NoProxy: []string{"*"}}).proxyFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://anything.example.org/", nil)
+	if proxyURL, _ := proxyFunc(req); proxyURL != nil {
+		t.Errorf("expected direct connection, got proxy %v", proxyURL)
+	}
+}
+
+func TestProxyFuncValidation(t *testing.T) {
+	tests := []struct {
+		desc    string
+		proxy   Proxy
+		direct  bool
+		wantErr bool
+	}{
+		{desc: "http proxy", proxy: Proxy{URL: "http://proxy:3128"}},
+		{desc: "socks5 proxy", proxy: Proxy{URL: "socks5://proxy:1080"}},
+		{desc: "empty proxy", proxy: Proxy{}, direct: true},
+		{desc: "noProxy only", proxy: Proxy{NoProxy: []string{"internal"}}, direct: true},
+		{desc: "unsupported scheme", proxy: Proxy{URL: "ftp://proxy:21"}, wantErr: true},
+		{desc: "missing scheme", proxy: Proxy{URL: "proxy:3128"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			proxyFunc, err := test.proxy.proxyFunc()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if direct := proxyFunc == nil; direct != test.direct {
+				t.Errorf("expected direct=%t", test.direct)
+			}
+		})
+	}
+}
+
+func TestNewClientProxyOverride(t *testing.T) {
+	provider := &Proxy{URL: "http://proxy.internal:3128"}
+
+	client, err := newClient(Endpoint{Endpoint: "10.0.0.1", Proxy: &Proxy{}}, nil, nil, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Transport.(*http.Transport).Proxy != nil {
+		t.Error("expected the endpoint to disable the provider proxy")
+	}
+
+	client, err = newClient(Endpoint{Endpoint: "10.0.0.1"}, nil, nil, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Transport.(*http.Transport).Proxy == nil {
+		t.Error("expected the provider proxy to be used")
+	}
+}
@@ -0,0 +1,45 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// quorum the polled endpoints that must respond in a cycle for the merged
+// configuration to be published, a number or a percentage of them.
+type quorum struct {
+	count   int
+	percent float64
+}
+
+func parseQuorum(s string) (*quorum, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid percentage %q", s)
+		}
+		return &quorum{percent: percent}, nil
+	}
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid number of endpoints %q", s)
+	}
+	return &quorum{count: count}, nil
+}
+
+// required returns the endpoints that must respond out of total.
+func (q *quorum) required(total int) int {
+	if q == nil {
+		return 0
+	}
+	if q.percent > 0 {
+		return int(math.Ceil(q.percent * float64(total) / 100))
+	}
+	return q.count
+}
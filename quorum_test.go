@@ -0,0 +1,62 @@
+package multi_http_provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuorum(t *testing.T) {
+	tests := []struct {
+		value    string
+		total    int
+		expected int
+	}{
+		{value: "", total: 10, expected: 0},
+		{value: "3", total: 10, expected: 3},
+		{value: "50%", total: 5, expected: 3},
+		{value: "100%", total: 4, expected: 4},
+	}
+	for _, test := range tests {
+		q, err := parseQuorum(test.value)
+		if err != nil {
+			t.Fatalf("%q: %s", test.value, err)
+		}
+		if actual := q.required(test.total); actual != test.expected {
+			t.Errorf("%q of %d: expected %d, got %d", test.value, test.total, test.expected, actual)
+		}
+	}
+	for _, value := range []string{"many", "-1", "150%", "x%"} {
+		if _, err := parseQuorum(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestProvideMinEndpoints(t *testing.T) {
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(routerConfig("stable", "web")))
+	}))
+	defer stable.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "10ms"
+	config.EntryPoints = []string{"web"}
+	config.MinEndpoints = "2"
+	config.Endpoints = map[string]Endpoint{"stable": {Endpoint: stable.URL}, "down": {Endpoint: down.URL}}
+	cfgChan := startProviderConfig(t, config)
+
+	select {
+	case <-cfgChan:
+		t.Error("expected no configuration to be published without a quorum")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	config.MinEndpoints = "50%"
+	if names := routerNames(receiveConfig(t, startProviderConfig(t, config))); len(names) != 1 {
+		t.Errorf("expected the configuration of stable with half of the endpoints, got %v", names)
+	}
+}
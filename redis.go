@@ -0,0 +1,315 @@
+package multi_http_provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func isRedisURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "redis://") || strings.HasPrefix(endpoint, "rediss://")
+}
+
+// redisTarget is a parsed redis://[user:password@]host:port/key?db=0&channel=name
+// endpoint, rediss:// connecting over TLS.
+type redisTarget struct {
+	address  string
+	tls      bool
+	username string
+	password string
+	db       int
+	key      string
+	channel  string
+}
+
+func parseRedisURL(raw string) (*redisTarget, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	target := &redisTarget{
+		address: u.Host,
+		tls:     u.Scheme == "rediss",
+		key:     strings.TrimPrefix(u.Path, "/"),
+		channel: u.Query().Get("channel"),
+	}
+	if u.Port() == "" {
+		target.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		target.username = u.User.Username()
+		target.password, _ = u.User.Password()
+		if target.password == "" {
+			// redis://:password@host or redis://password@host
+			target.password, target.username = target.username, ""
+		}
+	}
+	if db := u.Query().Get("db"); db != "" {
+		target.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis db %q", db)
+		}
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in redis url")
+	}
+	if target.key == "" && target.channel == "" {
+		return nil, fmt.Errorf("redis url must set a key or a channel")
+	}
+	return target, nil
+}
+
+// redisSource reads the configuration stored in a Redis key on every poll.
+type redisSource struct {
+	target *redisTarget
+}
+
+func (r *redisSource) fetch(ctx context.Context, e endpoint) ([]byte, error) {
+	conn, err := dialRedis(ctx, r.target, e)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.get(r.target.key)
+}
+
+// redisSubscriber reads the configuration stored in the key, if any, then
+// applies every configuration published on the channel.
+type redisSubscriber struct {
+	target  *redisTarget
+	backoff *backoff
+}
+
+func (r *redisSubscriber) reconnect(connected bool) time.Duration {
+	if connected {
+		r.backoff.reset()
+	}
+	return r.backoff.next()
+}
+
+func (r *redisSubscriber) watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error) {
+	conn, err := dialRedis(ctx, r.target, e)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if r.target.key != "" {
+		body, err := conn.get(r.target.key)
+		if err != nil {
+			return false, err
+		}
+		emit("", "", body)
+	}
+
+	if err := conn.send("SUBSCRIBE", r.target.channel); err != nil {
+		return false, err
+	}
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return true, err
+		}
+		message, ok := reply.([]interface{})
+		if !ok || len(message) != 3 {
+			continue
+		}
+		if kind, _ := message[0].(string); kind != "message" {
+			continue
+		}
+		if payload, ok := message[2].(string); ok {
+			emit("", "", []byte(payload))
+		}
+	}
+}
+
+// maxRedisDepth bounds the nesting of the arrays of a reply.
+const maxRedisDepth = 8
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// stops closing the connection once the context is done
+	stop func() bool
+	// the size limit of a reply, see maxResponseBytes
+	limit int
+}
+
+func dialRedis(ctx context.Context, target *redisTarget, e endpoint) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if target.tls {
+		config := &tls.Config{}
+		if transport, ok := e.client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(target.address)
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, "tcp", target.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", target.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the replies are awaited until the deadline of the context, if any, and
+	// no longer once it is done
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), limit: e.maxBytes}
+	c.stop = context.AfterFunc(ctx, func() { _ = conn.Close() })
+	if target.password != "" {
+		args := []string{"AUTH", target.password}
+		if target.username != "" {
+			args = []string{"AUTH", target.username, target.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if target.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(target.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) Close() error {
+	if c.stop != nil {
+		c.stop()
+	}
+	return c.conn.Close()
+}
+
+func (c *redisConn) get(key string) ([]byte, error) {
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return []byte(value), nil
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) send(args ...string) error {
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.conn, cmd.String())
+	return err
+}
+
+// read decodes a RESP reply: bulk and simple strings as string, integers as
+// int64, arrays as []interface{} and null replies as nil. Replies larger than
+// the limit are rejected.
+func (c *redisConn) read() (interface{}, error) {
+	return c.readDepth(0)
+}
+
+func (c *redisConn) readDepth(depth int) (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("invalid redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line[1:])
+		}
+		if size == -1 {
+			return nil, nil
+		}
+		if limit := bodyLimit(c.limit); size < 0 || size > limit {
+			return nil, fmt.Errorf("invalid bulk length %d, limit %d bytes, see maxResponseBytes", size, limit)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line[1:])
+		}
+		if count == -1 {
+			return nil, nil
+		}
+		// every item takes at least 3 bytes
+		if count < 0 || count > bodyLimit(c.limit)/3 {
+			return nil, fmt.Errorf("invalid array length %d", count)
+		}
+		if depth >= maxRedisDepth {
+			return nil, fmt.Errorf("redis reply nested deeper than %d arrays", maxRedisDepth)
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			items[i], err = c.readDepth(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unsupported redis reply %q", line)
+	}
+}
+
+// readLine reads a line of a reply without its CRLF, failing when longer than
+// the limit.
+func (c *redisConn) readLine() (string, error) {
+	limit := bodyLimit(c.limit)
+	var line []byte
+	for {
+		chunk, err := c.reader.ReadSlice('\n')
+		if len(line)+len(chunk) > limit+2 {
+			return "", fmt.Errorf("redis reply line exceeds %d bytes", limit)
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(line), "\r\n"), nil
+	}
+}
@@ -0,0 +1,91 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// referenceChecker rejects the routers referencing services or middlewares
+// their node does not define, but for the shared ones.
+type referenceChecker struct {
+	shared []*regexp.Regexp
+}
+
+func newReferenceChecker(strict bool, shared []string) (*referenceChecker, error) {
+	if !strict {
+		return nil, nil
+	}
+	c := &referenceChecker{}
+	for _, pattern := range shared {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("sharedReferences: %w", err)
+		}
+		c.shared = append(c.shared, re)
+	}
+	return c, nil
+}
+
+func (c *referenceChecker) isShared(name string) bool {
+	for _, re := range c.shared {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpRouter reports whether the services and middlewares the router uses,
+// directly or through others, are defined by config or shared.
+func (c *referenceChecker) httpRouter(e endpoint, name string, router *dynamic.Router, config *dynamic.HTTPConfiguration) bool {
+	if c == nil {
+		return true
+	}
+	services, middlewares := httpReferences(&dynamic.HTTPConfiguration{
+		Routers:     map[string]*dynamic.Router{name: router},
+		Services:    config.Services,
+		Middlewares: config.Middlewares,
+	})
+	for s := range services {
+		if config.Services[s] == nil && !c.isShared(s) {
+			logger.Warn("Dropping a router, its service is not defined by the node", "router", name, "endpoint", e, "service", s)
+			return false
+		}
+	}
+	for m := range middlewares {
+		if config.Middlewares[m] == nil && !c.isShared(m) {
+			logger.Warn("Dropping a router, its middleware is not defined by the node", "router", name, "endpoint", e, "middleware", m)
+			return false
+		}
+	}
+	return true
+}
+
+// tcpRouter reports whether the service, its weighted services, and the
+// middlewares of the router are defined by config or shared.
+func (c *referenceChecker) tcpRouter(e endpoint, name string, router *dynamic.TCPRouter, config *dynamic.TCPConfiguration) bool {
+	if c == nil {
+		return true
+	}
+	services := []string{router.Service}
+	if s := config.Services[router.Service]; s != nil && s.Weighted != nil {
+		for _, w := range s.Weighted.Services {
+			services = append(services, w.Name)
+		}
+	}
+	for _, s := range services {
+		if config.Services[s] == nil && !c.isShared(s) {
+			logger.Warn("Dropping a tcp router, its service is not defined by the node", "router", name, "endpoint", e, "service", s)
+			return false
+		}
+	}
+	for _, m := range router.Middlewares {
+		if config.Middlewares[m] == nil && !c.isShared(m) {
+			logger.Warn("Dropping a tcp router, its middleware is not defined by the node", "router", name, "endpoint", e, "middleware", m)
+			return false
+		}
+	}
+	return true
+}
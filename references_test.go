@@ -0,0 +1,60 @@
+package multi_http_provider
+
+import (
+	"testing"
+)
+
+func TestFilterConfigStrictReferences(t *testing.T) {
+	body := `{"http":{"routers":{` +
+		`"own":{"entryPoints":["web"],"service":"own","middlewares":["chain"]},` +
+		`"shared":{"entryPoints":["web"],"service":"own","middlewares":["auth@file"]},` +
+		`"service":{"entryPoints":["web"],"service":"missing"},` +
+		`"nested":{"entryPoints":["web"],"service":"split"},` +
+		`"chained":{"entryPoints":["web"],"service":"own","middlewares":["broken"]}},` +
+		`"services":{"own":{"loadBalancer":{}},"split":{"weighted":{"services":[{"name":"own"},{"name":"other@docker"}]}}},` +
+		`"middlewares":{"chain":{"chain":{"middlewares":["headers"]}},"headers":{"headers":{}},"broken":{"chain":{"middlewares":["gone"]}}}},` +
+		`"tcp":{"routers":{"db":{"entryPoints":["web"],"service":"db","rule":"HostSNI(` + "`*`" + `)"},` +
+		`"remote":{"entryPoints":["web"],"service":"db@file","rule":"HostSNI(` + "`*`" + `)"}},` +
+		`"services":{"db":{"loadBalancer":{}}}}}`
+
+	references, err := newReferenceChecker(true, []string{".*@file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{entrypoints: map[string]bool{"web": true}, references: references}
+	c := p.filterConfig(endpoint{}, []byte(body))
+	if c == nil {
+		t.Fatal("expected a configuration")
+	}
+	for _, name := range []string{"own", "shared"} {
+		if c.HTTP.Routers[name] == nil {
+			t.Errorf("expected router %s to be kept", name)
+		}
+	}
+	for _, name := range []string{"service", "nested", "chained"} {
+		if c.HTTP.Routers[name] != nil {
+			t.Errorf("expected router %s to be dropped", name)
+		}
+	}
+	if _, ok := c.HTTP.Services["split"]; ok {
+		t.Error("expected the service of the dropped router to be removed")
+	}
+	if len(c.TCP.Routers) != 2 {
+		t.Errorf("expected the tcp routers to be kept, got %v", c.TCP.Routers)
+	}
+
+	references, _ = newReferenceChecker(true, nil)
+	p.references = references
+	if c := p.filterConfig(endpoint{}, []byte(body)); c == nil || c.HTTP.Routers["shared"] != nil || c.TCP.Routers["remote"] != nil {
+		t.Error("expected the references to other providers to be dropped without shared ones")
+	}
+}
+
+func TestNewReferenceChecker(t *testing.T) {
+	if c, err := newReferenceChecker(false, []string{"("}); c != nil || err != nil {
+		t.Errorf("expected no checker when not strict, got %v, %v", c, err)
+	}
+	if _, err := newReferenceChecker(true, []string{"("}); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}
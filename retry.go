@@ -0,0 +1,94 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Retry the retries of the failed fetches of an endpoint within a polling
+// cycle, waiting InitialInterval, doubled after each attempt up to
+// MaxInterval. Network errors and StatusCodes are retried.
+type Retry struct {
+	Attempts        int    `json:"attempts,omitempty"`
+	InitialInterval string `json:"initialInterval,omitempty"`
+	MaxInterval     string `json:"maxInterval,omitempty"`
+	StatusCodes     []int  `json:"statusCodes,omitempty"`
+}
+
+// defaultRetryStatusCodes the statuses of transient failures.
+var defaultRetryStatusCodes = []int{429, 502, 503, 504}
+
+type retryPolicy struct {
+	attempts        int
+	initial, max    time.Duration
+	retryableStatus map[int]bool
+}
+
+func newRetryPolicy(config *Retry) (*retryPolicy, error) {
+	if config == nil || config.Attempts == 0 {
+		return nil, nil
+	}
+	if config.Attempts < 0 {
+		return nil, fmt.Errorf("attempts must not be negative")
+	}
+	r := &retryPolicy{attempts: config.Attempts, initial: 500 * time.Millisecond, max: 5 * time.Second}
+	var err error
+	if config.InitialInterval != "" {
+		if r.initial, err = time.ParseDuration(config.InitialInterval); err != nil {
+			return nil, fmt.Errorf("initialInterval: %w", err)
+		}
+	}
+	if config.MaxInterval != "" {
+		if r.max, err = time.ParseDuration(config.MaxInterval); err != nil {
+			return nil, fmt.Errorf("maxInterval: %w", err)
+		}
+	} else if r.max < r.initial {
+		r.max = r.initial
+	}
+	if r.initial <= 0 || r.max < r.initial {
+		return nil, fmt.Errorf("initialInterval must be greater than 0 and at most maxInterval")
+	}
+	codes := config.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	r.retryableStatus = map[int]bool{}
+	for _, code := range codes {
+		r.retryableStatus[code] = true
+	}
+	return r, nil
+}
+
+// statusError a response with a retryable status.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.code)
+}
+
+// do calls fetch until it succeeds, the attempts are exhausted or ctx is done,
+// a nil policy calling it once.
+func (r *retryPolicy) do(ctx context.Context, fetch func() error) error {
+	err := fetch()
+	if r == nil {
+		return err
+	}
+	wait := r.initial
+	for attempt := 0; err != nil && attempt < r.attempts; attempt++ {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if wait *= 2; wait > r.max {
+			wait = r.max
+		}
+		err = fetch()
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package multi_http_provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchConfigRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n := atomic.AddInt32(&calls, 1); {
+		case n <= 2:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("not found"))
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	retry, err := newRetryPolicy(&Retry{Attempts: 3, InitialInterval: "1ms", MaxInterval: "2ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{}
+	body, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client(), retry: retry})
+	if err != nil || string(body) != "ok" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expected the third attempt to succeed, got %q, %v after %d calls", body, err, atomic.LoadInt32(&calls))
+	}
+
+	// statuses out of the retryable ones are returned as before
+	atomic.StoreInt32(&calls, 2)
+	if body, _, err := p.fetchConfig(context.Background(), endpoint{url: srv.URL + "/missing", client: srv.Client(), retry: retry}); err != nil || string(body) != "not found" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expected no retry, got %q, %v after %d calls", body, err, atomic.LoadInt32(&calls))
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	retry, _ = newRetryPolicy(&Retry{Attempts: 1, InitialInterval: "1ms"})
+	_, _, err = p.fetchConfig(context.Background(), endpoint{url: srv.URL, client: srv.Client(), retry: retry})
+	var status *statusError
+	if !errors.As(err, &status) || status.code != http.StatusBadGateway || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected a status error after 2 calls, got %v after %d calls", err, atomic.LoadInt32(&calls))
+	}
+}
+
+func TestRetryPolicyCanceled(t *testing.T) {
+	retry, err := newRetryPolicy(&Retry{Attempts: 5, InitialInterval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err = retry.do(ctx, func() error {
+		calls++
+		return errors.New("failed")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected to give up waiting, got %v after %d calls", err, calls)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	if r, err := newRetryPolicy(nil); r != nil || err != nil {
+		t.Errorf("expected no policy, got %v, %v", r, err)
+	}
+	r, err := newRetryPolicy(&Retry{Attempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.initial != 500*time.Millisecond || r.max != 5*time.Second || !r.retryableStatus[503] || r.retryableStatus[500] {
+		t.Errorf("unexpected defaults %+v", r)
+	}
+	for _, config := range []*Retry{
+		{Attempts: -1},
+		{Attempts: 1, InitialInterval: "soon"},
+		{Attempts: 1, InitialInterval: "10s", MaxInterval: "1s"},
+	} {
+		if _, err := newRetryPolicy(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// routerFilter the allow and deny lists of router names. Routers are kept
+// when they match an allow pattern, if any, and no deny pattern.
+type routerFilter struct {
+	allow, deny []*regexp.Regexp
+}
+
+func newRouterFilter(allow, deny []string) (*routerFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &routerFilter{}
+	for _, pattern := range allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("allowRouters: %w", err)
+		}
+		f.allow = append(f.allow, re)
+	}
+	for _, pattern := range deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("denyRouters: %w", err)
+		}
+		f.deny = append(f.deny, re)
+	}
+	return f, nil
+}
+
+func (f *routerFilter) allows(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, re := range f.deny {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, re := range f.allow {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectMiddlewares prepends the injected middlewares of the provider, then
+// those of e, to the routers, moving them first when already referenced.
+func (p *Provider) injectMiddlewares(e endpoint, routers map[string]*dynamic.Router) {
+	if len(p.inject) == 0 && len(e.inject) == 0 {
+		return
+	}
+	var inject []string
+	injected := map[string]bool{}
+	for _, name := range append(append([]string{}, p.inject...), e.inject...) {
+		if !injected[name] {
+			injected[name] = true
+			inject = append(inject, name)
+		}
+	}
+	for _, v := range routers {
+		middlewares := append([]string{}, inject...)
+		for _, name := range v.Middlewares {
+			if !injected[name] {
+				middlewares = append(middlewares, name)
+			}
+		}
+		v.Middlewares = middlewares
+	}
+}
+
+// middlewareRewriter strips and rewrites the middleware references of
+// routers, the patterns matching whole names.
+type middlewareRewriter struct {
+	strip   []*regexp.Regexp
+	rewrite []middlewareRewrite
+}
+
+type middlewareRewrite struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+func newMiddlewareRewriter(strip []string, rewrite map[string]string) (*middlewareRewriter, error) {
+	if len(strip) == 0 && len(rewrite) == 0 {
+		return nil, nil
+	}
+	r := &middlewareRewriter{}
+	for _, pattern := range strip {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("stripMiddlewares: %w", err)
+		}
+		r.strip = append(r.strip, re)
+	}
+	// sorted for the first matching rewrite to be deterministic
+	patterns := make([]string, 0, len(rewrite))
+	for pattern := range rewrite {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("rewriteMiddlewares: %w", err)
+		}
+		r.rewrite = append(r.rewrite, middlewareRewrite{re: re, replacement: rewrite[pattern]})
+	}
+	return r, nil
+}
+
+// apply returns the middlewares without the stripped ones, rewriting the
+// others with the first matching rule.
+func (r *middlewareRewriter) apply(middlewares []string) []string {
+	if r == nil || len(middlewares) == 0 {
+		return middlewares
+	}
+	var result []string
+	seen := map[string]bool{}
+	for _, name := range r.filter(middlewares) {
+		for _, rw := range r.rewrite {
+			if rw.re.MatchString(name) {
+				name = rw.re.ReplaceAllString(name, rw.replacement)
+				break
+			}
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func (r *middlewareRewriter) filter(middlewares []string) []string {
+	var result []string
+next:
+	for _, name := range middlewares {
+		for _, re := range r.strip {
+			if re.MatchString(name) {
+				continue next
+			}
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+// routerPriority adds the priority offset of e to the priority of a router,
+// those without one having the length of their rule as Traefik does. The
+// result is at least 1, 0 meaning the default priority.
+func (e endpoint) routerPriority(priority int, rule string) int {
+	if e.offset == 0 {
+		return priority
+	}
+	if priority == 0 {
+		priority = len(rule)
+	}
+	if priority += e.offset; priority < 1 {
+		return 1
+	}
+	return priority
+}
+
+// prefixRule mounts the rule under the path prefix of e, if any, prefixing
+// the paths of its Path, PathPrefix and PathRegexp matchers.
+func (e endpoint) prefixRule(rule string) string {
+	if e.pathPrefix == "" {
+		return rule
+	}
+	mount := "PathPrefix(`" + e.pathPrefix + "`)"
+	if strings.TrimSpace(rule) == "" {
+		return mount
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		if !isMatcherStart(c) || i > 0 && isMatcherChar(rule[i-1]) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(rule) && isMatcherChar(rule[j]) {
+			j++
+		}
+		name := rule[i:j]
+		args, end, ok := parseMatcherArgs(rule, j)
+		if !ok {
+			b.WriteString(name)
+			i = j
+			continue
+		}
+		if name != "Path" && name != "PathPrefix" && name != "PathRegexp" {
+			b.WriteString(rule[i:end])
+			i = end
+			continue
+		}
+		for k, arg := range args {
+			if name == "PathRegexp" {
+				if strings.HasPrefix(arg, "^") {
+					args[k] = "^" + regexp.QuoteMeta(e.pathPrefix) + arg[1:]
+				}
+				continue
+			}
+			args[k] = e.pathPrefix + arg
+		}
+		b.WriteString(name + "(`" + strings.Join(args, "`, `") + "`)")
+		i = end
+	}
+	return mount + " && (" + b.String() + ")"
+}
+
+// stripPrefixName the name of the stripPrefix middleware of a path prefix,
+// the same for the nodes sharing it.
+func stripPrefixName(prefix string) string {
+	return "strip" + normalizeName(prefix)
+}
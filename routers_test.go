@@ -0,0 +1,95 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouterFilter(t *testing.T) {
+	f, err := newRouterFilter([]string{"^edge-", "^shared$"}, []string{"-admin$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"edge-api":   true,
+		"shared":     true,
+		"edge-admin": false,
+		"other":      false,
+		"shared-api": false,
+	}
+	for name, expected := range tests {
+		if actual := f.allows(name); actual != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, actual)
+		}
+	}
+
+	var none *routerFilter
+	if !none.allows("anything") {
+		t.Error("expected no filter to allow every router")
+	}
+	if _, err := newRouterFilter([]string{"("}, nil); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}
+
+func TestMiddlewareRewriter(t *testing.T) {
+	r, err := newMiddlewareRewriter([]string{"auth", "debug-.*"}, map[string]string{
+		"(.*)-headers": "$1-headers@file",
+		"limit":        "ratelimit@file",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := r.apply([]string{"auth", "oauth", "debug-trace", "secure-headers", "limit", "ratelimit@file"})
+	expected := []string{"oauth", "secure-headers@file", "ratelimit@file"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	var none *middlewareRewriter
+	if m := none.apply([]string{"auth"}); !reflect.DeepEqual(m, []string{"auth"}) {
+		t.Errorf("expected no rewriter to keep the middlewares, got %v", m)
+	}
+	if _, err := newMiddlewareRewriter(nil, map[string]string{"(": ""}); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}
+
+func TestRouterPriority(t *testing.T) {
+	tests := []struct {
+		offset, priority int
+		rule             string
+		expected         int
+	}{
+		{offset: 0, priority: 0, rule: "Host(`a`)", expected: 0},
+		{offset: 1000, priority: 5, rule: "Host(`a`)", expected: 1005},
+		{offset: 1000, priority: 0, rule: "Host(`a`)", expected: 1009},
+		{offset: -100, priority: 5, rule: "Host(`a`)", expected: 1},
+	}
+	for _, test := range tests {
+		e := endpoint{offset: test.offset}
+		if actual := e.routerPriority(test.priority, test.rule); actual != test.expected {
+			t.Errorf("offset %d, priority %d: expected %d, got %d", test.offset, test.priority, test.expected, actual)
+		}
+	}
+}
+
+func TestPrefixRule(t *testing.T) {
+	e := endpoint{pathPrefix: "/node1"}
+	tests := map[string]string{
+		"":                            "PathPrefix(`/node1`)",
+		"Host(`a.example.com`)":       "PathPrefix(`/node1`) && (Host(`a.example.com`))",
+		"PathPrefix(`/`)":             "PathPrefix(`/node1`) && (PathPrefix(`/node1/`))",
+		"Path(`/a`) || !Path(\"/b\")": "PathPrefix(`/node1`) && (Path(`/node1/a`) || !Path(`/node1/b`))",
+		"PathRegexp(`^/v[0-9]+`)":     "PathPrefix(`/node1`) && (PathRegexp(`^/node1/v[0-9]+`))",
+		"Header(`X-Path`, `Path(/x)`) && Method(`GET`)": "PathPrefix(`/node1`) && (Header(`X-Path`, `Path(/x)`) && Method(`GET`))",
+	}
+	for rule, expected := range tests {
+		if actual := e.prefixRule(rule); actual != expected {
+			t.Errorf("%q: expected %q, got %q", rule, expected, actual)
+		}
+	}
+	if rule := (endpoint{}).prefixRule("Path(`/a`)"); rule != "Path(`/a`)" {
+		t.Errorf("expected the rule to be kept without a prefix, got %q", rule)
+	}
+}
@@ -0,0 +1,116 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3 the settings of s3://bucket/key endpoints. Credentials default to the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables, the region to AWS_REGION. Without credentials objects are
+// fetched anonymously.
+type S3 struct {
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	PathStyle       bool   `json:"pathStyle,omitempty"`
+}
+
+func isS3URL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "s3://")
+}
+
+// s3ObjectURL returns the HTTPS URL of an s3://bucket/key object. Objects of
+// S3-compatible services, set with Endpoint, are always addressed path-style.
+func s3ObjectURL(endpoint string, config *S3) string {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(endpoint, "s3://"), "/")
+	key = awsURIEncode(key, false)
+	if config.Endpoint != "" {
+		return strings.TrimSuffix(config.Endpoint, "/") + "/" + bucket + "/" + key
+	}
+	region := s3Region(config)
+	if config.PathStyle {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", region, bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, key)
+}
+
+func s3Region(config *S3) string {
+	return awsRegion(config.Region)
+}
+
+// awsRegion returns region, defaulting to AWS_REGION and us-east-1.
+func awsRegion(region string) string {
+	if region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// s3Source fetches an object on every poll, with a conditional request on the
+// ETag of the last fetched version.
+type s3Source struct {
+	signer *sigV4
+
+	mu   sync.Mutex
+	etag string
+	body []byte
+}
+
+func newS3Source(config *S3) *s3Source {
+	return &s3Source{
+		signer: newSigV4(s3Region(config), "s3", config.AccessKeyID, config.SecretAccessKey, config.SessionToken),
+	}
+}
+
+func (s *s3Source) fetch(ctx context.Context, e endpoint) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return nil, err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	if s.signer != nil {
+		if err := s.signer.sign(req, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		body, err := readLimited(resp.Body, e.maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		s.etag = resp.Header.Get("ETag")
+		s.body = body
+		return body, nil
+	case http.StatusNotModified:
+		return s.body, nil
+	default:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
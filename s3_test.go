@@ -0,0 +1,81 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestS3Source(t *testing.T) {
+	var conditional int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/traefik-config/nodes/edge.json" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+			t.Errorf("expected a signed request, got %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(routerConfig("bucket", "web")))
+	}))
+	defer srv.Close()
+
+	config := &S3{Endpoint: srv.URL, Region: "eu-west-1", AccessKeyID: "AK", SecretAccessKey: "SK"}
+	e := endpoint{
+		url:    s3ObjectURL("s3://traefik-config/nodes/edge.json", config),
+		client: srv.Client(),
+		source: newS3Source(config),
+	}
+
+	p := &Provider{}
+	for i := 0; i < 2; i++ {
+		body, _, err := p.fetchConfig(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != routerConfig("bucket", "web") {
+			t.Fatalf("unexpected body %s", body)
+		}
+	}
+	if conditional != 1 {
+		t.Errorf("expected 1 conditional request, got %d", conditional)
+	}
+}
+
+func TestS3SourceError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "access denied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	config := &S3{Endpoint: srv.URL}
+	e := endpoint{url: s3ObjectURL("s3://bucket/key", config), client: srv.Client(), source: newS3Source(config)}
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err == nil {
+		t.Error("expected an error on a forbidden object")
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+
+	tests := []struct {
+		config   S3
+		expected string
+	}{
+		{config: S3{}, expected: "https://bucket.s3.us-east-1.amazonaws.com/nodes/edge%20node.json"},
+		{config: S3{Region: "eu-west-1", PathStyle: true}, expected: "https://s3.eu-west-1.amazonaws.com/bucket/nodes/edge%20node.json"},
+		{config: S3{Endpoint: "http://minio:9000/"}, expected: "http://minio:9000/bucket/nodes/edge%20node.json"},
+	}
+	for _, test := range tests {
+		if actual := s3ObjectURL("s3://bucket/nodes/edge node.json", &test.config); actual != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// RewriteServers points the servers of the node at the node itself, replacing
+// their host with the endpoint host, or Host, and optionally their scheme and
+// port.
+type RewriteServers struct {
+	Host   string `json:"host,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+	Port   string `json:"port,omitempty"`
+}
+
+type serverRewriter struct {
+	host, scheme, port string
+}
+
+// newServerRewriter returns the rewriter of config, the host defaulting to
+// the one of the endpoint url.
+func newServerRewriter(config *RewriteServers, endpointURL string) (*serverRewriter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	r := &serverRewriter{host: config.Host, scheme: config.Scheme, port: config.Port}
+	if r.host == "" {
+		if u, err := url.Parse(endpointURL); err == nil {
+			r.host = u.Hostname()
+		}
+	}
+	if r.host == "" {
+		return nil, fmt.Errorf("a host is required, the endpoint has none")
+	}
+	if r.port != "" {
+		if n, err := strconv.Atoi(r.port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", r.port)
+		}
+	}
+	return r, nil
+}
+
+// rewrite rewrites the servers of the HTTP, TCP and UDP load balancers of
+// config.
+func (r *serverRewriter) rewrite(config *dynamic.Configuration) {
+	if r == nil {
+		return
+	}
+	if config.HTTP != nil {
+		for name, v := range config.HTTP.Services {
+			if v.LoadBalancer == nil {
+				continue
+			}
+			for i, s := range v.LoadBalancer.Servers {
+				u, err := url.Parse(s.URL)
+				if err != nil || u.Host == "" {
+					logger.Warn("Cannot rewrite a server with an invalid url", "server", s.URL, "service", name)
+					continue
+				}
+				if r.scheme != "" {
+					u.Scheme = r.scheme
+				}
+				u.Host = r.address(u.Port())
+				v.LoadBalancer.Servers[i].URL = u.String()
+			}
+		}
+	}
+	if config.TCP != nil {
+		for name, v := range config.TCP.Services {
+			if v.LoadBalancer == nil {
+				continue
+			}
+			for i, s := range v.LoadBalancer.Servers {
+				v.LoadBalancer.Servers[i].Address = r.rewriteAddress(name, s.Address)
+			}
+		}
+	}
+	if config.UDP != nil {
+		for name, v := range config.UDP.Services {
+			if v.LoadBalancer == nil {
+				continue
+			}
+			for i, s := range v.LoadBalancer.Servers {
+				v.LoadBalancer.Servers[i].Address = r.rewriteAddress(name, s.Address)
+			}
+		}
+	}
+}
+
+func (r *serverRewriter) rewriteAddress(service, address string) string {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		logger.Warn("Cannot rewrite a server", "server", address, "service", service, "error", err)
+		return address
+	}
+	return r.address(port)
+}
+
+// address joins the host with the configured port, or port.
+func (r *serverRewriter) address(port string) string {
+	if r.port != "" {
+		port = r.port
+	}
+	if port == "" {
+		if net.ParseIP(r.host) != nil && net.ParseIP(r.host).To4() == nil {
+			return "[" + r.host + "]"
+		}
+		return r.host
+	}
+	return net.JoinHostPort(r.host, port)
+}
@@ -0,0 +1,60 @@
+package multi_http_provider
+
+import (
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestServerRewriter(t *testing.T) {
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{Services: map[string]*dynamic.Service{
+			"api": {LoadBalancer: &dynamic.ServersLoadBalancer{Servers: []dynamic.Server{
+				{URL: "http://127.0.0.1:8080/base"}, {URL: "https://localhost"},
+			}}},
+		}},
+		TCP: &dynamic.TCPConfiguration{Services: map[string]*dynamic.TCPService{
+			"db": {LoadBalancer: &dynamic.TCPServersLoadBalancer{Servers: []dynamic.TCPServer{{Address: "127.0.0.1:5432"}}}},
+		}},
+		UDP: &dynamic.UDPConfiguration{Services: map[string]*dynamic.UDPService{
+			"dns": {LoadBalancer: &dynamic.UDPServersLoadBalancer{Servers: []dynamic.UDPServer{{Address: "127.0.0.1:53"}}}},
+		}},
+	}
+
+	r, err := newServerRewriter(&RewriteServers{}, "https://node1.internal:9000/api/rawdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.rewrite(config)
+	servers := config.HTTP.Services["api"].LoadBalancer.Servers
+	if servers[0].URL != "http://node1.internal:8080/base" || servers[1].URL != "https://node1.internal" {
+		t.Errorf("unexpected servers %+v", servers)
+	}
+	if a := config.TCP.Services["db"].LoadBalancer.Servers[0].Address; a != "node1.internal:5432" {
+		t.Errorf("unexpected tcp address %s", a)
+	}
+	if a := config.UDP.Services["dns"].LoadBalancer.Servers[0].Address; a != "node1.internal:53" {
+		t.Errorf("unexpected udp address %s", a)
+	}
+
+	r, err = newServerRewriter(&RewriteServers{Host: "fd00::1", Scheme: "h2c", Port: "9090"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.rewrite(config)
+	if u := config.HTTP.Services["api"].LoadBalancer.Servers[0].URL; u != "h2c://[fd00::1]:9090/base" {
+		t.Errorf("unexpected server %s", u)
+	}
+}
+
+func TestNewServerRewriterErrors(t *testing.T) {
+	if _, err := newServerRewriter(&RewriteServers{}, "file:///etc/traefik/config.json"); err == nil {
+		t.Error("expected an error without a host")
+	}
+	if _, err := newServerRewriter(&RewriteServers{Host: "node1", Port: "http"}, ""); err == nil {
+		t.Error("expected an invalid port error")
+	}
+	if r, err := newServerRewriter(nil, ""); r != nil || err != nil {
+		t.Errorf("expected no rewriter, got %v, %v", r, err)
+	}
+}
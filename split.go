@@ -0,0 +1,106 @@
+package multi_http_provider
+
+import (
+	"reflect"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// split turns the service key of s, defined differently by several nodes,
+// into a weighted service balancing between the services of the nodes, named
+// after the service and the node, by the weight of their endpoint.
+func (m *merger) split(s mergeSection, key, node string, service reflect.Value) {
+	owner := s.kind + "/" + key
+	if m.generated[owner] != conflictWeighted {
+		first := m.owners[owner]
+		existing := s.dst.MapIndex(reflect.ValueOf(key))
+		child := key + "-" + normalizeName(first)
+		s.dst.SetMapIndex(reflect.ValueOf(child), existing)
+		m.owners[s.kind+"/"+child] = first
+
+		weighted := reflect.New(existing.Type().Elem())
+		wrr := weighted.Elem().FieldByName("Weighted")
+		wrr.Set(reflect.New(wrr.Type().Elem()))
+		s.dst.SetMapIndex(reflect.ValueOf(key), weighted)
+		m.generated[owner] = conflictWeighted
+		m.addWeightedService(weighted, child, first)
+	}
+
+	child := key + "-" + normalizeName(node)
+	s.dst.SetMapIndex(reflect.ValueOf(child), service)
+	m.owners[s.kind+"/"+child] = node
+	m.addWeightedService(s.dst.MapIndex(reflect.ValueOf(key)), child, node)
+}
+
+// addWeightedService appends name with the weight of node to the services of
+// the weighted service.
+func (m *merger) addWeightedService(service reflect.Value, name, node string) {
+	services := service.Elem().FieldByName("Weighted").Elem().FieldByName("Services")
+	wrr := reflect.New(services.Type().Elem()).Elem()
+	wrr.FieldByName("Name").SetString(name)
+	weight := nodeWeight(m.weights, node)
+	wrr.FieldByName("Weight").Set(reflect.ValueOf(&weight))
+	services.Set(reflect.Append(services, wrr))
+}
+
+// nodeWeight returns the weight of node, 1 by default, sub-nodes having the
+// weight of their node.
+func nodeWeight(weights map[string]int, node string) int {
+	if weight, ok := nodeSetting(weights, node); ok {
+		return weight
+	}
+	return 1
+}
+
+// mirror turns the HTTP service key into a mirroring service, the service
+// already defined being the main one, under a name of its node, and the
+// service of the mirror node one of its mirrors.
+func (m *merger) mirror(key, node string, service *dynamic.Service) {
+	owner := "service/" + key
+	services := m.config.HTTP.Services
+	if m.generated[owner] != "mirroring" {
+		main := key + "-" + normalizeName(m.owners[owner])
+		if m.generated[owner] == conflictWeighted {
+			main = key + "-weighted"
+		}
+		services[main] = services[key]
+		m.owners["service/"+main] = m.owners[owner]
+		services[key] = &dynamic.Service{Mirroring: &dynamic.Mirroring{Service: main}}
+		m.generated[owner] = "mirroring"
+	}
+
+	name := key + "-" + normalizeName(node)
+	services[name] = service
+	m.owners["service/"+name] = node
+	percent, _ := nodeSetting(m.mirrors, node)
+	mirroring := services[key].Mirroring
+	mirroring.Mirrors = append(mirroring.Mirrors, dynamic.MirrorService{Name: name, Percent: percent})
+}
+
+// failover turns the HTTP service key into a failover service, from the
+// service already defined, under a name of its node, to the service of node.
+// The services of further nodes are the fallbacks of the last fallback.
+func (m *merger) failover(key, node string, service *dynamic.Service) {
+	owner := "service/" + key
+	services := m.config.HTTP.Services
+	name := key + "-" + normalizeName(node)
+	services[name] = service
+	m.owners["service/"+name] = node
+
+	if m.generated[owner] != conflictFailover {
+		main := key + "-" + normalizeName(m.owners[owner])
+		services[main] = services[key]
+		m.owners["service/"+main] = m.owners[owner]
+		services[key] = &dynamic.Service{Failover: &dynamic.Failover{Service: main, Fallback: name}}
+		m.generated[owner] = conflictFailover
+		m.fallbacks[key] = key
+		return
+	}
+
+	last := services[m.fallbacks[key]].Failover
+	nested := key + "-failover-" + normalizeName(node)
+	services[nested] = &dynamic.Service{Failover: &dynamic.Failover{Service: last.Fallback, Fallback: name}}
+	m.owners["service/"+nested] = node
+	last.Fallback = nested
+	m.fallbacks[key] = nested
+}
@@ -0,0 +1,151 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestMergeWeighted(t *testing.T) {
+	configs := conflictingConfigs()
+	configs["canary"] = httpConfig(nil, map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.0.5")})
+	options := mergeOptions{
+		policy:   conflictFirstWins,
+		policies: map[string]string{"services": conflictWeighted},
+		weights:  map[string]int{"node1": 90, "canary": 10},
+	}
+
+	config, conflicts, err := mergeConfig(configs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := config.HTTP.Services["api"]
+	if api == nil || api.Weighted == nil {
+		t.Fatalf("expected a weighted service, got %+v", api)
+	}
+	var names []string
+	weights := map[string]int{}
+	for _, s := range api.Weighted.Services {
+		names = append(names, s.Name)
+		weights[s.Name] = *s.Weight
+	}
+	// canary is merged first, in the order of the node names
+	if !reflect.DeepEqual(names, []string{"api-canary", "api-node1", "api-node2"}) {
+		t.Fatalf("unexpected weighted services %v", names)
+	}
+	if weights["api-canary"] != 10 || weights["api-node1"] != 90 || weights["api-node2"] != 1 {
+		t.Errorf("unexpected weights %v", weights)
+	}
+	for name, url := range map[string]string{"api-canary": "http://10.0.0.5", "api-node1": "http://10.0.0.1", "api-node2": "http://10.0.0.2"} {
+		if s := config.HTTP.Services[name]; s == nil || s.LoadBalancer.Servers[0].URL != url {
+			t.Errorf("expected service %s with %s, got %+v", name, url, s)
+		}
+	}
+	// the identical shared service is not split, only the routers conflict
+	if s := config.HTTP.Services["shared"]; s == nil || s.LoadBalancer == nil {
+		t.Errorf("expected service shared to be kept, got %+v", s)
+	}
+	if len(conflicts) != 1 {
+		t.Errorf("expected the router conflict only, got %v", conflicts)
+	}
+	if configs["node1"].HTTP.Services["api"].Weighted != nil {
+		t.Error("expected the node configuration to be unchanged")
+	}
+}
+
+func TestMergeWeightedTCP(t *testing.T) {
+	tcp := func(address string) *dynamic.Configuration {
+		return &dynamic.Configuration{TCP: &dynamic.TCPConfiguration{
+			Services: map[string]*dynamic.TCPService{"db": {LoadBalancer: &dynamic.TCPServersLoadBalancer{Servers: []dynamic.TCPServer{{Address: address}}}}},
+		}}
+	}
+	configs := map[string]*dynamic.Configuration{"old": tcp("10.0.0.1:5432"), "new": tcp("10.0.0.2:5432")}
+
+	config, _, err := mergeConfig(configs, mergeOptions{policy: conflictFirstWins, policies: map[string]string{"tcpServices": conflictWeighted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := config.TCP.Services["db"]
+	if db == nil || db.Weighted == nil || len(db.Weighted.Services) != 2 || db.Weighted.Services[0].Name != "db-new" {
+		t.Fatalf("expected a weighted tcp service, got %+v", db)
+	}
+}
+
+func TestMergeMirroring(t *testing.T) {
+	configs := conflictingConfigs()
+	// merged last whatever its name
+	configs["a-staging"] = httpConfig(
+		map[string]*dynamic.Router{"api": {Rule: "Host(`a`)", Service: "api"}},
+		map[string]*dynamic.Service{"api": serviceWithURL("http://10.0.1.1"), "debug": serviceWithURL("http://10.0.1.2")},
+	)
+	options := mergeOptions{policy: conflictSkipNode, mirrors: map[string]int{"a-staging": 20}}
+
+	config, _, err := mergeConfig(configs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := config.HTTP.Services["api"]
+	if api == nil || api.Mirroring == nil {
+		t.Fatalf("expected a mirroring service, got %+v", api)
+	}
+	expected := []dynamic.MirrorService{{Name: "api-a-staging", Percent: 20}}
+	if api.Mirroring.Service != "api-node1" || !reflect.DeepEqual(api.Mirroring.Mirrors, expected) {
+		t.Errorf("unexpected mirroring %+v", api.Mirroring)
+	}
+	if s := config.HTTP.Services["api-node1"]; s == nil || s.LoadBalancer.Servers[0].URL != "http://10.0.0.1" {
+		t.Errorf("expected the main service of node1, got %+v", s)
+	}
+	if s := config.HTTP.Services["api-a-staging"]; s == nil || s.LoadBalancer.Servers[0].URL != "http://10.0.1.1" {
+		t.Errorf("expected the mirror service, got %+v", s)
+	}
+	if _, ok := config.HTTP.Services["debug"]; !ok {
+		t.Error("expected the other services of the mirror node to be merged")
+	}
+
+	options.policy, options.policies = conflictFirstWins, map[string]string{"services": conflictWeighted}
+	config, _, err = mergeConfig(configs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := config.HTTP.Services["api"].Mirroring; m == nil || m.Service != "api-weighted" || config.HTTP.Services["api-weighted"].Weighted == nil {
+		t.Errorf("expected the weighted service to be mirrored, got %+v", config.HTTP.Services["api"])
+	}
+}
+
+func TestMergeFailover(t *testing.T) {
+	configs := conflictingConfigs()
+	configs["node3"].HTTP.Services["api"] = serviceWithURL("http://10.0.0.3")
+	options := mergeOptions{policy: conflictFirstWins, policies: map[string]string{"services": conflictFailover}, order: []string{"node2"}}
+
+	config, _, err := mergeConfig(configs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := config.HTTP.Services
+	api := services["api"]
+	if api == nil || api.Failover == nil {
+		t.Fatalf("expected a failover service, got %+v", api)
+	}
+	// node2 is merged first, node3 is the fallback of node1
+	if api.Failover.Service != "api-node2" || api.Failover.Fallback != "api-failover-node3" {
+		t.Errorf("unexpected failover %+v", api.Failover)
+	}
+	if f := services["api-failover-node3"].Failover; f == nil || f.Service != "api-node1" || f.Fallback != "api-node3" {
+		t.Errorf("unexpected nested failover %+v", f)
+	}
+	for name, url := range map[string]string{"api-node1": "http://10.0.0.1", "api-node2": "http://10.0.0.2", "api-node3": "http://10.0.0.3"} {
+		if s := services[name]; s == nil || s.LoadBalancer.Servers[0].URL != url {
+			t.Errorf("expected service %s with %s, got %+v", name, url, s)
+		}
+	}
+}
+
+func TestNodeWeight(t *testing.T) {
+	weights := map[string]int{"edge": 0, "edge/1": 5}
+	for node, expected := range map[string]int{"edge/0": 0, "edge/1": 5, "other": 1} {
+		if actual := nodeWeight(weights, node); actual != expected {
+			t.Errorf("%s: expected %d, got %d", node, expected, actual)
+		}
+	}
+}
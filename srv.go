@@ -0,0 +1,40 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var lookupSRV = func(ctx context.Context, name string) ([]*net.SRV, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	return records, err
+}
+
+// srvDiscovery discovers one endpoint per target of a DNS SRV record.
+type srvDiscovery struct {
+	name     string
+	template Endpoint
+	lookup   func(ctx context.Context, name string) ([]*net.SRV, error)
+}
+
+func (d *srvDiscovery) discover(ctx context.Context) (map[string]Endpoint, error) {
+	records, err := d.lookup(ctx, d.name)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[string]Endpoint{}
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		if host == "" {
+			continue
+		}
+		e := d.template
+		e.Endpoint = host
+		e.Port = int(record.Port)
+		endpoints[net.JoinHostPort(host, strconv.Itoa(int(record.Port)))] = e
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,150 @@
+package multi_http_provider
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSRVDiscover(t *testing.T) {
+	d := &srvDiscovery{
+		name:     "_config._tcp.internal",
+		template: Endpoint{Scheme: "https", Path: "/config"},
+		lookup: func(_ context.Context, name string) ([]*net.SRV, error) {
+			if name != "_config._tcp.internal" {
+				t.Errorf("unexpected name %s", name)
+			}
+			return []*net.SRV{
+				{Target: "node1.internal.", Port: 8443},
+				{Target: "node2.internal.", Port: 9443},
+				{Target: ".", Port: 0},
+			}, nil
+		},
+	}
+
+	endpoints, err := d.discover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %v", endpoints)
+	}
+	e := endpoints["node1.internal:8443"]
+	if endpointURL(e) != "https://node1.internal:8443/config" {
+		t.Errorf("unexpected endpoint url %s", endpointURL(e))
+	}
+}
+
+func TestSRVDiscoveryAddsAndRemovesNodes(t *testing.T) {
+	stable := sseServer(t, "data: "+routerConfig("stable", "web")+"\n\n")
+	discoveredSrv := sseServer(t, "data: "+routerConfig("discovered", "web")+"\n\n")
+	u, _ := url.Parse(discoveredSrv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	var mu sync.Mutex
+	records := []*net.SRV{{Target: u.Hostname(), Port: uint16(port)}}
+	lookup := lookupSRV
+	lookupSRV = func(context.Context, string) ([]*net.SRV, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return records, nil
+	}
+	t.Cleanup(func() { lookupSRV = lookup })
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"stable": {Endpoint: stable.URL, Mode: "sse"}}
+	config.Discovery = map[string]Discovery{
+		"nodes": {SRV: "_config._tcp.internal", Interval: "50ms", Template: Endpoint{Mode: "sse", Path: "/"}},
+	}
+	cfgChan := startProviderConfig(t, config)
+
+	// updates interleave, wait for the discovered router then for its removal
+	for {
+		config := receiveConfig(t, cfgChan)
+		if _, ok := config.HTTP.Routers["discovered"]; ok {
+			break
+		}
+	}
+	mu.Lock()
+	records = nil
+	mu.Unlock()
+	for {
+		config := receiveConfig(t, cfgChan)
+		_, hasStable := config.HTTP.Routers["stable"]
+		_, hasDiscovered := config.HTTP.Routers["discovered"]
+		if hasStable && !hasDiscovered {
+			return
+		}
+	}
+}
+
+func TestDiscoveryValidation(t *testing.T) {
+	tests := []struct {
+		desc      string
+		discovery Discovery
+	}{
+		{desc: "no source", discovery: Discovery{}},
+		{desc: "invalid interval", discovery: Discovery{SRV: "_config._tcp.internal", Interval: "soon"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config := CreateConfig()
+			config.EntryPoints = []string{"web"}
+			config.Discovery = map[string]Discovery{"nodes": test.discovery}
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"nodes": {Endpoint: "10.0.1.2"}}
+	config.Discovery = map[string]Discovery{"nodes": {SRV: "_config._tcp.internal"}}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected a conflict between the discovery and the endpoint")
+	}
+}
+
+// staticDiscoverer discovers the same instances on every refresh.
+type staticDiscoverer map[string]Endpoint
+
+func (d staticDiscoverer) discover(context.Context) (map[string]Endpoint, error) {
+	return d, nil
+}
+
+func TestRunDiscoveryIgnoresSkippedInstances(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = map[string]Endpoint{"nodes/configured": {Endpoint: "http://10.0.0.3"}}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &discovery{interval: 10 * time.Millisecond, prefix: "nodes/", discoverer: staticDiscoverer{
+		"valid":      {Endpoint: "http://10.0.0.1"},
+		"invalid":    {Endpoint: "http://10.0.0.2", Mode: "carrier-pigeon"},
+		"configured": {Endpoint: "http://10.0.0.3"},
+	}}
+	found := make(chan discovered, 10)
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	p.runDiscovery(ctx, "nodes", d, found)
+
+	if len(found) != 1 {
+		t.Fatalf("expected the endpoints to be reported once, got %d reports", len(found))
+	}
+	if endpoints := (<-found).endpoints; len(endpoints) != 1 || endpoints["nodes/valid"].url == "" {
+		t.Errorf("expected the valid endpoint only, got %v", endpoints)
+	}
+}
@@ -0,0 +1,107 @@
+package multi_http_provider
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseStream subscribes to the Server-Sent Events stream of an endpoint. The
+// stream is reopened after the retry delay requested by the server, or the
+// poll interval, when it drops.
+//
+// The node configuration is kept while resuming a dropped stream, the server
+// only sending events newer than Last-Event-ID. When the endpoint cannot be
+// reached the next stream starts from scratch so the server replays its
+// current configuration.
+type sseStream struct {
+	lastEventID string
+	retry       time.Duration
+}
+
+func (s *sseStream) reconnect(connected bool) time.Duration {
+	if !connected {
+		s.lastEventID = ""
+	}
+	return s.retry
+}
+
+// watch reads events until the connection ends. Only "message" events, the
+// default event type, carry configurations.
+func (s *sseStream) watch(ctx context.Context, e endpoint, handle emitFunc) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// the size of an event, and of its lines, is bounded by maxResponseBytes
+	limiter := newStreamLimiter(resp.Body, e.maxBytes)
+	reader := bufio.NewReader(limiter)
+	var event string
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return true, fmt.Errorf("stream ended")
+			}
+			return true, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if data.Len() > 0 && (event == "" || event == "message") {
+				handle("", "", []byte(strings.TrimSuffix(data.String(), "\n")))
+			}
+			event = ""
+			data.Reset()
+			limiter.reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data.Len()+len(value) >= limiter.limit {
+				return true, fmt.Errorf("event exceeds %d bytes, see maxResponseBytes", limiter.limit)
+			}
+			data.WriteString(value)
+			data.WriteString("\n")
+		case "id":
+			s.lastEventID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
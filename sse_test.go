@@ -0,0 +1,200 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func routerConfig(router, entrypoint string) string {
+	return fmt.Sprintf(`{"http":{"routers":{%q:{"entryPoints":[%q],"service":"svc-%s","rule":"PathPrefix(`+"`/%s`"+`)"}},"services":{"svc-%s":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}}}`,
+		router, entrypoint, router, router, router)
+}
+
+func startProvider(t *testing.T, endpoints map[string]Endpoint) chan json.Marshaler {
+	t.Helper()
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.EntryPoints = []string{"web"}
+	config.Endpoints = endpoints
+	return startProviderConfig(t, config)
+}
+
+func startProviderConfig(t *testing.T, config *Config) chan json.Marshaler {
+	t.Helper()
+
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgChan := make(chan json.Marshaler)
+	if err := p.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Stop() })
+	return cfgChan
+}
+
+func receiveConfig(t *testing.T, cfgChan chan json.Marshaler) *dynamic.Configuration {
+	t.Helper()
+
+	select {
+	case m := <-cfgChan:
+		body, err := m.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config dynamic.Configuration
+		if err := json.Unmarshal(body, &config); err != nil {
+			t.Fatal(err)
+		}
+		return &config
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a configuration")
+		return nil
+	}
+}
+
+func routerNames(config *dynamic.Configuration) []string {
+	var names []string
+	for name := range config.HTTP.Routers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// sseServer serves the given events once per connection, then holds the
+// stream open until the request is canceled.
+func sseServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprint(w, event)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSSEPublishesEvents(t *testing.T) {
+	srv := sseServer(t,
+		"id: 1\ndata: "+routerConfig("first", "web")+"\n\n",
+		": keepalive\n\n",
+		"event: status\ndata: ignored\n\n",
+		"id: 2\ndata: "+routerConfig("second", "web")+"\n\n",
+	)
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "sse"},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["first"]; !ok || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected router first, got %v", routerNames(config))
+	}
+
+	config = receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["second"]; !ok || len(config.HTTP.Routers) != 1 {
+		t.Fatalf("expected router second, got %v", routerNames(config))
+	}
+}
+
+func TestSSEMultilineData(t *testing.T) {
+	body := routerConfig("multi", "web")
+	split := strings.Index(body, `"services"`)
+	srv := sseServer(t, "data: "+body[:split]+"\ndata: "+body[split:]+"\n\n")
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "sse"},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Services["svc-multi"]; !ok {
+		t.Fatalf("expected service svc-multi, got %v", config.HTTP.Services)
+	}
+}
+
+func TestSSEInvalidEventRemovesNode(t *testing.T) {
+	stable := sseServer(t, "data: "+routerConfig("stable", "web")+"\n\n")
+	flaky := sseServer(t,
+		"data: "+routerConfig("flaky", "web")+"\n\n",
+		`data: {"http":{"routers":{"null":null},"middlewares":{"null":null}}}`+"\n\n",
+	)
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"stable": {Endpoint: stable.URL, Mode: "sse"},
+		"flaky":  {Endpoint: flaky.URL, Mode: "sse"},
+	})
+
+	// updates from both nodes interleave, wait for the flaky node removal.
+	for {
+		config := receiveConfig(t, cfgChan)
+		_, hasStable := config.HTTP.Routers["stable"]
+		_, hasFlaky := config.HTTP.Routers["flaky"]
+		if hasStable && !hasFlaky {
+			return
+		}
+	}
+}
+
+func TestSSEResumesWithLastEventID(t *testing.T) {
+	resumed := make(chan string, 1)
+	var connections int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if atomic.AddInt32(&connections, 1) == 1 {
+			fmt.Fprint(w, "retry: 10\nid: 42\ndata: "+routerConfig("first", "web")+"\n\n")
+			return
+		}
+		resumed <- r.Header.Get("Last-Event-ID")
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "sse"},
+	})
+	receiveConfig(t, cfgChan)
+
+	select {
+	case id := <-resumed:
+		if id != "42" {
+			t.Fatalf("expected Last-Event-ID 42, got %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream to resume")
+	}
+
+	select {
+	case <-cfgChan:
+		t.Fatal("node must be kept while the stream resumes")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSSEMaxResponseBytes(t *testing.T) {
+	srv := sseServer(t, "data: "+routerConfig("small", "web")+"\n\n", "data: "+strings.Repeat("a", 1024)+"\n\n")
+	var handled int
+	e := endpoint{url: srv.URL, client: srv.Client(), maxBytes: 512}
+	_, err := (&sseStream{}).watch(context.Background(), e, func(string, string, []byte) { handled++ })
+	if err == nil || !strings.Contains(err.Error(), "exceeds 512 bytes") {
+		t.Errorf("expected the event to exceed the limit, got %v", err)
+	}
+	if handled != 1 {
+		t.Errorf("expected the first event only, got %d", handled)
+	}
+}
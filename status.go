@@ -0,0 +1,266 @@
+package multi_http_provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// Status the embedded listener exposing the state of the provider as JSON on
+// Path (default /status): the last fetch of each endpoint, the hash of their
+// configurations and the merged configuration.
+type Status struct {
+	Address string `json:"address,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Token   string `json:"token,omitempty"`
+	// Router publishes a route to the status through Traefik.
+	Router *StatusRouter `json:"router,omitempty"`
+}
+
+// StatusRouter the router published with the merged configuration forwarding
+// the requests matching Rule on EntryPoint to the status listener, through
+// Middlewares such as an IP allow list.
+type StatusRouter struct {
+	EntryPoint  string   `json:"entryPoint,omitempty"`
+	Rule        string   `json:"rule,omitempty"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// statusName names the router, service and middleware of the status route.
+const statusName = "multi-http-provider-status"
+
+// defaultStatusRule the rule of the status route without one.
+const defaultStatusRule = "Path(`/multi-http-provider/status`)"
+
+type statusRegistry struct {
+	address string
+	path    string
+	token   string
+	router  *StatusRouter
+
+	mu          sync.Mutex
+	endpoints   map[string]*endpointStatus
+	configs     map[string]string
+	published   *dynamic.Configuration
+	publishedAt time.Time
+}
+
+// endpointStatus the state of a node.
+type endpointStatus struct {
+	Endpoint    string     `json:"endpoint"`
+	Mode        string     `json:"mode"`
+	LastStatus  int        `json:"lastStatus,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFetch   *time.Time `json:"lastFetch,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+func newStatusRegistry(config *Status) *statusRegistry {
+	if config == nil {
+		return nil
+	}
+	path := config.Path
+	if path == "" {
+		path = "/status"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return &statusRegistry{
+		address:   config.Address,
+		path:      path,
+		token:     config.Token,
+		router:    config.Router,
+		endpoints: map[string]*endpointStatus{},
+		configs:   map[string]string{},
+	}
+}
+
+// started records a started node.
+func (s *statusRegistry) started(node string, e endpoint) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints[node] = &endpointStatus{Endpoint: e.String(), Mode: e.mode}
+}
+
+// fetched records a fetch of node answered with status, failed with err if
+// not nil.
+func (s *statusRegistry) fetched(node string, status int, err error, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.endpoints[node]
+	if st == nil {
+		return
+	}
+	st.LastStatus, st.LastError, st.LastFetch = status, "", &now
+	if err != nil {
+		st.LastError = err.Error()
+		return
+	}
+	st.LastSuccess = &now
+}
+
+// forget drops the state of a stopped node.
+func (s *statusRegistry) forget(node string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.endpoints, node)
+}
+
+// merged records the hashes of the configurations merged.
+func (s *statusRegistry) merged(configs map[string]*dynamic.Configuration) {
+	if s == nil {
+		return
+	}
+	hashes := make(map[string]string, len(configs))
+	for name, config := range configs {
+		b, err := json.Marshal(config)
+		if err != nil {
+			continue
+		}
+		hashes[name] = fmt.Sprintf("%x", sha256.Sum256(b))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configs = hashes
+}
+
+// publish records the published configuration.
+func (s *statusRegistry) publish(config *dynamic.Configuration, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published, s.publishedAt = config, now
+}
+
+// route adds the status route to config.
+func (s *statusRegistry) route(config *dynamic.Configuration) {
+	if s == nil || s.router == nil {
+		return
+	}
+	if config.HTTP == nil {
+		config.HTTP = &dynamic.HTTPConfiguration{}
+	}
+	if config.HTTP.Routers == nil {
+		config.HTTP.Routers = map[string]*dynamic.Router{}
+	}
+	if config.HTTP.Services == nil {
+		config.HTTP.Services = map[string]*dynamic.Service{}
+	}
+	if config.HTTP.Middlewares == nil {
+		config.HTTP.Middlewares = map[string]*dynamic.Middleware{}
+	}
+	rule := s.router.Rule
+	if rule == "" {
+		rule = defaultStatusRule
+	}
+	config.HTTP.Routers[statusName] = &dynamic.Router{
+		EntryPoints: []string{s.router.EntryPoint},
+		Middlewares: append(append([]string{}, s.router.Middlewares...), statusName),
+		Service:     statusName,
+		Rule:        rule,
+	}
+	config.HTTP.Middlewares[statusName] = &dynamic.Middleware{
+		ReplacePath: &dynamic.ReplacePath{Path: s.path},
+	}
+	config.HTTP.Services[statusName] = &dynamic.Service{
+		LoadBalancer: &dynamic.ServersLoadBalancer{
+			Servers: []dynamic.Server{{URL: "http://" + localAddress(s.address)}},
+		},
+	}
+}
+
+// localAddress returns the address reaching a listener on address from the
+// same host.
+func localAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// ServeHTTP serves the status on its path.
+func (s *statusRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.URL.Path != s.path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	state := struct {
+		Endpoints     map[string]*endpointStatus `json:"endpoints"`
+		Configs       map[string]string          `json:"configs"`
+		PublishedAt   *time.Time                 `json:"publishedAt,omitempty"`
+		Configuration *dynamic.Configuration     `json:"configuration,omitempty"`
+	}{Endpoints: s.endpoints, Configs: s.configs, Configuration: s.published}
+	if !s.publishedAt.IsZero() {
+		state.PublishedAt = &s.publishedAt
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// serveStatus starts the status listener, stopped when the context is
+// canceled.
+func (p *Provider) serveStatus(ctx context.Context) error {
+	listener, err := net.Listen("tcp", p.status.address)
+	if err != nil {
+		return fmt.Errorf("starting status listener: %w", err)
+	}
+	server := &http.Server{Handler: p.status, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("Status listener stopped", "error", err)
+		}
+	}()
+	return nil
+}
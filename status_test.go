@@ -0,0 +1,134 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestStatusRegistry(t *testing.T) {
+	s := newStatusRegistry(&Status{Address: ":9101", Token: "secret"})
+	now := time.Unix(1700000000, 0).UTC()
+	s.started("edge", endpoint{url: "http://10.0.1.2/config", mode: modePoll})
+	s.fetched("edge", http.StatusOK, nil, now)
+	s.fetched("edge", http.StatusServiceUnavailable, errors.New("unexpected status 503"), now.Add(time.Minute))
+	s.started("gone", endpoint{url: "http://10.0.1.3/config", mode: modePoll})
+	s.forget("gone")
+	config := &dynamic.Configuration{HTTP: &dynamic.HTTPConfiguration{Routers: map[string]*dynamic.Router{"a": {Service: "s"}}}}
+	s.merged(map[string]*dynamic.Configuration{"edge": config})
+	s.publish(config, now)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var state struct {
+		Endpoints     map[string]endpointStatus `json:"endpoints"`
+		Configs       map[string]string         `json:"configs"`
+		PublishedAt   time.Time                 `json:"publishedAt"`
+		Configuration dynamic.Configuration     `json:"configuration"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	edge, ok := state.Endpoints["edge"]
+	if !ok || len(state.Endpoints) != 1 {
+		t.Fatalf("expected the edge node only, got %+v", state.Endpoints)
+	}
+	if edge.Endpoint != "http://10.0.1.2/config" || edge.Mode != modePoll || edge.LastStatus != http.StatusServiceUnavailable || edge.LastError != "unexpected status 503" {
+		t.Errorf("unexpected status %+v", edge)
+	}
+	if edge.LastFetch == nil || !edge.LastFetch.Equal(now.Add(time.Minute)) || edge.LastSuccess == nil || !edge.LastSuccess.Equal(now) {
+		t.Errorf("unexpected fetch times %v, %v", edge.LastFetch, edge.LastSuccess)
+	}
+	if len(state.Configs["edge"]) != 64 {
+		t.Errorf("expected the hash of the edge configuration, got %v", state.Configs)
+	}
+	if !state.PublishedAt.Equal(now) || state.Configuration.HTTP == nil || state.Configuration.HTTP.Routers["a"] == nil {
+		t.Errorf("unexpected published configuration %+v at %v", state.Configuration, state.PublishedAt)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestInitStatus(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["node"] = Endpoint{Endpoint: "10.0.1.2"}
+	config.Status = &Status{}
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected the status address to be required")
+	}
+
+	config.Status = &Status{Address: ":9101", Router: &StatusRouter{}}
+	if p, err = New(context.Background(), config, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected the status router entrypoint to be required")
+	}
+}
+
+func TestStatusRoute(t *testing.T) {
+	s := newStatusRegistry(&Status{Address: ":9101", Router: &StatusRouter{EntryPoint: "admin", Middlewares: []string{"operators@file"}}})
+	config := &dynamic.Configuration{}
+	s.route(config)
+	router := config.HTTP.Routers[statusName]
+	if router == nil || router.Rule != defaultStatusRule || router.Service != statusName || len(router.EntryPoints) != 1 || router.EntryPoints[0] != "admin" {
+		t.Fatalf("unexpected status router %+v", router)
+	}
+	if len(router.Middlewares) != 2 || router.Middlewares[0] != "operators@file" || router.Middlewares[1] != statusName {
+		t.Errorf("unexpected middlewares %v", router.Middlewares)
+	}
+	if m := config.HTTP.Middlewares[statusName]; m == nil || m.ReplacePath == nil || m.ReplacePath.Path != "/status" {
+		t.Errorf("unexpected status middleware %+v", m)
+	}
+	if svc := config.HTTP.Services[statusName]; svc == nil || svc.LoadBalancer == nil || svc.LoadBalancer.Servers[0].URL != "http://127.0.0.1:9101" {
+		t.Errorf("unexpected status service %+v", svc)
+	}
+
+	config = &dynamic.Configuration{}
+	newStatusRegistry(&Status{Address: ":9101"}).route(config)
+	if config.HTTP != nil {
+		t.Error("expected no status route without a router")
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	for address, expected := range map[string]string{
+		":9101":          "127.0.0.1:9101",
+		"0.0.0.0:9101":   "127.0.0.1:9101",
+		"[::]:9101":      "127.0.0.1:9101",
+		"10.0.0.1:9101":  "10.0.0.1:9101",
+		"localhost:9101": "localhost:9101",
+	} {
+		if got := localAddress(address); got != expected {
+			t.Errorf("%s: expected %s, got %s", address, expected, got)
+		}
+	}
+}
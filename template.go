@@ -0,0 +1,81 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateData the data of the transformation template: the node name, the
+// endpoint and the decoded configuration of the node.
+type templateData struct {
+	Node     string
+	Endpoint templateEndpoint
+	Config   interface{}
+}
+
+type templateEndpoint struct {
+	URL         string
+	Mode        string
+	Format      string
+	Priority    int
+	EntryPoints []string
+}
+
+var templateFuncs = template.FuncMap{
+	"toJSON": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"replace":    strings.ReplaceAll,
+	"hasPrefix":  strings.HasPrefix,
+	"hasSuffix":  strings.HasSuffix,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+}
+
+// newTransformTemplate loads the text/template file transforming the
+// configurations of the nodes, if any.
+func newTransformTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+	t, err := template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	return t, nil
+}
+
+// transform renders the template with the JSON configuration of node, the
+// output replacing it. It reports false when the template fails.
+func (p *Provider) transform(node string, e endpoint, body []byte) ([]byte, bool) {
+	if p.template == nil {
+		return body, true
+	}
+	data := templateData{
+		Node: node,
+		Endpoint: templateEndpoint{
+			URL:         e.String(),
+			Mode:        e.mode,
+			Format:      e.format,
+			Priority:    e.priority,
+			EntryPoints: e.entrypoints,
+		},
+	}
+	if err := json.Unmarshal(body, &data.Config); err != nil {
+		logger.Error("Error decoding the body for the template", "endpoint", e, "error", err)
+		return nil, false
+	}
+	var out bytes.Buffer
+	if err := p.template.Execute(&out, data); err != nil {
+		logger.Error("Error applying the template", "node", node, "error", err)
+		return nil, false
+	}
+	return out.Bytes(), true
+}
@@ -0,0 +1,54 @@
+package multi_http_provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUpdateTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.tmpl")
+	// renames the routers after the node and keeps the services as they are
+	tmpl := `{"http":{"routers":{
+{{- range $name, $r := .Config.http.routers }}"{{ $.Node }}-{{ $name }}":{{ toJSON $r }},{{ end -}}
+"{{ .Node }}-marker":{"entryPoints":{{ toJSON .Endpoint.EntryPoints }},"service":"svc-api","rule":"Host(` + "`{{ lower .Node }}.example.com`" + `)"}},
+"services":{{ toJSON .Config.http.services }}}}`
+	if err := os.WriteFile(path, []byte(tmpl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	template, err := newTransformTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}, template: template}
+	u := p.parseUpdate("Edge", endpoint{entrypoints: []string{"web"}}, "", []byte(routerConfig("api", "web")))
+	if u.config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if r := u.config.HTTP.Routers["Edge-api"]; r == nil || r.Service != "svc-api" {
+		t.Errorf("expected the renamed router, got %v", routerNames(u.config))
+	}
+	if r := u.config.HTTP.Routers["Edge-marker"]; r == nil || r.Rule != "Host(`edge.example.com`)" {
+		t.Errorf("expected the router added by the template, got %+v", r)
+	}
+}
+
+func TestParseUpdateTemplateError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.tmpl")
+	if err := os.WriteFile(path, []byte(`{{ .Missing.Field }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	template, err := newTransformTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{entrypoints: map[string]bool{"web": true}, template: template}
+	if u := p.parseUpdate("node", endpoint{}, "", []byte(routerConfig("api", "web"))); !u.empty() {
+		t.Errorf("expected an empty update, got %+v", u)
+	}
+
+	if _, err := newTransformTemplate(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
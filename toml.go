@@ -0,0 +1,452 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlToJSON converts a TOML document to JSON, so it decodes into the json
+// tagged configuration types. Dates and times are kept as strings.
+func tomlToJSON(data []byte) ([]byte, error) {
+	value, err := decodeTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// maxTOMLDepth bounds the nesting of the arrays and inline tables.
+const maxTOMLDepth = 64
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+	// the arrays and inline tables being parsed
+	depth int
+}
+
+func decodeTOML(s string) (map[string]interface{}, error) {
+	p := &tomlParser{s: strings.ReplaceAll(s, "\r\n", "\n"), line: 1}
+	root := map[string]interface{}{}
+	current := root
+	defined := map[string]bool{}
+
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.s) {
+			return root, nil
+		}
+
+		if p.s[p.pos] == '[' {
+			array := strings.HasPrefix(p.s[p.pos:], "[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+			keys, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			p.skipBlank(false)
+			if !strings.HasPrefix(p.s[p.pos:], closing) {
+				return nil, p.errorf("expected %s", closing)
+			}
+			p.pos += len(closing)
+
+			parent, err := p.table(root, keys[:len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+			last := keys[len(keys)-1]
+			if array {
+				tables, ok := parent[last].([]interface{})
+				if _, exists := parent[last]; exists && !ok {
+					return nil, p.errorf("key %s is not an array of tables", last)
+				}
+				current = map[string]interface{}{}
+				parent[last] = append(tables, current)
+			} else {
+				name := strings.Join(keys, "\x00")
+				if defined[name] {
+					return nil, p.errorf("table %s defined twice", strings.Join(keys, "."))
+				}
+				defined[name] = true
+				current, err = p.table(parent, []string{last})
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			if err := p.parseKeyValue(current); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// table returns the table at keys below t, creating missing ones. Arrays of
+// tables resolve to their last element.
+func (p *tomlParser) table(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := t[key].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			t[key] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			var last map[string]interface{}
+			if len(v) > 0 {
+				last, _ = v[len(v)-1].(map[string]interface{})
+			}
+			if last == nil {
+				return nil, p.errorf("key %s is not a table", key)
+			}
+			t = last
+		default:
+			return nil, p.errorf("key %s is not a table", key)
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) parseKeyValue(t map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+		return p.errorf("expected =")
+	}
+	p.pos++
+	p.skipBlank(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.table(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return p.errorf("duplicate key %s", last)
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseKey parses a possibly dotted and quoted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("expected a key")
+		}
+		switch c := p.s[p.pos]; {
+		case c == '"' || c == '\'':
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && isBareKeyChar(p.s[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key character %q", c)
+			}
+			keys = append(keys, p.s[start:p.pos])
+		}
+		p.skipBlank(false)
+		if p.pos < len(p.s) && p.s[p.pos] == '.' {
+			p.pos++
+			continue
+		}
+		return keys, nil
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.s[p.pos]; c {
+	case '"', '\'':
+		return p.parseString()
+	case '[', '{':
+		if p.depth >= maxTOMLDepth {
+			return nil, p.errorf("nested deeper than %d arrays and inline tables", maxTOMLDepth)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+	switch p.s[p.pos] {
+	case '[':
+		p.pos++
+		items := []interface{}{}
+		for {
+			p.skipBlank(true)
+			if p.pos >= len(p.s) {
+				return nil, p.errorf("unterminated array")
+			}
+			if p.s[p.pos] == ']' {
+				p.pos++
+				return items, nil
+			}
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			p.skipBlank(true)
+			if p.pos < len(p.s) && p.s[p.pos] == ',' {
+				p.pos++
+			} else if p.pos >= len(p.s) || p.s[p.pos] != ']' {
+				return nil, p.errorf("expected , or ] in array")
+			}
+		}
+	case '{':
+		p.pos++
+		table := map[string]interface{}{}
+		p.skipBlank(false)
+		if p.pos < len(p.s) && p.s[p.pos] == '}' {
+			p.pos++
+			return table, nil
+		}
+		for {
+			if err := p.parseKeyValue(table); err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			if p.pos >= len(p.s) {
+				return nil, p.errorf("unterminated inline table")
+			}
+			switch p.s[p.pos] {
+			case ',':
+				p.pos++
+			case '}':
+				p.pos++
+				return table, nil
+			default:
+				return nil, p.errorf("expected , or } in inline table")
+			}
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && (isBareKeyChar(p.s[p.pos]) || strings.IndexByte("+.:", p.s[p.pos]) >= 0) {
+		p.pos++
+	}
+	// local date times may separate the date and time with a space
+	if p.pos+1 < len(p.s) && p.s[p.pos] == ' ' && isTOMLDate(p.s[start:p.pos]) && p.s[p.pos+1] >= '0' && p.s[p.pos+1] <= '9' {
+		p.pos++
+		for p.pos < len(p.s) && (isBareKeyChar(p.s[p.pos]) || strings.IndexByte("+.:", p.s[p.pos]) >= 0) {
+			p.pos++
+		}
+	}
+	return p.parseScalar(p.s[start:p.pos])
+}
+
+func isTOMLDate(token string) bool {
+	return len(token) == 10 && token[4] == '-' && token[7] == '-'
+}
+
+func (p *tomlParser) parseScalar(token string) (interface{}, error) {
+	switch token {
+	case "":
+		return nil, p.errorf("expected a value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if len(token) >= 10 && token[4] == '-' && token[7] == '-' || len(token) >= 8 && token[2] == ':' && token[5] == ':' {
+		return token, nil
+	}
+
+	number := strings.ReplaceAll(token, "_", "")
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if digits, ok := strings.CutPrefix(number, prefix); ok {
+			n, err := strconv.ParseInt(digits, base, 64)
+			if err != nil {
+				return nil, p.errorf("invalid integer %s", token)
+			}
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+	}
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(n, 10)), nil
+	}
+	if strings.HasSuffix(number, "inf") || strings.HasSuffix(number, "nan") {
+		// not representable in JSON
+		return nil, p.errorf("unsupported value %s", token)
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return nil, p.errorf("invalid value %s", token)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+// parseString parses basic, literal and their multi-line variants.
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.s[p.pos]
+	delimiter := string(quote)
+	multiline := strings.HasPrefix(p.s[p.pos:], strings.Repeat(delimiter, 3))
+	if multiline {
+		delimiter = strings.Repeat(delimiter, 3)
+	}
+	p.pos += len(delimiter)
+	if multiline && strings.HasPrefix(p.s[p.pos:], "\n") {
+		// a newline following the opening delimiter is trimmed
+		p.pos++
+		p.line++
+	}
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.pos:], delimiter) {
+			n := len(delimiter)
+			// up to two quotes may directly precede a multi-line closing delimiter
+			for multiline && n < 5 && p.pos+n < len(p.s) && p.s[p.pos+n] == quote {
+				n++
+			}
+			b.WriteString(p.s[p.pos : p.pos+n-len(delimiter)])
+			p.pos += n
+			return b.String(), nil
+		}
+
+		c := p.s[p.pos]
+		switch {
+		case c == '\n':
+			if !multiline {
+				return "", p.errorf("newline in string")
+			}
+			p.line++
+			b.WriteByte(c)
+			p.pos++
+		case c == '\\' && quote == '"':
+			if err := p.parseEscape(&b, multiline); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder, multiline bool) error {
+	p.pos++
+	if p.pos >= len(p.s) {
+		return p.errorf("unterminated escape")
+	}
+	c := p.s[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape")
+		}
+		b.WriteRune(rune(r))
+		p.pos += size
+	case ' ', '\t', '\n':
+		// a line ending backslash trims the following whitespace
+		if !multiline {
+			return p.errorf("invalid escape")
+		}
+		p.pos--
+		for p.pos < len(p.s) && strings.IndexByte(" \t\n", p.s[p.pos]) >= 0 {
+			if p.s[p.pos] == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines when multiline.
+func (p *tomlParser) skipBlank(multiline bool) {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		case '\n':
+			if !multiline {
+				return
+			}
+			p.line++
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		return p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return nil
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
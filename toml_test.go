@@ -0,0 +1,87 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOMLToJSON(t *testing.T) {
+	tests := []struct {
+		desc     string
+		toml     string
+		expected string
+	}{
+		{
+			desc: "traefik dynamic configuration",
+			toml: `# routers of the node
+[http.routers.api]
+  entryPoints = ["web", "websecure"]
+  rule = "Host(` + "`api.example.com`" + `)"
+  service = "api"
+  priority = 10
+
+[http.services.api.loadBalancer]
+  passHostHeader = true
+  [[http.services.api.loadBalancer.servers]]
+    url = "http://10.0.0.1:8080"
+  [[http.services.api.loadBalancer.servers]]
+    url = 'http://10.0.0.2:8080' # literal
+`,
+			expected: `{"http":{"routers":{"api":{"entryPoints":["web","websecure"],"priority":10,"rule":"Host(` + "`api.example.com`" + `)","service":"api"}},"services":{"api":{"loadBalancer":{"passHostHeader":true,"servers":[{"url":"http://10.0.0.1:8080"},{"url":"http://10.0.0.2:8080"}]}}}}}`,
+		},
+		{
+			desc:     "dotted keys and inline tables",
+			toml:     "http.middlewares.auth.basicAuth = { users = [\"a:b\"], \"removeHeader\" = true }\nsite.\"a.b\".c = 1\n",
+			expected: `{"http":{"middlewares":{"auth":{"basicAuth":{"removeHeader":true,"users":["a:b"]}}}},"site":{"a.b":{"c":1}}}`,
+		},
+		{
+			desc:     "numbers, dates and multi-line values",
+			toml:     "hex = 0xff\nbig = 1_000\nratio = 1.5e2\nneg = -3\nwhen = 1979-05-27T07:32:00Z\nlocal = 1979-05-27 07:32:00\nlist = [\n  1,\n  2, # two\n]\n",
+			expected: `{"big":1000,"hex":255,"list":[1,2],"local":"1979-05-27 07:32:00","neg":-3,"ratio":150,"when":"1979-05-27T07:32:00Z"}`,
+		},
+		{
+			desc:     "strings",
+			toml:     "basic = \"tab\\t\\u00e9\"\nlines = \"\"\"\none \\\n  two\"\"\"\"\nraw = '''\nC:\\path'''\n",
+			expected: `{"basic":"tab\t\u00e9","lines":"one two\"","raw":"C:\\path"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			actual, err := tomlToJSON([]byte(test.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(actual, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTOMLToJSONErrors(t *testing.T) {
+	for _, toml := range []string{
+		"a = 1\na = 2\n",
+		"[a]\n[a]\n",
+		"a = 1 b = 2\n",
+		"a = [1, 2\n",
+		"a = \"unterminated\n",
+		"a = inf\n",
+		"a = 1\n[a.b]\n",
+		"= 1\n",
+		"a = " + strings.Repeat("[", 1<<20),
+		"a = " + strings.Repeat("{b = ", 1<<10),
+	} {
+		if actual, err := tomlToJSON([]byte(toml)); err == nil {
+			t.Errorf("%q: expected an error, got %s", toml, actual)
+		}
+	}
+}
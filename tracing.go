@@ -0,0 +1,221 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing exports the traces of the poll cycles to an OpenTelemetry collector
+// over OTLP/HTTP, such as http://otel-collector:4318, the fetches carrying
+// their span in a traceparent header.
+type Tracing struct {
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"serviceName,omitempty"`
+}
+
+// maxPendingSpans bounds the spans waiting to be exported.
+const maxPendingSpans = 4096
+
+type tracer struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+
+	mu      sync.Mutex
+	pending []*span
+}
+
+// span a timed step of a poll cycle.
+type span struct {
+	tracer   *tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      error
+}
+
+func newTracer(config *Tracing, client *http.Client) *tracer {
+	if config == nil {
+		return nil
+	}
+	service := config.ServiceName
+	if service == "" {
+		service = "multi-http-provider"
+	}
+	return &tracer{
+		url:     strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces",
+		headers: config.Headers,
+		service: service,
+		client:  client,
+	}
+}
+
+// start starts a span, the root of a new trace without parent.
+func (t *tracer) start(parent *span, name string) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{tracer: t, spanID: randomID(8), name: name, start: time.Now(), attrs: map[string]string{}}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return s
+}
+
+// child starts a span of the trace of s.
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(s, name)
+}
+
+// set sets an attribute of the span.
+func (s *span) set(key string, value interface{}) {
+	if s != nil {
+		s.attrs[key] = fmt.Sprint(value)
+	}
+}
+
+// finish ends the span, failed with err if not nil. The spans are exported
+// once their root ends.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	t := s.tracer
+	t.mu.Lock()
+	if len(t.pending) < maxPendingSpans {
+		t.pending = append(t.pending, s)
+	}
+	var spans []*span
+	if s.parentID == "" {
+		spans, t.pending = t.pending, nil
+	}
+	t.mu.Unlock()
+	if len(spans) > 0 {
+		go t.export(spans)
+	}
+}
+
+// traceparent returns the W3C trace context header of the span.
+func (s *span) traceparent() string {
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+// export sends spans to the collector.
+func (t *tracer) export(spans []*span) {
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		logger.Error("Error encoding the traces", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Error exporting the traces", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, expandVars(v))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		logger.Error("Error exporting the traces", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		logger.Error("Error exporting the traces", "status", resp.StatusCode)
+	}
+}
+
+// request builds the OTLP/HTTP JSON request of spans.
+func (t *tracer) request(spans []*span) map[string]interface{} {
+	var encoded []interface{}
+	for _, s := range spans {
+		keys := make([]string, 0, len(s.attrs))
+		for k := range s.attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var attrs []interface{}
+		for _, k := range keys {
+			attrs = append(attrs, stringAttribute(k, s.attrs[k]))
+		}
+		// OTLP status codes: 1 ok, 2 error
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		encoded = append(encoded, map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"parentSpanId":      s.parentID,
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attrs,
+			"status":            status,
+		})
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []interface{}{stringAttribute("service.name", t.service)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/marcelohpf/multi-http-provider"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func stringAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]interface{}{"stringValue": value}}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type spanKey struct{}
+
+// contextWithSpan returns a copy of ctx carrying s.
+func contextWithSpan(ctx context.Context, s *span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// spanFromContext returns the span of ctx, nil if none.
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
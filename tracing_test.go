@@ -0,0 +1,78 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvideTracing(t *testing.T) {
+	traceparents := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(routerConfig("api", "web")))
+	}))
+	defer srv.Close()
+
+	type otlpSpan struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	}
+	exports := make(chan []otlpSpan, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected export to %s", r.URL.Path)
+		}
+		var request struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		exports <- request.ResourceSpans[0].ScopeSpans[0].Spans
+	}))
+	defer collector.Close()
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.EntryPoints = []string{"web"}
+	config.Tracing = &Tracing{Endpoint: collector.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	config.Endpoints = map[string]Endpoint{"node": {Endpoint: srv.URL}}
+	receiveConfig(t, startProviderConfig(t, config))
+
+	var spans []otlpSpan
+	select {
+	case spans = <-exports:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the traces")
+	}
+	var names []string
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+		byName[s.Name] = s
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "decode,fetch,filter,merge,poll cycle" {
+		t.Fatalf("unexpected spans %v", names)
+	}
+	root := byName["poll cycle"]
+	for _, s := range spans {
+		if s.TraceID != root.TraceID || s.Name != "poll cycle" && s.ParentSpanID != root.SpanID {
+			t.Errorf("expected span %s to be a child of the poll cycle", s.Name)
+		}
+	}
+	if header := <-traceparents; header != "00-"+root.TraceID+"-"+byName["fetch"].SpanID+"-01" {
+		t.Errorf("unexpected traceparent %q", header)
+	}
+}
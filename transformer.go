@@ -0,0 +1,70 @@
+package multi_http_provider
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// Transformer mutates the filtered configuration of a node before it is
+// merged. An error drops the configuration.
+type Transformer interface {
+	Transform(node string, cfg *dynamic.Configuration) error
+}
+
+// TransformerFunc adapts a function to a Transformer.
+type TransformerFunc func(node string, cfg *dynamic.Configuration) error
+
+// Transform calls f.
+func (f TransformerFunc) Transform(node string, cfg *dynamic.Configuration) error {
+	return f(node, cfg)
+}
+
+var (
+	transformersMu sync.Mutex
+	transformers   = map[string]Transformer{}
+)
+
+// RegisterTransformer registers a transformer under name, for the providers
+// listing it in their transformers. Registering a name twice replaces it.
+func RegisterTransformer(name string, t Transformer) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	transformers[name] = t
+}
+
+// lookupTransformers returns the registered transformers of names, in order.
+func lookupTransformers(names []string) ([]namedTransformer, error) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	var result []namedTransformer
+	for _, name := range names {
+		t, ok := transformers[name]
+		if !ok || t == nil {
+			return nil, fmt.Errorf("unknown transformer %q", name)
+		}
+		result = append(result, namedTransformer{name: name, Transformer: t})
+	}
+	return result, nil
+}
+
+type namedTransformer struct {
+	name string
+	Transformer
+}
+
+// applyTransformers runs the transformers of the provider on the
+// configuration of node, returning nil when one of them fails.
+func (p *Provider) applyTransformers(node string, config *dynamic.Configuration) *dynamic.Configuration {
+	if config == nil {
+		return nil
+	}
+	for _, t := range p.transformers {
+		if err := t.Transform(node, config); err != nil {
+			logger.Warn("Dropping the configuration, a transformer failed", "node", node, "transformer", t.name, "error", err)
+			return nil
+		}
+	}
+	return config
+}
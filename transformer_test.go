@@ -0,0 +1,45 @@
+package multi_http_provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestParseUpdateTransformers(t *testing.T) {
+	RegisterTransformer("test-rename", TransformerFunc(func(node string, cfg *dynamic.Configuration) error {
+		for name, r := range cfg.HTTP.Routers {
+			delete(cfg.HTTP.Routers, name)
+			cfg.HTTP.Routers[node+"-"+name] = r
+		}
+		return nil
+	}))
+	RegisterTransformer("test-fail", TransformerFunc(func(string, *dynamic.Configuration) error {
+		return errors.New("rejected")
+	}))
+
+	transformers, err := lookupTransformers([]string{"test-rename"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{entrypoints: map[string]bool{"web": true}, transformers: transformers}
+	u := p.parseUpdate("edge", endpoint{}, "", []byte(routerConfig("api", "web")))
+	if u.config == nil || u.config.HTTP.Routers["edge-api"] == nil {
+		t.Fatalf("expected the renamed router, got %+v", u.config)
+	}
+
+	p.transformers, _ = lookupTransformers([]string{"test-rename", "test-fail"})
+	if u := p.parseUpdate("edge", endpoint{}, "", []byte(routerConfig("api", "web"))); !u.empty() {
+		t.Errorf("expected the failed configuration to be dropped, got %+v", u)
+	}
+}
+
+func TestNewUnknownTransformer(t *testing.T) {
+	config := CreateConfig()
+	config.Transformers = []string{"missing"}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an unknown transformer error")
+	}
+}
@@ -0,0 +1,402 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// translateV2 rewrites a configuration written for Traefik v2 into its v3
+// equivalent: v2 rule matchers, ipWhiteList, the removed headers options and
+// the removed stripPrefix and contentType options. It reports whether the
+// configuration was detected as a v2 one, v3 configurations being unchanged.
+func translateV2(config *dynamic.Configuration) bool {
+	if !isV2(config) {
+		return false
+	}
+
+	if config.HTTP != nil {
+		for _, r := range config.HTTP.Routers {
+			if r != nil {
+				r.Rule = translateV2Rule(r.Rule)
+			}
+		}
+		disabled := map[string]bool{}
+		for name, m := range config.HTTP.Middlewares {
+			if m == nil {
+				continue
+			}
+			if m.IPWhiteList != nil {
+				if m.IPAllowList == nil {
+					m.IPAllowList = &dynamic.IPAllowList{SourceRange: m.IPWhiteList.SourceRange, IPStrategy: m.IPWhiteList.IPStrategy}
+				}
+				m.IPWhiteList = nil
+			}
+			if m.Headers != nil {
+				translateV2Headers(m)
+			}
+			if m.StripPrefix != nil {
+				m.StripPrefix.ForceSlash = false
+			}
+			if m.ContentType != nil {
+				// v2 detected content types unless disabled, v3 only
+				// when the middleware is used
+				if !m.ContentType.AutoDetect {
+					disabled[name] = true
+				}
+				m.ContentType.AutoDetect = false
+			}
+		}
+		for name := range disabled {
+			delete(config.HTTP.Middlewares, name)
+			for _, r := range config.HTTP.Routers {
+				if r != nil {
+					r.Middlewares = removeString(r.Middlewares, name)
+				}
+			}
+		}
+	}
+
+	if config.TCP != nil {
+		for _, r := range config.TCP.Routers {
+			if r != nil {
+				r.Rule = translateV2Rule(r.Rule)
+			}
+		}
+		for _, m := range config.TCP.Middlewares {
+			if m != nil && m.IPWhiteList != nil {
+				if m.IPAllowList == nil {
+					m.IPAllowList = &dynamic.TCPIPAllowList{SourceRange: m.IPWhiteList.SourceRange}
+				}
+				m.IPWhiteList = nil
+			}
+		}
+	}
+	return true
+}
+
+// isV2 reports whether a configuration uses constructs only valid in v2.
+func isV2(config *dynamic.Configuration) bool {
+	if config.HTTP != nil {
+		for _, r := range config.HTTP.Routers {
+			if r != nil && translateV2Rule(r.Rule) != r.Rule {
+				return true
+			}
+		}
+		for _, m := range config.HTTP.Middlewares {
+			if m == nil {
+				continue
+			}
+			if m.IPWhiteList != nil ||
+				m.StripPrefix != nil && m.StripPrefix.ForceSlash ||
+				m.ContentType != nil && m.ContentType.AutoDetect {
+				return true
+			}
+			if h := m.Headers; h != nil && (h.SSLRedirect || h.SSLTemporaryRedirect || h.SSLHost != "" || h.SSLForceHost || h.FeaturePolicy != "") {
+				return true
+			}
+		}
+	}
+	if config.TCP != nil {
+		for _, r := range config.TCP.Routers {
+			if r != nil && translateV2Rule(r.Rule) != r.Rule {
+				return true
+			}
+		}
+		for _, m := range config.TCP.Middlewares {
+			if m != nil && m.IPWhiteList != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// translateV2Headers moves featurePolicy to permissionsPolicy and replaces a
+// headers middleware only redirecting to HTTPS by a redirectScheme one.
+func translateV2Headers(m *dynamic.Middleware) {
+	h := m.Headers
+	if h.FeaturePolicy != "" {
+		if h.PermissionsPolicy == "" {
+			h.PermissionsPolicy = h.FeaturePolicy
+		}
+		h.FeaturePolicy = ""
+	}
+
+	redirect, temporary := h.SSLRedirect, h.SSLTemporaryRedirect
+	h.SSLRedirect = false
+	h.SSLTemporaryRedirect = false
+	h.SSLHost = ""
+	h.SSLForceHost = false
+	if !redirect && !temporary {
+		return
+	}
+	if reflect.DeepEqual(*h, dynamic.Headers{}) && m.RedirectScheme == nil {
+		m.Headers = nil
+		m.RedirectScheme = &dynamic.RedirectScheme{Scheme: "https", Permanent: !temporary}
+	}
+}
+
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// v2 matchers taking several values, matching any of them, or all of them for
+// Query.
+var v2MultiMatchers = map[string]bool{
+	"Host": true, "HostHeader": true, "HostRegexp": true, "Method": true, "Path": true,
+	"PathPrefix": true, "Query": true, "ClientIP": true, "HostSNI": true,
+}
+
+// v2 rule templates variables, {name} or {name:pattern}.
+var v2Variable = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_]*(:|\})`)
+
+// translateV2Rule rewrites the v2 matchers of a rule. Matchers that do not
+// parse are kept as they are.
+func translateV2Rule(rule string) string {
+	var b strings.Builder
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		if !isMatcherStart(c) || i > 0 && isMatcherChar(rule[i-1]) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(rule) && isMatcherChar(rule[j]) {
+			j++
+		}
+		name := rule[i:j]
+		args, end, ok := parseMatcherArgs(rule, j)
+		if !ok {
+			b.WriteString(name)
+			i = j
+			continue
+		}
+		b.WriteString(translateV2Matcher(name, args, rule[i:end]))
+		i = end
+	}
+	return b.String()
+}
+
+func isMatcherStart(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isMatcherChar(c byte) bool {
+	return isMatcherStart(c) || c >= '0' && c <= '9'
+}
+
+// parseMatcherArgs parses the quoted arguments of a matcher from the opening
+// parenthesis at i, returning them with the position after the closing one.
+func parseMatcherArgs(rule string, i int) ([]string, int, bool) {
+	i = skipSpaces(rule, i)
+	if i >= len(rule) || rule[i] != '(' {
+		return nil, 0, false
+	}
+	var args []string
+	i = skipSpaces(rule, i+1)
+	if i < len(rule) && rule[i] == ')' {
+		return args, i + 1, true
+	}
+	for {
+		if i >= len(rule) {
+			return nil, 0, false
+		}
+		var arg string
+		switch rule[i] {
+		case '`':
+			end := strings.IndexByte(rule[i+1:], '`')
+			if end < 0 {
+				return nil, 0, false
+			}
+			arg = rule[i+1 : i+1+end]
+			i += end + 2
+		case '"':
+			end := i + 1
+			for end < len(rule) && rule[end] != '"' {
+				if rule[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rule) {
+				return nil, 0, false
+			}
+			unquoted, err := strconv.Unquote(rule[i : end+1])
+			if err != nil {
+				return nil, 0, false
+			}
+			arg = unquoted
+			i = end + 1
+		default:
+			return nil, 0, false
+		}
+		args = append(args, arg)
+
+		i = skipSpaces(rule, i)
+		if i >= len(rule) {
+			return nil, 0, false
+		}
+		switch rule[i] {
+		case ',':
+			i = skipSpaces(rule, i+1)
+		case ')':
+			return args, i + 1, true
+		default:
+			return nil, 0, false
+		}
+	}
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// translateV2Matcher translates a matcher when it is a v2 one, returning the
+// original text otherwise.
+func translateV2Matcher(name string, args []string, original string) string {
+	if !isV2Matcher(name, args) {
+		return original
+	}
+	switch name {
+	case "Headers":
+		return "Header(" + strings.Join(quoteRuleArgs(args), ", ") + ")"
+	case "HeadersRegexp":
+		return "HeaderRegexp(" + strings.Join(quoteRuleArgs(args), ", ") + ")"
+	case "HostHeader":
+		name = "Host"
+	}
+
+	var matchers []string
+	for _, arg := range args {
+		matcher, ok := translateV2Value(name, arg)
+		if !ok {
+			return original
+		}
+		matchers = append(matchers, matcher)
+	}
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	operator := " || "
+	if name == "Query" {
+		operator = " && "
+	}
+	return "(" + strings.Join(matchers, operator) + ")"
+}
+
+func isV2Matcher(name string, args []string) bool {
+	switch name {
+	case "Headers", "HeadersRegexp", "HostHeader":
+		return true
+	}
+	if !v2MultiMatchers[name] || len(args) == 0 {
+		return false
+	}
+	if name == "Query" {
+		// v3 takes a key and a value, v2 key=value pairs
+		for _, arg := range args {
+			if strings.Contains(arg, "=") {
+				return true
+			}
+		}
+		return false
+	}
+	if len(args) > 1 {
+		return true
+	}
+	switch name {
+	case "HostRegexp", "Path", "PathPrefix":
+		return v2Variable.MatchString(args[0])
+	}
+	return false
+}
+
+// translateV2Value translates a single value of a multi-value matcher, false
+// for an invalid template.
+func translateV2Value(name, value string) (string, bool) {
+	switch name {
+	case "Query":
+		if key, v, ok := strings.Cut(value, "="); ok {
+			return "Query(" + quoteRuleArg(key) + ", " + quoteRuleArg(v) + ")", true
+		}
+	case "HostRegexp":
+		pattern, ok := v2TemplateRegexp(value, "[^.]+")
+		return "HostRegexp(" + quoteRuleArg("^"+pattern+"$") + ")", ok
+	case "Path":
+		if v2Variable.MatchString(value) {
+			pattern, ok := v2TemplateRegexp(value, "[^/]+")
+			return "PathRegexp(" + quoteRuleArg("^"+pattern+"$") + ")", ok
+		}
+	case "PathPrefix":
+		if v2Variable.MatchString(value) {
+			pattern, ok := v2TemplateRegexp(value, "[^/]+")
+			return "PathRegexp(" + quoteRuleArg("^"+pattern) + ")", ok
+		}
+	}
+	return name + "(" + quoteRuleArg(value) + ")", true
+}
+
+// v2TemplateRegexp converts a v2 template, literal text with {name} and
+// {name:pattern} variables, into a regular expression, false when a variable
+// is not closed.
+func v2TemplateRegexp(template, defaultPattern string) (string, bool) {
+	var b strings.Builder
+	for {
+		loc := v2Variable.FindStringIndex(template)
+		if loc == nil {
+			b.WriteString(regexp.QuoteMeta(template))
+			return b.String(), true
+		}
+		b.WriteString(regexp.QuoteMeta(template[:loc[0]]))
+		pattern := defaultPattern
+		end := loc[1]
+		if template[loc[1]-1] == ':' {
+			// the pattern ends at the brace closing the variable
+			depth := 1
+			for end < len(template) && depth > 0 {
+				switch template[end] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+				end++
+			}
+			if depth > 0 {
+				return "", false
+			}
+			pattern = template[loc[1] : end-1]
+		}
+		b.WriteString("(?:" + pattern + ")")
+		template = template[end:]
+	}
+}
+
+func quoteRuleArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteRuleArg(arg)
+	}
+	return quoted
+}
+
+func quoteRuleArg(arg string) string {
+	if strings.Contains(arg, "`") {
+		return strconv.Quote(arg)
+	}
+	return "`" + arg + "`"
+}
@@ -0,0 +1,130 @@
+package multi_http_provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestTranslateV2Rule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected string
+	}{
+		{rule: "Host(`a.example.com`)", expected: "Host(`a.example.com`)"},
+		{rule: "Host(`a.example.com`, `b.example.com`)", expected: "(Host(`a.example.com`) || Host(`b.example.com`))"},
+		{rule: "HostHeader(`a.example.com`) && PathPrefix(`/api`)", expected: "Host(`a.example.com`) && PathPrefix(`/api`)"},
+		{rule: `Host("a.example.com", "b.example.com")`, expected: "(Host(`a.example.com`) || Host(`b.example.com`))"},
+		{rule: "HostRegexp(`{subdomain:[a-z]+}.example.com`)", expected: "HostRegexp(`^(?:[a-z]+)\\.example\\.com$`)"},
+		{rule: "HostRegexp(`{name}.example.com`)", expected: "HostRegexp(`^(?:[^.]+)\\.example\\.com$`)"},
+		{rule: "HostRegexp(`^[a-z]{2,3}\\.example\\.com$`)", expected: "HostRegexp(`^[a-z]{2,3}\\.example\\.com$`)"},
+		{rule: "Path(`/users/{id:[0-9]{1,4}}`)", expected: "PathRegexp(`^/users/(?:[0-9]{1,4})$`)"},
+		{rule: "PathPrefix(`/users/{id}`)", expected: "PathRegexp(`^/users/(?:[^/]+)`)"},
+		{rule: "Headers(`X-Env`, `prod`) || HeadersRegexp(`X-Team`, `^a`)", expected: "Header(`X-Env`, `prod`) || HeaderRegexp(`X-Team`, `^a`)"},
+		{rule: "Query(`env=prod`, `debug`)", expected: "(Query(`env`, `prod`) && Query(`debug`))"},
+		{rule: "Query(`env`, `prod`)", expected: "Query(`env`, `prod`)"},
+		{rule: "Method(`GET`, `HEAD`) && !ClientIP(`10.0.0.0/8`, `192.168.0.0/16`)", expected: "(Method(`GET`) || Method(`HEAD`)) && !(ClientIP(`10.0.0.0/8`) || ClientIP(`192.168.0.0/16`))"},
+		{rule: "HostSNI(`a.example.com`,`b.example.com`)", expected: "(HostSNI(`a.example.com`) || HostSNI(`b.example.com`))"},
+		{rule: "Header(`X-Env`,`prod`) && Query(`env`,`prod`)", expected: "Header(`X-Env`,`prod`) && Query(`env`,`prod`)"},
+		{rule: "Host(`unterminated", expected: "Host(`unterminated"},
+		{rule: "HostRegexp(`{A:`)", expected: "HostRegexp(`{A:`)"},
+		{rule: "Path(`/a`, `/users/{id:[0-9]+`)", expected: "Path(`/a`, `/users/{id:[0-9]+`)"},
+	}
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			if actual := translateV2Rule(test.rule); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTranslateV2(t *testing.T) {
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers: map[string]*dynamic.Router{
+				"app": {Rule: "Host(`a.example.com`, `b.example.com`)", Middlewares: []string{"allow", "redirect", "nosniff", "types"}},
+			},
+			Middlewares: map[string]*dynamic.Middleware{
+				"allow":    {IPWhiteList: &dynamic.IPWhiteList{SourceRange: []string{"10.0.0.0/8"}}},
+				"redirect": {Headers: &dynamic.Headers{SSLRedirect: true, SSLTemporaryRedirect: true}},
+				"nosniff":  {Headers: &dynamic.Headers{ContentTypeNosniff: true, FeaturePolicy: "camera 'none'", SSLRedirect: true}},
+				"types":    {ContentType: &dynamic.ContentType{}},
+				"strip":    {StripPrefix: &dynamic.StripPrefix{Prefixes: []string{"/api"}, ForceSlash: true}},
+			},
+		},
+		TCP: &dynamic.TCPConfiguration{
+			Middlewares: map[string]*dynamic.TCPMiddleware{
+				"allow": {IPWhiteList: &dynamic.TCPIPWhiteList{SourceRange: []string{"10.0.0.0/8"}}},
+			},
+		},
+	}
+	if !translateV2(config) {
+		t.Fatal("expected a v2 configuration")
+	}
+
+	router := config.HTTP.Routers["app"]
+	if router.Rule != "(Host(`a.example.com`) || Host(`b.example.com`))" {
+		t.Errorf("unexpected rule %s", router.Rule)
+	}
+	if !reflect.DeepEqual(router.Middlewares, []string{"allow", "redirect", "nosniff"}) {
+		t.Errorf("expected the disabled contentType middleware to be removed, got %v", router.Middlewares)
+	}
+	middlewares := config.HTTP.Middlewares
+	if m := middlewares["allow"]; m.IPWhiteList != nil || m.IPAllowList == nil || m.IPAllowList.SourceRange[0] != "10.0.0.0/8" {
+		t.Errorf("expected ipWhiteList to become ipAllowList, got %+v", m)
+	}
+	if m := middlewares["redirect"]; m.Headers != nil || !reflect.DeepEqual(m.RedirectScheme, &dynamic.RedirectScheme{Scheme: "https"}) {
+		t.Errorf("expected a temporary redirectScheme, got %+v", m)
+	}
+	if h := middlewares["nosniff"].Headers; h.SSLRedirect || h.FeaturePolicy != "" || h.PermissionsPolicy != "camera 'none'" || !h.ContentTypeNosniff {
+		t.Errorf("unexpected headers %+v", h)
+	}
+	if _, ok := middlewares["types"]; ok {
+		t.Error("expected the contentType middleware to be removed")
+	}
+	if m := middlewares["strip"]; m.StripPrefix.ForceSlash {
+		t.Error("expected forceSlash to be dropped")
+	}
+	if m := config.TCP.Middlewares["allow"]; m.IPWhiteList != nil || m.IPAllowList == nil {
+		t.Errorf("expected the TCP ipWhiteList to become ipAllowList, got %+v", m)
+	}
+}
+
+func TestTranslateV2KeepsV3(t *testing.T) {
+	config := &dynamic.Configuration{
+		HTTP: &dynamic.HTTPConfiguration{
+			Routers: map[string]*dynamic.Router{
+				"app": {Rule: "Host(`a.example.com`) && HostRegexp(`^[a-z]+\\.example\\.com$`)", Middlewares: []string{"types"}},
+			},
+			Middlewares: map[string]*dynamic.Middleware{
+				"types": {ContentType: &dynamic.ContentType{}},
+			},
+		},
+	}
+	if translateV2(config) {
+		t.Fatal("expected a v3 configuration")
+	}
+	if _, ok := config.HTTP.Middlewares["types"]; !ok {
+		t.Error("expected the v3 contentType middleware to be kept")
+	}
+}
+
+func TestParseV2Config(t *testing.T) {
+	body := `{"http":{"routers":{"app":{"entryPoints":["web"],"service":"app","rule":"Host(` + "`a`, `b`" + `)","middlewares":["allow"]}},` +
+		`"middlewares":{"allow":{"ipWhiteList":{"sourceRange":["10.0.0.0/8"]}}},` +
+		`"services":{"app":{"loadBalancer":{"servers":[{"url":"http://10.0.0.1"}]}}}}}`
+
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	config := p.parseConfig(endpoint{}, "", []byte(body))
+	if config == nil {
+		t.Fatal("expected a configuration")
+	}
+	if rule := config.HTTP.Routers["app"].Rule; rule != "(Host(`a`) || Host(`b`))" {
+		t.Errorf("unexpected rule %s", rule)
+	}
+	if m := config.HTTP.Middlewares["allow"]; m == nil || m.IPAllowList == nil {
+		t.Errorf("expected an ipAllowList middleware, got %+v", m)
+	}
+}
@@ -0,0 +1,198 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultMaxStaleness bounds how long secrets without a renewable lease are
+// cached, so that rotated static secrets are picked up.
+const vaultMaxStaleness = 5 * time.Minute
+
+// Vault the HashiCorp Vault server resolving the vault:<path>#<field> header
+// and auth values. The address and token default to the VAULT_ADDR and
+// VAULT_TOKEN environment variables.
+type Vault struct {
+	Address   string `json:"address,omitempty"`
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	CAFile    string `json:"caFile,omitempty"`
+}
+
+func isVaultRef(value string) bool {
+	return strings.HasPrefix(value, "vault:")
+}
+
+// vaultClient reads secrets from Vault, caching them until their lease is due
+// for renewal.
+type vaultClient struct {
+	address   string
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+
+	mu      sync.Mutex
+	secrets map[string]*vaultSecret
+}
+
+type vaultSecret struct {
+	data      map[string]interface{}
+	leaseID   string
+	renewable bool
+	refreshAt time.Time
+}
+
+func newVaultClient(config *Vault, client *http.Client) (*vaultClient, error) {
+	if config == nil {
+		return nil, nil
+	}
+	address := config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if err := validateURL(address); err != nil {
+		return nil, fmt.Errorf("vault address: %w", err)
+	}
+	token := config.Token
+	if token == "" && config.TokenFile == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	return &vaultClient{
+		address:   strings.TrimSuffix(address, "/"),
+		token:     token,
+		tokenFile: config.TokenFile,
+		namespace: config.Namespace,
+		client:    client,
+		secrets:   map[string]*vaultSecret{},
+	}, nil
+}
+
+// resolve returns the field of a vault:<path>#<field> reference, the secret
+// being read again, or its lease renewed, once it is due.
+func (v *vaultClient) resolve(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(strings.TrimPrefix(ref, "vault:"), "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault references must be vault:<path>#<field>")
+	}
+	if v == nil {
+		return "", fmt.Errorf("vault is not configured")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, err := v.secret(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+	value, ok := s.data[field]
+	if !ok {
+		return "", fmt.Errorf("vault %s: no field %q", path, field)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func (v *vaultClient) secret(ctx context.Context, path string) (*vaultSecret, error) {
+	now := time.Now()
+	s := v.secrets[path]
+	if s != nil && now.Before(s.refreshAt) {
+		return s, nil
+	}
+	if s != nil && s.renewable {
+		var lease vaultResponse
+		body, _ := json.Marshal(map[string]string{"lease_id": s.leaseID})
+		if err := v.do(ctx, http.MethodPut, "sys/leases/renew", body, &lease); err == nil && lease.LeaseDuration > 0 {
+			s.refreshAt = now.Add(renewalDelay(lease.LeaseDuration, true))
+			return s, nil
+		}
+		// leases past their max TTL are not renewed, the secret is read again
+	}
+
+	var resp vaultResponse
+	if err := v.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		// KV version 2 secrets nest their data
+		data = inner
+	}
+	s = &vaultSecret{
+		data:      data,
+		leaseID:   resp.LeaseID,
+		renewable: resp.Renewable && resp.LeaseID != "",
+	}
+	s.refreshAt = now.Add(renewalDelay(resp.LeaseDuration, s.renewable))
+	v.secrets[path] = s
+	return s, nil
+}
+
+// renewalDelay returns when a lease of seconds is renewed, at two thirds of
+// its duration, static secrets being read again at least every
+// vaultMaxStaleness.
+func renewalDelay(seconds int, renewable bool) time.Duration {
+	delay := time.Duration(seconds) * time.Second * 2 / 3
+	if !renewable && (delay <= 0 || delay > vaultMaxStaleness) {
+		delay = vaultMaxStaleness
+	}
+	return delay
+}
+
+type vaultResponse struct {
+	Data          map[string]interface{} `json:"data"`
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Errors        []string               `json:"errors"`
+}
+
+func (v *vaultClient) do(ctx context.Context, method, path string, body []byte, out *vaultResponse) error {
+	req, err := http.NewRequestWithContext(ctx, method, v.address+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// tokens written by Vault agent are renewed, read on every request
+	token, err := secretValue(ctx, nil, v.token, v.tokenFile)
+	if err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil && resp.StatusCode == http.StatusOK {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.Join(out.Errors, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newVaultServer(t *testing.T, reads, renewals *int32, renewable bool) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "edge" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/traefik":
+			n := atomic.AddInt32(reads, 1)
+			_, _ = w.Write([]byte(`{"data":{"data":{"token":"kv-token-` + string(rune('0'+n)) + `","port":8443},"metadata":{"version":1}},"lease_duration":0}`))
+		case "/v1/database/creds/config":
+			n := atomic.AddInt32(reads, 1)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data":     map[string]string{"password": "db-" + string(rune('0'+n))},
+				"lease_id": "database/creds/config/abc", "lease_duration": 3600, "renewable": renewable,
+			})
+		case "/v1/sys/leases/renew":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != http.MethodPut || body["lease_id"] != "database/creds/config/abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			atomic.AddInt32(renewals, 1)
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/config/abc","lease_duration":3600,"renewable":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVaultResolve(t *testing.T) {
+	var reads, renewals int32
+	srv := newVaultServer(t, &reads, &renewals, true)
+	v, err := newVaultClient(&Vault{Address: srv.URL, Token: "root", Namespace: "edge"}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{ref: "vault:secret/data/traefik#token", expected: "kv-token-1"},
+		{ref: "vault:/secret/data/traefik#port", expected: "8443"},
+		{ref: "vault:database/creds/config#password", expected: "db-2"},
+	}
+	for _, test := range tests {
+		actual, err := v.resolve(ctx, test.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.ref, test.expected, actual)
+		}
+	}
+	if n := atomic.LoadInt32(&reads); n != 2 {
+		t.Errorf("expected cached secrets, got %d reads", n)
+	}
+
+	// due leases are renewed, static secrets read again
+	for _, s := range v.secrets {
+		s.refreshAt = time.Now().Add(-time.Second)
+	}
+	if password, err := v.resolve(ctx, "vault:database/creds/config#password"); err != nil || password != "db-2" {
+		t.Errorf("expected the renewed secret, got %q: %v", password, err)
+	}
+	if n := atomic.LoadInt32(&renewals); n != 1 {
+		t.Errorf("expected 1 renewal, got %d", n)
+	}
+	if token, err := v.resolve(ctx, "vault:secret/data/traefik#token"); err != nil || token != "kv-token-3" {
+		t.Errorf("expected the secret to be read again, got %q: %v", token, err)
+	}
+
+	for _, ref := range []string{"vault:secret/data/traefik#missing", "vault:secret/data/other#token", "vault:secret/data/traefik"} {
+		if _, err := v.resolve(ctx, ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+func TestVaultHeadersAndAuth(t *testing.T) {
+	var reads, renewals int32
+	vault := newVaultServer(t, &reads, &renewals, false)
+	v, err := newVaultClient(&Vault{Address: vault.URL, Token: "root", Namespace: "edge"}, vault.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header, user, password string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		user, password, _ = r.BasicAuth()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	e := endpoint{
+		url: srv.URL, client: srv.Client(), vault: v,
+		headers: map[string]string{"X-Token": "vault:secret/data/traefik#token"},
+		auth:    &Auth{Username: "config", Password: "vault:database/creds/config#password"},
+	}
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if header != "kv-token-1" || user != "config" || password != "db-2" {
+		t.Errorf("unexpected credentials %q, %q:%q", header, user, password)
+	}
+
+	e.vault = nil
+	if _, _, err := (&Provider{}).fetchConfig(context.Background(), e); err == nil {
+		t.Error("expected an error without vault configured")
+	}
+}
+
+func TestRenewalDelay(t *testing.T) {
+	if d := renewalDelay(3600, true); d != 40*time.Minute {
+		t.Errorf("expected leases to be renewed at two thirds, got %s", d)
+	}
+	if d := renewalDelay(0, false); d != vaultMaxStaleness {
+		t.Errorf("expected static secrets to be read again, got %s", d)
+	}
+	if d := renewalDelay(60, false); d != 40*time.Second {
+		t.Errorf("unexpected delay %s", d)
+	}
+}
@@ -0,0 +1,147 @@
+package multi_http_provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// emitFunc forwards a configuration received from an endpoint, in the format
+// of its media type, or of the endpoint when empty. Watchers serving several
+// nodes name them with key, the node being published as <endpoint>/<key>, and
+// remove them with a nil body.
+type emitFunc func(key, contentType string, body []byte)
+
+// watcher receives the configurations pushed by an endpoint.
+type watcher interface {
+	// watch forwards every received configuration to emit until the
+	// connection ends, and reports whether the endpoint was reached.
+	watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error)
+	// reconnect prepares the next connection and returns the delay to wait
+	// before opening it.
+	reconnect(connected bool) time.Duration
+}
+
+// newWatcher returns the watcher of push mode endpoints, nil for polled ones.
+func (p *Provider) newWatcher(node string, e endpoint) watcher {
+	switch e.mode {
+	case modeSSE:
+		return &sseStream{retry: p.pollInterval}
+	case modeWebSocket:
+		return &websocketStream{backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeLongPoll:
+		return &longPoll{wait: e.wait, backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeFile:
+		return &fileWatcher{
+			path:     strings.TrimPrefix(e.url, "file://"),
+			interval: fileCheckInterval,
+			backoff:  newBackoff(time.Second, p.pollInterval),
+		}
+	case modeConsul:
+		return &consulKV{wait: e.wait, backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeEtcd:
+		return &etcdWatch{backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeRedis:
+		return &redisSubscriber{target: e.source.(*redisSource).target, backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeKubernetes:
+		return &kubernetesWatch{object: e.kubernetes, backoff: newBackoff(time.Second, p.pollInterval)}
+	case modeGRPC:
+		return &grpcStream{node: node, backoff: newBackoff(time.Second, p.pollInterval)}
+	default:
+		return nil
+	}
+}
+
+// runWatcher keeps an endpoint watched until the context is canceled. Its
+// nodes are removed from the merged configuration while the endpoint is
+// unreachable.
+func (p *Provider) runWatcher(ctx context.Context, node string, e endpoint, w watcher, updates chan<- update) {
+	nodes := map[string]bool{}
+	emit := func(key, contentType string, body []byte) {
+		name := node
+		if key != "" {
+			name = node + "/" + key
+		}
+		if body == nil {
+			delete(nodes, name)
+			sendUpdate(ctx, updates, update{node: name, done: ctx.Done()})
+			return
+		}
+		nodes[name] = true
+		u, err := p.safeParseUpdate(name, e, contentType, body)
+		if err != nil {
+			logger.Error("Error parsing the pushed configuration", "node", name, "endpoint", e, "error", err)
+		}
+		u.done = ctx.Done()
+		sendUpdate(ctx, updates, u)
+	}
+
+	for {
+		connected, err := safeWatch(ctx, w, e, emit)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("Connection closed", "node", node, "endpoint", e, "error", err)
+		if !connected {
+			for name := range nodes {
+				delete(nodes, name)
+				sendUpdate(ctx, updates, update{node: name, done: ctx.Done()})
+			}
+		}
+
+		select {
+		case <-time.After(w.reconnect(connected)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// safeWatch runs w.watch, a panic ending the connection with an error so the
+// endpoint is reconnected after its backoff.
+func safeWatch(ctx context.Context, w watcher, e endpoint, emit emitFunc) (connected bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			connected, err = false, fmt.Errorf("panic watching the endpoint: %v", r)
+		}
+	}()
+	return w.watch(ctx, e, emit)
+}
+
+func sendUpdate(ctx context.Context, updates chan<- update, u update) {
+	select {
+	case updates <- u:
+	case <-ctx.Done():
+	}
+}
+
+// backoff computes exponentially growing delays between min and max.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	if max < min {
+		max = min
+	}
+	return &backoff{min: min, max: max}
+}
+
+func (b *backoff) next() time.Duration {
+	if b.current == 0 {
+		b.current = b.min
+	} else {
+		b.current *= 2
+	}
+	if b.current > b.max {
+		b.current = b.max
+	}
+	return b.current
+}
+
+func (b *backoff) reset() {
+	b.current = 0
+}
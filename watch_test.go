@@ -0,0 +1,43 @@
+package multi_http_provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// panicWatcher panics on its first connection and pushes body on the next ones.
+type panicWatcher struct {
+	calls int
+	body  string
+}
+
+func (w *panicWatcher) watch(ctx context.Context, e endpoint, emit emitFunc) (bool, error) {
+	if w.calls++; w.calls == 1 {
+		panic("bad stream")
+	}
+	emit("", "", []byte(w.body))
+	<-ctx.Done()
+	return true, ctx.Err()
+}
+
+func (w *panicWatcher) reconnect(bool) time.Duration {
+	return time.Millisecond
+}
+
+func TestRunWatcherReconnectsAfterPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &Provider{entrypoints: map[string]bool{"web": true}}
+	updates := make(chan update)
+	go p.runWatcher(ctx, "node", endpoint{}, &panicWatcher{body: routerConfig("api", "web")}, updates)
+
+	select {
+	case u := <-updates:
+		if u.node != "node" || u.config == nil || u.config.HTTP.Routers["api"] == nil {
+			t.Errorf("unexpected update %+v", u)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watcher to reconnect after the panic")
+	}
+}
@@ -0,0 +1,128 @@
+package multi_http_provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook the embedded listener receiving the configurations pushed by the
+// endpoints.
+type Webhook struct {
+	Address string `json:"address,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Token   string `json:"token,omitempty"`
+	// Insecure accepts the pushes without a token on any address, rather than
+	// on a loopback one only.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// isLoopbackAddress reports whether address only listens on a loopback
+// interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type webhookHandler struct {
+	p       *Provider
+	prefix  string
+	token   string
+	updates chan<- update
+}
+
+// serveWebhook starts the webhook listener, stopped when the context is
+// canceled.
+func (p *Provider) serveWebhook(ctx context.Context, updates chan<- update) error {
+	listener, err := net.Listen("tcp", p.webhook.Address)
+	if err != nil {
+		return fmt.Errorf("starting webhook listener: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(p.webhook.Path, "/") + "/"
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	server := &http.Server{
+		Handler: &webhookHandler{
+			p:       p,
+			prefix:  prefix,
+			token:   p.webhook.Token,
+			updates: updates,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("Webhook listener stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// ServeHTTP applies the configuration POSTed on <path>/<node>, or removes the
+// node on DELETE. Only configured endpoints are accepted.
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	node, ok := strings.CutPrefix(r.URL.Path, h.prefix)
+	if !ok || node == "" || strings.Contains(node, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	e, ok := h.p.endpoints[node]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown endpoint %s", node), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(bodyLimit(h.p.maxResponseBytes))))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		u, err := h.p.safeParseUpdate(node, e, r.Header.Get("Content-Type"), body)
+		if err != nil {
+			logger.Error("Error parsing the pushed configuration", "node", node, "error", err)
+		}
+		sendUpdate(r.Context(), h.updates, u)
+		if u.empty() {
+			http.Error(w, "no configuration left to publish, endpoint removed", http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		sendUpdate(r.Context(), h.updates, update{node: node})
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "POST, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
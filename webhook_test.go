@@ -0,0 +1,150 @@
+package multi_http_provider
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func push(t *testing.T, method, url, token, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhook(t *testing.T) {
+	address := freeAddress(t)
+
+	config := CreateConfig()
+	config.PollInterval = "1h"
+	config.EntryPoints = []string{"web"}
+	config.Webhook = &Webhook{Address: address, Path: "/push", Token: "secret"}
+	config.Endpoints = map[string]Endpoint{
+		"pushed": {Mode: "webhook"},
+		"other":  {Mode: "webhook"},
+	}
+
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	cfgChan := make(chan json.Marshaler, 10)
+	if err := p.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Stop() })
+
+	base := "http://" + address + "/push/"
+
+	if status := push(t, http.MethodPost, base+"pushed", "wrong", routerConfig("pushed", "web")); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", status)
+	}
+	if status := push(t, http.MethodPost, base+"pushed", "", routerConfig("pushed", "web")); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", status)
+	}
+	if status := push(t, http.MethodPost, base+"unknown", "secret", routerConfig("unknown", "web")); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown endpoint, got %d", status)
+	}
+	if status := push(t, http.MethodGet, base+"pushed", "secret", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", status)
+	}
+
+	if status := push(t, http.MethodPost, base+"pushed", "secret", routerConfig("pushed", "web")); status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", status)
+	}
+	published := receiveConfig(t, cfgChan)
+	if _, ok := published.HTTP.Routers["pushed"]; !ok {
+		t.Fatalf("expected router pushed, got %v", routerNames(published))
+	}
+
+	if status := push(t, http.MethodPost, base+"other", "secret", routerConfig("other", "web")); status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", status)
+	}
+	published = receiveConfig(t, cfgChan)
+	if len(published.HTTP.Routers) != 2 {
+		t.Fatalf("expected both routers, got %v", routerNames(published))
+	}
+
+	if status := push(t, http.MethodPost, base+"other", "secret", routerConfig("other", "internal")); status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a filtered configuration, got %d", status)
+	}
+	published = receiveConfig(t, cfgChan)
+	if _, ok := published.HTTP.Routers["other"]; ok || len(published.HTTP.Routers) != 1 {
+		t.Fatalf("expected only router pushed, got %v", routerNames(published))
+	}
+
+	if status := push(t, http.MethodDelete, base+"pushed", "secret", ""); status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", status)
+	}
+}
+
+func TestWebhookInit(t *testing.T) {
+	config := CreateConfig()
+	config.EntryPoints = []string{"web"}
+	config.Endpoints["pushed"] = Endpoint{Mode: "webhook"}
+
+	p, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err == nil {
+		t.Error("expected webhook mode to require the webhook listener")
+	}
+}
+
+func TestWebhookInitToken(t *testing.T) {
+	tests := []struct {
+		webhook Webhook
+		wantErr bool
+	}{
+		{webhook: Webhook{Address: ":8090"}, wantErr: true},
+		{webhook: Webhook{Address: "10.0.0.1:8090"}, wantErr: true},
+		{webhook: Webhook{Address: ":8090", Token: "secret"}},
+		{webhook: Webhook{Address: ":8090", Insecure: true}},
+		{webhook: Webhook{Address: "127.0.0.1:8090"}},
+		{webhook: Webhook{Address: "[::1]:8090"}},
+		{webhook: Webhook{Address: "localhost:8090"}},
+	}
+	for _, test := range tests {
+		config := CreateConfig()
+		config.EntryPoints = []string{"web"}
+		config.Webhook = &test.webhook
+		config.Endpoints["pushed"] = Endpoint{Mode: "webhook"}
+		p, err := New(context.Background(), config, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Init(); (err != nil) != test.wantErr {
+			t.Errorf("%+v: unexpected error %v", test.webhook, err)
+		}
+	}
+}
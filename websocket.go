@@ -0,0 +1,208 @@
+package multi_http_provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// websocketStream receives the configurations pushed as WebSocket messages by
+// an endpoint, every text or binary message carrying a complete configuration.
+// Dropped connections are reopened with an exponential backoff.
+type websocketStream struct {
+	backoff *backoff
+}
+
+func (s *websocketStream) reconnect(connected bool) time.Duration {
+	if connected {
+		s.backoff.reset()
+	}
+	return s.backoff.next()
+}
+
+func (s *websocketStream) watch(ctx context.Context, e endpoint, handle emitFunc) (bool, error) {
+	conn, err := s.dial(ctx, e)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	// the size of a reassembled message is bounded by maxResponseBytes
+	limit := bodyLimit(e.maxBytes)
+	var message []byte
+	for {
+		fin, opcode, payload, err := readFrame(conn, limit)
+		if err != nil {
+			return true, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := writeFrame(conn, opPong, payload); err != nil {
+				return true, err
+			}
+		case opPong:
+		case opClose:
+			_ = writeFrame(conn, opClose, payload)
+			return true, fmt.Errorf("closed by server")
+		case opText, opBinary, opContinuation:
+			if len(message)+len(payload) > limit {
+				return true, fmt.Errorf("message exceeds %d bytes, see maxResponseBytes", limit)
+			}
+			message = append(message, payload...)
+			if fin {
+				handle("", "", message)
+				message = nil
+			}
+		default:
+			return true, fmt.Errorf("unsupported opcode %d", opcode)
+		}
+	}
+}
+
+// dial performs the opening handshake through the endpoint client, which
+// hands over the connection on a 101 Switching Protocols response.
+func (s *websocketStream) dial(ctx context.Context, e endpoint) (io.ReadWriteCloser, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.setHeaders(req); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("connection cannot be upgraded")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, fmt.Errorf("invalid handshake response")
+	}
+	return conn, nil
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// readFrame reads a frame, rejecting payloads larger than limit bytes.
+func readFrame(r io.Reader, limit int) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(limit) {
+		return false, 0, nil, fmt.Errorf("frame exceeds %d bytes, see maxResponseBytes", limit)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a single masked frame, as required from clients.
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	var frame bytes.Buffer
+	frame.WriteByte(0x80 | opcode)
+
+	switch {
+	case len(payload) < 126:
+		frame.WriteByte(0x80 | byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame.WriteByte(0x80 | 126)
+		_ = binary.Write(&frame, binary.BigEndian, uint16(len(payload)))
+	default:
+		frame.WriteByte(0x80 | 127)
+		_ = binary.Write(&frame, binary.BigEndian, uint64(len(payload)))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame.Write(mask[:])
+	for i, b := range payload {
+		frame.WriteByte(b ^ mask[i%4])
+	}
+
+	_, err := w.Write(frame.Bytes())
+	return err
+}
@@ -0,0 +1,160 @@
+package multi_http_provider
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serverFrame encodes an unmasked frame, as sent by servers.
+func serverFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	return append(frame, payload...)
+}
+
+// websocketServer upgrades connections and runs serve on them.
+func websocketServer(t *testing.T, serve func(rw *bufio.ReadWriter)) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+		serve(rw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketPublishesMessages(t *testing.T) {
+	pong := make(chan []byte, 1)
+	srv := websocketServer(t, func(rw *bufio.ReadWriter) {
+		body := []byte(routerConfig("ws", "web"))
+		rw.Write(serverFrame(false, opText, body[:10]))
+		rw.Write(serverFrame(false, opContinuation, body[10:20]))
+		rw.Write(serverFrame(true, opContinuation, body[20:]))
+		rw.Write(serverFrame(true, opPing, []byte("ping")))
+		rw.Flush()
+
+		_, opcode, payload, err := readFrame(rw, maxDecodedBody)
+		if err == nil && opcode == opPong {
+			pong <- payload
+		}
+		// hold the connection until the client goes away
+		_, _ = io.Copy(io.Discard, rw)
+	})
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: strings.Replace(srv.URL, "http://", "ws://", 1)},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if _, ok := config.HTTP.Routers["ws"]; !ok {
+		t.Fatalf("expected router ws, got %v", routerNames(config))
+	}
+
+	select {
+	case payload := <-pong:
+		if string(payload) != "ping" {
+			t.Errorf("expected pong payload ping, got %q", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pong")
+	}
+}
+
+func TestWebSocketLargeMessage(t *testing.T) {
+	services := strings.Repeat(`{"url":"http://10.0.0.1"},`, 5000)
+	body := `{"http":{"routers":{"big":{"entryPoints":["web"],"service":"big"}},"services":{"big":{"loadBalancer":{"servers":[` +
+		strings.TrimSuffix(services, ",") + `]}}}}}`
+	srv := websocketServer(t, func(rw *bufio.ReadWriter) {
+		rw.Write(serverFrame(true, opBinary, []byte(body)))
+		rw.Flush()
+		_, _ = io.Copy(io.Discard, rw)
+	})
+
+	cfgChan := startProvider(t, map[string]Endpoint{
+		"node": {Endpoint: srv.URL, Mode: "websocket"},
+	})
+
+	config := receiveConfig(t, cfgChan)
+	if servers := config.HTTP.Services["big"].LoadBalancer.Servers; len(servers) != 5000 {
+		t.Fatalf("expected 5000 servers, got %d", len(servers))
+	}
+}
+
+func TestWebSocketRejectedHandshake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s := &websocketStream{backoff: newBackoff(time.Second, time.Minute)}
+	connected, err := s.watch(t.Context(), endpoint{url: srv.URL, client: srv.Client()}, func(string, string, []byte) {})
+	if connected || err == nil {
+		t.Fatalf("expected a failed handshake, got connected=%t err=%v", connected, err)
+	}
+}
+
+func TestWriteFrameIsMasked(t *testing.T) {
+	var buf strings.Builder
+	if err := writeFrame(&buf, opPong, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	frame := []byte(buf.String())
+	if frame[1]&0x80 == 0 {
+		t.Fatal("expected a masked frame")
+	}
+
+	fin, opcode, payload, err := readFrame(strings.NewReader(buf.String()), maxDecodedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fin || opcode != opPong || string(payload) != "payload" {
+		t.Errorf("unexpected frame fin=%t opcode=%d payload=%q", fin, opcode, payload)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 5*time.Second)
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if actual := b.next(); actual != delay {
+			t.Errorf("step %d: expected %s, got %s", i, delay, actual)
+		}
+	}
+	b.reset()
+	if actual := b.next(); actual != time.Second {
+		t.Errorf("expected reset backoff to restart at 1s, got %s", actual)
+	}
+}
@@ -0,0 +1,503 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts a YAML document to JSON, so it decodes into the json
+// tagged configuration types. The subset used by configuration files is
+// supported: block mappings and sequences, flow collections, quoted, plain
+// and block scalars, and comments. Anchors, aliases and tags are not.
+func yamlToJSON(data []byte) ([]byte, error) {
+	value, err := decodeYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// maxYAMLDepth bounds the nesting of the collections of a document.
+const maxYAMLDepth = 64
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+	// the collections being parsed
+	depth int
+}
+
+func decodeYAML(data []byte) (interface{}, error) {
+	documents, err := splitYAMLDocuments(data)
+	if err != nil || len(documents) == 0 {
+		return nil, err
+	}
+	// only the first document is read
+	return documents[0].parse()
+}
+
+// decodeYAMLDocuments decodes every document of a YAML stream, skipping empty
+// ones.
+func decodeYAMLDocuments(data []byte) ([]interface{}, error) {
+	documents, err := splitYAMLDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for _, document := range documents {
+		value, err := document.parse()
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// splitYAMLDocuments splits a YAML stream on its --- and ... markers.
+func splitYAMLDocuments(data []byte) ([]*yamlParser, error) {
+	p := &yamlParser{}
+	var documents []*yamlParser
+	content := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i, raw := range strings.Split(content, "\n") {
+		text := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs cannot be used for indentation", i+1)
+		}
+		if trimmed == "---" || trimmed == "..." {
+			if len(p.lines) > 0 {
+				documents = append(documents, p)
+				p = &yamlParser{}
+			}
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) > 0 {
+		documents = append(documents, p)
+	}
+	return documents, nil
+}
+
+func (p *yamlParser) parse() (interface{}, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	value, err := p.parseNode(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml line %d: unexpected content", p.lines[p.pos].number)
+	}
+	return value, nil
+}
+
+// skipBlank moves past empty and comment lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		text := stripYAMLComment(p.lines[p.pos].text)
+		if text != "" {
+			return
+		}
+		p.pos++
+	}
+}
+
+// parseNode parses the block node starting at the current line, indented by
+// indent.
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if p.depth >= maxYAMLDepth {
+		return nil, fmt.Errorf("yaml line %d: nested deeper than %d collections", line.number, maxYAMLDepth)
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	text := stripYAMLComment(line.text)
+	if text == "-" || strings.HasPrefix(text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(text); ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLValue(text, line.number)
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return items, nil
+		}
+		line := p.lines[p.pos]
+		text := stripYAMLComment(line.text)
+		if line.indent < indent || !(text == "-" || strings.HasPrefix(text, "- ")) {
+			return items, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: bad indentation", line.number)
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if stripYAMLComment(rest) == "" {
+			p.pos++
+			p.skipBlank()
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			item, err := p.parseNode(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// the item content starts a node indented at its own column
+		p.lines[p.pos] = yamlLine{number: line.number, indent: line.indent + len(line.text) - len(rest), text: rest}
+		item, err := p.parseNode(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := map[string]interface{}{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return mapping, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			return mapping, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: bad indentation", line.number)
+		}
+		text := stripYAMLComment(line.text)
+		key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			return mapping, nil
+		}
+		if key == "" {
+			return nil, fmt.Errorf("yaml line %d: empty key", line.number)
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, fmt.Errorf("yaml line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+
+		switch {
+		case rest == "":
+			p.skipBlank()
+			if p.pos >= len(p.lines) {
+				mapping[key] = nil
+				continue
+			}
+			next := p.lines[p.pos]
+			nextText := stripYAMLComment(next.text)
+			isItem := nextText == "-" || strings.HasPrefix(nextText, "- ")
+			// sequences may be indented at the level of their key
+			if next.indent > indent || (next.indent == indent && isItem) {
+				value, err := p.parseNode(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				mapping[key] = value
+			} else {
+				mapping[key] = nil
+			}
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			mapping[key] = p.parseBlockScalar(indent, rest)
+		default:
+			value, err := parseYAMLValue(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = value
+		}
+	}
+}
+
+// parseBlockScalar reads the literal (|) or folded (>) scalar following a
+// key, with the clip, strip (-) and keep (+) chomping indicators.
+func (p *yamlParser) parseBlockScalar(indent int, header string) string {
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-min(line.indent, blockIndent))+line.text)
+		p.pos++
+	}
+
+	// trailing empty lines belong to the block only for the keep chomping
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var value string
+	if header[0] == '|' {
+		value = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, line := range lines {
+			// empty lines become line breaks, the others are joined
+			switch {
+			case i == 0 || lines[i-1] == "":
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		value = b.String()
+	}
+
+	switch {
+	case strings.Contains(header, "-"):
+	case strings.Contains(header, "+"):
+		value += "\n" + strings.Repeat("\n", trailing)
+	case len(lines) > 0:
+		value += "\n"
+	}
+	return value
+}
+
+// splitYAMLKey splits a "key: value" mapping entry.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	end := -1
+	if text[0] == '"' || text[0] == '\'' {
+		end = quotedYAMLEnd(text)
+		if end < 0 {
+			return "", "", false
+		}
+	}
+	for i := end + 1; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key := strings.TrimSpace(text[:i])
+			if key != "" && (key[0] == '"' || key[0] == '\'') {
+				unquoted, err := unquoteYAML(key)
+				if err != nil {
+					return "", "", false
+				}
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing comment, outside of quoted scalars.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return text
+}
+
+// quotedYAMLEnd returns the index of the quote closing the scalar text starts
+// with, -1 when unterminated.
+func quotedYAMLEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(text)
+}
+
+func parseYAMLValue(text string, number int) (interface{}, error) {
+	value, rest, err := parseYAMLFlow(text, 0)
+	if err != nil {
+		return nil, fmt.Errorf("yaml line %d: %w", number, err)
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("yaml line %d: unexpected %q", number, rest)
+	}
+	return value, nil
+}
+
+// parseYAMLFlow parses a flow node nested in depth flow collections and
+// returns the remaining text. Inside flow collections plain scalars end at
+// commas and closing brackets.
+func parseYAMLFlow(text string, depth int) (interface{}, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", nil
+	}
+	if depth >= maxYAMLDepth {
+		return nil, "", fmt.Errorf("nested deeper than %d collections", maxYAMLDepth)
+	}
+
+	switch text[0] {
+	case '[':
+		items := []interface{}{}
+		text = strings.TrimLeft(text[1:], " ")
+		for {
+			if text == "" {
+				return nil, "", fmt.Errorf("unterminated flow sequence")
+			}
+			if text[0] == ']' {
+				return items, text[1:], nil
+			}
+			item, rest, err := parseYAMLFlow(text, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			text, err = nextYAMLFlowItem(rest, ']')
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	case '{':
+		mapping := map[string]interface{}{}
+		text = strings.TrimLeft(text[1:], " ")
+		for {
+			if text == "" {
+				return nil, "", fmt.Errorf("unterminated flow mapping")
+			}
+			if text[0] == '}' {
+				return mapping, text[1:], nil
+			}
+			key, rest, err := parseYAMLFlow(text, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			rest = strings.TrimLeft(rest, " ")
+			var value interface{}
+			if strings.HasPrefix(rest, ":") {
+				value, rest, err = parseYAMLFlow(rest[1:], depth+1)
+				if err != nil {
+					return nil, "", err
+				}
+			}
+			mapping[fmt.Sprint(key)] = value
+			text, err = nextYAMLFlowItem(rest, '}')
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	case '"', '\'':
+		end := quotedYAMLEnd(text)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated quoted scalar")
+		}
+		value, err := unquoteYAML(text[:end+1])
+		if err != nil {
+			return nil, "", err
+		}
+		return value, text[end+1:], nil
+	case '&', '*', '!':
+		return nil, "", fmt.Errorf("anchors, aliases and tags are not supported")
+	}
+
+	end := len(text)
+	if depth > 0 {
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			if c == ',' || c == ']' || c == '}' || (c == ':' && (i == len(text)-1 || text[i+1] == ' ')) {
+				end = i
+				break
+			}
+		}
+	}
+	return plainYAMLScalar(strings.TrimSpace(text[:end])), text[end:], nil
+}
+
+func nextYAMLFlowItem(text string, closing byte) (string, error) {
+	text = strings.TrimLeft(text, " ")
+	switch {
+	case strings.HasPrefix(text, ","):
+		return strings.TrimLeft(text[1:], " "), nil
+	case text != "" && text[0] == closing:
+		return text, nil
+	default:
+		return "", fmt.Errorf("expected , or %c in flow collection", closing)
+	}
+}
+
+// plainYAMLScalar resolves the type of an unquoted scalar.
+func plainYAMLScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return json.Number(text)
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXpP_") &&
+		!strings.EqualFold(text, "inf") && !strings.EqualFold(text, "nan") {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return text
+}
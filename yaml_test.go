@@ -0,0 +1,115 @@
+package multi_http_provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		desc     string
+		yaml     string
+		expected string
+	}{
+		{
+			desc: "traefik dynamic configuration",
+			yaml: `---
+# routers of the node
+http:
+  routers:
+    api:
+      entryPoints:
+        - web
+        - websecure   # both
+      rule: Host(` + "`api.example.com`" + `) && PathPrefix(` + "`/v1`" + `)
+      service: api
+      priority: 10
+  services:
+    api:
+      loadBalancer:
+        passHostHeader: true
+        servers:
+        - url: "http://10.0.0.1:8080"
+        - url: 'http://10.0.0.2:8080'
+`,
+			expected: `{"http":{"routers":{"api":{"entryPoints":["web","websecure"],"priority":10,"rule":"Host(` + "`api.example.com`" + `) \u0026\u0026 PathPrefix(` + "`/v1`" + `)","service":"api"}},"services":{"api":{"loadBalancer":{"passHostHeader":true,"servers":[{"url":"http://10.0.0.1:8080"},{"url":"http://10.0.0.2:8080"}]}}}}}`,
+		},
+		{
+			desc:     "flow collections",
+			yaml:     `middlewares: {chain: {middlewares: [a, "b", 'c d']}, empty: []}`,
+			expected: `{"middlewares":{"chain":{"middlewares":["a","b","c d"]},"empty":[]}}`,
+		},
+		{
+			desc:     "scalars",
+			yaml:     "a: ~\nb: false\nc: 1.50\nd: 0x1F\ne: \"tab\\there\"\nf: 'it''s'\ng: value # comment\nh: \"# not a comment\"\n",
+			expected: `{"a":null,"b":false,"c":1.5,"d":"0x1F","e":"tab\there","f":"it's","g":"value","h":"# not a comment"}`,
+		},
+		{
+			desc:     "block scalars",
+			yaml:     "literal: |\n  line 1\n    line 2\n\nfolded: >-\n  one\n  two\n\n  three\nkept: |+\n  end\n\n",
+			expected: `{"folded":"one two\nthree","kept":"end\n\n","literal":"line 1\n  line 2\n"}`,
+		},
+		{
+			desc:     "nested sequences",
+			yaml:     "- - a\n  - b\n- key: value\n  other: 2\n-\n",
+			expected: `[["a","b"],{"key":"value","other":2},null]`,
+		},
+		{
+			desc:     "quoted keys and second document",
+			yaml:     "\"a: b\": 1\n---\nignored: true\n",
+			expected: `{"a: b":1}`,
+		},
+		{desc: "empty document", yaml: "# nothing\n", expected: `null`},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			actual, err := yamlToJSON([]byte(test.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(actual, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	for _, yaml := range []string{
+		"a:\n\tb: 1\n",
+		"a: 1\na: 2\n",
+		"a:\n    b: 1\n  c: 2\n",
+		"a: [1, 2\n",
+		"a: \"unterminated\n",
+		"a: &anchor 1\n",
+		"a: 1\n plain continuation\n",
+		":",
+		"a: 1\n: 2\n",
+		"a: " + strings.Repeat("[", 1<<20),
+		strings.Repeat("- ", 1<<10) + "a\n",
+	} {
+		if actual, err := yamlToJSON([]byte(yaml)); err == nil {
+			t.Errorf("%q: expected an error, got %s", yaml, actual)
+		}
+	}
+}
+
+func TestDecodeYAMLDocuments(t *testing.T) {
+	values, err := decodeYAMLDocuments([]byte("---\nkind: A\n---\n# empty\n---\nkind: B\n...\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{map[string]interface{}{"kind": "A"}, map[string]interface{}{"kind": "B"}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,918 @@
+package multi_http_provider
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// zstd decoding, as specified by RFC 8878. Frames are decoded as a whole into
+// memory, dictionaries are not supported.
+
+const (
+	zstdMagic         = 0xfd2fb528
+	zstdSkippableMask = 0xfffffff0
+	zstdSkippable     = 0x184d2a50
+	zstdMaxBlockSize  = 128 << 10
+)
+
+var errZstdCorrupted = errors.New("zstd: corrupted input")
+
+// zstdDecompress decodes the zstd frames of src, failing once the output
+// would exceed maxSize bytes.
+func zstdDecompress(src []byte, maxSize int) ([]byte, error) {
+	var out []byte
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, errZstdCorrupted
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		if magic&zstdSkippableMask == zstdSkippable {
+			if len(src) < 8 {
+				return nil, errZstdCorrupted
+			}
+			size := int(binary.LittleEndian.Uint32(src[4:]))
+			if len(src) < 8+size {
+				return nil, errZstdCorrupted
+			}
+			src = src[8+size:]
+			continue
+		}
+		if magic != zstdMagic {
+			return nil, fmt.Errorf("zstd: invalid magic number %#x", magic)
+		}
+
+		d := &zstdFrame{out: out, start: len(out), maxSize: maxSize}
+		n, err := d.decode(src[4:])
+		if err != nil {
+			return nil, err
+		}
+		out = d.out
+		src = src[4+n:]
+	}
+	return out, nil
+}
+
+type zstdFrame struct {
+	out     []byte
+	start   int
+	maxSize int
+
+	huffman     *huffmanTable
+	llTable     *fseTable
+	ofTable     *fseTable
+	mlTable     *fseTable
+	repeats     [3]int
+	literalsBuf []byte
+}
+
+// decode decodes a frame following its magic number and returns its size.
+func (d *zstdFrame) decode(src []byte) (int, error) {
+	if len(src) < 1 {
+		return 0, errZstdCorrupted
+	}
+	descriptor := src[0]
+	pos := 1
+	fcsFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	checksum := descriptor&0x04 != 0
+	dictFlag := descriptor & 0x03
+	if descriptor&0x08 != 0 {
+		return 0, errZstdCorrupted
+	}
+
+	if !singleSegment {
+		// the window size only matters to streaming decoders
+		pos++
+	}
+	dictSize := [4]int{0, 1, 2, 4}[dictFlag]
+	if pos+dictSize > len(src) {
+		return 0, errZstdCorrupted
+	}
+	var dictID uint32
+	for i := 0; i < dictSize; i++ {
+		dictID |= uint32(src[pos+i]) << (8 * i)
+	}
+	if dictID != 0 {
+		return 0, fmt.Errorf("zstd: dictionaries are not supported")
+	}
+	pos += dictSize
+
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	pos += fcsSize
+	if pos > len(src) {
+		return 0, errZstdCorrupted
+	}
+
+	d.repeats = [3]int{1, 4, 8}
+	for {
+		if pos+3 > len(src) {
+			return 0, errZstdCorrupted
+		}
+		header := uint32(src[pos]) | uint32(src[pos+1])<<8 | uint32(src[pos+2])<<16
+		pos += 3
+		last := header&1 != 0
+		blockType := (header >> 1) & 3
+		size := int(header >> 3)
+
+		switch blockType {
+		case 0: // raw
+			if pos+size > len(src) {
+				return 0, errZstdCorrupted
+			}
+			if err := d.grow(size); err != nil {
+				return 0, err
+			}
+			d.out = append(d.out, src[pos:pos+size]...)
+			pos += size
+		case 1: // RLE
+			if pos+1 > len(src) {
+				return 0, errZstdCorrupted
+			}
+			if err := d.grow(size); err != nil {
+				return 0, err
+			}
+			for i := 0; i < size; i++ {
+				d.out = append(d.out, src[pos])
+			}
+			pos++
+		case 2: // compressed
+			if size > zstdMaxBlockSize || pos+size > len(src) {
+				return 0, errZstdCorrupted
+			}
+			if err := d.decodeBlock(src[pos : pos+size]); err != nil {
+				return 0, err
+			}
+			pos += size
+		default:
+			return 0, errZstdCorrupted
+		}
+		if last {
+			break
+		}
+	}
+
+	if checksum {
+		if pos+4 > len(src) {
+			return 0, errZstdCorrupted
+		}
+		if uint32(xxhash64(d.out[d.start:])) != binary.LittleEndian.Uint32(src[pos:]) {
+			return 0, fmt.Errorf("zstd: checksum mismatch")
+		}
+		pos += 4
+	}
+	return pos, nil
+}
+
+func (d *zstdFrame) grow(n int) error {
+	if len(d.out)+n > d.maxSize {
+		return fmt.Errorf("zstd: decompressed size exceeds %d bytes", d.maxSize)
+	}
+	return nil
+}
+
+func (d *zstdFrame) decodeBlock(block []byte) error {
+	literals, n, err := d.decodeLiterals(block)
+	if err != nil {
+		return err
+	}
+	return d.decodeSequences(block[n:], literals)
+}
+
+// decodeLiterals decodes the literals section of a compressed block and
+// returns the literals with the section size.
+func (d *zstdFrame) decodeLiterals(block []byte) ([]byte, int, error) {
+	if len(block) < 1 {
+		return nil, 0, errZstdCorrupted
+	}
+	b0 := int(block[0])
+	literalsType := b0 & 3
+	sizeFormat := (b0 >> 2) & 3
+
+	if literalsType < 2 {
+		var size, header int
+		switch sizeFormat {
+		case 0, 2:
+			size, header = b0>>3, 1
+		case 1:
+			if len(block) < 2 {
+				return nil, 0, errZstdCorrupted
+			}
+			size, header = b0>>4|int(block[1])<<4, 2
+		case 3:
+			if len(block) < 3 {
+				return nil, 0, errZstdCorrupted
+			}
+			size, header = b0>>4|int(block[1])<<4|int(block[2])<<12, 3
+		}
+		if literalsType == 0 {
+			if header+size > len(block) {
+				return nil, 0, errZstdCorrupted
+			}
+			return block[header : header+size], header + size, nil
+		}
+		if header+1 > len(block) || size > zstdMaxBlockSize {
+			return nil, 0, errZstdCorrupted
+		}
+		literals := d.literals(size)
+		for i := range literals {
+			literals[i] = block[header]
+		}
+		return literals, header + 1, nil
+	}
+
+	var regenerated, compressed, header int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(block) < 3 {
+			return nil, 0, errZstdCorrupted
+		}
+		if sizeFormat == 0 {
+			streams = 1
+		}
+		regenerated = b0>>4 | int(block[1]&0x3f)<<4
+		compressed = int(block[1])>>6 | int(block[2])<<2
+		header = 3
+	case 2:
+		if len(block) < 4 {
+			return nil, 0, errZstdCorrupted
+		}
+		regenerated = b0>>4 | int(block[1])<<4 | int(block[2]&3)<<12
+		compressed = int(block[2])>>2 | int(block[3])<<6
+		header = 4
+	case 3:
+		if len(block) < 5 {
+			return nil, 0, errZstdCorrupted
+		}
+		regenerated = b0>>4 | int(block[1])<<4 | int(block[2]&0x3f)<<12
+		compressed = int(block[2])>>6 | int(block[3])<<2 | int(block[4])<<10
+		header = 5
+	}
+	if header+compressed > len(block) || regenerated > zstdMaxBlockSize {
+		return nil, 0, errZstdCorrupted
+	}
+	data := block[header : header+compressed]
+
+	if literalsType == 2 {
+		table, n, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		d.huffman = table
+		data = data[n:]
+	} else if d.huffman == nil {
+		return nil, 0, errZstdCorrupted
+	}
+
+	literals := d.literals(regenerated)
+	if streams == 1 {
+		if err := d.huffman.decode(data, literals); err != nil {
+			return nil, 0, err
+		}
+		return literals, header + compressed, nil
+	}
+
+	if len(data) < 6 {
+		return nil, 0, errZstdCorrupted
+	}
+	sizes := [3]int{
+		int(binary.LittleEndian.Uint16(data)),
+		int(binary.LittleEndian.Uint16(data[2:])),
+		int(binary.LittleEndian.Uint16(data[4:])),
+	}
+	data = data[6:]
+	segment := (regenerated + 3) / 4
+	if 3*segment > regenerated {
+		return nil, 0, errZstdCorrupted
+	}
+	for i := 0; i < 4; i++ {
+		stream := data
+		if i < 3 {
+			if sizes[i] > len(data) {
+				return nil, 0, errZstdCorrupted
+			}
+			stream, data = data[:sizes[i]], data[sizes[i]:]
+		}
+		out := literals[i*segment:]
+		if i < 3 {
+			out = out[:segment]
+		}
+		if err := d.huffman.decode(stream, out); err != nil {
+			return nil, 0, err
+		}
+	}
+	return literals, header + compressed, nil
+}
+
+func (d *zstdFrame) literals(size int) []byte {
+	if cap(d.literalsBuf) < size {
+		d.literalsBuf = make([]byte, size)
+	}
+	return d.literalsBuf[:size]
+}
+
+var (
+	llBaselines = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llExtraBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBaselines = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlExtraBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+
+	llDefault = mustFSETable([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	mlDefault = mustFSETable([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+	ofDefault = mustFSETable([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+)
+
+func (d *zstdFrame) decodeSequences(src []byte, literals []byte) error {
+	if len(src) < 1 {
+		return errZstdCorrupted
+	}
+	count := int(src[0])
+	pos := 1
+	switch {
+	case count == 0:
+		if err := d.grow(len(literals)); err != nil {
+			return err
+		}
+		d.out = append(d.out, literals...)
+		return nil
+	case count == 255:
+		if len(src) < 3 {
+			return errZstdCorrupted
+		}
+		count = int(src[1]) + int(src[2])<<8 + 0x7f00
+		pos = 3
+	case count >= 128:
+		if len(src) < 2 {
+			return errZstdCorrupted
+		}
+		count = (count-128)<<8 + int(src[1])
+		pos = 2
+	}
+
+	if pos >= len(src) {
+		return errZstdCorrupted
+	}
+	modes := src[pos]
+	pos++
+	if modes&3 != 0 {
+		return errZstdCorrupted
+	}
+	var err error
+	var n int
+	if d.llTable, n, err = d.readSequenceTable(src[pos:], modes>>6, d.llTable, llDefault, 35, 9); err != nil {
+		return err
+	}
+	pos += n
+	if d.ofTable, n, err = d.readSequenceTable(src[pos:], (modes>>4)&3, d.ofTable, ofDefault, 31, 8); err != nil {
+		return err
+	}
+	pos += n
+	if d.mlTable, n, err = d.readSequenceTable(src[pos:], (modes>>2)&3, d.mlTable, mlDefault, 52, 9); err != nil {
+		return err
+	}
+	pos += n
+
+	r, err := newBackwardBitReader(src[pos:])
+	if err != nil {
+		return err
+	}
+	ll := d.llTable.init(r)
+	of := d.ofTable.init(r)
+	ml := d.mlTable.init(r)
+
+	for i := 0; i < count; i++ {
+		ofCode := d.ofTable.entries[of].symbol
+		mlCode := d.mlTable.entries[ml].symbol
+		llCode := d.llTable.entries[ll].symbol
+		if ofCode > 31 || mlCode > 52 || llCode > 35 {
+			return errZstdCorrupted
+		}
+
+		offsetValue := int(1)<<ofCode + int(r.read(uint(ofCode)))
+		matchLength := int(mlBaselines[mlCode]) + int(r.read(uint(mlExtraBits[mlCode])))
+		literalLength := int(llBaselines[llCode]) + int(r.read(uint(llExtraBits[llCode])))
+
+		var offset int
+		if offsetValue > 3 {
+			offset = offsetValue - 3
+			d.repeats = [3]int{offset, d.repeats[0], d.repeats[1]}
+		} else {
+			index := offsetValue - 1
+			if literalLength == 0 {
+				index++
+			}
+			switch index {
+			case 0:
+				offset = d.repeats[0]
+			case 1:
+				offset = d.repeats[1]
+				d.repeats[0], d.repeats[1] = offset, d.repeats[0]
+			default:
+				if index == 3 {
+					offset = d.repeats[0] - 1
+				} else {
+					offset = d.repeats[2]
+				}
+				d.repeats = [3]int{offset, d.repeats[0], d.repeats[1]}
+			}
+		}
+
+		if literalLength > len(literals) {
+			return errZstdCorrupted
+		}
+		if err := d.grow(literalLength + matchLength); err != nil {
+			return err
+		}
+		d.out = append(d.out, literals[:literalLength]...)
+		literals = literals[literalLength:]
+
+		if offset <= 0 || offset > len(d.out)-d.start {
+			return errZstdCorrupted
+		}
+		from := len(d.out) - offset
+		for j := 0; j < matchLength; j++ {
+			d.out = append(d.out, d.out[from+j])
+		}
+
+		if i < count-1 {
+			ll = d.llTable.update(r, ll)
+			ml = d.mlTable.update(r, ml)
+			of = d.ofTable.update(r, of)
+		}
+	}
+	if r.overflowed() {
+		return errZstdCorrupted
+	}
+
+	if err := d.grow(len(literals)); err != nil {
+		return err
+	}
+	d.out = append(d.out, literals...)
+	return nil
+}
+
+// readSequenceTable reads the decoding table of a sequence symbol in the
+// given compression mode and returns it with the size read.
+func (d *zstdFrame) readSequenceTable(src []byte, mode byte, previous, predefined *fseTable, maxSymbol, maxLog int) (*fseTable, int, error) {
+	switch mode {
+	case 0:
+		return predefined, 0, nil
+	case 1:
+		if len(src) < 1 {
+			return nil, 0, errZstdCorrupted
+		}
+		return &fseTable{entries: []fseEntry{{symbol: src[0]}}}, 1, nil
+	case 2:
+		counts, log, n, err := readFSECounts(src, maxSymbol, maxLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		table, err := newFSETable(counts, log)
+		return table, n, err
+	default:
+		if previous == nil {
+			return nil, 0, errZstdCorrupted
+		}
+		return previous, 0, nil
+	}
+}
+
+type fseEntry struct {
+	symbol   uint8
+	bits     uint8
+	newState uint16
+}
+
+type fseTable struct {
+	log     uint
+	entries []fseEntry
+}
+
+func (t *fseTable) init(r *backwardBitReader) int {
+	return int(r.read(t.log))
+}
+
+func (t *fseTable) update(r *backwardBitReader, state int) int {
+	e := t.entries[state]
+	return int(e.newState) + int(r.read(uint(e.bits)))
+}
+
+func mustFSETable(counts []int16, log uint) *fseTable {
+	t, err := newFSETable(counts, log)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// newFSETable builds the decoding table of normalized counts, -1 standing
+// for the "less than one" probability.
+func newFSETable(counts []int16, log uint) (*fseTable, error) {
+	size := 1 << log
+	entries := make([]fseEntry, size)
+	next := make([]int, len(counts))
+	high := size - 1
+	for s, c := range counts {
+		if c == -1 {
+			entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(c)
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	position := 0
+	for s, c := range counts {
+		for i := 0; i < int(c); i++ {
+			entries[position].symbol = uint8(s)
+			position = (position + step) & mask
+			for position > high {
+				position = (position + step) & mask
+			}
+		}
+	}
+	if position != 0 {
+		return nil, errZstdCorrupted
+	}
+
+	for i := range entries {
+		s := entries[i].symbol
+		state := next[s]
+		next[s]++
+		if state == 0 {
+			return nil, errZstdCorrupted
+		}
+		nbBits := log - uint(bits.Len(uint(state))-1)
+		entries[i].bits = uint8(nbBits)
+		entries[i].newState = uint16(state<<nbBits - size)
+	}
+	return &fseTable{log: log, entries: entries}, nil
+}
+
+// readFSECounts reads the normalized counts of an FSE table description and
+// returns them with the accuracy log and the description size.
+func readFSECounts(src []byte, maxSymbol, maxLog int) ([]int16, uint, int, error) {
+	r := &forwardBitReader{data: src}
+	log := int(r.read(4)) + 5
+	if log > maxLog {
+		return nil, 0, 0, errZstdCorrupted
+	}
+
+	var counts []int16
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	nbBits := log + 1
+	for remaining > 1 && len(counts) <= maxSymbol {
+		bitsValue := int(r.peek(uint(nbBits)))
+		max := 2*threshold - 1 - remaining
+		var value int
+		if bitsValue&(threshold-1) < max {
+			value = bitsValue & (threshold - 1)
+			r.skip(uint(nbBits - 1))
+		} else {
+			value = bitsValue & (2*threshold - 1)
+			if value >= threshold {
+				value -= max
+			}
+			r.skip(uint(nbBits))
+		}
+
+		count := value - 1
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		counts = append(counts, int16(count))
+
+		if count == 0 {
+			// repeat flags of zero counts
+			for {
+				repeat := int(r.read(2))
+				for i := 0; i < repeat; i++ {
+					counts = append(counts, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || len(counts) > maxSymbol+1 || r.pos > 8*len(src) {
+		return nil, 0, 0, errZstdCorrupted
+	}
+	return counts, uint(log), (r.pos + 7) / 8, nil
+}
+
+type huffmanEntry struct {
+	symbol uint8
+	bits   uint8
+}
+
+type huffmanTable struct {
+	maxBits uint
+	entries []huffmanEntry
+}
+
+// readHuffmanTable reads a Huffman tree description and returns the decoding
+// table with the description size.
+func readHuffmanTable(src []byte) (*huffmanTable, int, error) {
+	if len(src) < 1 {
+		return nil, 0, errZstdCorrupted
+	}
+	header := int(src[0])
+	var weights []uint8
+	var size int
+
+	if header >= 128 {
+		count := header - 127
+		size = 1 + (count+1)/2
+		if size > len(src) {
+			return nil, 0, errZstdCorrupted
+		}
+		for i := 0; i < count; i++ {
+			b := src[1+i/2]
+			if i%2 == 0 {
+				weights = append(weights, b>>4)
+			} else {
+				weights = append(weights, b&0xf)
+			}
+		}
+	} else {
+		size = 1 + header
+		if size > len(src) {
+			return nil, 0, errZstdCorrupted
+		}
+		data := src[1:size]
+		counts, log, n, err := readFSECounts(data, 255, 6)
+		if err != nil {
+			return nil, 0, err
+		}
+		table, err := newFSETable(counts, log)
+		if err != nil {
+			return nil, 0, err
+		}
+		r, err := newBackwardBitReader(data[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// two interleaved states, until the bitstream is overflowed
+		state1 := table.init(r)
+		state2 := table.init(r)
+		for len(weights) < 255 {
+			weights = append(weights, table.entries[state1].symbol)
+			state1 = table.update(r, state1)
+			if r.overflowed() {
+				weights = append(weights, table.entries[state2].symbol)
+				break
+			}
+			weights = append(weights, table.entries[state2].symbol)
+			state2 = table.update(r, state2)
+			if r.overflowed() {
+				weights = append(weights, table.entries[state1].symbol)
+				break
+			}
+		}
+	}
+
+	// the weight of the last symbol is implied by the others
+	total := 0
+	for _, w := range weights {
+		if w > 12 {
+			return nil, 0, errZstdCorrupted
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, errZstdCorrupted
+	}
+	maxBits := uint(bits.Len(uint(total)))
+	rest := 1<<maxBits - total
+	if rest&(rest-1) != 0 || maxBits > 11 {
+		return nil, 0, errZstdCorrupted
+	}
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+
+	entries := make([]huffmanEntry, 1<<maxBits)
+	position := 0
+	for w := uint8(1); w <= uint8(maxBits); w++ {
+		for s, weight := range weights {
+			if weight != w {
+				continue
+			}
+			length := 1 << (w - 1)
+			for i := 0; i < length; i++ {
+				entries[position+i] = huffmanEntry{symbol: uint8(s), bits: uint8(maxBits + 1 - uint(w))}
+			}
+			position += length
+		}
+	}
+	return &huffmanTable{maxBits: maxBits, entries: entries}, size, nil
+}
+
+func (t *huffmanTable) decode(stream []byte, out []byte) error {
+	r, err := newBackwardBitReader(stream)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		e := t.entries[r.peek(t.maxBits)]
+		r.skip(uint(e.bits))
+		out[i] = e.symbol
+	}
+	if r.pos != 0 {
+		return errZstdCorrupted
+	}
+	return nil
+}
+
+// backwardBitReader reads a bitstream from its end, the highest bit of its
+// last byte marking the start. Bits read past the beginning are zeros.
+type backwardBitReader struct {
+	data []byte
+	pos  int
+}
+
+func newBackwardBitReader(data []byte) (*backwardBitReader, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errZstdCorrupted
+	}
+	return &backwardBitReader{data: data, pos: 8*(len(data)-1) + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+func (r *backwardBitReader) peek(n uint) uint64 {
+	var v uint64
+	start := r.pos - int(n)
+	for i := 0; i < int(n); {
+		index := start + i
+		if index < 0 {
+			i -= index
+			continue
+		}
+		offset := index & 7
+		take := min(8-offset, int(n)-i)
+		v |= (uint64(r.data[index>>3]) >> offset) & (1<<take - 1) << i
+		i += take
+	}
+	return v
+}
+
+func (r *backwardBitReader) skip(n uint) {
+	r.pos -= int(n)
+}
+
+func (r *backwardBitReader) read(n uint) uint64 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+func (r *backwardBitReader) overflowed() bool {
+	return r.pos < 0
+}
+
+// forwardBitReader reads a little-endian bitstream from its start, bits read
+// past the end being zeros.
+type forwardBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *forwardBitReader) peek(n uint) uint64 {
+	var v uint64
+	for i := 0; i < int(n); {
+		index := r.pos + i
+		if index>>3 >= len(r.data) {
+			break
+		}
+		offset := index & 7
+		take := min(8-offset, int(n)-i)
+		v |= (uint64(r.data[index>>3]) >> offset) & (1<<take - 1) << i
+		i += take
+	}
+	return v
+}
+
+func (r *forwardBitReader) skip(n uint) {
+	r.pos += int(n)
+}
+
+func (r *forwardBitReader) read(n uint) uint64 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 computes the XXH64 hash of b with a zero seed, used for the zstd
+// content checksum.
+func xxhash64(b []byte) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		prime1, prime2 := xxPrime1, xxPrime2
+		v1 := prime1 + prime2
+		v2 := prime2
+		v3 := uint64(0)
+		v4 := -prime1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(h, v uint64) uint64 {
+	h ^= xxRound(0, v)
+	return h*xxPrime1 + xxPrime4
+}